@@ -0,0 +1,116 @@
+package main
+
+import (
+	"balance/internal/databases"
+	"balance/internal/imports"
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/log/zapadapter"
+	"github.com/jackc/pgx/v4/pgxpool"
+	_ "github.com/joho/godotenv/autoload"
+	"go.uber.org/zap"
+)
+
+// import loads CSV file of user_id, amount and optional external_ref into staging table and applies its credits.
+// Import of the same file is detected, not completed import of the file is resumed.
+// Status of every row is written to result file
+func main() {
+	currency := flag.String("currency", utils.DefaultCurrency, "currency of amounts")
+	result := flag.String("result", "", "path of result file, <file>.result.csv by default")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import [-currency RUB] [-result result.csv] file.csv")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	if *result == "" {
+		*result = path + ".result.csv"
+	}
+	code, err := utils.NormalizeCurrency(*currency)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger, err := zap.NewDevelopment(zap.IncreaseLevel(zap.WarnLevel))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config, err := pgxpool.ParseConfig(databases.DSNFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.ConnConfig.Logger = zapadapter.NewLogger(logger)
+	config.ConnConfig.LogLevel = pgx.LogLevelError
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	pgxDB := databases.NewPgxDB(pool, zapadapter.NewLogger(logger))
+
+	// file is read twice: for checksum and for rows streamed into database
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	checksum, err := imports.Checksum(file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		log.Fatal(err)
+	}
+
+	imp, err := pgxDB.CreateImport(models.Import{
+		FileName: filepath.Base(path),
+		SHA256:   checksum,
+		Currency: code,
+	}, imports.NewReader(file, code).Read)
+	file.Close()
+	if err != nil && (imp.ID == 0 || imp.Status == models.ImportCompleted) {
+		log.Fatal(err)
+	} else if err != nil {
+		fmt.Printf("Resuming import %d, pending rows: %d\n", imp.ID, imp.Pending)
+	} else {
+		fmt.Printf("Loaded import %d, rows: %d, invalid: %d\n", imp.ID, imp.Rows, imp.Invalid)
+	}
+
+	id := imp.ID
+	imp, err = pgxDB.ApplyImport(id)
+	if err != nil {
+		log.Fatalf("import %d is interrupted, run the command again to resume it: %v", id, err)
+	}
+
+	importRows, err := pgxDB.GetImportRows(imp.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out, err := os.Create(*result)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = imports.WriteResult(out, importRows, imp.Currency); err != nil {
+		out.Close()
+		log.Fatal(err)
+	}
+	if err = out.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Import %d is %s, applied: %d, invalid: %d, failed: %d, result: %s\n",
+		imp.ID, imp.Status, imp.Applied, imp.Invalid, imp.Failed, *result)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"balance/internal/databases"
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/log/zapadapter"
+	"github.com/jackc/pgx/v4/pgxpool"
+	_ "github.com/joho/godotenv/autoload"
+	"go.uber.org/zap"
+)
+
+// reconcile recomputes every wallet balance from operations and reports mismatches.
+// With -fix flag it writes correcting operations after operator confirmation
+func main() {
+	fix := flag.Bool("fix", false, "write correcting operations for found mismatches after confirmation")
+	yes := flag.Bool("yes", false, "do not ask for confirmation")
+	flag.Parse()
+
+	logger, err := zap.NewDevelopment(zap.IncreaseLevel(zap.WarnLevel))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config, err := pgxpool.ParseConfig(databases.DSNFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.ConnConfig.Logger = zapadapter.NewLogger(logger)
+	config.ConnConfig.LogLevel = pgx.LogLevelError
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	pgxDB := databases.NewPgxDB(pool, zapadapter.NewLogger(logger))
+
+	reconciliation, err := pgxDB.Reconcile()
+	if err != nil {
+		log.Fatal(err)
+	}
+	printReconciliation(reconciliation)
+
+	if !*fix || len(reconciliation.Mismatches) == 0 {
+		return
+	}
+	if !*yes {
+		fmt.Printf("Write %d correcting operations? Type 'yes' to confirm: ", len(reconciliation.Mismatches))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			fmt.Println("Aborted")
+			return
+		}
+	}
+
+	if err = pgxDB.CorrectBalances(reconciliation.Mismatches); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Written %d correcting operations\n", len(reconciliation.Mismatches))
+}
+
+// printReconciliation prints reconciliation results as a table
+func printReconciliation(reconciliation models.Reconciliation) {
+	fmt.Printf("Checked %d wallets at %s, mismatches: %d\n", reconciliation.Wallets,
+		reconciliation.CheckedAt.Format("2006-01-02 15:04:05"), len(reconciliation.Mismatches))
+	if len(reconciliation.Mismatches) == 0 {
+		return
+	}
+	fmt.Printf("%-20s %-8s %16s %16s %16s %16s %16s %18s\n", "user_id", "currency", "balance", "journal", "held", "difference", "wallet", "wallet_difference")
+	for _, m := range reconciliation.Mismatches {
+		fmt.Printf("%-20d %-8s %16s %16s %16s %16s %16s %18s\n", m.UserID, m.Currency, utils.FormatMoney(m.Balance, m.Currency),
+			utils.FormatMoney(m.Journal, m.Currency), utils.FormatMoney(m.Held, m.Currency), utils.FormatMoney(m.Difference, m.Currency),
+			utils.FormatMoney(m.Wallet, m.Currency), utils.FormatMoney(m.WalletDifference, m.Currency))
+	}
+}
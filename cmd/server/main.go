@@ -2,13 +2,19 @@ package main
 
 import (
 	_ "balance/docs"
+	"balance/internal/auth"
 	"balance/internal/databases"
 	"balance/internal/handlers"
+	"balance/internal/jobs"
+	"balance/internal/models"
+	"balance/internal/outbox"
 	"balance/internal/routes"
+	"balance/internal/rpc"
+	"balance/internal/stream"
 
 	"context"
-	"fmt"
 	"log"
+	"net"
 	"os"
 	"time"
 
@@ -21,6 +27,9 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+// sampleAdminKey is admin key formerly shipped in .env, it is publicly known and refused
+const sampleAdminKey = "bk_local_development_admin_key"
+
 func initializeLogger() *zap.Logger {
 	config := zap.NewDevelopmentEncoderConfig()
 	config.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -36,19 +45,18 @@ func initializeLogger() *zap.Logger {
 	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
 }
 
-// @title       Balance Microservice
-// @version     1.0
-// @description This is an auto-generated API Docs for Balance Microservice - a microservice for managing user balances.
-// @BasePath    /api
+// @title                      Balance Microservice
+// @version                    1.0
+// @description                This is an auto-generated API Docs for Balance Microservice - a microservice for managing user balances. Responses of v2 API are wrapped into {"data": ...} on success and {"error": {"message": ...}} on failure, v1 API is deprecated.
+// @BasePath                   /api
+// @securityDefinitions.apikey ApiKey
+// @in                         header
+// @name                       X-API-Key
+// @description                API key of client, also accepted as bearer token of Authorization header together with JWT of gateway. Role of key or scopes of token limit routes the caller could call
 func main() {
 	app := fiber.New()
 
-	dsn := fmt.Sprintf("host=%v user=%v password=%v dbname=%v port=%v sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_DATABASE"),
-		os.Getenv("DB_PORT"))
+	dsn := databases.DSNFromEnv()
 
 	logger := initializeLogger()
 	defer func() {
@@ -72,9 +80,132 @@ func main() {
 
 	pgxDB := databases.NewPgxDB(pool, zapadapter.NewLogger(logger))
 
-	handler := handlers.NewHandler(pgxDB)
+	// admin key from environment lets the first keys be created, it is not written again once rotated or revoked.
+	// Without it random admin key is generated on the first start and shown once
+	if adminKey := os.Getenv("ADMIN_API_KEY"); adminKey != "" {
+		if adminKey == sampleAdminKey {
+			log.Fatal("ADMIN_API_KEY is the publicly known sample key, set your own key or leave it empty")
+		}
+		err = pgxDB.EnsureAPIKey(models.APIKey{
+			Name:   "admin",
+			Prefix: auth.Prefix(adminKey),
+			Hash:   auth.Hash(adminKey),
+			Role:   models.RoleAdmin,
+		})
+		if err != nil {
+			log.Printf("Admin API key is not written! Reason: %v", err)
+		}
+	} else {
+		key, prefix, hash, err := auth.NewKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		created, err := pgxDB.CreateFirstAPIKey(models.APIKey{Name: "admin", Prefix: prefix, Hash: hash, Role: models.RoleAdmin})
+		if err != nil {
+			log.Printf("Admin API key is not written! Reason: %v", err)
+		} else if created {
+			log.Printf("Admin API key is generated, it is shown only once: %s", key)
+		}
+	}
+
+	// streams of users are woken by notifications of database
+	hub := stream.NewHub()
+	hub.Start(context.Background(), pgxDB, logger)
+
+	// bearer tokens of gateway are validated against JWKS from file or URL, empty JWT_JWKS disables tokens
+	var validator *auth.JWTValidator
+	if jwks := os.Getenv("JWT_JWKS"); jwks != "" {
+		refresh, err := time.ParseDuration(os.Getenv("JWT_JWKS_REFRESH"))
+		if err != nil {
+			refresh = auth.DefaultJWKSRefresh
+		}
+		validator, err = auth.NewJWTValidator(auth.JWTConfig{
+			JWKS:      jwks,
+			Issuer:    os.Getenv("JWT_ISSUER"),
+			Audience:  os.Getenv("JWT_AUDIENCE"),
+			Refresh:   refresh,
+			UserClaim: os.Getenv("JWT_USER_CLAIM"),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		validator.Start(context.Background(), logger)
+	}
+
+	handler := handlers.NewHandler(pgxDB, hub, validator)
+
+	// reconcile balances with operations periodically, RECONCILE_INTERVAL=0 disables the job
+	reconcileInterval, err := time.ParseDuration(os.Getenv("RECONCILE_INTERVAL"))
+	if err != nil {
+		reconcileInterval = time.Hour
+	}
+	if reconcileInterval > 0 {
+		jobs.StartReconciliation(context.Background(), pgxDB, reconcileInterval, logger)
+	}
+
+	// store end of day balances every day, SNAPSHOTS_ENABLED=false disables the job
+	if os.Getenv("SNAPSHOTS_ENABLED") != "false" {
+		jobs.StartSnapshots(context.Background(), pgxDB, logger)
+	}
+
+	// send webhook deliveries every interval, WEBHOOKS_INTERVAL=0 disables the job
+	webhooksInterval, err := time.ParseDuration(os.Getenv("WEBHOOKS_INTERVAL"))
+	if err != nil {
+		webhooksInterval = 5 * time.Second
+	}
+	if webhooksInterval > 0 {
+		jobs.StartWebhooks(context.Background(), pgxDB, webhooksInterval, logger)
+	}
+
+	// delete old nonces of signed requests every interval, NONCES_CLEANUP_INTERVAL=0 disables the job
+	noncesInterval, err := time.ParseDuration(os.Getenv("NONCES_CLEANUP_INTERVAL"))
+	if err != nil {
+		noncesInterval = time.Minute
+	}
+	if noncesInterval > 0 {
+		jobs.StartNonceCleanup(context.Background(), pgxDB, noncesInterval, logger)
+	}
+
+	// publish outbox messages to message broker every interval, empty OUTBOX_BROKER disables the job
+	var publisher outbox.Publisher
+	switch os.Getenv("OUTBOX_BROKER") {
+	case "nats":
+		natsPublisher, err := outbox.NewNATSPublisher(os.Getenv("NATS_URL"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		publisher = natsPublisher
+	case "log":
+		publisher = outbox.LogPublisher{Logger: logger}
+	}
+	if publisher != nil {
+		outboxInterval, err := time.ParseDuration(os.Getenv("OUTBOX_INTERVAL"))
+		if err != nil || outboxInterval <= 0 {
+			outboxInterval = time.Second
+		}
+		jobs.StartOutbox(context.Background(), pgxDB, publisher, outboxInterval, logger)
+	}
+
+	// serve gRPC API on separate port, empty GRPC_SERVER_URL disables it
+	if grpcURL := os.Getenv("GRPC_SERVER_URL"); grpcURL != "" {
+		grpcTimeout, err := time.ParseDuration(os.Getenv("GRPC_TIMEOUT"))
+		if err != nil {
+			grpcTimeout = rpc.DefaultTimeout
+		}
+		listener, err := net.Listen("tcp", grpcURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcServer := rpc.NewServer(pgxDB, validator, grpcTimeout, logger)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("gRPC server is not running! Reason: %v", err)
+			}
+		}()
+	}
 
 	routes.InitializeSwaggerRoute(app)
+	routes.InitializeMetricsRoute(app)
 	routes.InitializeRoutes(app, handler)
 
 	if err = app.Listen(os.Getenv("SERVER_URL")); err != nil {
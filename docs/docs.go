@@ -18,7 +18,12 @@ const docTemplate = `{
     "paths": {
         "/": {
             "get": {
-                "description": "Get user balance by given id",
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get user balance by given id in given currency (RUB by default) and balances in all currencies. Balance is available money, held is money in open reserves and total is their sum. Held money is broken down by service if by_service is set",
                 "consumes": [
                     "application/json"
                 ],
@@ -31,12 +36,12 @@ const docTemplate = `{
                 "summary": "Get user balance",
                 "parameters": [
                     {
-                        "description": "In JSON with User ID",
+                        "description": "In JSON with User ID, optional currency and by_service flag",
                         "name": "inJSON",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.PayloadId"
+                            "$ref": "#/definitions/models.PayloadGetBalance"
                         }
                     }
                 ],
@@ -56,7 +61,12 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Add user balance by given id",
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Add user balance by given id in given currency (RUB by default)",
                 "consumes": [
                     "application/json"
                 ],
@@ -69,7 +79,7 @@ const docTemplate = `{
                 "summary": "Add user balance",
                 "parameters": [
                     {
-                        "description": "In JSON with User ID and Amount",
+                        "description": "In JSON with User ID, Amount and optional currency",
                         "name": "inJSON",
                         "in": "body",
                         "required": true,
@@ -94,9 +104,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/purchase/": {
+        "/balances/end-of-day": {
             "post": {
-                "description": "Perform purchase for given orderId, userId, serviceId and amount.",
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get balances of given users in every currency at the end of given day (Moscow time) for liability reporting",
                 "consumes": [
                     "application/json"
                 ],
@@ -104,25 +119,28 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Purchases"
+                    "Balance"
                 ],
-                "summary": "Perform purchase",
+                "summary": "Get end of day balances",
                 "parameters": [
                     {
-                        "description": "In JSON with user_id, service_id, order_id and amount",
+                        "description": "In JSON with user_ids (1000 at most) and date as YYYY-MM-DD",
                         "name": "inJSON",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.PayloadReserve"
+                            "$ref": "#/definitions/models.PayloadEndOfDayQuery"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Users' balances",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadBalanceAt"
+                            }
                         }
                     },
                     "400": {
@@ -134,9 +152,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/report/": {
+        "/batch": {
             "post": {
-                "description": "Get link to csv report file by given year and month",
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Perform up to 1000 operations in one request: credit (user_id, amount, currency), reserve (user_id, service_id, order_id, optional amount and currency), purchase (user_id, service_id, order_id, amount, optional currency) and release (user_id, service_id, order_id). Atomic batch is applied in one transaction and the first failed operation rolls it back, the rest of operations are skipped. Operations of independent batch are applied one by one and failed ones do not affect the others. Result is returned for every operation in order of the request: applied, failed with error code (NOT_FOUND, FAILED_PRECONDITION, INVALID_ARGUMENT, ALREADY_EXISTS, ABORTED, INTERNAL) or skipped. Failed operations with ABORTED code could be retried",
                 "consumes": [
                     "application/json"
                 ],
@@ -144,25 +167,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Reports"
+                    "Batch"
                 ],
-                "summary": "Get link to csv report file",
+                "summary": "Perform batch of operations",
                 "parameters": [
                     {
-                        "description": "In JSON with Service ID",
+                        "description": "In JSON with atomic flag and operations",
                         "name": "inJSON",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.PayloadId"
+                            "$ref": "#/definitions/models.PayloadBatch"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Link to CSV file",
+                        "description": "Result for every operation",
                         "schema": {
-                            "$ref": "#/definitions/models.PayloadLink"
+                            "$ref": "#/definitions/models.PayloadBatchResult"
                         }
                     },
                     "400": {
@@ -174,40 +197,40 @@ const docTemplate = `{
                 }
             }
         },
-        "/report/{year}/{month}/report.csv": {
-            "get": {
-                "description": "Get csv report file by given year and month",
+        "/convert": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Convert money of user from one currency to another by the current exchange rate. Amount is debited from wallet of from currency, amount * rate * (1 - spread) is credited to wallet of to currency",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "Reports"
+                    "Exchange rates"
                 ],
-                "summary": "Get csv report file",
+                "summary": "Convert money",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Year",
-                        "name": "year",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Month",
-                        "name": "month",
-                        "in": "path",
-                        "required": true
+                        "description": "In JSON with user_id, from, to and amount in from currency",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadConvert"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "CSV file",
+                        "description": "Conversion",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.PayloadConversion"
                         }
                     },
                     "400": {
@@ -215,9 +238,52 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/models.PayloadErr"
                         }
+                    }
+                }
+            }
+        },
+        "/imports": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Load CSV file of user_id, amount and optional external_ref columns (header is optional) in given currency (RUB by default). Rows are validated and loaded into staging table, invalid rows are not applied. Credits are applied in background in chunks the same way as adding of balance, progress is returned by GET /imports/{id} and status of every row by GET /imports/{id}/result.csv. The same file cannot be imported twice, import interrupted by failure is resumed by POST /imports/{id}/resume. Files larger than 4 MB are imported by import command",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Imports"
+                ],
+                "summary": "Import balances",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "CSV file",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Currency of amounts, RUB by default",
+                        "name": "currency",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created import",
+                        "schema": {
+                            "$ref": "#/definitions/models.Import"
+                        }
                     },
-                    "404": {
-                        "description": "CSV file not found",
+                    "400": {
+                        "description": "Error",
                         "schema": {
                             "$ref": "#/definitions/models.PayloadErr"
                         }
@@ -225,9 +291,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/reserve/": {
+        "/imports/{id}": {
             "get": {
-                "description": "Get reserve by user_id, service_id, order_id",
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get import by given id with its status and numbers of pending, applied, invalid and failed rows",
                 "consumes": [
                     "application/json"
                 ],
@@ -235,25 +306,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Reserves"
+                    "Imports"
                 ],
-                "summary": "Get reserve",
+                "summary": "Get import",
                 "parameters": [
                     {
-                        "description": "In JSON with user_id, service_id, order_id",
-                        "name": "inJSON",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.PayloadReserve"
-                        }
+                        "type": "integer",
+                        "description": "Import ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Service",
+                        "description": "Import",
                         "schema": {
-                            "$ref": "#/definitions/models.Reserve"
+                            "$ref": "#/definitions/models.Import"
                         }
                     },
                     "400": {
@@ -263,35 +332,37 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "post": {
-                "description": "Reserve money for given orderId, userId, serviceId and amount.",
-                "consumes": [
-                    "application/json"
+            }
+        },
+        "/imports/{id}/result.csv": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
                 ],
+                "description": "Get csv file with line, user_id, amount, external_ref, status (pending, applied, invalid or failed) and error of every row of import by given id",
                 "produces": [
-                    "application/json"
+                    "text/csv"
                 ],
                 "tags": [
-                    "Reserves"
+                    "Imports"
                 ],
-                "summary": "Reserve money",
+                "summary": "Get import result",
                 "parameters": [
                     {
-                        "description": "In JSON with user_id, service_id, order_id and amount",
-                        "name": "inJSON",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.PayloadReserve"
-                        }
+                        "type": "integer",
+                        "description": "Import ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Result file",
                         "schema": {
-                            "type": "string"
+                            "type": "file"
                         }
                     },
                     "400": {
@@ -301,9 +372,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Remove reserve for given orderId, userId, serviceId and amount.",
+            }
+        },
+        "/imports/{id}/resume": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Resume import by given id interrupted by failure, credits of pending rows are applied in background. Rows being applied by another instance are not applied twice",
                 "consumes": [
                     "application/json"
                 ],
@@ -311,25 +389,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Reserves"
+                    "Imports"
                 ],
-                "summary": "Remove reserve",
+                "summary": "Resume import",
                 "parameters": [
                     {
-                        "description": "In JSON with user_id, service_id, order_id and amount",
-                        "name": "inJSON",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.PayloadReserve"
-                        }
+                        "type": "integer",
+                        "description": "Import ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Import",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Import"
                         }
                     },
                     "400": {
@@ -341,9 +417,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/services/": {
+        "/keys": {
             "get": {
-                "description": "Get service by given id",
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all API keys with their roles, services and state, keys themselves are not returned",
                 "consumes": [
                     "application/json"
                 ],
@@ -351,25 +432,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Services"
-                ],
-                "summary": "Get service",
-                "parameters": [
-                    {
-                        "description": "In JSON with Service ID",
-                        "name": "inJSON",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.PayloadId"
-                        }
-                    }
+                    "Keys"
                 ],
+                "summary": "List API keys",
                 "responses": {
                     "200": {
-                        "description": "Service",
+                        "description": "Keys",
                         "schema": {
-                            "$ref": "#/definitions/models.Service"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadAPIKey"
+                            }
                         }
                     },
                     "400": {
@@ -381,7 +454,12 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Add multiple services",
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Create API key with name, role and optional services. Role is one of read-only (reads), billing-client (reads, credits, reserves, purchases, releases, orders and batches), finance (reads, credits, imports, reports, periods, rates and reconciliation) and admin (everything including users, services, webhooks and keys). Key restricted to services operates on reserves, purchases and orders of these services only. Key is returned only in this response, only its hash is stored",
                 "consumes": [
                     "application/json"
                 ],
@@ -389,28 +467,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Services"
+                    "Keys"
                 ],
-                "summary": "Add multiple services",
+                "summary": "Create API key",
                 "parameters": [
                     {
-                        "description": "Array of services",
+                        "description": "In JSON with name, role and optional services",
                         "name": "inJSON",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Service"
-                            }
+                            "$ref": "#/definitions/models.PayloadCreateAPIKey"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Created key",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.PayloadAPIKey"
                         }
                     },
                     "400": {
@@ -420,9 +495,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/keys/{id}": {
             "delete": {
-                "description": "Delete service by given id",
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Revoke API key by given id at once, requests with revoked key are unauthorized. Rotated key is revoked before end of its grace period",
                 "consumes": [
                     "application/json"
                 ],
@@ -430,18 +512,16 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Services"
+                    "Keys"
                 ],
-                "summary": "Delete service",
+                "summary": "Revoke API key",
                 "parameters": [
                     {
-                        "description": "In JSON with Service ID",
-                        "name": "inJSON",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.PayloadId"
-                        }
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -460,9 +540,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/": {
-            "delete": {
-                "description": "Delete user by given id",
+        "/keys/{id}/rotate": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Replace active API key by given id with a new key of the same name, role and services. The old key keeps working for grace period (duration like 1h, 24h by default, 0s ends it at once), so clients could switch to the new key. New key is returned only in this response",
                 "consumes": [
                     "application/json"
                 ],
@@ -470,25 +555,32 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Keys"
                 ],
-                "summary": "Delete user",
+                "summary": "Rotate API key",
                 "parameters": [
                     {
-                        "description": "In JSON with User ID",
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with optional grace period",
                         "name": "inJSON",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.PayloadId"
+                            "$ref": "#/definitions/models.PayloadRotateAPIKey"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "New key",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.PayloadAPIKey"
                         }
                     },
                     "400": {
@@ -499,58 +591,6205 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.PayloadAddBalance": {
-            "type": "object",
-            "properties": {
-                "amount": {
-                    "type": "number"
-                },
-                "id": {
-                    "type": "integer"
-                }
-            }
-        },
-        "models.PayloadBalance": {
-            "type": "object",
-            "properties": {
-                "balance": {
-                    "type": "number"
-                }
-            }
-        },
-        "models.PayloadErr": {
-            "type": "object",
-            "properties": {
-                "message": {
-                    "type": "string"
-                }
-            }
         },
-        "models.PayloadId": {
-            "type": "object",
-            "properties": {
-                "id": {
-                    "type": "integer"
-                }
-            }
+        "/keys/{id}/secrets": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all signing secrets of API key by given id with their state, secrets themselves are not returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "List signing secrets",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Secrets",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadSigningSecret"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Create secret of HMAC-SHA256 signatures for API key by given id. Requests of key with active secret crediting, reserving, purchasing and releasing money must be signed: X-Signature-Timestamp header with unix time in seconds (at most 5 minutes from time of the service), X-Signature-Nonce header with unique string up to 64 characters and X-Signature header with sha256=\u003chex HMAC-SHA256\u003e of method, path with query, timestamp, nonce and body joined by new lines. Nonce is accepted once. Active secrets of the key keep working for grace period (duration like 1h, 24h by default, 0s ends it at once), so creating secret rotates them. Secret is returned only in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "Create signing secret",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with optional grace period",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadCreateSigningSecret"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created secret",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadSigningSecret"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/keys/{id}/secrets/{secret_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Revoke signing secret by given id of API key by given id at once, requests signed by it are unauthorized. Key without active secrets sends requests without signatures",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "Revoke signing secret",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Secret ID",
+                        "name": "secret_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/liabilities": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get money owed to users at the end of every day by snapshots with daily inflows (top-ups), outflows (purchases), other operations and net change. Every day is reconciled with balance calculated from operations",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get liabilities report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First day of range, YYYY-MM-DD, first day of month of yesterday by default",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last day of range, YYYY-MM-DD, yesterday by default",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Liabilities report",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadLiabilities"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Reserve money for the whole order with multiple line items at once. Catalog price of service is used for item without unit price, otherwise unit price must be within bounds of the service. Currency defaults to currency of services, all services must be priced in the same currency",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Reserve order",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_id, order_id and items",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserveOrder"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Reserved order",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrder"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get order with multiple line items by order id and user id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Get order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Order",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrder"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Remove reserve of order with multiple line items and return money to user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Release order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with user_id",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrderQuery"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}/purchase": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Capture given line items of order, not given items are released and money is returned to user. All items are captured if lines are omitted. Revenue is attributed to every captured line item",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Purchase order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with user_id and optional numbers of captured lines",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrderQuery"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Purchased order",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrder"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/periods": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all closed accounting periods",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Periods"
+                ],
+                "summary": "Get closed periods",
+                "responses": {
+                    "200": {
+                        "description": "Closed periods",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Period"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/periods/close": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Close accounting period by given year and month. Operations dated in closed period are rejected, closing report is frozen as a new version",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Periods"
+                ],
+                "summary": "Close accounting period",
+                "parameters": [
+                    {
+                        "description": "In JSON with year and month",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadDate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Closing report version",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/purchase/": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Perform purchase for given orderId, userId, serviceId and amount. Currency defaults to currency of the reserve",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Purchases"
+                ],
+                "summary": "Perform purchase",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_id, service_id, order_id and amount",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserve"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/rates": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get exchange rate from base to quote currency valid at given time. Inverse rate is used if there is no direct one",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Exchange rates"
+                ],
+                "summary": "Get exchange rate",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Base currency",
+                        "name": "base",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Quote currency",
+                        "name": "quote",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Time, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339, now by default",
+                        "name": "at",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Exchange rate",
+                        "schema": {
+                            "$ref": "#/definitions/models.ExchangeRate"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Upload exchange rates as JSON array or as CSV file (Content-Type: text/csv) with columns base,quote,rate,spread,valid_from,valid_to. Spread and valid_to could be empty, time is given as YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339",
+                "consumes": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Exchange rates"
+                ],
+                "summary": "Upload exchange rates",
+                "parameters": [
+                    {
+                        "description": "Array of exchange rates",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadExchangeRate"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/reconciliation": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Recompute every wallet balance from operations and open reserves and get wallets whose stored balance differs",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reconciliation"
+                ],
+                "summary": "Reconcile balances",
+                "responses": {
+                    "200": {
+                        "description": "Reconciliation results",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReconciliation"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/report/": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Create a new version of csv report by given year and month and get link to it. Previous versions are kept, diff against the previous version is returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Create csv report version",
+                "parameters": [
+                    {
+                        "description": "In JSON with year and month",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadDate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created report version",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/report/{year}/{month}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all versions of report with their digests by given year and month",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get report versions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Report versions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Report"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/report/{year}/{month}/report.csv": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get the latest version of csv report file by given year and month",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get csv report file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    },
+                    "404": {
+                        "description": "CSV file not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/report/{year}/{month}/restated": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get the latest version of report by given year and month with revenue restated in given currency by exchange rates valid at the end of the month",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get restated report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base currency, RUB by default",
+                        "name": "currency",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Restated report",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadRestatedReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/report/{year}/{month}/{version}/diff.csv": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get csv file with diff of report version against the previous version by given year, month and version",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get csv report diff file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Report version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    },
+                    "404": {
+                        "description": "CSV file not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/report/{year}/{month}/{version}/report.csv": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get csv report file by given year, month and version",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get csv report file version",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Report version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    },
+                    "404": {
+                        "description": "CSV file not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/reserve/": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get reserve by user_id, service_id, order_id with its status and history of amendments. Order with multiple line items is found by any of its services",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Get reserve",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_id, service_id, order_id",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserve"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Reserve",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReserveFloatAmount"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Reserve money for given orderId, userId, serviceId and amount. Catalog price of the service is reserved if amount is omitted, otherwise amount must be within bounds of the service. Currency defaults to currency of the service and must match it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Reserve money",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_id, service_id, order_id and optional amount",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserve"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created reserve",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReserveFloatAmount"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Release reserve for given orderId, userId, serviceId and amount. Money is returned to user, the reserve is kept with released status",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Remove reserve",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_id, service_id, order_id and amount",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserve"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Increase or decrease reserved amount and extend expiry time of not purchased reserve. Increase is checked against available balance of user, difference of decrease is returned to user. Omitted amount keeps the reserved one, extend is duration like 30m or 1h",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Amend reserve",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_id, service_id, order_id, optional new amount and extend",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadAmendReserve"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Amended reserve",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReserveFloatAmount"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/reserves": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get page of reserves ordered by reserve time descending with filters by user, service, status and reserve time range. Order with multiple line items is found by any of its services. Page is continued by next_cursor of previous page",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "List reserves",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter by User ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by Service ID",
+                        "name": "service_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by status: open, purchased, released or expired",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reserved at or after, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reserved before, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 20 by default, 100 at most",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Page of reserves",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserves"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/reserves/outstanding": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get open reserves grouped by service, currency and age (\u003c1h, 1-24h, 1-7d, \u003e7d), totals per user and currency, totals per currency and reserves which expiry mechanism failed to release",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Get outstanding reserves",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter by User ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by Service ID",
+                        "name": "service_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Outstanding reserves",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReservesAging"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/services/": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get service by given id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Get service",
+                "parameters": [
+                    {
+                        "description": "In JSON with Service ID",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadId"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Service",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadService"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Update name, active flag, catalog price and amount bounds of service by given id. Omitted fields are left unchanged, change of price or bounds creates a new price version. Currency of service cannot be changed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Update service",
+                "parameters": [
+                    {
+                        "description": "In JSON with Service ID and changed fields",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadService"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated service",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadService"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Create or update multiple services with optional catalog price and amount bounds, currency of service is RUB by default, service is active by default. Result is returned for every service: created, updated or conflict (name is taken, currency differs from currency of existing service or price is not valid)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Create or update multiple services",
+                "parameters": [
+                    {
+                        "description": "Array of services",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadService"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Result for every service",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ServiceUpsertResult"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Deactivate service by given id. Service is kept for operations, reserves and reports, but cannot be reserved anymore",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Delete service",
+                "parameters": [
+                    {
+                        "description": "In JSON with Service ID",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadId"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/services/list": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get page of services ordered by id with case-insensitive search by name",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "List services",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Substring of service name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Filter by active flag",
+                        "name": "active",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 20 by default, 100 at most",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of skipped services",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Page of services",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadServices"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/services/{id}/prices": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all versions of catalog price and amount bounds of service by given id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Get service price versions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Price versions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadServicePrice"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/snapshots/{date}": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Store end of day balances and held money of all users for given day which is over, snapshot of the same day is replaced. Snapshots are made by daily job, the endpoint is for backfill",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Create balance snapshot",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Day, YYYY-MM-DD",
+                        "name": "date",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Snapshot",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadSnapshot"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Delete user by given id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "description": "In JSON with User ID",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadId"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/accounts": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get wallet and hold ledger accounts of user with balances derived from postings",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get user ledger accounts",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User accounts",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadAccount"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/balance": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get balances of user in every currency and reserves open at given moment calculated from operations and reserves. Operations done exactly at the moment are not taken into account",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Get user balance at moment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Moment, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339, now by default",
+                        "name": "at",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User's balance at moment",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadBalanceAt"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/events": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Stream changes of balances and reserve statuses of user by given id as Server-Sent Events. Stream starts with \"balance\" event with current balances of user, then \"movement\" event is sent for every money movement with changes of available and held money and status of its reserve. Reconnected client continues from the last received event by Last-Event-ID header or last_event_id query parameter, the \"balance\" event is not sent then. Changes made through any instance of service are streamed",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Stream balance changes",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the last received event",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the last received event, used if header is not set",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stream of events",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadStreamMovement"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/statement": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get account statement of user for given date range with opening balance, operations with running balance, held and closing balance",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "application/pdf"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get user statement",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Currency of statement, RUB by default",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "First day of range, YYYY-MM-DD, first day of current month by default",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last day of range, YYYY-MM-DD, today by default",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Statement format: json (default), csv or pdf",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User statement",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadStatement"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/balances/end-of-day": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get balances of given users in every currency at the end of given day (Moscow time) for liability reporting",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Get end of day balances",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_ids (1000 at most) and date as YYYY-MM-DD",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadEndOfDayQuery"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Users' balances",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadBalanceAt"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/batch": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Perform up to 1000 operations in one request: credit (user_id, amount, currency), reserve (user_id, service_id, order_id, optional amount and currency), purchase (user_id, service_id, order_id, amount, optional currency) and release (user_id, service_id, order_id). Atomic batch is applied in one transaction and the first failed operation rolls it back, the rest of operations are skipped. Operations of independent batch are applied one by one and failed ones do not affect the others. Result is returned for every operation in order of the request: applied, failed with error code (NOT_FOUND, FAILED_PRECONDITION, INVALID_ARGUMENT, ALREADY_EXISTS, ABORTED, INTERNAL) or skipped. Failed operations with ABORTED code could be retried",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Batch"
+                ],
+                "summary": "Perform batch of operations",
+                "parameters": [
+                    {
+                        "description": "In JSON with atomic flag and operations",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadBatch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Result for every operation",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadBatchResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/convert": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Convert money of user from one currency to another by the current exchange rate. Amount is debited from wallet of from currency, amount * rate * (1 - spread) is credited to wallet of to currency",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Exchange rates"
+                ],
+                "summary": "Convert money",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_id, from, to and amount in from currency",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadConvert"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Conversion",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadConversion"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/imports": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Load CSV file of user_id, amount and optional external_ref columns (header is optional) in given currency (RUB by default). Rows are validated and loaded into staging table, invalid rows are not applied. Credits are applied in background in chunks the same way as adding of balance, progress is returned by GET /imports/{id} and status of every row by GET /imports/{id}/result.csv. The same file cannot be imported twice, import interrupted by failure is resumed by POST /imports/{id}/resume. Files larger than 4 MB are imported by import command",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Imports"
+                ],
+                "summary": "Import balances",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "CSV file",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Currency of amounts, RUB by default",
+                        "name": "currency",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created import",
+                        "schema": {
+                            "$ref": "#/definitions/models.Import"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/imports/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get import by given id with its status and numbers of pending, applied, invalid and failed rows",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Imports"
+                ],
+                "summary": "Get import",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Import ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Import",
+                        "schema": {
+                            "$ref": "#/definitions/models.Import"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/imports/{id}/result.csv": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get csv file with line, user_id, amount, external_ref, status (pending, applied, invalid or failed) and error of every row of import by given id",
+                "produces": [
+                    "text/csv"
+                ],
+                "tags": [
+                    "Imports"
+                ],
+                "summary": "Get import result",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Import ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Result file",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/imports/{id}/resume": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Resume import by given id interrupted by failure, credits of pending rows are applied in background. Rows being applied by another instance are not applied twice",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Imports"
+                ],
+                "summary": "Resume import",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Import ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Import",
+                        "schema": {
+                            "$ref": "#/definitions/models.Import"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/keys": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all API keys with their roles, services and state, keys themselves are not returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "List API keys",
+                "responses": {
+                    "200": {
+                        "description": "Keys",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadAPIKey"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Create API key with name, role and optional services. Role is one of read-only (reads), billing-client (reads, credits, reserves, purchases, releases, orders and batches), finance (reads, credits, imports, reports, periods, rates and reconciliation) and admin (everything including users, services, webhooks and keys). Key restricted to services operates on reserves, purchases and orders of these services only. Key is returned only in this response, only its hash is stored",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "Create API key",
+                "parameters": [
+                    {
+                        "description": "In JSON with name, role and optional services",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadCreateAPIKey"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created key",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadAPIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Revoke API key by given id at once, requests with revoked key are unauthorized. Rotated key is revoked before end of its grace period",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "Revoke API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/keys/{id}/rotate": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Replace active API key by given id with a new key of the same name, role and services. The old key keeps working for grace period (duration like 1h, 24h by default, 0s ends it at once), so clients could switch to the new key. New key is returned only in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "Rotate API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with optional grace period",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadRotateAPIKey"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "New key",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadAPIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/keys/{id}/secrets": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all signing secrets of API key by given id with their state, secrets themselves are not returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "List signing secrets",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Secrets",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadSigningSecret"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Create secret of HMAC-SHA256 signatures for API key by given id. Requests of key with active secret crediting, reserving, purchasing and releasing money must be signed: X-Signature-Timestamp header with unix time in seconds (at most 5 minutes from time of the service), X-Signature-Nonce header with unique string up to 64 characters and X-Signature header with sha256=\u003chex HMAC-SHA256\u003e of method, path with query, timestamp, nonce and body joined by new lines. Nonce is accepted once. Active secrets of the key keep working for grace period (duration like 1h, 24h by default, 0s ends it at once), so creating secret rotates them. Secret is returned only in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "Create signing secret",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with optional grace period",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadCreateSigningSecret"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created secret",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadSigningSecret"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/keys/{id}/secrets/{secret_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Revoke signing secret by given id of API key by given id at once, requests signed by it are unauthorized. Key without active secrets sends requests without signatures",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "Revoke signing secret",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Secret ID",
+                        "name": "secret_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/liabilities": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get money owed to users at the end of every day by snapshots with daily inflows (top-ups), outflows (purchases), other operations and net change. Every day is reconciled with balance calculated from operations",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get liabilities report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First day of range, YYYY-MM-DD, first day of month of yesterday by default",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last day of range, YYYY-MM-DD, yesterday by default",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Liabilities report",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadLiabilities"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/orders": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Reserve money for the whole order with multiple line items at once. Catalog price of service is used for item without unit price, otherwise unit price must be within bounds of the service. Currency defaults to currency of services, all services must be priced in the same currency",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Reserve order",
+                "parameters": [
+                    {
+                        "description": "In JSON with user_id, order_id and items",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserveOrder"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Reserved order",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrder"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/orders/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get order with multiple line items by order id and user id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Get order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Order",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrder"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Remove reserve of order with multiple line items and return money to user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Release order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/orders/{id}/purchase": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Capture given line items of order, not given items are released and money is returned to user. All items are captured if lines are omitted. Revenue is attributed to every captured line item",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Purchase order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with user_id and optional numbers of captured lines",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrderQuery"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Purchased order",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadOrder"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/orders/{id}/reserve": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get reserve of order by user_id and service_id with its status and history of amendments. Order with multiple line items is found by any of its services",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Get reserve",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "service_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Reserve",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReserveFloatAmount"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Reserve money for given order, user_id, service_id and amount. Catalog price of the service is reserved if amount is omitted, otherwise amount must be within bounds of the service. Currency defaults to currency of the service and must match it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Reserve money",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with user_id, service_id and optional amount",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserve"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created reserve",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReserveFloatAmount"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Release reserve of order by user_id and service_id. Money is returned to user, the reserve is kept with released status",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Remove reserve",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "service_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Increase or decrease reserved amount and extend expiry time of not purchased reserve. Increase is checked against available balance of user, difference of decrease is returned to user. Omitted amount keeps the reserved one, extend is duration like 30m or 1h",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Amend reserve",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with user_id, service_id, optional new amount and extend",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadAmendReserve"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Amended reserve",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReserveFloatAmount"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/orders/{id}/reserve/purchase": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Perform purchase of reserve of order by user_id, service_id and amount. Currency defaults to currency of the reserve",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Purchases"
+                ],
+                "summary": "Perform purchase",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with user_id, service_id and amount",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserve"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/periods": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all closed accounting periods",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Periods"
+                ],
+                "summary": "Get closed periods",
+                "responses": {
+                    "200": {
+                        "description": "Closed periods",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Period"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/periods/close": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Close accounting period by given year and month. Operations dated in closed period are rejected, closing report is frozen as a new version",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Periods"
+                ],
+                "summary": "Close accounting period",
+                "parameters": [
+                    {
+                        "description": "In JSON with year and month",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadDate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Closing report version",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/rates": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get exchange rate from base to quote currency valid at given time. Inverse rate is used if there is no direct one",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Exchange rates"
+                ],
+                "summary": "Get exchange rate",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Base currency",
+                        "name": "base",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Quote currency",
+                        "name": "quote",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Time, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339, now by default",
+                        "name": "at",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Exchange rate",
+                        "schema": {
+                            "$ref": "#/definitions/models.ExchangeRate"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Upload exchange rates as JSON array or as CSV file (Content-Type: text/csv) with columns base,quote,rate,spread,valid_from,valid_to. Spread and valid_to could be empty, time is given as YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339",
+                "consumes": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Exchange rates"
+                ],
+                "summary": "Upload exchange rates",
+                "parameters": [
+                    {
+                        "description": "Array of exchange rates",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadExchangeRate"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/reconciliation": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Recompute every wallet balance from operations and open reserves and get wallets whose stored balance differs",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reconciliation"
+                ],
+                "summary": "Reconcile balances",
+                "responses": {
+                    "200": {
+                        "description": "Reconciliation results",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReconciliation"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/report/{year}/{month}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all versions of report with their digests by given year and month",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get report versions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Report versions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Report"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Create a new version of csv report by given year and month and get link to it. Previous versions are kept, diff against the previous version is returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Create csv report version",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created report version",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/report/{year}/{month}/report.csv": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get the latest version of csv report file by given year and month",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get csv report file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    },
+                    "404": {
+                        "description": "CSV file not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/report/{year}/{month}/restated": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get the latest version of report by given year and month with revenue restated in given currency by exchange rates valid at the end of the month",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get restated report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base currency, RUB by default",
+                        "name": "currency",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Restated report",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadRestatedReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/report/{year}/{month}/{version}/diff.csv": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get csv file with diff of report version against the previous version by given year, month and version",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get csv report diff file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Report version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    },
+                    "404": {
+                        "description": "CSV file not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/report/{year}/{month}/{version}/report.csv": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get csv report file by given year, month and version",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Get csv report file version",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Year",
+                        "name": "year",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Month",
+                        "name": "month",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Report version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    },
+                    "404": {
+                        "description": "CSV file not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/reserves": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get page of reserves ordered by reserve time descending with filters by user, service, status and reserve time range. Order with multiple line items is found by any of its services. Page is continued by next_cursor of previous page",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "List reserves",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter by User ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by Service ID",
+                        "name": "service_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by status: open, purchased, released or expired",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reserved at or after, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reserved before, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 20 by default, 100 at most",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Page of reserves",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReserves"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/reserves/outstanding": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get open reserves grouped by service, currency and age (\u003c1h, 1-24h, 1-7d, \u003e7d), totals per user and currency, totals per currency and reserves which expiry mechanism failed to release",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reserves"
+                ],
+                "summary": "Get outstanding reserves",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter by User ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by Service ID",
+                        "name": "service_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Outstanding reserves",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadReservesAging"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/services": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get page of services ordered by id with case-insensitive search by name",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "List services",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Substring of service name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Filter by active flag",
+                        "name": "active",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 20 by default, 100 at most",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of skipped services",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Page of services",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadServices"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Create or update multiple services with optional catalog price and amount bounds, currency of service is RUB by default, service is active by default. Result is returned for every service: created, updated or conflict (name is taken, currency differs from currency of existing service or price is not valid)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Create or update multiple services",
+                "parameters": [
+                    {
+                        "description": "Array of services",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadService"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Result for every service",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ServiceUpsertResult"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/services/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get service by given id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Get service",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Service",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadService"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Update name, active flag, catalog price and amount bounds of service by given id. Omitted fields are left unchanged, change of price or bounds creates a new price version. Currency of service cannot be changed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Update service",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with changed fields",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadService"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated service",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadService"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Deactivate service by given id. Service is kept for operations, reserves and reports, but cannot be reserved anymore",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Delete service",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/services/{id}/prices": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all versions of catalog price and amount bounds of service by given id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Services"
+                ],
+                "summary": "Get service price versions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Price versions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadServicePrice"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/snapshots/{date}": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Store end of day balances and held money of all users for given day which is over, snapshot of the same day is replaced. Snapshots are made by daily job, the endpoint is for backfill",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Create balance snapshot",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Day, YYYY-MM-DD",
+                        "name": "date",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Snapshot",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadSnapshot"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/users/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Delete user by given id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/users/{id}/accounts": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get wallet and hold ledger accounts of user with balances derived from postings",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get user ledger accounts",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User accounts",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadAccount"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/users/{id}/balance": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get user balance by given id in given currency (RUB by default) and balances in all currencies. Balance is available money, held is money in open reserves and total is their sum. Held money is broken down by service if by_service is set",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Get user balance",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Currency, RUB by default",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Break down held money by service",
+                        "name": "by_service",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User's balance",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadBalance"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Add user balance by given id in given currency (RUB by default)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Add user balance",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with Amount and optional currency",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadAddBalance"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/users/{id}/balance/as-of": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get balances of user in every currency and reserves open at given moment calculated from operations and reserves. Operations done exactly at the moment are not taken into account",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Get user balance at moment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Moment, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339, now by default",
+                        "name": "at",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User's balance at moment",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadBalanceAt"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/users/{id}/events": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Stream changes of balances and reserve statuses of user by given id as Server-Sent Events. Stream starts with \"balance\" event with current balances of user, then \"movement\" event is sent for every money movement with changes of available and held money and status of its reserve. Reconnected client continues from the last received event by Last-Event-ID header or last_event_id query parameter, the \"balance\" event is not sent then. Changes made through any instance of service are streamed",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Balance"
+                ],
+                "summary": "Stream balance changes",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the last received event",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the last received event, used if header is not set",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stream of events",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadStreamMovement"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/users/{id}/statement": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get account statement of user for given date range with opening balance, operations with running balance, held and closing balance",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "application/pdf"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get user statement",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Currency of statement, RUB by default",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "First day of range, YYYY-MM-DD, first day of current month by default",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last day of range, YYYY-MM-DD, today by default",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Statement format: json (default), csv or pdf",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User statement",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadStatement"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all webhooks with their state, secrets are not returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "Webhooks",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadWebhook"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Subscribe url to balance events: balance.credited, reserve.created, reserve.expired, purchase.completed, refund.created. Events are sent by POST after the change is committed, signed with HMAC-SHA256 of \"timestamp.body\" in X-Balance-Signature header. Failed deliveries are retried with exponential backoff, webhook is disabled after repeated failed deliveries. Secret is generated if omitted and returned only in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Create webhook",
+                "parameters": [
+                    {
+                        "description": "In JSON with url, event_types and optional secret",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadCreateWebhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created webhook with secret",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadWebhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/webhooks/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Delete webhook by given id with its deliveries",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Delete webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Change url, event types or active flag of webhook by given id. Enabling of webhook resets count of failed deliveries, pending deliveries of disabled webhook fail",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Update webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with changed fields",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadUpdateWebhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated webhook",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadWebhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/webhooks/{id}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get the latest deliveries of webhook by given id with their events, statuses and history of attempts",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Get webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of deliveries, 20 by default, 100 at most",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Deliveries",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadWebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get all webhooks with their state, secrets are not returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "Webhooks",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadWebhook"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Subscribe url to balance events: balance.credited, reserve.created, reserve.expired, purchase.completed, refund.created. Events are sent by POST after the change is committed, signed with HMAC-SHA256 of \"timestamp.body\" in X-Balance-Signature header. Failed deliveries are retried with exponential backoff, webhook is disabled after repeated failed deliveries. Secret is generated if omitted and returned only in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Create webhook",
+                "parameters": [
+                    {
+                        "description": "In JSON with url, event_types and optional secret",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadCreateWebhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Created webhook with secret",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadWebhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Delete webhook by given id with its deliveries",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Delete webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Change url, event types or active flag of webhook by given id. Enabling of webhook resets count of failed deliveries, pending deliveries of disabled webhook fail",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Update webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "In JSON with changed fields",
+                        "name": "inJSON",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadUpdateWebhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated webhook",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadWebhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKey": []
+                    }
+                ],
+                "description": "Get the latest deliveries of webhook by given id with their events, statuses and history of attempts",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Get webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of deliveries, 20 by default, 100 at most",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Deliveries",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PayloadWebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.PayloadErr"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "models.ExchangeRate": {
+            "type": "object",
+            "properties": {
+                "base": {
+                    "description": "currency which is sold",
+                    "type": "string"
+                },
+                "created_at": {
+                    "description": "time when rate was uploaded",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "quote": {
+                    "description": "currency which is bought",
+                    "type": "string"
+                },
+                "rate": {
+                    "description": "amount of quote currency for one unit of base currency, exact decimal",
+                    "type": "string"
+                },
+                "spread": {
+                    "description": "fraction of converted amount kept by service, exact decimal",
+                    "type": "string"
+                },
+                "valid_from": {
+                    "description": "time since rate is valid",
+                    "type": "string"
+                },
+                "valid_to": {
+                    "description": "time until rate is valid, nullable for rates valid until superseded",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Import": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "type": "integer"
+                },
+                "completed_at": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "file_name": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "invalid": {
+                    "type": "integer"
+                },
+                "pending": {
+                    "type": "integer"
+                },
+                "rows": {
+                    "type": "integer"
+                },
+                "sha256": {
+                    "description": "checksum of file, the same file cannot be imported twice",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "one of import statuses",
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadAPIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "description": "returned only when key is created or rotated",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "rotated_to": {
+                    "type": "integer"
+                },
+                "services": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.PayloadAccount": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadAddBalance": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadAmendReserve": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "new amount in currency of the reserve",
+                    "type": "number"
+                },
+                "extend": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadBalance": {
+            "type": "object",
+            "properties": {
+                "available": {
+                    "type": "number"
+                },
+                "balance": {
+                    "type": "number"
+                },
+                "balances": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadWallet"
+                    }
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "held": {
+                    "type": "number"
+                },
+                "services": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadServiceHeld"
+                    }
+                },
+                "total": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.PayloadBalanceAt": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "balances": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadWallet"
+                    }
+                },
+                "reserves": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadOpenReserve"
+                    }
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadBalanceChange": {
+            "type": "object",
+            "properties": {
+                "available": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "held": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.PayloadBalanceMismatch": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "difference": {
+                    "type": "number"
+                },
+                "held": {
+                    "type": "number"
+                },
+                "journal": {
+                    "type": "number"
+                },
+                "user_id": {
+                    "type": "integer"
+                },
+                "wallet": {
+                    "type": "number"
+                },
+                "wallet_difference": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.PayloadBatch": {
+            "type": "object",
+            "properties": {
+                "atomic": {
+                    "description": "all operations are applied or none",
+                    "type": "boolean"
+                },
+                "operations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadBatchOperation"
+                    }
+                }
+            }
+        },
+        "models.PayloadBatchItemResult": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "NOT_FOUND, FAILED_PRECONDITION, INVALID_ARGUMENT, ALREADY_EXISTS, ABORTED or INTERNAL",
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "reserve": {
+                    "$ref": "#/definitions/models.ReserveFloatAmount"
+                },
+                "status": {
+                    "description": "applied, failed or skipped",
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadBatchOperation": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "credit, reserve, purchase or release",
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadBatchResult": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadBatchItemResult"
+                    }
+                },
+                "skipped": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadConversion": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "converted": {
+                    "type": "number"
+                },
+                "done_at": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "rate": {
+                    "type": "string"
+                },
+                "spread": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadConvert": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadCreateAPIKey": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "description": "read-only, billing-client, finance or admin",
+                    "type": "string"
+                },
+                "services": {
+                    "description": "services the key operates on, all services if omitted",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.PayloadCreateSigningSecret": {
+            "type": "object",
+            "properties": {
+                "grace_period": {
+                    "description": "time the former secrets keep working, 24h by default",
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadCreateWebhook": {
+            "type": "object",
+            "properties": {
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "description": "generated if omitted",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadDate": {
+            "type": "object",
+            "properties": {
+                "month": {
+                    "type": "integer"
+                },
+                "year": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadEndOfDayQuery": {
+            "type": "object",
+            "properties": {
+                "date": {
+                    "type": "string"
+                },
+                "user_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.PayloadErr": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadExchangeRate": {
+            "type": "object",
+            "properties": {
+                "base": {
+                    "type": "string"
+                },
+                "quote": {
+                    "type": "string"
+                },
+                "rate": {
+                    "type": "number"
+                },
+                "spread": {
+                    "type": "number"
+                },
+                "valid_from": {
+                    "type": "string"
+                },
+                "valid_to": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadGetBalance": {
+            "type": "object",
+            "properties": {
+                "by_service": {
+                    "type": "boolean"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadId": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadLiabilities": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadLiabilitiesLine"
+                    }
+                },
+                "reconciled": {
+                    "type": "boolean"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadLiabilitiesLine": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string"
+                },
+                "day": {
+                    "type": "string"
+                },
+                "held": {
+                    "type": "number"
+                },
+                "inflows": {
+                    "type": "number"
+                },
+                "journal": {
+                    "type": "number"
+                },
+                "liabilities": {
+                    "type": "number"
+                },
+                "net_change": {
+                    "type": "number"
+                },
+                "other": {
+                    "type": "number"
+                },
+                "outflows": {
+                    "type": "number"
+                },
+                "reconciled": {
+                    "type": "boolean"
+                },
+                "snapshot": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.PayloadOpenReserve": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "reserved_at": {
+                    "type": "string"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadOrder": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadOrderLine"
+                    }
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "purchased": {
+                    "type": "boolean"
+                },
+                "purchased_at": {
+                    "type": "string"
+                },
+                "released_at": {
+                    "type": "string"
+                },
+                "reserved_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadOrderItem": {
+            "type": "object",
+            "properties": {
+                "quantity": {
+                    "type": "integer"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "unit_price": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.PayloadOrderLine": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "captured": {
+                    "type": "boolean"
+                },
+                "line_no": {
+                    "type": "integer"
+                },
+                "price_version": {
+                    "type": "integer"
+                },
+                "quantity": {
+                    "type": "integer"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "service_name": {
+                    "type": "string"
+                },
+                "unit_price": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.PayloadOrderQuery": {
+            "type": "object",
+            "properties": {
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadReconciliation": {
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "mismatches": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadBalanceMismatch"
+                    }
+                },
+                "wallets": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadReport": {
+            "type": "object",
+            "properties": {
+                "closing": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "diff": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadReportDiffLine"
+                    }
+                },
+                "diff_link": {
+                    "type": "string"
+                },
+                "report_link": {
+                    "type": "string"
+                },
+                "sha256": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadReportDiffLine": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string"
+                },
+                "current": {
+                    "type": "number"
+                },
+                "previous": {
+                    "type": "number"
+                },
+                "service_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadReserve": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadReserveAgingBucket": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "type": "string"
+                },
+                "amount": {
+                    "type": "number"
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "service_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadReserveAmendment": {
+            "type": "object",
+            "properties": {
+                "amended_at": {
+                    "type": "string"
+                },
+                "amount": {
+                    "type": "number"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "previous_amount": {
+                    "type": "number"
+                },
+                "previous_expires_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadReserveCurrencyTotal": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "currency": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadReserveOrder": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadOrderItem"
+                    }
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadReserveUserTotal": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadReserves": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "type": "string"
+                },
+                "reserves": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ReserveFloatAmount"
+                    }
+                }
+            }
+        },
+        "models.PayloadReservesAging": {
+            "type": "object",
+            "properties": {
+                "buckets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadReserveAgingBucket"
+                    }
+                },
+                "stuck": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadOpenReserve"
+                    }
+                },
+                "totals": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadReserveCurrencyTotal"
+                    }
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadReserveUserTotal"
+                    }
+                }
+            }
+        },
+        "models.PayloadRestatedReport": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadRestatedReportLine"
+                    }
+                },
+                "month": {
+                    "type": "integer"
+                },
+                "rates_at": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "number"
+                },
+                "version": {
+                    "type": "integer"
+                },
+                "year": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadRestatedReportLine": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "converted": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "rate": {
+                    "type": "string"
+                },
+                "service_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadRotateAPIKey": {
+            "type": "object",
+            "properties": {
+                "grace_period": {
+                    "description": "time the old key keeps working, 24h by default",
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadService": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "max_amount": {
+                    "type": "number"
+                },
+                "min_amount": {
+                    "type": "number"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "price": {
+                    "type": "number"
+                },
+                "price_version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadServiceHeld": {
+            "type": "object",
+            "properties": {
+                "held": {
+                    "type": "number"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "service_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadServicePrice": {
+            "type": "object",
+            "properties": {
+                "max_amount": {
+                    "type": "number"
+                },
+                "min_amount": {
+                    "type": "number"
+                },
+                "price": {
+                    "type": "number"
+                },
+                "valid_from": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadServices": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "services": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadService"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadSigningSecret": {
+            "type": "object",
+            "properties": {
+                "api_key_id": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "returned only when secret is created",
+                    "type": "string"
+                }
+            }
         },
-        "models.PayloadLink": {
+        "models.PayloadSnapshot": {
             "type": "object",
             "properties": {
-                "report_link": {
+                "created_at": {
+                    "type": "string"
+                },
+                "day": {
+                    "type": "string"
+                },
+                "wallets": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadStatement": {
+            "type": "object",
+            "properties": {
+                "available": {
+                    "type": "number"
+                },
+                "balance": {
+                    "type": "number"
+                },
+                "closing_balance": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "held": {
+                    "type": "number"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadStatementLine"
+                    }
+                },
+                "opening_balance": {
                     "type": "number"
+                },
+                "reconciled": {
+                    "type": "boolean"
+                },
+                "to": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
                 }
             }
         },
-        "models.PayloadReserve": {
+        "models.PayloadStatementLine": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "done_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "rate": {
+                    "type": "string"
+                },
+                "running_balance": {
+                    "type": "number"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
+                "service_name": {
+                    "type": "string"
+                },
+                "spread": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadStreamMovement": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadBalanceChange"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "reserve_status": {
+                    "type": "string"
+                },
+                "service_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadUpdateWebhook": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadWallet": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "held": {
+                    "type": "number"
+                },
+                "services": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadServiceHeld"
+                    }
+                },
+                "total": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.PayloadWebhook": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled_at": {
+                    "type": "string"
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "failures": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "description": "returned only when webhook is created",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadWebhookAttempt": {
+            "type": "object",
+            "properties": {
+                "attempted_at": {
+                    "type": "string"
+                },
+                "duration_ms": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PayloadWebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "event": {
+                    "$ref": "#/definitions/models.PayloadWebhookEvent"
+                },
+                "history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadWebhookAttempt"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadWebhookEvent": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "data": {
+                    "$ref": "#/definitions/models.PayloadWebhookEventData"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PayloadWebhookEventData": {
             "type": "object",
             "properties": {
                 "amount": {
                     "type": "number"
                 },
+                "currency": {
+                    "type": "string"
+                },
                 "order_id": {
                     "type": "integer"
                 },
@@ -562,16 +6801,101 @@ const docTemplate = `{
                 }
             }
         },
-        "models.Reserve": {
+        "models.Period": {
+            "type": "object",
+            "properties": {
+                "closed_at": {
+                    "description": "time when period was closed",
+                    "type": "string"
+                },
+                "month": {
+                    "type": "integer"
+                },
+                "year": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Report": {
+            "type": "object",
+            "properties": {
+                "closing": {
+                    "description": "report was frozen when the period was closed",
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "description": "time when report version was created",
+                    "type": "string"
+                },
+                "diff": {
+                    "description": "changes against the previous version",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ReportDiffLine"
+                    }
+                },
+                "month": {
+                    "type": "integer"
+                },
+                "sha256": {
+                    "description": "hex digest of the csv file",
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                },
+                "year": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ReportDiffLine": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string"
+                },
+                "current": {
+                    "description": "amount of money stored in minor units of currency",
+                    "type": "integer"
+                },
+                "previous": {
+                    "description": "amount of money stored in minor units of currency",
+                    "type": "integer"
+                },
+                "service_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ReserveFloatAmount": {
             "type": "object",
             "properties": {
+                "amendments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PayloadReserveAmendment"
+                    }
+                },
                 "amount": {
                     "description": "amount of money stored in cents",
-                    "type": "integer"
+                    "type": "number"
+                },
+                "currency": {
+                    "description": "ISO 4217 currency code",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "time when not purchased reserve is released",
+                    "type": "string"
                 },
                 "order_id": {
                     "type": "integer"
                 },
+                "price_version": {
+                    "description": "version of service price at the moment of reserve",
+                    "type": "integer"
+                },
                 "purchased": {
                     "description": "purchase status",
                     "type": "boolean"
@@ -580,40 +6904,81 @@ const docTemplate = `{
                     "description": "time when purchase happened, could be nullable",
                     "type": "string"
                 },
+                "released_at": {
+                    "description": "time when reserve was released or expired, could be nullable",
+                    "type": "string"
+                },
                 "reserved_at": {
                     "description": "time when reserve happend",
                     "type": "string"
                 },
                 "service": {
-                    "$ref": "#/definitions/models.Service"
+                    "$ref": "#/definitions/models.PayloadService"
+                },
+                "status": {
+                    "description": "one of reserve statuses",
+                    "type": "string"
                 },
                 "user": {
                     "$ref": "#/definitions/models.User"
                 }
             }
         },
-        "models.Service": {
+        "models.ServiceUpsertResult": {
             "type": "object",
             "properties": {
+                "error": {
+                    "description": "reason of conflict",
+                    "type": "string"
+                },
                 "id": {
                     "type": "integer"
                 },
                 "name": {
                     "type": "string"
+                },
+                "status": {
+                    "description": "one of upsert statuses",
+                    "type": "string"
                 }
             }
         },
         "models.User": {
             "type": "object",
             "properties": {
-                "balance": {
+                "id": {
                     "type": "integer"
                 },
-                "id": {
+                "wallets": {
+                    "description": "balances of user in every currency",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Wallet"
+                    }
+                }
+            }
+        },
+        "models.Wallet": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "description": "amount of money stored in minor units of currency",
                     "type": "integer"
+                },
+                "currency": {
+                    "description": "ISO 4217 currency code",
+                    "type": "string"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "ApiKey": {
+            "description": "API key of client, also accepted as bearer token of Authorization header together with JWT of gateway. Role of key or scopes of token limit routes the caller could call",
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        }
     }
 }`
 
@@ -624,7 +6989,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/api",
 	Schemes:          []string{},
 	Title:            "Balance Microservice",
-	Description:      "This is an auto-generated API Docs for Balance Microservice - a microservice for managing user balances.",
+	Description:      "This is an auto-generated API Docs for Balance Microservice - a microservice for managing user balances. Responses of v2 API are wrapped into {\"data\": ...} on success and {\"error\": {\"message\": ...}} on failure, v1 API is deprecated.",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 }
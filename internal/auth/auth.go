@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"balance/internal/models"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Headers of authenticated requests, key is sent in KeyHeader or as bearer token of authorization header
+const (
+	KeyHeader  = "X-API-Key"
+	BearerType = "Bearer"
+)
+
+// KeyPrefix is beginning of every generated API key
+const KeyPrefix = "bk_"
+
+// prefixLength is length of beginning of key stored to recognize it
+const prefixLength = 10
+
+// NewKey generates random API key and returns it with its prefix and hash
+func NewKey() (key, prefix, hash string, err error) {
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return "", "", "", err
+	}
+	key = KeyPrefix + hex.EncodeToString(random)
+	return key, Prefix(key), Hash(key), nil
+}
+
+// Hash returns hex SHA-256 of key, the key itself is not stored
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Prefix returns beginning of key to recognize it
+func Prefix(key string) string {
+	if len(key) > prefixLength {
+		return key[:prefixLength]
+	}
+	return key
+}
+
+// FromHeaders returns key from value of KeyHeader or bearer token of authorization header
+func FromHeaders(keyHeader, authorization string) string {
+	if keyHeader != "" {
+		return keyHeader
+	}
+	if len(authorization) > len(BearerType) && strings.EqualFold(authorization[:len(BearerType)], BearerType) {
+		return strings.TrimSpace(authorization[len(BearerType):])
+	}
+	return ""
+}
+
+// Scopes of callers, every route and method requires one of them, admin scope includes all scopes
+const (
+	ScopeRead    = "balance:read"    // balances, statements, reserves, orders, services and reports
+	ScopeCredit  = "balance:credit"  // credits and conversions of user money
+	ScopeBilling = "balance:billing" // reserves, purchases, releases, orders and batches
+	ScopeFinance = "balance:finance" // imports, reports, snapshots, periods, rates and reconciliation
+	ScopeAdmin   = "balance:admin"   // users, services, webhooks and keys
+)
+
+// RoleScopes maps roles of API keys to their scopes
+var RoleScopes = map[string][]string{
+	models.RoleReadOnly:      {ScopeRead},
+	models.RoleBillingClient: {ScopeRead, ScopeCredit, ScopeBilling},
+	models.RoleFinance:       {ScopeRead, ScopeCredit, ScopeFinance},
+	models.RoleAdmin:         {ScopeAdmin},
+}
+
+// KeyPrincipal returns caller authenticated by API key with scopes of its role
+func KeyPrincipal(key models.APIKey) models.Principal {
+	return models.Principal{
+		KeyID:    key.ID,
+		Subject:  key.Name,
+		Scopes:   RoleScopes[key.Role],
+		Services: key.Services,
+	}
+}
+
+// HasScope reports whether caller has given scope, caller with admin scope has every scope
+func HasScope(principal models.Principal, scope string) bool {
+	for _, s := range principal.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsService reports whether caller operates on given service, caller without services operates on all services
+func AllowsService(principal models.Principal, serviceId uint64) bool {
+	if len(principal.Services) == 0 {
+		return true
+	}
+	for _, id := range principal.Services {
+		if id == serviceId {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsUser reports whether caller operates on given user, only end-user token is restricted to its user
+func AllowsUser(principal models.Principal, userId uint64) bool {
+	return principal.UserID == 0 || principal.UserID == userId
+}
+
+// CheckRole checks that role is one of roles of API keys
+func CheckRole(role string) bool {
+	for _, r := range models.Roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
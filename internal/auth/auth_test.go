@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"balance/internal/models"
+
+	"strings"
+	"testing"
+)
+
+func TestNewKey(t *testing.T) {
+	key, prefix, hash, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, KeyPrefix) || len(key) != len(KeyPrefix)+64 {
+		t.Errorf("key %q is not %s with 32 random bytes in hex", key, KeyPrefix)
+	}
+	if prefix != key[:prefixLength] {
+		t.Errorf("prefix %q is not beginning of key %q", prefix, key)
+	}
+	if hash != Hash(key) || strings.Contains(hash, key) {
+		t.Errorf("hash %q is not SHA-256 of key", hash)
+	}
+
+	other, _, _, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Error("two generated keys are equal")
+	}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"bk_test", "b9ea9a069e1c3d119069883debdf80af44b84dda0c2311afc2728aea4a9a3a88"},
+	}
+	for _, tt := range tests {
+		if got := Hash(tt.key); got != tt.want {
+			t.Errorf("Hash(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if Hash("bk_a") == Hash("bk_b") {
+		t.Error("different keys have equal hashes")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", ""},
+		{"bk_1", "bk_1"},
+		{"bk_1234567", "bk_1234567"},
+		{"bk_12345678", "bk_1234567"},
+		{"bk_0123456789abcdef", "bk_0123456"},
+	}
+	for _, tt := range tests {
+		if got := Prefix(tt.key); got != tt.want {
+			t.Errorf("Prefix(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFromHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		keyHeader     string
+		authorization string
+		want          string
+	}{
+		{"no credentials", "", "", ""},
+		{"key header", "bk_key", "", "bk_key"},
+		{"bearer token", "", "Bearer bk_token", "bk_token"},
+		{"bearer type is case insensitive", "", "bearer bk_token", "bk_token"},
+		{"spaces around token are trimmed", "", "Bearer   bk_token ", "bk_token"},
+		{"key header wins over bearer token", "bk_key", "Bearer bk_token", "bk_key"},
+		{"basic authorization is ignored", "", "Basic dXNlcjpwYXNz", ""},
+		{"bearer type without token", "", "Bearer", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromHeaders(tt.keyHeader, tt.authorization); got != tt.want {
+				t.Errorf("FromHeaders(%q, %q) = %q, want %q", tt.keyHeader, tt.authorization, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyPrincipalScopes(t *testing.T) {
+	scopes := []string{ScopeRead, ScopeCredit, ScopeBilling, ScopeFinance, ScopeAdmin}
+	tests := []struct {
+		role    string
+		allowed []string
+	}{
+		{models.RoleReadOnly, []string{ScopeRead}},
+		{models.RoleBillingClient, []string{ScopeRead, ScopeCredit, ScopeBilling}},
+		{models.RoleFinance, []string{ScopeRead, ScopeCredit, ScopeFinance}},
+		{models.RoleAdmin, scopes},
+		{"unknown", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			key := models.APIKey{ID: 7, Name: "billing", Role: tt.role, Services: []uint64{1, 2}}
+			p := KeyPrincipal(key)
+			if p.KeyID != key.ID || p.Subject != key.Name || p.UserID != 0 || len(p.Services) != 2 {
+				t.Errorf("KeyPrincipal(%+v) = %+v", key, p)
+			}
+			for _, scope := range scopes {
+				want := false
+				for _, s := range tt.allowed {
+					want = want || s == scope
+				}
+				if got := HasScope(p, scope); got != want {
+					t.Errorf("HasScope(%s, %s) = %v, want %v", tt.role, scope, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEveryRoleHasScopes(t *testing.T) {
+	for _, role := range models.Roles {
+		if len(RoleScopes[role]) == 0 {
+			t.Errorf("role %q has no scopes", role)
+		}
+		if !CheckRole(role) {
+			t.Errorf("CheckRole(%q) = false", role)
+		}
+	}
+	for _, role := range []string{"", "root", "Admin"} {
+		if CheckRole(role) {
+			t.Errorf("CheckRole(%q) = true", role)
+		}
+	}
+}
+
+func TestAllowsService(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []uint64
+		service  uint64
+		want     bool
+	}{
+		{"caller without services operates on any service", nil, 5, true},
+		{"caller without services operates on no service", nil, 0, true},
+		{"own service", []uint64{1, 5}, 5, true},
+		{"other service", []uint64{1, 5}, 3, false},
+		{"no service", []uint64{1, 5}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AllowsService(models.Principal{Services: tt.services}, tt.service); got != tt.want {
+				t.Errorf("AllowsService(%v, %d) = %v, want %v", tt.services, tt.service, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowsUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal models.Principal
+		user      uint64
+		want      bool
+	}{
+		{"API key operates on any user", models.Principal{KeyID: 1}, 42, true},
+		{"service token operates on any user", models.Principal{Subject: "billing"}, 42, true},
+		{"end-user token operates on its user", models.Principal{UserID: 42}, 42, true},
+		{"end-user token does not operate on other user", models.Principal{UserID: 42}, 43, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AllowsUser(tt.principal, tt.user); got != tt.want {
+				t.Errorf("AllowsUser(%+v, %d) = %v, want %v", tt.principal, tt.user, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"balance/internal/models"
+
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	// JWTLeeway is tolerance of clock skew between issuer of tokens and the service
+	JWTLeeway = 30 * time.Second
+	// DefaultJWKSRefresh is interval of reloading JWKS if it is not configured
+	DefaultJWKSRefresh = 10 * time.Minute
+	// jwksReloadInterval is the shortest interval of reloading JWKS on token signed by unknown key
+	jwksReloadInterval = time.Minute
+	// jwksTimeout is timeout of loading JWKS by URL
+	jwksTimeout = 10 * time.Second
+)
+
+// jwtMethods are asymmetric algorithms of accepted tokens, tokens signed with shared secret or not signed are rejected
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JWTConfig configures validation of bearer tokens
+type JWTConfig struct {
+	JWKS      string        // path or http(s) URL of JWKS with public keys of issuer
+	Issuer    string        // required iss claim
+	Audience  string        // required value of aud claim
+	Refresh   time.Duration // interval of reloading JWKS
+	UserClaim string        // claim with user id of end-user tokens, empty disables restriction of tokens to users
+}
+
+// JWTValidator validates bearer tokens signed by keys of JWKS loaded from file or URL and reloaded periodically
+type JWTValidator struct {
+	config JWTConfig
+	client *http.Client
+
+	mu       sync.RWMutex
+	keys     map[string]interface{} // public keys by key id
+	loadedAt time.Time
+	reload   sync.Mutex // held while JWKS is reloaded on unknown key
+}
+
+// jwk is public key of JWKS, RSA keys have n and e, EC keys have crv, x and y
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWTValidator creates validator and loads JWKS, issuer and audience must be configured
+func NewJWTValidator(config JWTConfig) (*JWTValidator, error) {
+	if config.JWKS == "" || config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("auth: jwt: JWKS, issuer and audience must be configured")
+	}
+	if config.Refresh <= 0 {
+		config.Refresh = DefaultJWKSRefresh
+	}
+	v := &JWTValidator{config: config, client: &http.Client{Timeout: jwksTimeout}}
+	if err := v.Load(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Start reloads JWKS every refresh interval until context is done, failed reload keeps the loaded keys
+func (v *JWTValidator) Start(ctx context.Context, logger *zap.Logger) {
+	go func() {
+		ticker := time.NewTicker(v.config.Refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := v.Load(); err != nil {
+					logger.Error("auth: jwt: reload of JWKS failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Load reads JWKS from file or URL and replaces keys of validator
+func (v *JWTValidator) Load() error {
+	var data []byte
+	var err error
+	if strings.HasPrefix(v.config.JWKS, "http://") || strings.HasPrefix(v.config.JWKS, "https://") {
+		data, err = v.fetch(v.config.JWKS)
+	} else {
+		data, err = os.ReadFile(v.config.JWKS)
+	}
+	if err != nil {
+		return fmt.Errorf("auth: jwt: load JWKS: %v", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("auth: jwt: parse JWKS: %v", err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("auth: jwt: parse JWKS: key %q: %v", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("auth: jwt: parse JWKS: no signing keys")
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.loadedAt = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+// fetch gets JWKS by URL
+func (v *JWTValidator) fetch(url string) ([]byte, error) {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// key returns public key by key id, JWKS is reloaded at most once a minute if the key is unknown,
+// so keys rotated by issuer are taken before the next refresh
+func (v *JWTValidator) key(kid string) (interface{}, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.loadedAt) > jwksReloadInterval
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	// concurrent tokens with unknown key reload JWKS once
+	v.reload.Lock()
+	defer v.reload.Unlock()
+	v.mu.RLock()
+	stale = time.Since(v.loadedAt) > jwksReloadInterval
+	v.mu.RUnlock()
+	if stale {
+		if err := v.Load(); err != nil {
+			return nil, err
+		}
+	}
+	v.mu.RLock()
+	key, ok = v.keys[kid]
+	v.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// Validate checks signature, issuer, audience, expiry and not before time of token
+// and returns its caller with scopes of the token. Token with user claim is restricted to its user
+func (v *JWTValidator) Validate(token string) (models.Principal, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(jwtMethods), jwt.WithJSONNumber(), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(kid)
+	})
+	if err != nil {
+		return models.Principal{}, fmt.Errorf("auth: jwt: %v", err)
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyIssuer(v.config.Issuer, true):
+		err = errors.New("auth: jwt: wrong issuer")
+	case !claims.VerifyAudience(v.config.Audience, true):
+		err = errors.New("auth: jwt: wrong audience")
+	case !claims.VerifyExpiresAt(now.Add(-JWTLeeway).Unix(), true):
+		err = errors.New("auth: jwt: token has expired or has no expiry time")
+	case !claims.VerifyNotBefore(now.Add(JWTLeeway).Unix(), false):
+		err = errors.New("auth: jwt: token is not valid yet")
+	}
+	if err != nil {
+		return models.Principal{}, err
+	}
+
+	principal := models.Principal{Scopes: tokenScopes(claims)}
+	principal.Subject, _ = claims["sub"].(string)
+	if v.config.UserClaim != "" {
+		if value, ok := claims[v.config.UserClaim]; ok {
+			if principal.UserID, err = claimUserID(value); err != nil {
+				return models.Principal{}, fmt.Errorf("auth: jwt: %s claim: %v", v.config.UserClaim, err)
+			}
+		}
+	}
+	return principal, nil
+}
+
+// tokenScopes returns scopes of space separated scope claim or scp array claim
+func tokenScopes(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	scopes := make([]string, 0)
+	if scp, ok := claims["scp"].([]interface{}); ok {
+		for _, s := range scp {
+			if scope, ok := s.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// claimUserID parses user id of number or string claim
+func claimUserID(value interface{}) (uint64, error) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return 0, errors.New("user id must be number or string")
+	}
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("wrong user id %q", s)
+	}
+	return id, nil
+}
+
+// IsJWT reports whether bearer token looks like JWT rather than API key
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+// publicKey converts JWK to RSA or ECDSA public key
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("wrong exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// decodeBigInt decodes base64url encoded unsigned big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("wrong base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testIssuer   = "https://issuer.test"
+	testAudience = "balance"
+)
+
+// testJWKS writes JWKS with public keys by key id to temporary file and returns its path
+func testJWKS(t *testing.T, path string, keys map[string]interface{}) string {
+	t.Helper()
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kid: kid, Kty: "RSA", Use: "sig", N: encode(k.N), E: encode(big.NewInt(int64(k.E)))})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kid: kid, Kty: "EC", Crv: "P-256", X: encode(k.X), Y: encode(k.Y)})
+		}
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "jwks.json")
+	}
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testToken signs claims by key with given key id
+func testToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// testClaims returns valid claims with given changes, nil value removes claim
+func testClaims(changes jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "billing-service",
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"scope": ScopeRead + " " + ScopeBilling,
+	}
+	for k, v := range changes {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	return claims
+}
+
+func TestJWTValidate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTValidator(JWTConfig{
+		JWKS:      testJWKS(t, "", map[string]interface{}{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}),
+		Issuer:    testIssuer,
+		Audience:  testAudience,
+		UserClaim: "user_id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		token     string
+		wantErr   string
+		wantUser  uint64
+		wantScope []string
+	}{
+		{"valid token", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(nil)),
+			"", 0, []string{ScopeRead, ScopeBilling}},
+		{"EC key", testToken(t, jwt.SigningMethodES256, "ec", ecKey, testClaims(nil)),
+			"", 0, []string{ScopeRead, ScopeBilling}},
+		{"audience in list", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"aud": []string{"other", testAudience}})),
+			"", 0, []string{ScopeRead, ScopeBilling}},
+		{"scp claim", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"scope": nil, "scp": []string{ScopeFinance}})),
+			"", 0, []string{ScopeFinance}},
+		{"no scopes", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"scope": nil})),
+			"", 0, []string{}},
+		{"wrong audience", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"aud": "other"})),
+			"wrong audience", 0, nil},
+		{"no audience", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"aud": nil})),
+			"wrong audience", 0, nil},
+		{"wrong issuer", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"iss": "https://other.test"})),
+			"wrong issuer", 0, nil},
+		{"expired", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})),
+			"expired", 0, nil},
+		{"expired within leeway", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"exp": now.Add(-JWTLeeway / 2).Unix()})),
+			"", 0, []string{ScopeRead, ScopeBilling}},
+		{"no expiry", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"exp": nil})),
+			"expired or has no expiry", 0, nil},
+		{"not valid yet", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})),
+			"not valid yet", 0, nil},
+		{"not valid yet within leeway", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"nbf": now.Add(JWTLeeway / 2).Unix()})),
+			"", 0, []string{ScopeRead, ScopeBilling}},
+		{"unknown key id", testToken(t, jwt.SigningMethodRS256, "other", otherKey, testClaims(nil)),
+			"unknown key", 0, nil},
+		{"key id of other key", testToken(t, jwt.SigningMethodRS256, "rsa", otherKey, testClaims(nil)),
+			"verification error", 0, nil},
+		{"no key id", testToken(t, jwt.SigningMethodRS256, "", rsaKey, testClaims(nil)),
+			"unknown key", 0, nil},
+		{"shared secret", testToken(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), testClaims(nil)),
+			"signing method HS256 is invalid", 0, nil},
+		{"not signed", testToken(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, testClaims(nil)),
+			"signing method none is invalid", 0, nil},
+		{"end-user token with number claim", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"user_id": 42})),
+			"", 42, []string{ScopeRead, ScopeBilling}},
+		{"end-user token with string claim", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"user_id": "42"})),
+			"", 42, []string{ScopeRead, ScopeBilling}},
+		{"wrong user claim", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"user_id": "alice"})),
+			"user_id claim", 0, nil},
+		{"zero user claim", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"user_id": 0})),
+			"user_id claim", 0, nil},
+		{"user claim of wrong type", testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims(jwt.MapClaims{"user_id": true})),
+			"user_id claim", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Validate(tt.token)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.KeyID != 0 || p.Subject != "billing-service" || p.UserID != tt.wantUser {
+				t.Errorf("principal = %+v, want subject billing-service and user %d", p, tt.wantUser)
+			}
+			if strings.Join(p.Scopes, " ") != strings.Join(tt.wantScope, " ") {
+				t.Errorf("scopes = %v, want %v", p.Scopes, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestJWTValidateWithoutUserClaim(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTValidator(JWTConfig{
+		JWKS:     testJWKS(t, "", map[string]interface{}{"rsa": &key.PublicKey}),
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := v.Validate(testToken(t, jwt.SigningMethodRS256, "rsa", key, testClaims(jwt.MapClaims{"user_id": 42})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.UserID != 0 {
+		t.Errorf("token is restricted to user %d though user claim is not configured", p.UserID)
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := testJWKS(t, "", map[string]interface{}{"old": &oldKey.PublicKey})
+	v, err := NewJWTValidator(JWTConfig{JWKS: path, Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// issuer publishes the new key and drops the old one
+	testJWKS(t, path, map[string]interface{}{"new": &newKey.PublicKey})
+	newToken := testToken(t, jwt.SigningMethodRS256, "new", newKey, testClaims(nil))
+	oldToken := testToken(t, jwt.SigningMethodRS256, "old", oldKey, testClaims(nil))
+
+	// JWKS was loaded just now, unknown key does not reload it
+	if _, err = v.Validate(newToken); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Fatalf("token of new key is accepted before reload: %v", err)
+	}
+	if _, err = v.Validate(oldToken); err != nil {
+		t.Fatalf("token of old key is rejected before reload: %v", err)
+	}
+
+	// unknown key reloads JWKS loaded long enough ago
+	v.mu.Lock()
+	v.loadedAt = time.Now().Add(-2 * jwksReloadInterval)
+	v.mu.Unlock()
+	if _, err = v.Validate(newToken); err != nil {
+		t.Fatalf("token of new key is rejected after reload: %v", err)
+	}
+	if _, err = v.Validate(oldToken); err == nil {
+		t.Fatal("token of dropped key is accepted after reload")
+	}
+}
+
+func TestNewJWTValidator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := testJWKS(t, "", map[string]interface{}{"rsa": &key.PublicKey})
+	empty := filepath.Join(t.TempDir(), "empty.json")
+	if err = os.WriteFile(empty, []byte(`{"keys":[{"kid":"enc","kty":"RSA","use":"enc","n":"AQAB","e":"AQAB"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  JWTConfig
+		wantErr bool
+	}{
+		{"configured", JWTConfig{JWKS: jwks, Issuer: testIssuer, Audience: testAudience}, false},
+		{"no issuer", JWTConfig{JWKS: jwks, Audience: testAudience}, true},
+		{"no audience", JWTConfig{JWKS: jwks, Issuer: testIssuer}, true},
+		{"no JWKS", JWTConfig{Issuer: testIssuer, Audience: testAudience}, true},
+		{"missing JWKS file", JWTConfig{JWKS: filepath.Join(t.TempDir(), "missing.json"), Issuer: testIssuer, Audience: testAudience}, true},
+		{"JWKS without signing keys", JWTConfig{JWKS: empty, Issuer: testIssuer, Audience: testAudience}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewJWTValidator(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && v.config.Refresh != DefaultJWKSRefresh {
+				t.Errorf("refresh = %v, want default %v", v.config.Refresh, DefaultJWKSRefresh)
+			}
+		})
+	}
+}
+
+func TestIsJWT(t *testing.T) {
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ4In0.c2ln", true},
+		{"bk_0123456789abcdef", false},
+		{"eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ4In0", false},
+		{"abc.def.ghi", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsJWT(tt.token); got != tt.want {
+			t.Errorf("IsJWT(%q) = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of signed requests, signature is sent as sha256=<hex HMAC-SHA256>
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+	SignaturePrefix          = "sha256="
+)
+
+const (
+	// SignatureTolerance is the maximum difference between timestamp of signed request and time of the service
+	SignatureTolerance = 5 * time.Minute
+	// NonceRetention is time nonces are kept before cleanup, older requests are rejected by timestamp anyway
+	NonceRetention = 2 * SignatureTolerance
+	// MaxNonce is the maximum length of nonce of signed request
+	MaxNonce = 64
+)
+
+// NewSigningSecret generates random secret of signatures
+func NewSigningSecret() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return "bs_" + hex.EncodeToString(random), nil
+}
+
+// Sign returns hex HMAC-SHA256 by secret of method, path with query, unix timestamp, nonce and body of request
+// joined by new lines
+func Sign(secret, method, path string, timestamp int64, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.ToUpper(method) + "\n" + path + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedRequest is request to verify against signing secrets
+type SignedRequest struct {
+	Method    string
+	Path      string // path with query as sent by client
+	Timestamp string // unix seconds
+	Nonce     string
+	Signature string
+	Body      []byte
+}
+
+// Verify checks timestamp of request against given time with SignatureTolerance and its signature against
+// every given secret, so request signed by the old secret is accepted during rotation. Nonce is not checked for replay
+func (r SignedRequest) Verify(secrets []string, now time.Time) error {
+	if r.Signature == "" || r.Timestamp == "" || r.Nonce == "" {
+		return fmt.Errorf("auth: signature: %s, %s and %s headers are required", SignatureHeader, SignatureTimestampHeader, SignatureNonceHeader)
+	}
+	if len(r.Nonce) > MaxNonce {
+		return fmt.Errorf("auth: signature: nonce is longer than %d characters", MaxNonce)
+	}
+	timestamp, err := strconv.ParseInt(r.Timestamp, 10, 64)
+	if err != nil {
+		return errors.New("auth: signature: timestamp must be unix time in seconds")
+	}
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > SignatureTolerance || skew < -SignatureTolerance {
+		return fmt.Errorf("auth: signature: timestamp differs from time of the service by more than %v", SignatureTolerance)
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Signature, SignaturePrefix))
+	if err != nil {
+		return errors.New("auth: signature: signature must be sha256=<hex HMAC-SHA256>")
+	}
+	for _, secret := range secrets {
+		expected, _ := hex.DecodeString(Sign(secret, r.Method, r.Path, timestamp, r.Nonce, r.Body))
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return errors.New("auth: signature: signature does not match")
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSigningSecret(t *testing.T) {
+	secret, err := NewSigningSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, "bs_") || len(secret) != len("bs_")+64 {
+		t.Errorf("secret %q is not bs_ with 32 random bytes in hex", secret)
+	}
+	other, err := NewSigningSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == secret {
+		t.Error("two generated secrets are equal")
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		timestamp int64
+		nonce     string
+		body      string
+		want      string
+	}{
+		{"request with query and body", "POST", "/api/v2/users/42/balance?currency=RUB", 1700000000, "n-1", `{"amount":"10.00"}`,
+			"4bc6e42bf38579c95d5e862f628469a67ab2507737204ef792efa3a5dde465f0"},
+		{"method is upper-cased", "post", "/api/v2/users/42/balance?currency=RUB", 1700000000, "n-1", `{"amount":"10.00"}`,
+			"4bc6e42bf38579c95d5e862f628469a67ab2507737204ef792efa3a5dde465f0"},
+		{"request without body", "GET", "/", 0, "n", "",
+			"8527d80fd4cceb9ed24ff18709708677cd86ceb1229b21775df5737aed3d194b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign("bs_secret", tt.method, tt.path, tt.timestamp, tt.nonce, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignCanonicalisation(t *testing.T) {
+	base := Sign("bs_secret", "POST", "/api/orders?id=1", 1700000000, "n-1", []byte(`{"a":1}`))
+	// every part of request is signed and parts are separated, so moving bytes between them changes signature
+	tests := []struct {
+		name      string
+		secret    string
+		method    string
+		path      string
+		timestamp int64
+		nonce     string
+		body      string
+	}{
+		{"other secret", "bs_other", "POST", "/api/orders?id=1", 1700000000, "n-1", `{"a":1}`},
+		{"other method", "bs_secret", "PUT", "/api/orders?id=1", 1700000000, "n-1", `{"a":1}`},
+		{"other path", "bs_secret", "POST", "/api/orders?id=2", 1700000000, "n-1", `{"a":1}`},
+		{"path without query", "bs_secret", "POST", "/api/orders", 1700000000, "n-1", `{"a":1}`},
+		{"other timestamp", "bs_secret", "POST", "/api/orders?id=1", 1700000001, "n-1", `{"a":1}`},
+		{"other nonce", "bs_secret", "POST", "/api/orders?id=1", 1700000000, "n-2", `{"a":1}`},
+		{"other body", "bs_secret", "POST", "/api/orders?id=1", 1700000000, "n-1", `{"a":2}`},
+		{"nonce moved into body", "bs_secret", "POST", "/api/orders?id=1", 1700000000, "n-", "1\n" + `{"a":1}`},
+		{"path moved into nonce", "bs_secret", "POST", "/api/orders?id=", 1700000000, "1\n1700000000\nn-1", `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if Sign(tt.secret, tt.method, tt.path, tt.timestamp, tt.nonce, []byte(tt.body)) == base {
+				t.Error("signature of changed request is equal to signature of original one")
+			}
+		})
+	}
+}
+
+func TestSignedRequestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"amount":"10.00"}`)
+	signed := func(secret string, timestamp time.Time, nonce string) SignedRequest {
+		return SignedRequest{
+			Method:    "POST",
+			Path:      "/api/v2/users/42/balance",
+			Timestamp: strconv.FormatInt(timestamp.Unix(), 10),
+			Nonce:     nonce,
+			Signature: SignaturePrefix + Sign(secret, "POST", "/api/v2/users/42/balance", timestamp.Unix(), nonce, body),
+			Body:      body,
+		}
+	}
+	change := func(r SignedRequest, f func(r *SignedRequest)) SignedRequest {
+		f(&r)
+		return r
+	}
+	secrets := []string{"bs_old", "bs_new"}
+
+	tests := []struct {
+		name    string
+		request SignedRequest
+		wantErr string
+	}{
+		{"signed by new secret", signed("bs_new", now, "n-1"), ""},
+		{"signed by old secret during rotation", signed("bs_old", now, "n-1"), ""},
+		{"signature without prefix", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Signature = strings.TrimPrefix(r.Signature, SignaturePrefix)
+		}), ""},
+		{"upper-case hex", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Signature = SignaturePrefix + strings.ToUpper(strings.TrimPrefix(r.Signature, SignaturePrefix))
+		}), ""},
+		{"timestamp in the past within tolerance", signed("bs_new", now.Add(-SignatureTolerance), "n-1"), ""},
+		{"timestamp in the future within tolerance", signed("bs_new", now.Add(SignatureTolerance), "n-1"), ""},
+		{"timestamp too old", signed("bs_new", now.Add(-SignatureTolerance-time.Second), "n-1"), "differs from time"},
+		{"timestamp too far in the future", signed("bs_new", now.Add(SignatureTolerance+time.Second), "n-1"), "differs from time"},
+		{"timestamp in milliseconds", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Timestamp = strconv.FormatInt(now.UnixMilli(), 10)
+		}), "differs from time"},
+		{"timestamp is not a number", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Timestamp = now.Format(time.RFC3339)
+		}), "unix time"},
+		{"signed by other secret", signed("bs_other", now, "n-1"), "does not match"},
+		{"body tampered", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Body = []byte(`{"amount":"1000.00"}`)
+		}), "does not match"},
+		{"path tampered", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Path = "/api/v2/users/43/balance"
+		}), "does not match"},
+		{"method tampered", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Method = "PATCH"
+		}), "does not match"},
+		{"nonce tampered", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Nonce = "n-2"
+		}), "does not match"},
+		{"signature is not hex", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Signature = SignaturePrefix + "not-hex"
+		}), "must be sha256="},
+		{"no signature", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Signature = ""
+		}), "headers are required"},
+		{"no timestamp", change(signed("bs_new", now, "n-1"), func(r *SignedRequest) {
+			r.Timestamp = ""
+		}), "headers are required"},
+		{"no nonce", signed("bs_new", now, ""), "headers are required"},
+		{"nonce of maximum length", signed("bs_new", now, strings.Repeat("n", MaxNonce)), ""},
+		{"nonce too long", signed("bs_new", now, strings.Repeat("n", MaxNonce+1)), "longer than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.request.Verify(secrets, now)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Verify() = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Verify() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := signed("bs_new", now, "n-1").Verify(nil, now); err == nil {
+		t.Error("request is verified without secrets")
+	}
+}
@@ -1,17 +1,80 @@
 package databases
 
-import "balance/internal/models"
+import (
+	"balance/internal/models"
+
+	"context"
+	"time"
+)
 
 type DBInt interface {
-	GetBalance(id uint64) (int64, error)
-	AddBalance(id uint64, amount int64) error
+	GetBalance(id uint64, currency string) (int64, error)
+	GetBalances(id uint64) ([]models.Wallet, error)
+	GetBalanceDetails(id uint64, byService bool) ([]models.Balance, error)
+	GetBalanceAt(userId uint64, at time.Time) (models.BalanceAt, error)
+	GetEndOfDayBalances(userIds []uint64, day time.Time) ([]models.BalanceAt, error)
+	CreateSnapshot(day time.Time) (models.Snapshot, error)
+	GetLiabilities(from, to time.Time) (models.LiabilitiesReport, error)
+	AddBalance(id uint64, amount int64, currency string) error
 	DeleteUser(id uint64) error
-	Reserve(userId, serviceId, orderId uint64, amount int64) error
+	Reserve(userId, serviceId, orderId uint64, amount int64, currency string) (models.Reserve, error)
 	GetReserve(userId, serviceId, orderId uint64) (models.Reserve, error)
+	GetReserves(filter models.ReservesFilter) ([]models.Reserve, *models.ReserveCursor, error)
 	DeleteReserve(userId, serviceId, orderId uint64, amount int64) error
-	Purchase(userId, serviceId, orderId uint64, amount int64) error
-	AddServices(services []models.Service) error
+	AmendReserve(userId, serviceId, orderId uint64, amount int64, extend time.Duration) (models.Reserve, error)
+	GetOutstandingReserves(userId, serviceId uint64) (models.ReservesAging, error)
+	ReserveOrder(userId, orderId uint64, currency string, items []models.OrderItem) (models.Order, error)
+	GetOrder(userId, orderId uint64) (models.Order, error)
+	PurchaseOrder(userId, orderId uint64, lines []int) (models.Order, error)
+	ReleaseOrder(userId, orderId uint64) error
+	Purchase(userId, serviceId, orderId uint64, amount int64, currency string) error
+	UpsertServices(services []models.Service) ([]models.ServiceUpsertResult, error)
+	GetServices(filter models.ServicesFilter) ([]models.Service, int64, error)
 	GetService(id uint64) (models.Service, error)
-	DeleteService(id uint64) error
-	CreateReport(year, month int) (string, error)
+	UpdateService(update models.ServiceUpdate) (models.Service, error)
+	GetServicePrices(id uint64) ([]models.ServicePrice, error)
+	DeactivateService(id uint64) error
+	CreateReport(year, month int) (models.Report, error)
+	GetReports(year, month int) ([]models.Report, error)
+	ClosePeriod(year, month int) (models.Report, error)
+	GetClosedPeriods() ([]models.Period, error)
+	GetStatement(userId uint64, currency string, from, to time.Time) (models.Statement, error)
+	Reconcile() (models.Reconciliation, error)
+	CorrectBalances(mismatches []models.BalanceMismatch) error
+	GetUserAccounts(userId uint64) ([]models.Account, error)
+	AddExchangeRates(rates []models.ExchangeRate) error
+	GetExchangeRate(base, quote string, at time.Time) (models.ExchangeRate, error)
+	Convert(userId uint64, from, to string, amount int64) (models.Conversion, error)
+	GetRestatedReport(year, month int, currency string) (models.RestatedReport, error)
+	CreateWebhook(webhook models.Webhook) (models.Webhook, error)
+	GetWebhooks() ([]models.Webhook, error)
+	UpdateWebhook(update models.WebhookUpdate) (models.Webhook, error)
+	DeleteWebhook(id uint64) error
+	GetWebhookDeliveries(webhookId uint64, limit int) ([]models.WebhookDelivery, error)
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(attempt models.WebhookAttempt, retryAt *time.Time, disableAfter int) error
+	RelayOutbox(limit int, publish func(message models.OutboxMessage) error) (int, error)
+	GetStreamStart(userId uint64) ([]models.Balance, uint64, error)
+	GetUserEvents(userId uint64, afterId uint64, limit int) ([]models.UserEvent, error)
+	ListenUserEvents(ctx context.Context, started func(), notify func(userId uint64)) error
+	Batch(operations []models.BatchOperation, atomic bool) ([]models.BatchResult, error)
+	CreateImport(imp models.Import, next func() (models.ImportRow, error)) (models.Import, error)
+	GetImport(id uint64) (models.Import, error)
+	GetImportRows(id uint64) ([]models.ImportRow, error)
+	ApplyImport(id uint64) (models.Import, error)
+	CreateAPIKey(key models.APIKey) (models.APIKey, error)
+	EnsureAPIKey(key models.APIKey) error
+	CreateFirstAPIKey(key models.APIKey) (bool, error)
+	GetAPIKeys() ([]models.APIKey, error)
+	GetActiveAPIKey(hash string) (models.APIKey, error)
+	RotateAPIKey(id uint64, prefix, hash string, grace time.Duration) (models.APIKey, error)
+	RevokeAPIKey(id uint64) error
+	CreateSigningSecret(apiKeyId uint64, secret string, grace time.Duration) (models.SigningSecret, error)
+	GetSigningSecrets(apiKeyId uint64) ([]models.SigningSecret, error)
+	GetActiveSigningSecrets(apiKeyId uint64) ([]models.SigningSecret, error)
+	RevokeSigningSecret(apiKeyId, id uint64) error
+	UseSignatureNonce(apiKeyId uint64, nonce string) error
+	DeleteSignatureNonces(before time.Time) (int64, error)
+	WithActor(apiKeyId uint64) DBInt
+	WithContext(ctx context.Context) DBInt
 }
@@ -0,0 +1,71 @@
+package databases
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Codes of errors returned by database layer
+const (
+	CodeNotFound           = "NOT_FOUND"
+	CodeFailedPrecondition = "FAILED_PRECONDITION"
+	CodeInvalidArgument    = "INVALID_ARGUMENT"
+	CodeAlreadyExists      = "ALREADY_EXISTS"
+	CodeAborted            = "ABORTED" // transaction conflicted with concurrent one, operation could be retried
+	CodeInternal           = "INTERNAL"
+)
+
+// Kinds of domain errors returned by database layer, every domain error wraps one of them
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrPeriodClosed       = errors.New("accounting period is closed")
+	ErrFailedPrecondition = errors.New("failed precondition") // state of entity does not allow the operation
+	ErrInvalidArgument    = errors.New("invalid argument")
+)
+
+// domainError is domain error with its own message wrapping its kind
+type domainError struct {
+	kind    error
+	message string
+}
+
+func (e *domainError) Error() string {
+	return e.message
+}
+
+func (e *domainError) Unwrap() error {
+	return e.kind
+}
+
+// newError returns domain error of given kind with formatted message, the kind is not a part of the message
+func newError(kind error, format string, args ...interface{}) error {
+	return &domainError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorCode returns code of error returned by database layer
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, pgx.ErrNoRows):
+		return CodeNotFound
+	case errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrPeriodClosed), errors.Is(err, ErrFailedPrecondition):
+		return CodeFailedPrecondition
+	case errors.Is(err, ErrInvalidArgument):
+		return CodeInvalidArgument
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return CodeAlreadyExists
+		case "40001", "40P01", "55P03": // serialization_failure, deadlock_detected, lock_not_available
+			return CodeAborted
+		}
+	}
+	// errors of driver and connection are not domain errors
+	return CodeInternal
+}
@@ -1,6 +1,11 @@
 package databases
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
@@ -8,6 +13,8 @@ import (
 type PgxDB struct {
 	*pgxpool.Pool
 	Logger pgx.Logger
+	Actor  uint64          // id of API key acting in transactions, zero for the service itself
+	Ctx    context.Context // context of call, its cancellation cancels running statements and rolls back transactions
 }
 
 func NewPgxDB(pool *pgxpool.Pool, logger pgx.Logger) *PgxDB {
@@ -16,3 +23,48 @@ func NewPgxDB(pool *pgxpool.Pool, logger pgx.Logger) *PgxDB {
 		Logger: logger,
 	}
 }
+
+// WithActor returns database whose transactions record given API key on rows of operations, reserves and journal entries
+func (p PgxDB) WithActor(apiKeyId uint64) DBInt {
+	p.Actor = apiKeyId
+	return p
+}
+
+// WithContext returns database whose statements are bound to given context, so operation of call which has timed out
+// is cancelled and rolled back instead of being completed after the caller has got the error
+func (p PgxDB) WithContext(ctx context.Context) DBInt {
+	p.Ctx = ctx
+	return p
+}
+
+// callContext returns context of call, background one if database is not bound to call
+func (p PgxDB) callContext() context.Context {
+	if p.Ctx == nil {
+		return context.Background()
+	}
+	return p.Ctx
+}
+
+// BeginTx starts transaction with acting API key in balance.api_key_id setting,
+// the setting is the default of api_key_id columns and is reset when transaction ends
+func (p PgxDB) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	tx, err := p.Pool.BeginTx(ctx, txOptions)
+	if err != nil || p.Actor == 0 {
+		return tx, err
+	}
+	if _, err = tx.Exec(ctx, "select set_config('balance.api_key_id', $1, true)", strconv.FormatUint(p.Actor, 10)); err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// DSNFromEnv returns PostgreSQL connection string built from DB_* environment variables
+func DSNFromEnv() string {
+	return fmt.Sprintf("host=%v user=%v password=%v dbname=%v port=%v sslmode=disable",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_DATABASE"),
+		os.Getenv("DB_PORT"))
+}
@@ -0,0 +1,216 @@
+package databases
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// AmendReserve changes amount and extends expiry time of not purchased reserve by given userId, serviceId and orderId.
+// Zero amount means the reserved amount is kept, amount of order with multiple line items cannot be changed.
+//
+// 1) checks if reserve exists, is open and has not expired
+//
+// 2) checks new amount against bounds of price version the reserve was made with
+//
+// 3) for increase checks user balance and subtracts the difference, for decrease returns the difference to user
+//
+// 4) moves the difference between user's wallet and hold account in ledger unless accounting period is closed
+//
+// 5) updates the reserve and writes the change into reserve_amendments table
+func (p PgxDB) AmendReserve(userId, serviceId, orderId uint64, amount int64, extend time.Duration) (models.Reserve, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: amend reserve: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Reserve{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+
+	// get the reserve and check it could be amended
+	var reserve models.Reserve
+	var expired bool
+	err = tx.QueryRow(ctx, "select "+reserveColumns+", expires_at <= $4::timestamp from reserves where order_id = $1 and user_id = $3 and "+reserveHasService,
+		orderId, serviceId, userId, date).Scan(&reserve.OrderID, &reserve.UserID, &reserve.ServiceID, &reserve.Amount, &reserve.Currency,
+		&reserve.Purchased, &reserve.ReservedAt, &reserve.PurchasedAt, &reserve.PriceVersion, &reserve.ExpiresAt, &reserve.Status, &reserve.ReleasedAt, &expired)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: amend reserve: money were not reserved for order %d", orderId)
+		return models.Reserve{}, err
+	} else if err != nil {
+		return models.Reserve{}, err
+	} else if reserve.Status != models.ReserveOpen {
+		err = newError(ErrFailedPrecondition, "db: amend reserve: reserve of order %d is %s", orderId, reserve.Status)
+		return models.Reserve{}, err
+	} else if expired {
+		err = newError(ErrFailedPrecondition, "db: amend reserve: reserve of order %d has expired", orderId)
+		return models.Reserve{}, err
+	}
+
+	if amount == 0 {
+		amount = reserve.Amount
+	} else if amount < 0 {
+		err = newError(ErrInvalidArgument, "db: amend reserve: amount must be positive")
+		return models.Reserve{}, err
+	} else if reserve.ServiceID == 0 && amount != reserve.Amount {
+		err = newError(ErrInvalidArgument, "db: amend reserve: amount of order %d is defined by its line items and cannot be changed", orderId)
+		return models.Reserve{}, err
+	}
+	if extend < 0 {
+		err = newError(ErrInvalidArgument, "db: amend reserve: extension of expiry time must not be negative")
+		return models.Reserve{}, err
+	} else if amount == reserve.Amount && extend == 0 {
+		err = newError(ErrInvalidArgument, "db: amend reserve: nothing to amend in reserve of order %d", orderId)
+		return models.Reserve{}, err
+	}
+
+	// new amount must be within bounds of the price the reserve was made with
+	if amount != reserve.Amount {
+		var price models.ServicePrice
+		err = tx.QueryRow(ctx, "select min_amount, max_amount from service_prices where service_id = $1 and version = $2",
+			reserve.ServiceID, reserve.PriceVersion).Scan(&price.MinAmount, &price.MaxAmount)
+		if err != nil {
+			return models.Reserve{}, err
+		}
+		if price.MinAmount != nil && amount < *price.MinAmount {
+			err = newError(ErrInvalidArgument, "db: amend reserve: amount %s %s is less than minimum amount %s %s of service %d", utils.FormatMoney(amount, reserve.Currency), reserve.Currency,
+				utils.FormatMoney(*price.MinAmount, reserve.Currency), reserve.Currency, reserve.ServiceID)
+			return models.Reserve{}, err
+		} else if price.MaxAmount != nil && amount > *price.MaxAmount {
+			err = newError(ErrInvalidArgument, "db: amend reserve: amount %s %s is greater than maximum amount %s %s of service %d", utils.FormatMoney(amount, reserve.Currency), reserve.Currency,
+				utils.FormatMoney(*price.MaxAmount, reserve.Currency), reserve.Currency, reserve.ServiceID)
+			return models.Reserve{}, err
+		}
+	}
+
+	// hold the difference or return it to user
+	delta := amount - reserve.Amount
+	if delta > 0 {
+		var balance int64
+		err = tx.QueryRow(ctx, "select coalesce(sum(balance), 0) from wallets where user_id = $1 and currency = $2",
+			userId, reserve.Currency).Scan(&balance)
+		if err != nil {
+			return models.Reserve{}, err
+		} else if delta > balance {
+			err = newError(ErrInsufficientFunds, "db: amend reserve: the user %d doesn't have enough money, needed: %s %s, user has: %s %s", userId,
+				utils.FormatMoney(delta, reserve.Currency), reserve.Currency, utils.FormatMoney(balance, reserve.Currency), reserve.Currency)
+			return models.Reserve{}, err
+		}
+	}
+	if delta != 0 {
+		// money cannot be moved in closed accounting period, extension of expiry time is allowed
+		var closed bool
+		closed, err = isPeriodClosed(ctx, tx, date.Year(), int(date.Month()))
+		if err != nil {
+			return models.Reserve{}, err
+		} else if closed {
+			err = newError(ErrPeriodClosed, "db: amend reserve: accounting period %02d.%d is closed", date.Month(), date.Year())
+			return models.Reserve{}, err
+		}
+
+		_, err = changeWallet(ctx, tx, userId, reserve.Currency, -delta)
+		if err != nil {
+			return models.Reserve{}, err
+		}
+
+		postings := transfer(models.AccountWallet, userId, models.AccountHold, userId, reserve.Currency, delta)
+		if delta < 0 {
+			postings = transfer(models.AccountHold, userId, models.AccountWallet, userId, reserve.Currency, -delta)
+		}
+		entry := models.JournalEntry{
+			Kind:      models.EntryAmend,
+			UserID:    userId,
+			OrderID:   &orderId,
+			CreatedAt: date,
+			Postings:  postings,
+		}
+		if reserve.ServiceID != 0 {
+			entry.ServiceID = &reserve.ServiceID
+		}
+		err = postEntry(ctx, tx, entry)
+		if err != nil {
+			return models.Reserve{}, err
+		}
+	}
+
+	// update the reserve and record the change in its history
+	amendment := models.ReserveAmendment{
+		PreviousAmount:    reserve.Amount,
+		Amount:            amount,
+		PreviousExpiresAt: reserve.ExpiresAt,
+		ExpiresAt:         reserve.ExpiresAt.Add(extend),
+		AmendedAt:         date,
+	}
+	_, err = tx.Exec(ctx, "update reserves set amount = $2, expires_at = $3 where order_id = $1",
+		orderId, amendment.Amount, amendment.ExpiresAt)
+	if err != nil {
+		return models.Reserve{}, err
+	}
+	_, err = tx.Exec(ctx, "insert into reserve_amendments (order_id, previous_amount, amount, previous_expires_at, expires_at, amended_at) values ($1, $2, $3, $4, $5, $6)",
+		orderId, amendment.PreviousAmount, amendment.Amount, amendment.PreviousExpiresAt, amendment.ExpiresAt, amendment.AmendedAt)
+	if err != nil {
+		return models.Reserve{}, err
+	}
+
+	reserve.Amount = amendment.Amount
+	reserve.ExpiresAt = amendment.ExpiresAt
+	reserve.User = models.User{ID: userId}
+	if reserve.ServiceID != 0 {
+		err = scanService(tx.QueryRow(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = $2 where s.id = $1;",
+			reserve.ServiceID, reserve.PriceVersion), &reserve.Service)
+		if err != nil {
+			return models.Reserve{}, err
+		}
+	}
+	reserve.Amendments, err = getAmendments(ctx, tx, orderId)
+	if err != nil {
+		return models.Reserve{}, err
+	}
+
+	return reserve, err
+}
+
+// getAmendments returns history of amendments of reserve by given orderId
+func getAmendments(ctx context.Context, tx pgx.Tx, orderId uint64) ([]models.ReserveAmendment, error) {
+	rows, err := tx.Query(ctx, "select previous_amount, amount, previous_expires_at, expires_at, amended_at from reserve_amendments where order_id = $1 order by id",
+		orderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	amendments := make([]models.ReserveAmendment, 0)
+	for rows.Next() {
+		var a models.ReserveAmendment
+		if err = rows.Scan(&a.PreviousAmount, &a.Amount, &a.PreviousExpiresAt, &a.ExpiresAt, &a.AmendedAt); err != nil {
+			return nil, err
+		}
+		amendments = append(amendments, a)
+	}
+	return amendments, rows.Err()
+}
@@ -11,45 +11,92 @@ import (
 	"github.com/jackc/pgx/v4"
 )
 
-// GetBalance returns balance from user by given id
-func (p PgxDB) GetBalance(id uint64) (int64, error) {
-	ctx := context.Background()
+// GetBalance returns balance from user by given id in given currency
+func (p PgxDB) GetBalance(id uint64, currency string) (int64, error) {
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
 		if err != nil {
-			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: add balance: %v", err), nil)
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get balance: %v", err), nil)
 		}
 	}()
 
+	// user without wallet in currency has zero balance in it
 	var balance int64
-	err = p.QueryRow(ctx, "select balance from users where id = $1;", id).Scan(&balance)
+	err = p.QueryRow(ctx, "select coalesce(w.balance, 0) from users u left join wallets w on w.user_id = u.id and w.currency = $2 where u.id = $1;",
+		id, currency).Scan(&balance)
 	if err != nil && errors.Is(err, pgx.ErrNoRows) {
-		return 0, fmt.Errorf("db: reserve: no such user with id %d", id)
+		err = newError(ErrNotFound, "db: get balance: no such user with id %d", id)
+		return 0, err
 	} else if err != nil {
 		return 0, err
 	}
 	return balance, err
 }
 
-// AddBalance adds money balance of user by given id
-// Also writes report to operations table
-func (p PgxDB) AddBalance(id uint64, amount int64) error {
-	ctx := context.Background()
+// GetBalances returns balances of user by given id in every currency
+func (p PgxDB) GetBalances(id uint64) ([]models.Wallet, error) {
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
 		if err != nil {
-			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: add balance: %v", err), nil)
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get balances: %v", err), nil)
 		}
 	}()
 
-	// start transaction and defer its closing
+	var checkUserId uint64
+	err = p.QueryRow(ctx, "select id from users where id = $1;", id).Scan(&checkUserId)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: get balances: no such user with id %d", id)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.Query(ctx, "select currency, balance from wallets where user_id = $1 order by currency", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wallets := make([]models.Wallet, 0)
+	for rows.Next() {
+		var w models.Wallet
+		if err = rows.Scan(&w.Currency, &w.Balance); err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return wallets, err
+}
+
+// GetBalanceDetails returns available, held and total money of user by given id in every currency
+// he has wallet or open reserves in, held money is broken down by service if byService is set.
+// Money of order with multiple line items is attributed to services of its line items
+func (p PgxDB) GetBalanceDetails(id uint64, byService bool) ([]models.Balance, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get balance details: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
 	tx, err := p.BeginTx(ctx, pgx.TxOptions{
-		IsoLevel: pgx.Serializable,
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer func() {
@@ -60,44 +107,174 @@ func (p PgxDB) AddBalance(id uint64, amount int64) error {
 		}
 	}()
 
-	var user models.User
-	err = tx.QueryRow(ctx, "select * from users where id = $1;", id).Scan(&user.ID, &user.Balance)
-	if err != nil && errors.Is(err, pgx.ErrNoRows) { // if the user was not found then create him and add balance
-		user = models.User{
-			ID:      id,
-			Balance: amount,
+	var checkUserId uint64
+	err = tx.QueryRow(ctx, "select id from users where id = $1;", id).Scan(&checkUserId)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: get balance details: no such user with id %d", id)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	balances, err := queryBalances(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !byService {
+		return balances, err
+	}
+	currencies := make(map[string]int)
+	for i, b := range balances {
+		currencies[b.Currency] = i
+	}
+
+	rows, err := tx.Query(ctx, `select r.currency, s.id, s.name, sum(coalesce(i.amount, r.amount))
+		from reserves r left join order_items i on i.order_id = r.order_id
+		join services s on s.id = coalesce(i.service_id, r.service_id)
+		where r.user_id = $1 and r.status = 'open'
+		group by r.currency, s.id, s.name order by r.currency, s.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currency string
+		var h models.ServiceHeld
+		if err = rows.Scan(&currency, &h.ServiceID, &h.ServiceName, &h.Held); err != nil {
+			return nil, err
+		}
+		i := currencies[currency]
+		balances[i].Services = append(balances[i].Services, h)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return balances, err
+}
+
+// queryBalances returns available, held and total money of user in every currency he has wallet or open reserves in
+func queryBalances(ctx context.Context, tx pgx.Tx, id uint64) ([]models.Balance, error) {
+	rows, err := tx.Query(ctx, `select coalesce(w.currency, r.currency), coalesce(w.balance, 0), coalesce(r.held, 0)
+		from (select currency, balance from wallets where user_id = $1) w
+		full join (select currency, sum(amount) as held from reserves where user_id = $1 and status = 'open' group by currency) r on r.currency = w.currency
+		order by 1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make([]models.Balance, 0)
+	for rows.Next() {
+		var b models.Balance
+		if err = rows.Scan(&b.Currency, &b.Available, &b.Held); err != nil {
+			return nil, err
 		}
-		var createdId uint64
-		err = tx.QueryRow(ctx, "insert into users (id, balance) values ($1, $2) returning id", user.ID, user.Balance).Scan(&createdId)
+		b.Total = b.Available + b.Held
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// AddBalance adds money balance of user by given id in given currency
+// Also writes report to operations table and moves money from funding account to user's wallet in ledger
+func (p PgxDB) AddBalance(id uint64, amount int64, currency string) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
 		if err != nil {
-			return err
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: add balance: %v", err), nil)
 		}
+	}()
 
-		loc, _ := time.LoadLocation("Europe/Moscow")
-		date := time.Now().In(loc)
-		err = tx.QueryRow(ctx, "insert into operations (user_id, amount, done_at) values ($1, $2, $3) returning id", user.ID, user.Balance, date).Scan(&createdId)
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
 		if err != nil {
-			return err
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
 		}
+	}()
 
+	err = addBalance(ctx, tx, id, amount, currency)
+	return err
+}
+
+// addBalance adds money to user in given transaction, see AddBalance
+func addBalance(ctx context.Context, tx pgx.Tx, id uint64, amount int64, currency string) error {
+	var err error
+
+	// money is taken from user only by reserves and purchases, so credits of every path must be positive
+	if amount <= 0 {
+		err = newError(ErrInvalidArgument, "db: add balance: amount must be positive")
 		return err
-	} else if err != nil {
+	}
+
+	// operations cannot be dated in closed accounting period
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+	closed, err := isPeriodClosed(ctx, tx, date.Year(), int(date.Month()))
+	if err != nil {
+		return err
+	} else if closed {
+		err = newError(ErrPeriodClosed, "db: add balance: accounting period %02d.%d is closed", date.Month(), date.Year())
 		return err
 	}
 
-	user.Balance += amount
+	// if the user was not found then create him
+	_, err = tx.Exec(ctx, "insert into users (id) values ($1) on conflict (id) do nothing", id)
+	if err != nil {
+		return err
+	}
 
-	var updateId uint64
-	err = tx.QueryRow(ctx, "update users SET balance = $2 where id = $1 returning id", user.ID, user.Balance).Scan(&updateId)
+	_, err = changeWallet(ctx, tx, id, currency, amount)
+	if err != nil {
+		return err
+	}
+
+	// every top-up is written to operations table, so balance could be restored from it
+	var createdId uint64
+	err = tx.QueryRow(ctx, "insert into operations (user_id, amount, currency, done_at, kind) values ($1, $2, $3, $4, $5) returning id",
+		id, amount, currency, date, models.OperationTopUp).Scan(&createdId)
+	if err != nil {
+		return err
+	}
+
+	// move money from funding account to user's wallet
+	err = postEntry(ctx, tx, models.JournalEntry{
+		Kind:      models.EntryTopUp,
+		UserID:    id,
+		CreatedAt: date,
+		Postings:  transfer(models.AccountFunding, 0, models.AccountWallet, id, currency, amount),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = emitEvent(ctx, tx, models.WebhookEvent{
+		Type:      models.EventBalanceCredited,
+		UserID:    id,
+		Amount:    amount,
+		Currency:  currency,
+		CreatedAt: date,
+	})
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-// DeleteUser deletes user. User cannot be deleted if referenced in reports or operations tables
+// DeleteUser deletes user with empty wallets. User cannot be deleted if referenced in reports or operations tables or has money
 func (p PgxDB) DeleteUser(id uint64) error {
-	ctx := context.Background()
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
@@ -106,12 +283,43 @@ func (p PgxDB) DeleteUser(id uint64) error {
 		}
 	}()
 
-	res, err := p.Exec(ctx, "delete from users where id = $1", id)
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// empty wallets are deleted with user, user with money cannot be deleted
+	_, err = tx.Exec(ctx, "delete from wallets where user_id = $1 and balance = 0", id)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(ctx, "delete from users where id = $1", id)
 	if err != nil {
 		return err
 	} else if res.RowsAffected() == 0 {
-		err = fmt.Errorf("db: delete user: no such user with id %d", id)
+		err = newError(ErrNotFound, "db: delete user: no such user with id %d", id)
 		return err
 	}
-	return nil
+	return err
+}
+
+// changeWallet adds delta to balance of user's wallet in given currency and returns new balance.
+// Wallet is created if it doesn't exist
+func changeWallet(ctx context.Context, tx pgx.Tx, userId uint64, currency string, delta int64) (int64, error) {
+	var balance int64
+	err := tx.QueryRow(ctx, "insert into wallets (user_id, currency, balance) values ($1, $2, $3) on conflict (user_id, currency) do update set balance = wallets.balance + excluded.balance returning balance",
+		userId, currency, delta).Scan(&balance)
+	return balance, err
 }
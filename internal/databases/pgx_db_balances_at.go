@@ -0,0 +1,191 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// reserveAmountAt returns expression of amount reserve r had at moment given by param,
+// amount changed by later amendment is taken from the first of them
+func reserveAmountAt(param string) string {
+	return "coalesce((select a.previous_amount from reserve_amendments a where a.order_id = r.order_id and a.amended_at >= " + param + " order by a.id limit 1), r.amount)"
+}
+
+// reserveOpenAt is condition on reserves r that reserve was open at moment $2
+const reserveOpenAt = "r.reserved_at < $2 and (r.status = 'open' or coalesce(r.purchased_at, r.released_at) >= $2)"
+
+// balancesAtQuery selects user_id, currency, total and held money of users with ids $1 at moment $2,
+// null $1 means all users
+var balancesAtQuery = `with o as (
+		select user_id, currency, sum(amount) as total from operations where ($1::bigint[] is null or user_id = any($1)) and done_at < $2 group by user_id, currency
+	), h as (
+		select r.user_id, r.currency, sum(` + reserveAmountAt("$2") + `) as held from reserves r where ($1::bigint[] is null or r.user_id = any($1)) and ` + reserveOpenAt + ` group by r.user_id, r.currency
+	)
+	select coalesce(o.user_id, h.user_id) as user_id, coalesce(o.currency, h.currency) as currency, coalesce(o.total, 0) as total, coalesce(h.held, 0) as held
+	from o full join h on h.user_id = o.user_id and h.currency = o.currency`
+
+// GetBalanceAt returns balances of user by given id in every currency and reserves open at given moment.
+// Operations done and reserves made exactly at the moment are not taken into account.
+//
+// 1) sums operations done before the moment, that is total money of user
+//
+// 2) sums reserves open at the moment with amounts they had then, that is held money
+//
+// 3) available money is total minus held one
+func (p PgxDB) GetBalanceAt(userId uint64, at time.Time) (models.BalanceAt, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get balance at: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return models.BalanceAt{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	balances, err := balancesAt(ctx, tx, []uint64{userId}, at)
+	if err != nil {
+		err = fmt.Errorf("db: get balance at: %w", err)
+		return models.BalanceAt{}, err
+	}
+	balance := balances[0]
+
+	rows, err := tx.Query(ctx, "select order_id, user_id, coalesce(service_id, 0), "+reserveAmountAt("$2")+", currency, reserved_at, coalesce(price_version, 0) from reserves r where r.user_id = $1 and "+reserveOpenAt+" order by r.reserved_at, r.order_id",
+		userId, at)
+	if err != nil {
+		return models.BalanceAt{}, err
+	}
+	defer rows.Close()
+
+	balance.Reserves = make([]models.Reserve, 0)
+	for rows.Next() {
+		r := models.Reserve{Status: models.ReserveOpen}
+		if err = rows.Scan(&r.OrderID, &r.UserID, &r.ServiceID, &r.Amount, &r.Currency, &r.ReservedAt, &r.PriceVersion); err != nil {
+			return models.BalanceAt{}, err
+		}
+		r.User = models.User{ID: r.UserID}
+		r.Service = models.Service{ID: r.ServiceID}
+		balance.Reserves = append(balance.Reserves, r)
+	}
+	if err = rows.Err(); err != nil {
+		return models.BalanceAt{}, err
+	}
+
+	return balance, err
+}
+
+// GetEndOfDayBalances returns balances of users by given ids in every currency at the end of given day
+func (p PgxDB) GetEndOfDayBalances(userIds []uint64, day time.Time) ([]models.BalanceAt, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get end of day balances: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// the end of day is the beginning of the next one
+	at := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location()).AddDate(0, 0, 1)
+	balances, err := balancesAt(ctx, tx, userIds, at)
+	if err != nil {
+		err = fmt.Errorf("db: get end of day balances: %w", err)
+		return nil, err
+	}
+	return balances, err
+}
+
+// balancesAt returns balances of users by given ids in every currency at given moment in order of ids,
+// every user must exist
+func balancesAt(ctx context.Context, tx pgx.Tx, userIds []uint64, at time.Time) ([]models.BalanceAt, error) {
+	balances := make([]models.BalanceAt, 0, len(userIds))
+	users := make(map[uint64]int, len(userIds))
+	for _, id := range userIds {
+		if _, ok := users[id]; ok {
+			continue
+		}
+		users[id] = len(balances)
+		balances = append(balances, models.BalanceAt{UserID: id, At: at, Balances: make([]models.Balance, 0)})
+	}
+
+	var found int
+	err := tx.QueryRow(ctx, "select count(*) from users where id = any($1)", userIds).Scan(&found)
+	if err != nil {
+		return nil, err
+	} else if found != len(balances) {
+		var missing []uint64
+		rows, err := tx.Query(ctx, "select id from unnest($1::bigint[]) as ids(id) where not exists (select 1 from users u where u.id = ids.id) order by id", userIds)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id uint64
+			if err = rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			missing = append(missing, id)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, newError(ErrNotFound, "no such users with ids %v", missing)
+	}
+
+	rows, err := tx.Query(ctx, balancesAtQuery+" order by user_id, currency", userIds, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userId uint64
+		var b models.Balance
+		if err = rows.Scan(&userId, &b.Currency, &b.Total, &b.Held); err != nil {
+			return nil, err
+		}
+		b.Available = b.Total - b.Held
+		i := users[userId]
+		balances[i].Balances = append(balances[i].Balances, b)
+	}
+	return balances, rows.Err()
+}
@@ -0,0 +1,144 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// batchChunk is number of operations of independent batch performed in one transaction
+const batchChunk = 100
+
+// Batch performs operations and returns result for every operation.
+//
+// 1) atomic batch is performed in one transaction, the first failed operation rolls back the whole batch
+// and the rest of operations are skipped
+//
+// 2) operations of independent batch are performed in transactions of batchChunk operations, every operation
+// is performed in its own savepoint, so failed operation is rolled back alone.
+// If transaction is not committed, its applied operations fail with the commit error
+func (p PgxDB) Batch(operations []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, len(operations))
+	if atomic {
+		return results, p.batchChunk(operations, results, true)
+	}
+	for from := 0; from < len(operations); from += batchChunk {
+		to := from + batchChunk
+		if to > len(operations) {
+			to = len(operations)
+		}
+		if err := p.batchChunk(operations[from:to], results[from:to], false); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// batchChunk performs operations in one transaction and writes their results, see Batch.
+// Returns error only if operations could not be started
+func (p PgxDB) batchChunk(operations []models.BatchOperation, results []models.BatchResult, atomic bool) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: batch: %v", err), nil)
+		}
+	}()
+
+	// start transaction, it is closed explicitly as results depend on its commit
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for i, o := range operations {
+		if failed {
+			results[i] = models.BatchResult{Status: models.BatchSkipped}
+			continue
+		}
+
+		var reserve *models.Reserve
+		var opErr error
+		if atomic {
+			reserve, opErr = batchOperation(ctx, tx, o)
+		} else {
+			// savepoint rolls back failed operation alone
+			var savepoint pgx.Tx
+			if savepoint, err = tx.Begin(ctx); err != nil {
+				_ = tx.Rollback(ctx)
+				return err
+			}
+			if reserve, opErr = batchOperation(ctx, savepoint, o); opErr != nil {
+				err = savepoint.Rollback(ctx)
+			} else {
+				err = savepoint.Commit(ctx)
+			}
+			if err != nil {
+				_ = tx.Rollback(ctx)
+				return err
+			}
+		}
+
+		if opErr != nil {
+			results[i] = models.BatchResult{Status: models.BatchFailed, Code: ErrorCode(opErr), Error: opErr.Error()}
+			failed = atomic
+			continue
+		}
+		results[i] = models.BatchResult{Status: models.BatchApplied, Reserve: reserve}
+	}
+
+	if atomic && failed {
+		for i := range results {
+			if results[i].Status == models.BatchApplied {
+				results[i] = models.BatchResult{Status: models.BatchSkipped}
+			}
+		}
+		err = tx.Rollback(ctx)
+		return err
+	}
+
+	// operations are lost if transaction is not committed, e.g. it conflicted with concurrent one
+	if commitErr := tx.Commit(ctx); commitErr != nil {
+		p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: batch: %v", commitErr), nil)
+		for i := range results {
+			if results[i].Status == models.BatchApplied {
+				results[i] = models.BatchResult{Status: models.BatchFailed, Code: ErrorCode(commitErr), Error: commitErr.Error()}
+			}
+		}
+		return err
+	}
+
+	// start goroutines that return money of created reserves if they are not purchased until expiry time
+	for i, o := range operations {
+		if o.Type == models.BatchReserve && results[i].Status == models.BatchApplied {
+			go p.releaseOnExpiry(o.OrderID, ReserveTimeout)
+		}
+	}
+	return err
+}
+
+// batchOperation performs operation of batch in given transaction and returns reserve created by reserve operation
+func batchOperation(ctx context.Context, tx pgx.Tx, o models.BatchOperation) (*models.Reserve, error) {
+	switch o.Type {
+	case models.BatchCredit:
+		return nil, addBalance(ctx, tx, o.UserID, o.Amount, o.Currency)
+	case models.BatchReserve:
+		reserve, err := createReserve(ctx, tx, o.UserID, o.ServiceID, o.OrderID, o.Amount, o.Currency)
+		if err != nil {
+			return nil, err
+		}
+		return &reserve, nil
+	case models.BatchPurchase:
+		return nil, purchase(ctx, tx, o.UserID, o.ServiceID, o.OrderID, o.Amount, o.Currency)
+	case models.BatchRelease:
+		return nil, releaseReserve(ctx, tx, o.UserID, o.ServiceID, o.OrderID)
+	}
+	return nil, newError(ErrInvalidArgument, "db: batch: unknown operation type %q", o.Type)
+}
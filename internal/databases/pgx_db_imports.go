@@ -0,0 +1,330 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// ImportChunk is number of rows of import applied in one transaction
+	ImportChunk = 1000
+	// importRetries is number of retries of chunk conflicted with concurrent transactions
+	importRetries = 3
+)
+
+// importColumns are columns of imports with numbers of their rows by status in order of scanImport destinations,
+// importFrom is the table they are selected from
+const (
+	importColumns = "i.id, i.file_name, i.sha256, i.currency, i.status, i.created_at, i.completed_at, c.rows, c.pending, c.applied, c.invalid, c.failed"
+	importFrom    = `imports i, lateral (select count(*) as rows,
+		count(*) filter (where r.status = 'pending') as pending, count(*) filter (where r.status = 'applied') as applied,
+		count(*) filter (where r.status = 'invalid') as invalid, count(*) filter (where r.status = 'failed') as failed
+		from import_rows r where r.import_id = i.id) c`
+)
+
+// scanImport scans row with importColumns into import
+func scanImport(row pgx.Row, imp *models.Import) error {
+	return row.Scan(&imp.ID, &imp.FileName, &imp.SHA256, &imp.Currency, &imp.Status, &imp.CreatedAt, &imp.CompletedAt,
+		&imp.Rows, &imp.Pending, &imp.Applied, &imp.Invalid, &imp.Failed)
+}
+
+// importSource streams rows returned by next into COPY and counts them by status
+type importSource struct {
+	importId uint64
+	next     func() (models.ImportRow, error)
+	imp      *models.Import
+	row      models.ImportRow
+	err      error
+}
+
+// Next reads the next row, reading is stopped by io.EOF or error
+func (s *importSource) Next() bool {
+	s.row, s.err = s.next()
+	if errors.Is(s.err, io.EOF) {
+		s.err = nil
+		return false
+	}
+	if s.err != nil {
+		return false
+	}
+	s.imp.Rows++
+	if s.row.Status == models.ImportRowInvalid {
+		s.imp.Invalid++
+	} else {
+		s.imp.Pending++
+	}
+	return true
+}
+
+// Values returns columns of the current row
+func (s *importSource) Values() ([]interface{}, error) {
+	r := s.row
+	return []interface{}{s.importId, r.Line, int64(r.UserID), r.Amount, r.ExternalRef, r.Status, r.Error}, nil
+}
+
+// Err returns error of reading rows
+func (s *importSource) Err() error {
+	return s.err
+}
+
+// CreateImport writes import of file and streams its rows returned by next until io.EOF into staging table by COPY,
+// so rows of file are not held in memory, credits are not applied.
+// If the file was already imported, returns the existing import with error, so not completed import could be resumed
+func (p PgxDB) CreateImport(imp models.Import, next func() (models.ImportRow, error)) (models.Import, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: create import: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Import{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// the same file is detected by its checksum
+	var existing models.Import
+	err = scanImport(tx.QueryRow(ctx, "select "+importColumns+" from "+importFrom+" where i.sha256 = $1", imp.SHA256), &existing)
+	if err == nil {
+		err = newError(ErrFailedPrecondition, "db: create import: file is already imported as import %d with %s status", existing.ID, existing.Status)
+		return existing, err
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return models.Import{}, err
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	imp.CreatedAt = time.Now().In(loc)
+	imp.Status = models.ImportPending
+	err = tx.QueryRow(ctx, "insert into imports (file_name, sha256, currency, status, created_at) values ($1, $2, $3, $4, $5) returning id",
+		imp.FileName, imp.SHA256, imp.Currency, imp.Status, imp.CreatedAt).Scan(&imp.ID)
+	if err != nil {
+		return models.Import{}, err
+	}
+
+	// load rows in one COPY while they are read
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"import_rows"},
+		[]string{"import_id", "line", "user_id", "amount", "external_ref", "status", "error"},
+		&importSource{importId: imp.ID, next: next, imp: &imp})
+	if err != nil {
+		return models.Import{}, err
+	}
+	if imp.Rows == 0 {
+		err = newError(ErrInvalidArgument, "db: create import: file has no rows")
+		return models.Import{}, err
+	}
+	return imp, err
+}
+
+// GetImport returns import by given id with numbers of its rows by status
+func (p PgxDB) GetImport(id uint64) (models.Import, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get import: %v", err), nil)
+		}
+	}()
+
+	var imp models.Import
+	err = scanImport(p.QueryRow(ctx, "select "+importColumns+" from "+importFrom+" where i.id = $1", id), &imp)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: get import: no such import with id %d", id)
+		return models.Import{}, err
+	} else if err != nil {
+		return models.Import{}, err
+	}
+
+	return imp, err
+}
+
+// GetImportRows returns rows of import by given id ordered by line
+func (p PgxDB) GetImportRows(id uint64) ([]models.ImportRow, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get import rows: %v", err), nil)
+		}
+	}()
+
+	rows, err := p.Query(ctx, "select line, user_id, amount, external_ref, status, error from import_rows where import_id = $1 order by line", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	importRows := make([]models.ImportRow, 0)
+	for rows.Next() {
+		var r models.ImportRow
+		if err = rows.Scan(&r.Line, &r.UserID, &r.Amount, &r.ExternalRef, &r.Status, &r.Error); err != nil {
+			return nil, err
+		}
+		importRows = append(importRows, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return importRows, err
+}
+
+// ApplyImport applies credits of pending rows of import by given id in chunks and completes the import.
+//
+// 1) every chunk of ImportChunk rows is applied in its own transaction together with statuses of its rows,
+// so import interrupted by failure is resumed from the first not applied chunk
+//
+// 2) credit of every row is applied in its own savepoint the same way as AddBalance, credit failed by domain error
+// fails its row alone, other errors fail the whole chunk
+//
+// 3) chunk conflicted with concurrent transactions, deadlocked or not locked in time is retried up to importRetries times
+//
+// 4) rows are locked while applied, so the same import could be resumed concurrently without double credits
+func (p PgxDB) ApplyImport(id uint64) (models.Import, error) {
+	imp, err := p.GetImport(id)
+	if err != nil {
+		return models.Import{}, err
+	}
+
+	for retries := 0; ; {
+		n, err := p.applyImportChunk(imp, ImportChunk)
+		// chunk conflicted with concurrent transactions is applied again
+		if err != nil && ErrorCode(err) == CodeAborted && retries < importRetries {
+			retries++
+			continue
+		} else if err != nil {
+			return models.Import{}, err
+		}
+		retries = 0
+		if n < ImportChunk {
+			break
+		}
+	}
+
+	ctx := p.callContext()
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	_, err = p.Exec(ctx, `update imports set status = $2, completed_at = $3
+		where id = $1 and status = $4 and not exists (select 1 from import_rows where import_id = $1 and status = $4)`,
+		id, models.ImportCompleted, time.Now().In(loc), models.ImportPending)
+	if err != nil {
+		p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: apply import: %v", err), nil)
+		return models.Import{}, err
+	}
+
+	return p.GetImport(id)
+}
+
+// isRowError checks if credit of import row failed because of the row itself, so the row is failed permanently.
+// Conflicts with concurrent transactions and errors of driver and connection are not errors of the row
+func isRowError(err error) bool {
+	code := ErrorCode(err)
+	return code != CodeAborted && code != CodeInternal
+}
+
+// applyImportChunk applies credits of at most limit pending rows of import and returns number of taken rows
+func (p PgxDB) applyImportChunk(imp models.Import, limit int) (int, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: apply import: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its rollback on failure, it is committed explicitly
+	// as rows of not committed chunk must not be counted as taken
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	rows, err := tx.Query(ctx, "select line, user_id, amount from import_rows where import_id = $1 and status = $2 order by line limit $3 for update skip locked",
+		imp.ID, models.ImportRowPending, limit)
+	if err != nil {
+		return 0, err
+	}
+	pending := make([]models.ImportRow, 0, limit)
+	for rows.Next() {
+		var r models.ImportRow
+		if err = rows.Scan(&r.Line, &r.UserID, &r.Amount); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	batch := &pgx.Batch{}
+	for _, r := range pending {
+		var savepoint pgx.Tx
+		if savepoint, err = tx.Begin(ctx); err != nil {
+			return 0, err
+		}
+		r.Status = models.ImportRowApplied
+		if creditErr := addBalance(ctx, savepoint, r.UserID, r.Amount, imp.Currency); creditErr != nil && !isRowError(creditErr) {
+			// transient error fails the whole chunk, so it is retried instead of failing the row forever
+			err = creditErr
+			return 0, err
+		} else if creditErr != nil {
+			r.Status, r.Error = models.ImportRowFailed, creditErr.Error()
+			err = savepoint.Rollback(ctx)
+		} else {
+			err = savepoint.Commit(ctx)
+		}
+		if err != nil {
+			return 0, err
+		}
+		batch.Queue("update import_rows set status = $3, error = $4 where import_id = $1 and line = $2",
+			imp.ID, r.Line, r.Status, r.Error)
+	}
+
+	// write statuses of all rows in one round trip
+	br := tx.SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err = br.Exec(); err != nil {
+			br.Close()
+			return 0, err
+		}
+	}
+	if err = br.Close(); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(pending), err
+}
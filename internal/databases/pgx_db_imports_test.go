@@ -0,0 +1,33 @@
+package databases
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestIsRowError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"insufficient funds", newError(ErrInsufficientFunds, "db: add balance: insufficient funds"), true},
+		{"invalid argument", newError(ErrInvalidArgument, "db: add balance: wrong amount"), true},
+		{"not found", fmt.Errorf("db: add balance: %w", ErrNotFound), true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, false},
+		{"deadlock", fmt.Errorf("db: add balance: %w", &pgconn.PgError{Code: "40P01"}), false},
+		{"lock timeout", &pgconn.PgError{Code: "55P03"}, false},
+		{"connection error", errors.New("conn closed"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRowError(tt.err); got != tt.want {
+				t.Errorf("isRowError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
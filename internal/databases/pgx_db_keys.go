@@ -0,0 +1,260 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const apiKeyColumns = "id, name, prefix, key_hash, role, services, created_at, expires_at, revoked_at, rotated_to"
+
+// scanAPIKey scans row selected with apiKeyColumns into key
+func scanAPIKey(row pgx.Row, key *models.APIKey) error {
+	return row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &key.Role, &key.Services, &key.CreatedAt,
+		&key.ExpiresAt, &key.RevokedAt, &key.RotatedTo)
+}
+
+// insertAPIKey is statement writing key with values of name, prefix, hash, role, services and creation time
+const insertAPIKey = "insert into api_keys (name, prefix, key_hash, role, services, created_at) values ($1, $2, $3, $4, $5, $6)"
+
+// keyServices returns services of key as not null array
+func keyServices(key models.APIKey) []uint64 {
+	if key.Services == nil {
+		return []uint64{}
+	}
+	return key.Services
+}
+
+// CreateAPIKey writes API key with given name, role, services and hash
+func (p PgxDB) CreateAPIKey(key models.APIKey) (models.APIKey, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: create api key: %v", err), nil)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	key.CreatedAt = time.Now().In(loc)
+	key.Services = keyServices(key)
+	err = p.QueryRow(ctx, insertAPIKey+" returning id", key.Name, key.Prefix, key.Hash, key.Role, key.Services, key.CreatedAt).Scan(&key.ID)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	return key, err
+}
+
+// EnsureAPIKey writes API key if key with the same hash is not written yet.
+// Rotated or revoked key is not written again
+func (p PgxDB) EnsureAPIKey(key models.APIKey) error {
+	ctx := p.callContext()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	_, err := p.Exec(ctx, insertAPIKey+" on conflict (key_hash) do nothing",
+		key.Name, key.Prefix, key.Hash, key.Role, keyServices(key), time.Now().In(loc))
+	if err != nil {
+		p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: ensure api key: %v", err), nil)
+	}
+	return err
+}
+
+// firstKeyLockKey is key of advisory lock held by the instance which writes the first API key
+const firstKeyLockKey = 0x66697273746b6579
+
+// CreateFirstAPIKey writes API key if there are no API keys yet and reports whether it is written,
+// instances starting at the same time write one key
+func (p PgxDB) CreateFirstAPIKey(key models.APIKey) (bool, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: create first api key: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, "select pg_advisory_xact_lock($1)", firstKeyLockKey)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, "select exists (select 1 from api_keys)").Scan(&exists)
+	if err != nil || exists {
+		return false, err
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	_, err = tx.Exec(ctx, insertAPIKey, key.Name, key.Prefix, key.Hash, key.Role, keyServices(key), time.Now().In(loc))
+	if err != nil {
+		return false, err
+	}
+	return true, err
+}
+
+// GetAPIKeys returns all API keys ordered by id, revoked and expired ones included
+func (p PgxDB) GetAPIKeys() ([]models.APIKey, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get api keys: %v", err), nil)
+		}
+	}()
+
+	rows, err := p.Query(ctx, "select "+apiKeyColumns+" from api_keys order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		var key models.APIKey
+		if err = scanAPIKey(rows, &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	err = rows.Err()
+	return keys, err
+}
+
+// GetActiveAPIKey returns API key by given hash if it is neither revoked nor expired
+func (p PgxDB) GetActiveAPIKey(hash string) (models.APIKey, error) {
+	ctx := p.callContext()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	var key models.APIKey
+	err := scanAPIKey(p.QueryRow(ctx, "select "+apiKeyColumns+" from api_keys where key_hash = $1 and revoked_at is null and (expires_at is null or expires_at > $2)",
+		hash, time.Now().In(loc)), &key)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		// unknown keys are not logged, they are answered as unauthorized
+		return models.APIKey{}, newError(ErrNotFound, "db: get active api key: no such active key")
+	} else if err != nil {
+		p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get active api key: %v", err), nil)
+		return models.APIKey{}, err
+	}
+
+	return key, err
+}
+
+// RotateAPIKey replaces active API key by given id with a new key of the same name, role and services.
+//
+// 1) the old key keeps working for grace period, so clients could switch to the new key without downtime
+//
+// 2) key which is revoked, expired or already rotated is not rotated
+func (p PgxDB) RotateAPIKey(id uint64, prefix, hash string, grace time.Duration) (models.APIKey, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: rotate api key: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var old models.APIKey
+	err = scanAPIKey(tx.QueryRow(ctx, "select "+apiKeyColumns+" from api_keys where id = $1 for update", id), &old)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: rotate api key: no such key with id %d", id)
+		return models.APIKey{}, err
+	} else if err != nil {
+		return models.APIKey{}, err
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	now := time.Now().In(loc)
+	switch {
+	case old.RevokedAt != nil:
+		err = newError(ErrFailedPrecondition, "db: rotate api key: key %d is already revoked", id)
+	case old.RotatedTo != nil:
+		err = newError(ErrFailedPrecondition, "db: rotate api key: key %d is already rotated to key %d", id, *old.RotatedTo)
+	case old.ExpiresAt != nil && !old.ExpiresAt.After(now):
+		err = newError(ErrFailedPrecondition, "db: rotate api key: key %d has expired", id)
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	key := models.APIKey{
+		Name:      old.Name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Role:      old.Role,
+		Services:  old.Services,
+		CreatedAt: now,
+	}
+	err = tx.QueryRow(ctx, insertAPIKey+" returning id", key.Name, key.Prefix, key.Hash, key.Role, key.Services, key.CreatedAt).Scan(&key.ID)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	_, err = tx.Exec(ctx, "update api_keys set expires_at = $2, rotated_to = $3 where id = $1", id, now.Add(grace), key.ID)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	return key, err
+}
+
+// RevokeAPIKey revokes API key by given id at once
+func (p PgxDB) RevokeAPIKey(id uint64) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: revoke api key: %v", err), nil)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	tag, err := p.Exec(ctx, "update api_keys set revoked_at = $2 where id = $1 and revoked_at is null", id, time.Now().In(loc))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		err = newError(ErrNotFound, "db: revoke api key: no such key with id %d or it is already revoked", id)
+		return err
+	}
+	return err
+}
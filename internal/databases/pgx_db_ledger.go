@@ -0,0 +1,116 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// GetUserAccounts returns wallet and hold accounts of user by given id with balances derived from postings
+func (p PgxDB) GetUserAccounts(userId uint64) ([]models.Account, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get user accounts: %v", err), nil)
+		}
+	}()
+
+	var checkUserId uint64
+	err = p.QueryRow(ctx, "select id from users where id = $1;", userId).Scan(&checkUserId)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: get user accounts: no such user with id %d", userId)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.Query(ctx, `select a.id, a.kind, a.owner_id, a.currency, coalesce(sum(ps.amount), 0) from accounts a
+		left join postings ps on ps.account_id = a.id
+		where a.owner_id = $1 and a.kind in ($2, $3)
+		group by a.id order by a.currency, a.id`,
+		userId, models.AccountWallet, models.AccountHold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make([]models.Account, 0)
+	for rows.Next() {
+		var a models.Account
+		if err = rows.Scan(&a.ID, &a.Kind, &a.OwnerID, &a.Currency, &a.Balance); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, err
+}
+
+// postEntry writes journal entry with its postings and outbox event of the movement. Postings must be balanced, accounts are created if needed
+func postEntry(ctx context.Context, tx pgx.Tx, entry models.JournalEntry) error {
+	sums := make(map[string]int64)
+	for _, posting := range entry.Postings {
+		sums[posting.Currency] += posting.Amount
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("unbalanced %s entry for user %d, postings sum: %d %s", entry.Kind, entry.UserID, sum, currency)
+		}
+	}
+
+	var entryId uint64
+	err := tx.QueryRow(ctx, "insert into journal_entries (kind, user_id, service_id, order_id, created_at) values ($1, $2, $3, $4, $5) returning id",
+		entry.Kind, entry.UserID, entry.ServiceID, entry.OrderID, entry.CreatedAt).Scan(&entryId)
+	if err != nil {
+		return err
+	}
+
+	for _, posting := range entry.Postings {
+		var accountId uint64
+		accountId, err = getAccountId(ctx, tx, posting.AccountKind, posting.OwnerID, posting.Currency)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "insert into postings (entry_id, account_id, amount) values ($1, $2, $3)",
+			entryId, accountId, posting.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	// every money movement is published to message broker through outbox
+	return writeOutbox(ctx, tx, entry.UserID, models.OutboxMoneyMovement, models.OutboxMoneyMovementVersion, entry.CreatedAt, models.MoneyMovementV1{
+		EntryID:   entryId,
+		Kind:      entry.Kind,
+		UserID:    entry.UserID,
+		ServiceID: entry.ServiceID,
+		OrderID:   entry.OrderID,
+		CreatedAt: entry.CreatedAt,
+		Postings:  entry.Postings,
+	})
+}
+
+// getAccountId returns id of account by given kind, owner and currency, creates account if it doesn't exist
+func getAccountId(ctx context.Context, tx pgx.Tx, kind string, ownerId uint64, currency string) (uint64, error) {
+	var accountId uint64
+	err := tx.QueryRow(ctx, "insert into accounts (kind, owner_id, currency) values ($1, $2, $3) on conflict (kind, owner_id, currency) do update set kind = excluded.kind returning id",
+		kind, ownerId, currency).Scan(&accountId)
+	return accountId, err
+}
+
+// transfer returns balanced postings which move amount of money in given currency from one account to another
+func transfer(fromKind string, fromOwner uint64, toKind string, toOwner uint64, currency string, amount int64) []models.Posting {
+	return []models.Posting{
+		{AccountKind: fromKind, OwnerID: fromOwner, Currency: currency, Amount: -amount},
+		{AccountKind: toKind, OwnerID: toOwner, Currency: currency, Amount: amount},
+	}
+}
@@ -0,0 +1,459 @@
+package databases
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ReserveOrder reserves money for the whole order with multiple line items at once and returns the order.
+// Zero unit price of item means catalog price of service, empty currency means currency of services.
+//
+// 1) checks that every service exists, is active and all services are priced in the same currency,
+// takes catalog prices or checks unit prices against bounds of the current price versions,
+// amounts of items and total amount of order must fit into int64 and total amount must be positive
+//
+// 2) checks if given user exists and subtracts user balance in currency by total amount of items
+//
+// 3) writes into reserves table without service and line items into order_items table
+//
+// 4) moves total amount from user's wallet to hold account in ledger
+func (p PgxDB) ReserveOrder(userId, orderId uint64, currency string, items []models.OrderItem) (models.Order, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: reserve order: %v", err), nil)
+		}
+	}()
+
+	if len(items) == 0 {
+		err = newError(ErrInvalidArgument, "db: reserve order: order has no items")
+		return models.Order{}, err
+	}
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+	order := models.Order{
+		OrderID:    orderId,
+		UserID:     userId,
+		Currency:   currency,
+		ReservedAt: date,
+		ExpiresAt:  date.Add(ReserveTimeout),
+		Status:     models.ReserveOpen,
+		Items:      make([]models.OrderItem, 0, len(items)),
+	}
+
+	// price every line item by catalog of services
+	for i, item := range items {
+		item.LineNo = i + 1
+		if item.Quantity <= 0 {
+			err = newError(ErrInvalidArgument, "db: reserve order: line %d: quantity must be positive", item.LineNo)
+			return models.Order{}, err
+		}
+
+		var service models.Service
+		err = scanService(tx.QueryRow(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = s.price_version where s.id = $1;",
+			item.ServiceID), &service)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			err = newError(ErrNotFound, "db: reserve order: line %d: no such service with id %d", item.LineNo, item.ServiceID)
+			return models.Order{}, err
+		} else if err != nil {
+			return models.Order{}, err
+		} else if !service.Active {
+			err = newError(ErrFailedPrecondition, "db: reserve order: line %d: service %d is not active", item.LineNo, item.ServiceID)
+			return models.Order{}, err
+		}
+		if order.Currency == "" {
+			order.Currency = service.Currency
+		} else if service.Currency != order.Currency {
+			err = newError(ErrInvalidArgument, "db: reserve order: line %d: service %d is priced in %s, order is in %s", item.LineNo, item.ServiceID, service.Currency, order.Currency)
+			return models.Order{}, err
+		}
+
+		// omitted unit price is taken from catalog, given unit price must be within bounds
+		if item.UnitPrice == 0 {
+			if service.Price == nil {
+				err = newError(ErrInvalidArgument, "db: reserve order: line %d: service %d has no catalog price, unit price must be given", item.LineNo, item.ServiceID)
+				return models.Order{}, err
+			}
+			item.UnitPrice = *service.Price
+		} else if item.UnitPrice < 0 {
+			err = newError(ErrInvalidArgument, "db: reserve order: line %d: unit price must be positive", item.LineNo)
+			return models.Order{}, err
+		} else if (service.MinAmount != nil && item.UnitPrice < *service.MinAmount) || (service.MaxAmount != nil && item.UnitPrice > *service.MaxAmount) {
+			err = newError(ErrInvalidArgument, "db: reserve order: line %d: unit price %s %s is out of bounds of service %d", item.LineNo,
+				utils.FormatMoney(item.UnitPrice, order.Currency), order.Currency, item.ServiceID)
+			return models.Order{}, err
+		}
+
+		item.ServiceName = service.Name
+		item.PriceVersion = service.PriceVersion
+		item.Amount, order.Amount, err = addItemAmount(order.Amount, item)
+		if err != nil {
+			return models.Order{}, err
+		}
+		item.Captured = false
+		order.Items = append(order.Items, item)
+	}
+	// negative or zero total would credit the wallet instead of holding money
+	if order.Amount <= 0 {
+		err = newError(ErrInvalidArgument, "db: reserve order: total amount of order must be positive")
+		return models.Order{}, err
+	}
+
+	// check user by id and his balance in currency
+	var balance int64
+	err = tx.QueryRow(ctx, "select coalesce(w.balance, 0) from users u left join wallets w on w.user_id = u.id and w.currency = $2 where u.id = $1;",
+		userId, order.Currency).Scan(&balance)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: reserve order: no such user with id %d", userId)
+		return models.Order{}, err
+	} else if err != nil {
+		return models.Order{}, err
+	} else if order.Amount > balance {
+		err = newError(ErrInsufficientFunds, "db: reserve order: the user %d doesn't have enough money, needed: %s %s, user has: %s %s", userId,
+			utils.FormatMoney(order.Amount, order.Currency), order.Currency, utils.FormatMoney(balance, order.Currency), order.Currency)
+		return models.Order{}, err
+	}
+
+	// subtract user's balance
+	_, err = changeWallet(ctx, tx, userId, order.Currency, -order.Amount)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	// insert reserve of the whole order and its items
+	_, err = tx.Exec(ctx, "insert into reserves (order_id, user_id, amount, currency, status, reserved_at, expires_at) values ($1, $2, $3, $4, $5, $6, $7)",
+		orderId, userId, order.Amount, order.Currency, order.Status, order.ReservedAt, order.ExpiresAt)
+	if err != nil {
+		return models.Order{}, err
+	}
+	lines := make([][]interface{}, 0, len(order.Items))
+	for _, item := range order.Items {
+		lines = append(lines, []interface{}{orderId, item.LineNo, item.ServiceID, item.Quantity, item.UnitPrice, item.Amount, item.PriceVersion})
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"order_items"}, []string{"order_id", "line_no", "service_id", "quantity", "unit_price", "amount", "price_version"},
+		pgx.CopyFromRows(lines))
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	// move money from user's wallet to hold account
+	err = postEntry(ctx, tx, models.JournalEntry{
+		Kind:      models.EntryReserve,
+		UserID:    userId,
+		OrderID:   &orderId,
+		CreatedAt: order.ReservedAt,
+		Postings:  transfer(models.AccountWallet, userId, models.AccountHold, userId, order.Currency, order.Amount),
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	err = emitEvent(ctx, tx, models.WebhookEvent{
+		Type:      models.EventReserveCreated,
+		UserID:    userId,
+		OrderID:   &orderId,
+		Amount:    order.Amount,
+		Currency:  order.Currency,
+		CreatedAt: order.ReservedAt,
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	// start a new goroutine that returns money to user if the order was not purchased until expiry time
+	go p.releaseOnExpiry(orderId, ReserveTimeout)
+
+	return order, err
+}
+
+// addItemAmount returns amount of line item priced by unit price and total amount of order with it,
+// amounts which do not fit into int64 are rejected instead of wrapping negative
+func addItemAmount(total int64, item models.OrderItem) (int64, int64, error) {
+	if item.Quantity < 0 || item.UnitPrice < 0 || (item.UnitPrice != 0 && item.Quantity > math.MaxInt64/item.UnitPrice) {
+		return 0, 0, newError(ErrInvalidArgument, "db: reserve order: line %d: amount of %d items is too large", item.LineNo, item.Quantity)
+	}
+	amount := item.Quantity * item.UnitPrice
+	if total > math.MaxInt64-amount {
+		return 0, 0, newError(ErrInvalidArgument, "db: reserve order: line %d: total amount of order is too large", item.LineNo)
+	}
+	return amount, total + amount, nil
+}
+
+// GetOrder returns order with its line items by given userId and orderId
+func (p PgxDB) GetOrder(userId, orderId uint64) (models.Order, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get order: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	order, err := getOrder(ctx, tx, userId, orderId)
+	if err != nil {
+		return models.Order{}, err
+	}
+	return order, err
+}
+
+// PurchaseOrder captures given line items of order, not given items are released.
+// Empty lines mean all items of order.
+//
+// 1) checks if order was reserved and was not purchased yet
+//
+// 2) sets reserve status to purchased and marks captured items
+//
+// 3) writes every captured item to operations table, so revenue is attributed to line items
+//
+// 4) moves captured money from user's hold account to revenue of services and returns the rest to user's wallet
+func (p PgxDB) PurchaseOrder(userId, orderId uint64, lines []int) (models.Order, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: purchase order: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	order, err := getOrder(ctx, tx, userId, orderId)
+	if err != nil {
+		return models.Order{}, err
+	} else if order.Purchased {
+		err = newError(ErrFailedPrecondition, "db: purchase order: the purchase has already happened")
+		return models.Order{}, err
+	} else if order.Status != models.ReserveOpen {
+		err = newError(ErrFailedPrecondition, "db: purchase order: order %d is %s", orderId, order.Status)
+		return models.Order{}, err
+	}
+
+	// find captured items
+	capture := make(map[int]bool)
+	for _, line := range lines {
+		if line < 1 || line > len(order.Items) {
+			err = newError(ErrNotFound, "db: purchase order: order %d has no line %d", orderId, line)
+			return models.Order{}, err
+		}
+		capture[line] = true
+	}
+	for i := range order.Items {
+		order.Items[i].Captured = len(lines) == 0 || capture[order.Items[i].LineNo]
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	purchasedAt := time.Now().In(loc)
+
+	// operations cannot be dated in closed accounting period
+	closed, err := isPeriodClosed(ctx, tx, purchasedAt.Year(), int(purchasedAt.Month()))
+	if err != nil {
+		return models.Order{}, err
+	} else if closed {
+		err = newError(ErrPeriodClosed, "db: purchase order: accounting period %02d.%d is closed", purchasedAt.Month(), purchasedAt.Year())
+		return models.Order{}, err
+	}
+	order.Purchased = true
+	order.PurchasedAt = &purchasedAt
+	order.Status = models.ReservePurchased
+
+	_, err = tx.Exec(ctx, "update reserves set status = $1, purchased_at = $2 where order_id = $3",
+		order.Status, order.PurchasedAt, orderId)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	var captured int64
+	var postings []models.Posting
+	for _, item := range order.Items {
+		if !item.Captured {
+			continue
+		}
+		_, err = tx.Exec(ctx, "update order_items set captured = true where order_id = $1 and line_no = $2", orderId, item.LineNo)
+		if err != nil {
+			return models.Order{}, err
+		}
+		_, err = tx.Exec(ctx, "insert into operations (user_id, service_id, service_name, amount, currency, done_at, kind, order_id, line_no) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+			userId, item.ServiceID, item.ServiceName, item.Amount*-1, order.Currency, purchasedAt, models.OperationPurchase, orderId, item.LineNo)
+		if err != nil {
+			return models.Order{}, err
+		}
+		captured += item.Amount
+		postings = append(postings, transfer(models.AccountHold, userId, models.AccountRevenue, item.ServiceID, order.Currency, item.Amount)...)
+	}
+
+	// not captured money is returned to user
+	released := order.Amount - captured
+	if released > 0 {
+		_, err = changeWallet(ctx, tx, userId, order.Currency, released)
+		if err != nil {
+			return models.Order{}, err
+		}
+		postings = append(postings, transfer(models.AccountHold, userId, models.AccountWallet, userId, order.Currency, released)...)
+	}
+
+	err = postEntry(ctx, tx, models.JournalEntry{
+		Kind:      models.EntryPurchase,
+		UserID:    userId,
+		OrderID:   &orderId,
+		CreatedAt: purchasedAt,
+		Postings:  postings,
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	events := []models.WebhookEvent{{Type: models.EventPurchaseCompleted, Amount: captured}}
+	if released > 0 {
+		events = append(events, models.WebhookEvent{Type: models.EventRefundCreated, Amount: released})
+	}
+	for _, event := range events {
+		event.UserID = userId
+		event.OrderID = &orderId
+		event.Currency = order.Currency
+		event.CreatedAt = purchasedAt
+		if err = emitEvent(ctx, tx, event); err != nil {
+			return models.Order{}, err
+		}
+	}
+
+	return order, err
+}
+
+// ReleaseOrder releases not purchased reserve of order with multiple line items by given userId and orderId,
+// the reserve and its line items are kept with released status
+func (p PgxDB) ReleaseOrder(userId, orderId uint64) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: release order: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	order, err := getOrder(ctx, tx, userId, orderId)
+	if err != nil {
+		return err
+	} else if order.Status != models.ReserveOpen {
+		return err
+	}
+
+	// return money and move it from hold account back to user's wallet
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	err = closeReserve(ctx, tx, models.Reserve{
+		OrderID:  orderId,
+		UserID:   userId,
+		Amount:   order.Amount,
+		Currency: order.Currency,
+	}, models.ReserveReleased, time.Now().In(loc))
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// getOrder returns reserve of order with multiple line items and its items by given userId and orderId
+func getOrder(ctx context.Context, tx pgx.Tx, userId, orderId uint64) (models.Order, error) {
+	order := models.Order{Items: make([]models.OrderItem, 0)}
+	err := tx.QueryRow(ctx, "select order_id, user_id, amount, currency, status = 'purchased', reserved_at, purchased_at, expires_at, status, released_at from reserves where order_id = $1 and user_id = $2 and service_id is null",
+		orderId, userId).Scan(&order.OrderID, &order.UserID, &order.Amount, &order.Currency, &order.Purchased, &order.ReservedAt, &order.PurchasedAt, &order.ExpiresAt,
+		&order.Status, &order.ReleasedAt)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return models.Order{}, newError(ErrNotFound, "money were not reserved for order %d of user %d", orderId, userId)
+	} else if err != nil {
+		return models.Order{}, err
+	}
+
+	rows, err := tx.Query(ctx, `select i.line_no, i.service_id, s.name, i.quantity, i.unit_price, i.amount, i.price_version, i.captured
+		from order_items i join services s on s.id = i.service_id where i.order_id = $1 order by i.line_no`, orderId)
+	if err != nil {
+		return models.Order{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item models.OrderItem
+		err = rows.Scan(&item.LineNo, &item.ServiceID, &item.ServiceName, &item.Quantity, &item.UnitPrice, &item.Amount, &item.PriceVersion, &item.Captured)
+		if err != nil {
+			return models.Order{}, err
+		}
+		order.Items = append(order.Items, item)
+	}
+	return order, rows.Err()
+}
@@ -0,0 +1,50 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"math"
+	"testing"
+)
+
+func TestAddItemAmount(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      int64
+		item       models.OrderItem
+		wantAmount int64
+		wantTotal  int64
+		wantErr    bool
+	}{
+		{"first item", 0, models.OrderItem{LineNo: 1, Quantity: 3, UnitPrice: 1050}, 3150, 3150, false},
+		{"next item", 3150, models.OrderItem{LineNo: 2, Quantity: 1, UnitPrice: 100}, 100, 3250, false},
+		{"free item", 100, models.OrderItem{LineNo: 2, Quantity: 5, UnitPrice: 0}, 0, 100, false},
+		{"the largest amount", 0, models.OrderItem{LineNo: 1, Quantity: math.MaxInt64 / 100, UnitPrice: 100}, math.MaxInt64 / 100 * 100, math.MaxInt64 / 100 * 100, false},
+		{"quantity overflows amount", 0, models.OrderItem{LineNo: 1, Quantity: math.MaxInt64/100 + 1, UnitPrice: 100}, 0, 0, true},
+		// 2^62 items by 4 wrap to zero and 2^62+1 items by 4 wrap to 4
+		{"amount wrapping to zero", 0, models.OrderItem{LineNo: 1, Quantity: 1 << 62, UnitPrice: 4}, 0, 0, true},
+		{"amount wrapping to small one", 0, models.OrderItem{LineNo: 1, Quantity: 1<<62 + 1, UnitPrice: 4}, 0, 0, true},
+		{"amount wrapping negative", 0, models.OrderItem{LineNo: 1, Quantity: math.MaxInt64, UnitPrice: 2}, 0, 0, true},
+		{"total overflows", math.MaxInt64 - 10, models.OrderItem{LineNo: 2, Quantity: 1, UnitPrice: 11}, 0, 0, true},
+		{"total reaches the largest amount", math.MaxInt64 - 10, models.OrderItem{LineNo: 2, Quantity: 1, UnitPrice: 10}, 10, math.MaxInt64, false},
+		{"negative quantity", 0, models.OrderItem{LineNo: 1, Quantity: -1, UnitPrice: 100}, 0, 0, true},
+		{"negative unit price", 0, models.OrderItem{LineNo: 1, Quantity: 1, UnitPrice: -100}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, total, err := addItemAmount(tt.total, tt.item)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if ErrorCode(err) != CodeInvalidArgument {
+					t.Errorf("code = %s, want %s", ErrorCode(err), CodeInvalidArgument)
+				}
+				return
+			}
+			if amount != tt.wantAmount || total != tt.wantTotal {
+				t.Errorf("addItemAmount() = %d, %d, want %d, %d", amount, total, tt.wantAmount, tt.wantTotal)
+			}
+		})
+	}
+}
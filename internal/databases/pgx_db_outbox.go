@@ -0,0 +1,149 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// outboxLockKey is key of advisory lock held by the instance which claims messages of outbox
+	outboxLockKey = 0x6f7574626f78
+	// outboxClaim is time messages are claimed by relay for publishing
+	outboxClaim = time.Minute
+)
+
+// writeOutbox writes event for message broker in transaction of the change
+// and notifies listeners of UserEventsChannel about new event of user when transaction is committed
+func writeOutbox(ctx context.Context, tx pgx.Tx, userId uint64, eventType string, version int, createdAt time.Time, event interface{}) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "insert into outbox (user_id, type, version, payload, created_at) values ($1, $2, $3, $4, $5)",
+		userId, eventType, version, payload, createdAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "select pg_notify($1, $2)", UserEventsChannel, strconv.FormatUint(userId, 10))
+	return err
+}
+
+// RelayOutbox publishes not sent outbox messages in order of their ids by given publish function
+// and marks published messages as sent. Returns number of published messages.
+//
+// 1) messages are claimed in a short transaction, so publishing to the broker does not hold locks of writers of outbox
+//
+// 2) only one relay has claimed messages at a time, the others return at once, so messages of every user are published in order.
+// Claim of relay which has failed expires after outboxClaim
+//
+// 3) relay stops at the first message which was not published, so later messages are not published before it
+//
+// 4) message which was published but not marked as sent is published again, broker drops it by message id
+func (p PgxDB) RelayOutbox(limit int, publish func(message models.OutboxMessage) error) (int, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: relay outbox: %v", err), nil)
+		}
+	}()
+
+	messages, err := p.claimOutbox(ctx, limit)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	// published messages are marked as sent even if publishing of a later one fails
+	var publishErr error
+	claimed := make([]uint64, 0, len(messages))
+	sent := make([]uint64, 0, len(messages))
+	for _, m := range messages {
+		claimed = append(claimed, m.ID)
+		if publishErr == nil {
+			if publishErr = publish(m); publishErr != nil {
+				publishErr = fmt.Errorf("db: relay outbox: message %d is not published: %v", m.ID, publishErr)
+			} else {
+				sent = append(sent, m.ID)
+			}
+		}
+	}
+
+	// claims of not published messages are released, so the next relay starts from them
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	_, err = p.Exec(ctx, "update outbox set claimed_until = null, sent_at = case when id = any($2) then $3::timestamp end where id = any($1)",
+		claimed, sent, time.Now().In(loc))
+	if err != nil {
+		return 0, err
+	}
+	return len(sent), publishErr
+}
+
+// claimOutbox claims not sent outbox messages in order of their ids for outboxClaim,
+// no messages are claimed while claim of other relay has not expired
+func (p PgxDB) claimOutbox(ctx context.Context, limit int) ([]models.OutboxMessage, error) {
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var locked bool
+	err = tx.QueryRow(ctx, "select pg_try_advisory_xact_lock($1)", outboxLockKey).Scan(&locked)
+	if err != nil || !locked {
+		// other instance claims messages
+		return nil, err
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	now := time.Now().In(loc)
+	var claimedByOther bool
+	err = tx.QueryRow(ctx, "select exists (select 1 from outbox where sent_at is null and claimed_until > $1)", now).Scan(&claimedByOther)
+	if err != nil || claimedByOther {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "select id, user_id, type, version, payload, created_at from outbox where sent_at is null order by id limit $1 for update skip locked",
+		limit)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]models.OutboxMessage, 0)
+	ids := make([]uint64, 0)
+	for rows.Next() {
+		var m models.OutboxMessage
+		if err = rows.Scan(&m.ID, &m.UserID, &m.Type, &m.Version, &m.Payload, &m.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		messages = append(messages, m)
+		ids = append(ids, m.ID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, "update outbox set claimed_until = $2 where id = any($1)", ids, now.Add(outboxClaim))
+	if err != nil {
+		return nil, err
+	}
+	return messages, err
+}
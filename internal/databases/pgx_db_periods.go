@@ -0,0 +1,111 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ClosePeriod closes accounting period by given year and month and freezes its closing report.
+//
+// 1) checks that the period has already started and is not closed yet
+//
+// 2) marks the period as closed, so operations dated in it are rejected
+//
+// 3) creates a new report version marked as closing, its files are put into place after transaction is committed
+func (p PgxDB) ClosePeriod(year, month int) (report models.Report, err error) {
+	ctx := p.callContext()
+
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: close period: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	var files *reportFiles
+	defer func() {
+		if closeErr := closeReportTx(ctx, tx, files, err); err == nil && closeErr != nil {
+			report, err = models.Report{}, closeErr
+		}
+	}()
+
+	// set time location
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+
+	if year > date.Year() || (year == date.Year() && month > int(date.Month())) {
+		err = newError(ErrInvalidArgument, "db: close period: period %02d.%d has not started yet", month, year)
+		return models.Report{}, err
+	}
+
+	closed, err := isPeriodClosed(ctx, tx, year, month)
+	if err != nil {
+		return models.Report{}, err
+	} else if closed {
+		err = newError(ErrFailedPrecondition, "db: close period: period %02d.%d is already closed", month, year)
+		return models.Report{}, err
+	}
+
+	_, err = tx.Exec(ctx, "insert into closed_periods (year, month, closed_at) values ($1, $2, $3)", year, month, date)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	report, files, err = createReport(ctx, tx, year, month, true)
+	if err != nil {
+		return models.Report{}, err
+	}
+	return report, err
+}
+
+// GetClosedPeriods returns all closed accounting periods ordered by date
+func (p PgxDB) GetClosedPeriods() ([]models.Period, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get closed periods: %v", err), nil)
+		}
+	}()
+
+	rows, err := p.Query(ctx, "select year, month, closed_at from closed_periods order by year, month")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []models.Period
+	for rows.Next() {
+		var period models.Period
+		if err = rows.Scan(&period.Year, &period.Month, &period.ClosedAt); err != nil {
+			return nil, err
+		}
+		periods = append(periods, period)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return periods, err
+}
+
+// isPeriodClosed checks if accounting period by given year and month is closed
+func isPeriodClosed(ctx context.Context, tx pgx.Tx, year, month int) (bool, error) {
+	var closed bool
+	err := tx.QueryRow(ctx, "select exists(select 1 from closed_periods where year = $1 and month = $2)",
+		year, month).Scan(&closed)
+	return closed, err
+}
@@ -2,6 +2,7 @@ package databases
 
 import (
 	"balance/internal/models"
+	"balance/internal/utils"
 
 	"context"
 	"errors"
@@ -11,15 +12,18 @@ import (
 	"github.com/jackc/pgx/v4"
 )
 
-// Purchase performs the purchase transaction for given orderId, userId, serviceId and amount.
+// Purchase performs the purchase transaction for given orderId, userId, serviceId, amount and currency.
+// Empty currency means currency of the reserve.
 //
-// 1) checks if money were reserved or purchase has already happened
+// 1) checks if money were reserved in the same currency or purchase has already happened
 //
 // 2) if everything is ok sets reserve status to purchased
 //
 // 3) writes report to operations table
-func (p PgxDB) Purchase(userId, serviceId, orderId uint64, amount int64) error {
-	ctx := context.Background()
+//
+// 4) moves money from user's hold account to service revenue in ledger
+func (p PgxDB) Purchase(userId, serviceId, orderId uint64, amount int64, currency string) error {
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
@@ -44,6 +48,14 @@ func (p PgxDB) Purchase(userId, serviceId, orderId uint64, amount int64) error {
 		}
 	}()
 
+	err = purchase(ctx, tx, userId, serviceId, orderId, amount, currency)
+	return err
+}
+
+// purchase purchases reserve in given transaction, see Purchase
+func purchase(ctx context.Context, tx pgx.Tx, userId, serviceId, orderId uint64, amount int64, currency string) error {
+	var err error
+
 	reserve := models.Reserve{
 		UserID:    userId,
 		ServiceID: serviceId,
@@ -51,48 +63,88 @@ func (p PgxDB) Purchase(userId, serviceId, orderId uint64, amount int64) error {
 	}
 
 	// find reserve
-	err = tx.QueryRow(ctx, "select * from reserves where order_id = $1 and user_id = $2 and service_id = $3",
-		reserve.OrderID, reserve.UserID, reserve.ServiceID).Scan(&reserve.OrderID, &reserve.UserID, &reserve.ServiceID,
-		&reserve.Amount, &reserve.Purchased, &reserve.ReservedAt, &reserve.PurchasedAt)
+	err = scanReserve(tx.QueryRow(ctx, "select "+reserveColumns+" from reserves where order_id = $1 and user_id = $2 and service_id = $3",
+		reserve.OrderID, reserve.UserID, reserve.ServiceID), &reserve)
 	if err != nil && errors.Is(err, pgx.ErrNoRows) { // reserve not found
-		err = fmt.Errorf("db: get purchase: money were not reserved for order %d, user %d and service %d", userId, serviceId, orderId)
+		err = newError(ErrNotFound, "db: get purchase: money were not reserved for order %d, user %d and service %d", userId, serviceId, orderId)
 		return err
 	} else if err != nil {
 		return err
+	} else if currency != "" && reserve.Currency != currency { // wrong currency
+		err = newError(ErrInvalidArgument, "db: purchase: wrong purchase currency, stored in reserve: %s, got: %s", reserve.Currency, currency)
+		return err
 	} else if reserve.Amount != amount { // wrong amount
-		got := (float32(amount%100) * 0.01) + float32(amount/100)
-		stored := (float32(reserve.Amount%100) * 0.01) + float32(reserve.Amount/100)
-		err = fmt.Errorf("db: purchase: wrong purchase amount, stored in reserve: %.2f, got: %.2f", stored, got)
+		err = newError(ErrInvalidArgument, "db: purchase: wrong purchase amount, stored in reserve: %s, got: %s",
+			utils.FormatMoney(reserve.Amount, reserve.Currency), utils.FormatMoney(amount, reserve.Currency))
 		return err
 	} else if reserve.Purchased { // already purchased
-		err = errors.New("db: purchase: the purchase has already happened")
+		err = newError(ErrFailedPrecondition, "db: purchase: the purchase has already happened")
+		return err
+	} else if reserve.Status != models.ReserveOpen { // released or expired
+		err = newError(ErrFailedPrecondition, "db: purchase: reserve of order %d is %s", orderId, reserve.Status)
 		return err
 	}
 
 	loc, _ := time.LoadLocation("Europe/Moscow")
 	purchasedAt := time.Now().In(loc)
+
+	// operations cannot be dated in closed accounting period
+	closed, err := isPeriodClosed(ctx, tx, purchasedAt.Year(), int(purchasedAt.Month()))
+	if err != nil {
+		return err
+	} else if closed {
+		err = newError(ErrPeriodClosed, "db: purchase: accounting period %02d.%d is closed", purchasedAt.Month(), purchasedAt.Year())
+		return err
+	}
 	reserve.PurchasedAt = &purchasedAt
 	reserve.Purchased = true
+	reserve.Status = models.ReservePurchased
 
 	// update purchase status
 	var updateId uint64
-	err = tx.QueryRow(ctx, "update reserves SET purchased = $1, purchased_at = $2 where order_id = $3 returning order_id",
-		reserve.Purchased, reserve.PurchasedAt, reserve.OrderID).Scan(&updateId)
+	err = tx.QueryRow(ctx, "update reserves SET status = $1, purchased_at = $2 where order_id = $3 returning order_id",
+		reserve.Status, reserve.PurchasedAt, reserve.OrderID).Scan(&updateId)
 	if err != nil {
 		return err
 	}
 
 	// write to operations table
 	var service models.Service
-	err = tx.QueryRow(ctx, "select * from services where id = $1;", serviceId).Scan(&service.ID, &service.Name)
+	err = tx.QueryRow(ctx, "select id, name, currency from services where id = $1;", serviceId).Scan(&service.ID, &service.Name, &service.Currency)
 	if err != nil {
 		return err
 	}
 	reserve.Service = service
 
 	var createdId uint64
-	err = tx.QueryRow(ctx, "insert into operations (user_id, service_id, service_name, amount, done_at) values ($1, $2, $3, $4, $5) returning id",
-		reserve.UserID, reserve.ServiceID, reserve.Service.Name, reserve.Amount*-1, purchasedAt).Scan(&createdId)
+	err = tx.QueryRow(ctx, "insert into operations (user_id, service_id, service_name, amount, currency, done_at, kind, order_id) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id",
+		reserve.UserID, reserve.ServiceID, reserve.Service.Name, reserve.Amount*-1, reserve.Currency, purchasedAt, models.OperationPurchase, reserve.OrderID).Scan(&createdId)
+	if err != nil {
+		return err
+	}
+
+	// move money from user's hold account to service revenue
+	err = postEntry(ctx, tx, models.JournalEntry{
+		Kind:      models.EntryPurchase,
+		UserID:    reserve.UserID,
+		ServiceID: &reserve.ServiceID,
+		OrderID:   &reserve.OrderID,
+		CreatedAt: purchasedAt,
+		Postings:  transfer(models.AccountHold, reserve.UserID, models.AccountRevenue, reserve.ServiceID, reserve.Currency, reserve.Amount),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = emitEvent(ctx, tx, models.WebhookEvent{
+		Type:      models.EventPurchaseCompleted,
+		UserID:    reserve.UserID,
+		ServiceID: &reserve.ServiceID,
+		OrderID:   &reserve.OrderID,
+		Amount:    reserve.Amount,
+		Currency:  reserve.Currency,
+		CreatedAt: purchasedAt,
+	})
 	if err != nil {
 		return err
 	}
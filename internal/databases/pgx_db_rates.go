@@ -0,0 +1,345 @@
+package databases
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// AddExchangeRates saves uploaded exchange rates. Rates are never overwritten,
+// the latest valid rate is used for every moment of time
+func (p PgxDB) AddExchangeRates(rates []models.ExchangeRate) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: add exchange rates: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	createdAt := time.Now().In(loc)
+	for _, r := range rates {
+		_, err = tx.Exec(ctx, "insert into exchange_rates (base, quote, rate, spread, valid_from, valid_to, created_at) values ($1, $2, $3, $4, $5, $6, $7)",
+			r.Base, r.Quote, r.Rate, r.Spread, r.ValidFrom, r.ValidTo, createdAt)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// GetExchangeRate returns exchange rate from base to quote currency valid at given time
+func (p PgxDB) GetExchangeRate(base, quote string, at time.Time) (models.ExchangeRate, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get exchange rate: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	rate, err := findExchangeRate(ctx, tx, base, quote, at)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	return rate, err
+}
+
+// Convert converts money of user from one currency to another by exchange rate valid at the moment.
+//
+// 1) checks that user has enough money in wallet of from currency
+//
+// 2) finds exchange rate and calculates converted amount: amount * rate * (1 - spread) rounded down
+//
+// 3) debits wallet of from currency, credits wallet of to currency and writes both sides
+// of conversion to operations table with applied rate and spread
+//
+// 4) moves money through exchange account in ledger, spread stays on exchange account
+func (p PgxDB) Convert(userId uint64, from, to string, amount int64) (models.Conversion, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: convert: %v", err), nil)
+		}
+	}()
+
+	if from == to {
+		err = newError(ErrInvalidArgument, "db: convert: currencies must differ")
+		return models.Conversion{}, err
+	} else if amount <= 0 {
+		err = newError(ErrInvalidArgument, "db: convert: amount must be positive")
+		return models.Conversion{}, err
+	}
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Conversion{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// operations cannot be dated in closed accounting period
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+	closed, err := isPeriodClosed(ctx, tx, date.Year(), int(date.Month()))
+	if err != nil {
+		return models.Conversion{}, err
+	} else if closed {
+		err = newError(ErrPeriodClosed, "db: convert: accounting period %02d.%d is closed", date.Month(), date.Year())
+		return models.Conversion{}, err
+	}
+
+	var balance int64
+	err = tx.QueryRow(ctx, "select coalesce(w.balance, 0) from users u left join wallets w on w.user_id = u.id and w.currency = $2 where u.id = $1;",
+		userId, from).Scan(&balance)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: convert: no such user with id %d", userId)
+		return models.Conversion{}, err
+	} else if err != nil {
+		return models.Conversion{}, err
+	}
+	if balance < amount {
+		err = newError(ErrInsufficientFunds, "db: convert: not enough money in %s wallet", from)
+		return models.Conversion{}, err
+	}
+
+	rate, err := findExchangeRate(ctx, tx, from, to, date)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+	rateValue, err := utils.ParseDecimal(rate.Rate)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+	spreadValue, err := utils.ParseDecimal(rate.Spread)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+
+	conversion := models.Conversion{
+		UserID:    userId,
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Converted: utils.ConvertMoney(amount, from, to, rateValue, spreadValue),
+		Rate:      rate.Rate,
+		Spread:    rate.Spread,
+		DoneAt:    date,
+	}
+	if conversion.Converted <= 0 {
+		err = newError(ErrInvalidArgument, "db: convert: amount %s %s is too small to convert", utils.FormatMoney(amount, from), from)
+		return models.Conversion{}, err
+	}
+
+	_, err = changeWallet(ctx, tx, userId, from, -conversion.Amount)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+	_, err = changeWallet(ctx, tx, userId, to, conversion.Converted)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+
+	// both sides of conversion are written to operations table, so balances could be restored from it
+	for _, side := range []struct {
+		amount   int64
+		currency string
+	}{{-conversion.Amount, from}, {conversion.Converted, to}} {
+		_, err = tx.Exec(ctx, "insert into operations (user_id, amount, currency, done_at, kind, rate, spread) values ($1, $2, $3, $4, $5, $6, $7)",
+			userId, side.amount, side.currency, date, models.OperationConversion, conversion.Rate, conversion.Spread)
+		if err != nil {
+			return models.Conversion{}, err
+		}
+	}
+
+	// sell money to exchange account and buy converted money from it
+	postings := transfer(models.AccountWallet, userId, models.AccountExchange, 0, from, conversion.Amount)
+	postings = append(postings, transfer(models.AccountExchange, 0, models.AccountWallet, userId, to, conversion.Converted)...)
+	err = postEntry(ctx, tx, models.JournalEntry{
+		Kind:      models.EntryConversion,
+		UserID:    userId,
+		CreatedAt: date,
+		Postings:  postings,
+	})
+	if err != nil {
+		return models.Conversion{}, err
+	}
+	return conversion, err
+}
+
+// GetRestatedReport returns the latest version of report by given year and month with revenue
+// restated in given currency by exchange rates valid at the end of the month. Spread is not applied
+func (p PgxDB) GetRestatedReport(year, month int, currency string) (models.RestatedReport, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get restated report: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return models.RestatedReport{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// rates are taken at the last moment of the month
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	report := models.RestatedReport{
+		Currency: currency,
+		RatesAt:  time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, loc).Add(-time.Second),
+		Lines:    make([]models.RestatedReportLine, 0),
+	}
+	err = tx.QueryRow(ctx, "select id, year, month, version, closing, sha256, created_at from reports where year = $1 and month = $2 order by version desc limit 1",
+		year, month).Scan(&report.ID, &report.Year, &report.Month, &report.Version, &report.Closing, &report.SHA256, &report.CreatedAt)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: get restated report: report from %d.%d doesn't exist", month, year)
+		return models.RestatedReport{}, err
+	} else if err != nil {
+		return models.RestatedReport{}, err
+	}
+
+	rows, err := tx.Query(ctx, "select service_name, currency, amount from report_lines where report_id = $1 order by service_name, currency", report.ID)
+	if err != nil {
+		return models.RestatedReport{}, err
+	}
+	for rows.Next() {
+		var l models.RestatedReportLine
+		if err = rows.Scan(&l.ServiceName, &l.Currency, &l.Amount); err != nil {
+			rows.Close()
+			return models.RestatedReport{}, err
+		}
+		report.Lines = append(report.Lines, l)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.RestatedReport{}, err
+	}
+
+	// every currency of report is restated by one rate
+	rates := make(map[string]*big.Rat)
+	for i, l := range report.Lines {
+		rate, ok := rates[l.Currency]
+		if !ok {
+			var exchangeRate models.ExchangeRate
+			exchangeRate, err = findExchangeRate(ctx, tx, l.Currency, currency, report.RatesAt)
+			if err != nil {
+				return models.RestatedReport{}, err
+			}
+			if rate, err = utils.ParseDecimal(exchangeRate.Rate); err != nil {
+				return models.RestatedReport{}, err
+			}
+			rates[l.Currency] = rate
+		}
+		report.Lines[i].Rate = utils.FormatDecimal(rate)
+		report.Lines[i].Converted = utils.ConvertMoney(l.Amount, l.Currency, currency, rate, new(big.Rat))
+		report.Total += report.Lines[i].Converted
+	}
+
+	return report, err
+}
+
+// findExchangeRate returns exchange rate from base to quote currency valid at given time.
+// If there is no direct rate, inverse rate from quote to base currency is used
+func findExchangeRate(ctx context.Context, tx pgx.Tx, base, quote string, at time.Time) (models.ExchangeRate, error) {
+	if base == quote {
+		return models.ExchangeRate{Base: base, Quote: quote, Rate: "1", Spread: "0", ValidFrom: at}, nil
+	}
+
+	query := `select id, base, quote, trim_scale(rate)::text, trim_scale(spread)::text, valid_from, valid_to, created_at from exchange_rates
+		where base = $1 and quote = $2 and valid_from <= $3 and (valid_to is null or valid_to > $3)
+		order by valid_from desc, id desc limit 1`
+
+	var rate models.ExchangeRate
+	err := tx.QueryRow(ctx, query, base, quote, at).Scan(&rate.ID, &rate.Base, &rate.Quote, &rate.Rate, &rate.Spread,
+		&rate.ValidFrom, &rate.ValidTo, &rate.CreatedAt)
+	if err == nil {
+		return rate, nil
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return models.ExchangeRate{}, err
+	}
+
+	err = tx.QueryRow(ctx, query, quote, base, at).Scan(&rate.ID, &rate.Base, &rate.Quote, &rate.Rate, &rate.Spread,
+		&rate.ValidFrom, &rate.ValidTo, &rate.CreatedAt)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return models.ExchangeRate{}, newError(ErrNotFound, "no exchange rate from %s to %s at %s", base, quote, at.Format("2006-01-02 15:04:05"))
+	} else if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	inverse, err := utils.ParseDecimal(rate.Rate)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	rate.Base, rate.Quote = base, quote
+	rate.Rate = utils.FormatDecimal(inverse.Inv(inverse))
+	return rate, nil
+}
@@ -0,0 +1,169 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// mismatchesQuery selects wallets whose balance is not equal to sum of operations in wallet currency minus held money
+// or to balance of wallet account derived from ledger postings
+const mismatchesQuery = `select w.user_id, w.currency, w.balance, coalesce(o.total, 0), coalesce(r.held, 0), coalesce(l.wallet, 0)
+	from wallets w
+	left join (select user_id, currency, sum(amount) as total from operations group by user_id, currency) o
+		on o.user_id = w.user_id and o.currency = w.currency
+	left join (select user_id, currency, sum(amount) as held from reserves where status = 'open' group by user_id, currency) r
+		on r.user_id = w.user_id and r.currency = w.currency
+	left join (select a.owner_id, a.currency, sum(ps.amount) as wallet from accounts a join postings ps on ps.account_id = a.id
+		where a.kind = 'wallet' group by a.owner_id, a.currency) l on l.owner_id = w.user_id and l.currency = w.currency
+	where (w.balance <> coalesce(o.total, 0) - coalesce(r.held, 0) or w.balance <> coalesce(l.wallet, 0))`
+
+// scanMismatch scans row selected by mismatchesQuery and calculates differences
+func scanMismatch(row pgx.Row) (models.BalanceMismatch, error) {
+	var m models.BalanceMismatch
+	err := row.Scan(&m.UserID, &m.Currency, &m.Balance, &m.Journal, &m.Held, &m.Wallet)
+	m.Difference = m.Balance - (m.Journal - m.Held)
+	m.WalletDifference = m.Balance - m.Wallet
+	return m, err
+}
+
+// Reconcile recomputes balances of all wallets from operations and open reserves and returns wallets whose
+// stored balance differs from the recomputed one
+func (p PgxDB) Reconcile() (models.Reconciliation, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: reconcile: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	reconciliation := models.Reconciliation{
+		CheckedAt:  time.Now().In(loc),
+		Mismatches: make([]models.BalanceMismatch, 0),
+	}
+
+	err = tx.QueryRow(ctx, "select count(*) from wallets").Scan(&reconciliation.Wallets)
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+
+	rows, err := tx.Query(ctx, mismatchesQuery+" order by w.user_id, w.currency")
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m models.BalanceMismatch
+		if m, err = scanMismatch(rows); err != nil {
+			return models.Reconciliation{}, err
+		}
+		reconciliation.Mismatches = append(reconciliation.Mismatches, m)
+	}
+	if err = rows.Err(); err != nil {
+		return models.Reconciliation{}, err
+	}
+
+	return reconciliation, err
+}
+
+// CorrectBalances writes correcting operations and ledger entries for given mismatches, so operations and wallets match users balance.
+// Mismatch is corrected only if it is still the same as given, otherwise the whole transaction fails
+func (p PgxDB) CorrectBalances(mismatches []models.BalanceMismatch) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: correct balances: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// operations cannot be dated in closed accounting period
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+	closed, err := isPeriodClosed(ctx, tx, date.Year(), int(date.Month()))
+	if err != nil {
+		return err
+	} else if closed {
+		err = newError(ErrPeriodClosed, "db: correct balances: accounting period %02d.%d is closed", date.Month(), date.Year())
+		return err
+	}
+
+	for _, m := range mismatches {
+		// check that mismatch has not changed since it was confirmed
+		var current models.BalanceMismatch
+		current, err = scanMismatch(tx.QueryRow(ctx, mismatchesQuery+" and w.user_id = $1 and w.currency = $2", m.UserID, m.Currency))
+		if err != nil {
+			err = newError(ErrFailedPrecondition, "db: correct balances: no mismatch for user %d in %s: %v", m.UserID, m.Currency, err)
+			return err
+		}
+		if current.Difference != m.Difference || current.WalletDifference != m.WalletDifference {
+			err = newError(ErrFailedPrecondition, "db: correct balances: mismatch for user %d in %s has changed", m.UserID, m.Currency)
+			return err
+		}
+
+		if m.Difference != 0 {
+			var createdId uint64
+			err = tx.QueryRow(ctx, "insert into operations (user_id, amount, currency, done_at, kind) values ($1, $2, $3, $4, $5) returning id",
+				m.UserID, m.Difference, m.Currency, date, models.OperationCorrection).Scan(&createdId)
+			if err != nil {
+				return err
+			}
+		}
+
+		if m.WalletDifference != 0 {
+			err = postEntry(ctx, tx, models.JournalEntry{
+				Kind:      models.EntryCorrection,
+				UserID:    m.UserID,
+				CreatedAt: date,
+				Postings:  transfer(models.AccountFunding, 0, models.AccountWallet, m.UserID, m.Currency, m.WalletDifference),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return err
+}
@@ -1,98 +1,343 @@
 package databases
 
 import (
+	"balance/internal/models"
 	"balance/internal/utils"
 
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
-	"errors"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/jackc/pgx/v4"
 )
 
-// CreateReport creates report file and returns relative path to it
-func (p PgxDB) CreateReport(year, month int) (string, error) {
-	ctx := context.Background()
+// CreateReport creates a new version of report file for given year and month and returns it.
+// Previous versions are never overwritten, diff against the previous version is written next to the report.
+// Files are put into place only after transaction is committed, so they always match the stored version
+func (p PgxDB) CreateReport(year, month int) (report models.Report, err error) {
+	ctx := p.callContext()
 
 	// log error
-	var err error
 	defer func() {
 		if err != nil {
 			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: create report: %v", err), nil)
 		}
 	}()
 
-	type parsedRow struct {
-		ServiceName string
-		Amount      int64
+	// start transaction and defer its closing, failed commit is returned, so report without files is never returned
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Report{}, err
 	}
 
-	// get all operation from given month
-	from := utils.FirstDayInMonth(year, month)
-	to := utils.LastDayInMonth(year, month)
-	rows, _ := p.Query(ctx, "select * from operations where service_id is not null and done_at between $1 and $2 order by service_name",
-		from, to)
+	var files *reportFiles
+	defer func() {
+		if closeErr := closeReportTx(ctx, tx, files, err); err == nil && closeErr != nil {
+			report, err = models.Report{}, closeErr
+		}
+	}()
+
+	report, files, err = createReport(ctx, tx, year, month, false)
+	if err != nil {
+		return models.Report{}, err
+	}
+	return report, err
+}
+
+// GetReports returns all versions of report by given year and month ordered by version
+func (p PgxDB) GetReports(year, month int) ([]models.Report, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get reports: %v", err), nil)
+		}
+	}()
+
+	rows, err := p.Query(ctx, "select id, year, month, version, closing, sha256, created_at from reports where year = $1 and month = $2 order by version",
+		year, month)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	// parse rows to row struct
-	var parsedRows []parsedRow
+	var reports []models.Report
 	for rows.Next() {
-		var r parsedRow
-		var tempUint uint64 // we need this because if we select certain columns pgx returns error: "number of field descriptions must equal number of destinations, got 1 and 2"
-		var tempTime time.Time
-		err := rows.Scan(&tempUint, &tempUint, &tempUint, &r.ServiceName, &r.Amount, &tempTime)
+		var r models.Report
+		err = rows.Scan(&r.ID, &r.Year, &r.Month, &r.Version, &r.Closing, &r.SHA256, &r.CreatedAt)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, err
+}
+
+// createReport builds report from operations of given month, stores it as the next version and writes csv files
+// under temporary names, caller puts them into place by closeReportTx.
+// closing marks the version frozen when the period was closed
+func createReport(ctx context.Context, tx pgx.Tx, year, month int, closing bool) (models.Report, *reportFiles, error) {
+	// get revenue of every service in every currency from given month
+	from := utils.FirstDayInMonth(year, month)
+	to := utils.LastDayInMonth(year, month)
+	rows, err := tx.Query(ctx, "select service_name, currency, sum(amount) from operations where service_id is not null and done_at >= $1 and done_at < $2 group by service_name, currency order by service_name, currency",
+		from, to)
+	if err != nil {
+		return models.Report{}, nil, err
+	}
+	current := make(map[reportLineKey]int64)
+	var keys []reportLineKey
+	for rows.Next() {
+		var key reportLineKey
+		var amount int64
+		if err = rows.Scan(&key.ServiceName, &key.Currency, &amount); err != nil {
+			rows.Close()
+			return models.Report{}, nil, err
 		}
-		parsedRows = append(parsedRows, r)
+		current[key] = amount * -1 // purchases are stored as negative amounts
+		keys = append(keys, key)
 	}
+	rows.Close()
 	if err = rows.Err(); err != nil {
-		return "", err
+		return models.Report{}, nil, err
+	}
+
+	report := models.Report{
+		Year:    year,
+		Month:   month,
+		Closing: closing,
 	}
 
-	// convert parsed rows to csv table rows
-	csvRows := make(map[string]int64)
-	for _, r := range parsedRows {
-		csvRows[r.ServiceName] += r.Amount
+	// find the previous version and its lines
+	var previousId uint64
+	err = tx.QueryRow(ctx, "select coalesce(max(version), 0), coalesce(max(id), 0) from reports where year = $1 and month = $2",
+		year, month).Scan(&report.Version, &previousId)
+	if err != nil {
+		return models.Report{}, nil, err
 	}
+	report.Version++
 
-	// open out file
-	// if file and dir for it are not created - create them
-	filePath := utils.GetReportFilePath(year, month)
-	_, err = os.Stat(filePath)
-	if errors.Is(err, os.ErrNotExist) {
-		err = os.MkdirAll(utils.GetReportFileDir(year, month), os.ModePerm)
+	previous := make(map[reportLineKey]int64)
+	if previousId != 0 {
+		rows, err = tx.Query(ctx, "select service_name, currency, amount from report_lines where report_id = $1", previousId)
 		if err != nil {
-			return "", err
+			return models.Report{}, nil, err
+		}
+		for rows.Next() {
+			var key reportLineKey
+			var amount int64
+			if err = rows.Scan(&key.ServiceName, &key.Currency, &amount); err != nil {
+				rows.Close()
+				return models.Report{}, nil, err
+			}
+			previous[key] = amount
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return models.Report{}, nil, err
 		}
-	} else if err != nil {
-		return "", err
 	}
 
-	file, err := os.Create(filePath)
+	// write csv table into buffer, so it could be hashed before saving
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	err = w.Write([]string{"service_name", "currency", "month_amount"})
 	if err != nil {
-		return "", err
+		return models.Report{}, nil, err
+	}
+	for _, key := range keys {
+		if err = w.Write([]string{key.ServiceName, key.Currency, utils.FormatMoney(current[key], key.Currency)}); err != nil {
+			return models.Report{}, nil, err
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return models.Report{}, nil, err
+	}
+	digest := sha256.Sum256(buf.Bytes())
+	report.SHA256 = hex.EncodeToString(digest[:])
+
+	// save report version and its lines
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	report.CreatedAt = time.Now().In(loc)
+	err = tx.QueryRow(ctx, "insert into reports (year, month, version, closing, sha256, created_at) values ($1, $2, $3, $4, $5, $6) returning id",
+		report.Year, report.Month, report.Version, report.Closing, report.SHA256, report.CreatedAt).Scan(&report.ID)
+	if err != nil {
+		return models.Report{}, nil, err
 	}
-	defer func() {
-		err = file.Close()
-	}()
 
-	w := csv.NewWriter(file)
-	defer w.Flush()
+	lines := make([][]interface{}, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, []interface{}{report.ID, key.ServiceName, key.Currency, current[key]})
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"report_lines"}, []string{"report_id", "service_name", "currency", "amount"}, pgx.CopyFromRows(lines))
+	if err != nil {
+		return models.Report{}, nil, err
+	}
+
+	// compare with the previous version
+	if previousId != 0 {
+		report.Diff = diffReportLines(previous, current)
+	}
+
+	// write files under temporary names, they are put into place only after transaction is committed
+	files := &reportFiles{}
+	err = files.write(year, month, utils.GetReportFilePath(year, month, report.Version), buf.Bytes())
+	if err != nil {
+		files.discard()
+		return models.Report{}, nil, err
+	}
+	if previousId != 0 {
+		var diffFile []byte
+		diffFile, err = reportDiffToCSV(report.Diff)
+		if err == nil {
+			err = files.write(year, month, utils.GetReportDiffFilePath(year, month, report.Version), diffFile)
+		}
+		if err != nil {
+			files.discard()
+			return models.Report{}, nil, err
+		}
+	}
+
+	return report, files, err
+}
+
+// reportFiles holds files of report version written under temporary names until transaction is committed
+type reportFiles struct {
+	paths []string // final paths of files
+	temps []string // temporary paths of files in the same order
+}
+
+// write writes file to temporary name in dir of report month, so it can be renamed to given path later
+func (f *reportFiles) write(year, month int, path string, data []byte) error {
+	dir := utils.GetReportFileDir(year, month)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".report-*.tmp")
+	if err != nil {
+		return err
+	}
+	f.paths = append(f.paths, path)
+	f.temps = append(f.temps, file.Name())
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	return err
+}
 
-	// write header and rows of csv table
-	err = w.Write([]string{"service_name", "month_amount"})
+// publish renames files into place, it must be called only after transaction is committed
+func (f *reportFiles) publish() error {
+	for i, path := range f.paths {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			f.discard()
+			return err
+		}
+		if err := os.Rename(f.temps[i], path); err != nil {
+			f.discard()
+			return err
+		}
+	}
+	return nil
+}
+
+// discard removes files which are not renamed into place yet
+func (f *reportFiles) discard() {
+	for _, temp := range f.temps {
+		os.Remove(temp)
+	}
+}
+
+// closeReportTx closes transaction which created report version and puts its files into place if it is committed
+func closeReportTx(ctx context.Context, tx pgx.Tx, files *reportFiles, err error) error {
 	if err != nil {
-		return "", err
+		if files != nil {
+			files.discard()
+		}
+		return tx.Rollback(ctx)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		files.discard()
+		return err
+	}
+	return files.publish()
+}
+
+// reportLineKey identifies line of report, revenue in different currencies is reported separately
+type reportLineKey struct {
+	ServiceName string
+	Currency    string
+}
+
+// diffReportLines returns lines of services whose amount differs between two report versions
+func diffReportLines(previous, current map[reportLineKey]int64) []models.ReportDiffLine {
+	keys := make(map[reportLineKey]struct{})
+	for key := range previous {
+		keys[key] = struct{}{}
 	}
-	for name, amount := range csvRows {
-		if err = w.Write([]string{name, fmt.Sprintf("%.2f", float32(amount)*-0.01)}); err != nil {
-			return "", err
+	for key := range current {
+		keys[key] = struct{}{}
+	}
+
+	diff := make([]models.ReportDiffLine, 0)
+	for key := range keys {
+		if previous[key] != current[key] {
+			diff = append(diff, models.ReportDiffLine{
+				ServiceName: key.ServiceName,
+				Currency:    key.Currency,
+				Previous:    previous[key],
+				Current:     current[key],
+			})
 		}
 	}
+	sort.Slice(diff, func(i, j int) bool {
+		if diff[i].ServiceName != diff[j].ServiceName {
+			return diff[i].ServiceName < diff[j].ServiceName
+		}
+		return diff[i].Currency < diff[j].Currency
+	})
+	return diff
+}
 
-	return filePath[1:], nil
+// reportDiffToCSV converts diff lines into csv table
+func reportDiffToCSV(diff []models.ReportDiffLine) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	err := w.Write([]string{"service_name", "currency", "previous_amount", "current_amount", "change"})
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range diff {
+		err = w.Write([]string{
+			l.ServiceName,
+			l.Currency,
+			utils.FormatMoney(l.Previous, l.Currency),
+			utils.FormatMoney(l.Current, l.Currency),
+			utils.FormatMoney(l.Current-l.Previous, l.Currency),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
 }
@@ -0,0 +1,60 @@
+package databases
+
+import (
+	"balance/internal/utils"
+
+	"os"
+	"testing"
+)
+
+func TestReportFiles(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// files of rolled back version are not left behind
+	discarded := &reportFiles{}
+	if err = discarded.write(2022, 10, utils.GetReportFilePath(2022, 10, 1), []byte("rolled back")); err != nil {
+		t.Fatal(err)
+	}
+	discarded.discard()
+	entries, err := os.ReadDir(utils.GetReportFileDir(2022, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("discarded files left %d entries", len(entries))
+	}
+
+	// files of committed version are put into place only when published
+	files := &reportFiles{}
+	if err = files.write(2022, 10, utils.GetReportFilePath(2022, 10, 1), []byte("report")); err != nil {
+		t.Fatal(err)
+	}
+	if err = files.write(2022, 10, utils.GetReportDiffFilePath(2022, 10, 1), []byte("diff")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(utils.GetReportVersionDir(2022, 10, 1)); !os.IsNotExist(err) {
+		t.Fatalf("version dir exists before publishing: %v", err)
+	}
+	if err = files.publish(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		utils.GetReportFilePath(2022, 10, 1):     "report",
+		utils.GetReportDiffFilePath(2022, 10, 1): "diff",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", path, data, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package databases
 
 import (
 	"balance/internal/models"
+	"balance/internal/utils"
 
 	"context"
 	"errors"
@@ -11,15 +12,35 @@ import (
 	"github.com/jackc/pgx/v4"
 )
 
-// Reserve performs money reserve transaction for given orderId, userId, serviceId and amount.
+// ReserveTimeout is time after which not purchased reserve expires and money is returned to user
+const ReserveTimeout = 10 * time.Minute
+
+// reserveColumns are columns of reserves table in order of scanReserve destinations,
+// reserve of order with multiple line items has zero service id and price version
+const reserveColumns = "order_id, user_id, coalesce(service_id, 0), amount, currency, status = 'purchased', reserved_at, purchased_at, coalesce(price_version, 0), expires_at, status, released_at"
+
+// reserveHasService is condition on reserves table that reserve or one of its line items is for service $2
+const reserveHasService = "(service_id = $2 or exists (select 1 from order_items i where i.order_id = reserves.order_id and i.service_id = $2))"
+
+// scanReserve scans row with reserveColumns into reserve
+func scanReserve(row pgx.Row, reserve *models.Reserve) error {
+	return row.Scan(&reserve.OrderID, &reserve.UserID, &reserve.ServiceID, &reserve.Amount, &reserve.Currency,
+		&reserve.Purchased, &reserve.ReservedAt, &reserve.PurchasedAt, &reserve.PriceVersion, &reserve.ExpiresAt, &reserve.Status, &reserve.ReleasedAt)
+}
+
+// Reserve performs money reserve transaction for given orderId, userId, serviceId, amount and currency and returns the reserve.
+// Zero amount means catalog price of service, empty currency means currency of service.
+//
+// 1) checks if given service exists, is active and priced in given currency, takes catalog price
+// or checks amount against bounds of the current price version
 //
-// 1) checks if given user and service exist
+// 2) checks if given user exists and subtracts user balance in currency by amount
 //
-// 2) subtracts user balance by amount
+// 3) writes into reserves table with open status and price version of service
 //
-// 3) writes into reserves table with purchased status = false
-func (p PgxDB) Reserve(userId, serviceId, orderId uint64, amount int64) error {
-	ctx := context.Background()
+// 4) moves money from user's wallet to hold account in ledger
+func (p PgxDB) Reserve(userId, serviceId, orderId uint64, amount int64, currency string) (models.Reserve, error) {
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
@@ -33,7 +54,7 @@ func (p PgxDB) Reserve(userId, serviceId, orderId uint64, amount int64) error {
 		IsoLevel: pgx.Serializable,
 	})
 	if err != nil {
-		return err
+		return models.Reserve{}, err
 	}
 
 	defer func() {
@@ -44,65 +65,142 @@ func (p PgxDB) Reserve(userId, serviceId, orderId uint64, amount int64) error {
 		}
 	}()
 
-	// check user by id
-	var user models.User
-	err = tx.QueryRow(ctx, "select * from users where id = $1;", userId).Scan(&user.ID, &user.Balance)
+	reserve, err := createReserve(ctx, tx, userId, serviceId, orderId, amount, currency)
+	if err != nil {
+		return models.Reserve{}, err
+	}
+
+	// start a new goroutine that returns money to user if the order was not purchased until expiry time (10 minutes by default)
+	// TODO: make delete reserve timeout configurable
+	go p.releaseOnExpiry(orderId, ReserveTimeout)
+
+	return reserve, err
+}
+
+// createReserve reserves money of user in given transaction, see Reserve
+func createReserve(ctx context.Context, tx pgx.Tx, userId, serviceId, orderId uint64, amount int64, currency string) (models.Reserve, error) {
+	var err error
+
+	// check service by id, its currency and current price, currencies cannot be mixed without conversion
+	var service models.Service
+	err = scanService(tx.QueryRow(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = s.price_version where s.id = $1;",
+		serviceId), &service)
 	if err != nil && errors.Is(err, pgx.ErrNoRows) {
-		err = fmt.Errorf("db: reserve: no such user with id %d", userId)
-		return err
+		err = newError(ErrNotFound, "db: reserve: no such service with id %d", serviceId)
+		return models.Reserve{}, err
 	} else if err != nil {
-		return err
-	} else if amount > user.Balance {
-		needed := (float32(amount%100) * 0.01) + float32(amount/100)
-		got := (float32(user.Balance%100) * 0.01) + float32(user.Balance/100)
-		err = fmt.Errorf("db: reserve: the user %d doesn't have enough money, needed: %.2f, user has: %.2f", userId, needed, got)
-		return err
+		return models.Reserve{}, err
+	} else if !service.Active {
+		err = newError(ErrFailedPrecondition, "db: reserve: service %d is not active", serviceId)
+		return models.Reserve{}, err
+	}
+	if currency == "" {
+		currency = service.Currency
+	} else if service.Currency != currency {
+		err = newError(ErrInvalidArgument, "db: reserve: service %d is priced in %s, got %s", serviceId, service.Currency, currency)
+		return models.Reserve{}, err
 	}
 
-	// check service by id
-	var checkServiceId uint64
-	err = tx.QueryRow(ctx, "select id from services where id = $1;", serviceId).Scan(&checkServiceId)
+	// omitted amount is taken from catalog, given amount must be within bounds
+	if amount == 0 {
+		if service.Price == nil {
+			err = newError(ErrInvalidArgument, "db: reserve: service %d has no catalog price, amount must be given", serviceId)
+			return models.Reserve{}, err
+		}
+		amount = *service.Price
+	} else if amount < 0 {
+		err = newError(ErrInvalidArgument, "db: reserve: amount must be positive")
+		return models.Reserve{}, err
+	} else if service.MinAmount != nil && amount < *service.MinAmount {
+		err = newError(ErrInvalidArgument, "db: reserve: amount %s %s is less than minimum amount %s %s of service %d", utils.FormatMoney(amount, currency), currency,
+			utils.FormatMoney(*service.MinAmount, currency), currency, serviceId)
+		return models.Reserve{}, err
+	} else if service.MaxAmount != nil && amount > *service.MaxAmount {
+		err = newError(ErrInvalidArgument, "db: reserve: amount %s %s is greater than maximum amount %s %s of service %d", utils.FormatMoney(amount, currency), currency,
+			utils.FormatMoney(*service.MaxAmount, currency), currency, serviceId)
+		return models.Reserve{}, err
+	}
+
+	// check user by id and his balance in currency
+	var balance int64
+	err = tx.QueryRow(ctx, "select coalesce(w.balance, 0) from users u left join wallets w on w.user_id = u.id and w.currency = $2 where u.id = $1;",
+		userId, currency).Scan(&balance)
 	if err != nil && errors.Is(err, pgx.ErrNoRows) {
-		err = fmt.Errorf("db: reserve: no such service with id %d", serviceId)
-		return err
+		err = newError(ErrNotFound, "db: reserve: no such user with id %d", userId)
+		return models.Reserve{}, err
 	} else if err != nil {
-		return err
+		return models.Reserve{}, err
+	} else if amount > balance {
+		err = newError(ErrInsufficientFunds, "db: reserve: the user %d doesn't have enough money, needed: %s %s, user has: %s %s", userId,
+			utils.FormatMoney(amount, currency), currency, utils.FormatMoney(balance, currency), currency)
+		return models.Reserve{}, err
 	}
 
-	// subtract user's balance and update user
-	user.Balance -= amount
-	var updateId uint64
-	err = tx.QueryRow(ctx, "update users SET balance = $2 where id = $1 returning id", user.ID, user.Balance).Scan(&updateId)
+	// subtract user's balance
+	_, err = changeWallet(ctx, tx, userId, currency, -amount)
 	if err != nil {
-		return err
+		return models.Reserve{}, err
 	}
 
 	// set time location
 	loc, _ := time.LoadLocation("Europe/Moscow")
 	date := time.Now().In(loc)
 
+	reserve := models.Reserve{
+		OrderID:      orderId,
+		UserID:       userId,
+		User:         models.User{ID: userId},
+		ServiceID:    serviceId,
+		Service:      service,
+		Amount:       amount,
+		Currency:     currency,
+		ReservedAt:   date,
+		PriceVersion: service.PriceVersion,
+		ExpiresAt:    date.Add(ReserveTimeout),
+		Status:       models.ReserveOpen,
+	}
+
 	// insert into reserves table
 	var reserveId uint64
-	err = tx.QueryRow(ctx, "insert into reserves (order_id, user_id, service_id, amount, purchased, reserved_at) values ($1, $2, $3, $4, $5, $6) returning order_id",
-		orderId, userId, serviceId, amount, false, date).Scan(&reserveId)
+	err = tx.QueryRow(ctx, "insert into reserves (order_id, user_id, service_id, amount, currency, status, reserved_at, price_version, expires_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning order_id",
+		orderId, userId, serviceId, amount, currency, reserve.Status, date, reserve.PriceVersion, reserve.ExpiresAt).Scan(&reserveId)
 	if err != nil {
-		return err
+		return models.Reserve{}, err
 	}
 
-	// start a new goroutine that returns money to user if the order was not purchased with a time (10 minutes by default)
-	// TODO: make delete reserve timeout configurable
-	go func() {
-		time.Sleep(10 * time.Minute)
-		err = p.DeleteReserve(userId, serviceId, orderId, amount)
-		p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: reserve: %v", err), nil)
-	}()
+	// move money from user's wallet to hold account
+	err = postEntry(ctx, tx, models.JournalEntry{
+		Kind:      models.EntryReserve,
+		UserID:    userId,
+		ServiceID: &serviceId,
+		OrderID:   &orderId,
+		CreatedAt: date,
+		Postings:  transfer(models.AccountWallet, userId, models.AccountHold, userId, currency, amount),
+	})
+	if err != nil {
+		return models.Reserve{}, err
+	}
 
-	return err
+	err = emitEvent(ctx, tx, models.WebhookEvent{
+		Type:      models.EventReserveCreated,
+		UserID:    userId,
+		ServiceID: &serviceId,
+		OrderID:   &orderId,
+		Amount:    amount,
+		Currency:  currency,
+		CreatedAt: date,
+	})
+	if err != nil {
+		return models.Reserve{}, err
+	}
+
+	return reserve, err
 }
 
-// GetReserve returns reserve by given userId, serviceId, orderId
+// GetReserve returns reserve by given userId, serviceId, orderId with history of its amendments.
+// Reserve of order with multiple line items is found by any of its services
 func (p PgxDB) GetReserve(userId, serviceId, orderId uint64) (models.Reserve, error) {
-	ctx := context.Background()
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
@@ -135,41 +233,151 @@ func (p PgxDB) GetReserve(userId, serviceId, orderId uint64) (models.Reserve, er
 		ServiceID: serviceId,
 	}
 
-	// it would be better to select only amount and reservedAt but pgx gets error then
-	err = tx.QueryRow(ctx, "select * from reserves where order_id = $1",
-		reserve.OrderID).Scan(&reserve.OrderID, &reserve.UserID, &reserve.ServiceID,
-		&reserve.Amount, &reserve.Purchased, &reserve.ReservedAt, &reserve.PurchasedAt)
+	err = scanReserve(tx.QueryRow(ctx, "select "+reserveColumns+" from reserves where order_id = $1 and user_id = $3 and "+reserveHasService,
+		orderId, serviceId, userId), &reserve)
 	if err != nil && errors.Is(err, pgx.ErrNoRows) {
-		err = fmt.Errorf("db: get reserve: money were not reserved for order %d", orderId)
+		err = newError(ErrNotFound, "db: get reserve: money were not reserved for order %d, user %d and service %d", orderId, userId, serviceId)
 		return models.Reserve{}, err
 	} else if err != nil {
 		return models.Reserve{}, err
 	}
 
-	// get user struct
-	var user models.User
-	err = tx.QueryRow(ctx, "select * from users where id = $1;", userId).Scan(&user.ID, &user.Balance)
+	// get user struct with his wallets
+	user := models.User{ID: userId, Wallets: make([]models.Wallet, 0)}
+	rows, err := tx.Query(ctx, "select currency, balance from wallets where user_id = $1 order by currency", userId)
 	if err != nil {
 		return models.Reserve{}, err
 	}
+	for rows.Next() {
+		var w models.Wallet
+		if err = rows.Scan(&w.Currency, &w.Balance); err != nil {
+			rows.Close()
+			return models.Reserve{}, err
+		}
+		user.Wallets = append(user.Wallets, w)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.Reserve{}, err
+	}
 	reserve.User = user
 
-	// get service struct
-	var service models.Service
-	err = tx.QueryRow(ctx, "select * from services where id = $1;", serviceId).Scan(&service.ID, &service.Name)
+	// get service struct with price version the reserve was made with, services of order are in its line items
+	if reserve.ServiceID != 0 {
+		var service models.Service
+		err = scanService(tx.QueryRow(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = $2 where s.id = $1;",
+			reserve.ServiceID, reserve.PriceVersion), &service)
+		if err != nil {
+			return models.Reserve{}, err
+		}
+		reserve.Service = service
+	}
+
+	reserve.Amendments, err = getAmendments(ctx, tx, orderId)
 	if err != nil {
 		return models.Reserve{}, err
 	}
-	reserve.Service = service
 
 	return reserve, err
 }
 
-// DeleteReserve deletes reserve by given userId, serviceId, orderId and amount
+// GetReserves returns page of reserves by given filter ordered by reserve time and order id descending
+// and cursor of the next page, nil cursor means the last page.
+// Reserve of order with multiple line items is found by any of its services
+func (p PgxDB) GetReserves(filter models.ReservesFilter) ([]models.Reserve, *models.ReserveCursor, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get reserves: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var afterTime *time.Time
+	var afterId uint64
+	if filter.After != nil {
+		afterTime, afterId = &filter.After.ReservedAt, filter.After.OrderID
+	}
+
+	// one more reserve is read to know if there is the next page
+	rows, err := tx.Query(ctx, `select `+reserveColumns+` from reserves
+		where ($1::bigint = 0 or user_id = $1) and ($2::bigint = 0 or `+reserveHasService+`) and ($3::text = '' or status = $3)
+		and ($4::timestamp is null or reserved_at >= $4) and ($5::timestamp is null or reserved_at < $5)
+		and ($6::timestamp is null or (reserved_at, order_id) < ($6, $7))
+		order by reserved_at desc, order_id desc limit $8`,
+		filter.UserID, filter.ServiceID, filter.Status, filter.From, filter.To, afterTime, afterId, filter.Limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	reserves := make([]models.Reserve, 0, filter.Limit)
+	for rows.Next() {
+		var r models.Reserve
+		if err = scanReserve(rows, &r); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		r.User = models.User{ID: r.UserID}
+		reserves = append(reserves, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *models.ReserveCursor
+	if len(reserves) > filter.Limit {
+		reserves = reserves[:filter.Limit]
+		last := reserves[len(reserves)-1]
+		next = &models.ReserveCursor{ReservedAt: last.ReservedAt, OrderID: last.OrderID}
+	}
+
+	// get services with price versions the reserves were made with, services of orders are in their line items
+	services := make(map[[2]uint64]models.Service)
+	for i, r := range reserves {
+		if r.ServiceID == 0 {
+			continue
+		}
+		key := [2]uint64{r.ServiceID, uint64(r.PriceVersion)}
+		service, ok := services[key]
+		if !ok {
+			err = scanService(tx.QueryRow(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = $2 where s.id = $1;",
+				r.ServiceID, r.PriceVersion), &service)
+			if err != nil {
+				return nil, nil, err
+			}
+			services[key] = service
+		}
+		reserves[i].Service = service
+	}
+
+	return reserves, next, err
+}
+
+// DeleteReserve releases reserve by given userId, serviceId, orderId and amount
 //
-// returns reserved money to user
+// returns reserved money to user, moves it from hold account back to user's wallet in ledger
+// and keeps the reserve with released status
 func (p PgxDB) DeleteReserve(userId, serviceId, orderId uint64, amount int64) error {
-	ctx := context.Background()
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
@@ -194,6 +402,14 @@ func (p PgxDB) DeleteReserve(userId, serviceId, orderId uint64, amount int64) er
 		}
 	}()
 
+	err = releaseReserve(ctx, tx, userId, serviceId, orderId)
+	return err
+}
+
+// releaseReserve releases open reserve in given transaction, see DeleteReserve
+func releaseReserve(ctx context.Context, tx pgx.Tx, userId, serviceId, orderId uint64) error {
+	var err error
+
 	reserve := models.Reserve{
 		UserID:    userId,
 		ServiceID: serviceId,
@@ -201,38 +417,261 @@ func (p PgxDB) DeleteReserve(userId, serviceId, orderId uint64, amount int64) er
 	}
 
 	// get the reserve
-	err = tx.QueryRow(ctx, "select * from reserves where order_id = $1 and user_id = $2 and service_id = $3",
-		reserve.OrderID, reserve.UserID, reserve.ServiceID).Scan(&reserve.OrderID, &reserve.UserID, &reserve.ServiceID,
-		&reserve.Amount, &reserve.Purchased, &reserve.ReservedAt, &reserve.PurchasedAt)
-	if err != nil {
+	err = scanReserve(tx.QueryRow(ctx, "select "+reserveColumns+" from reserves where order_id = $1 and user_id = $2 and service_id = $3",
+		reserve.OrderID, reserve.UserID, reserve.ServiceID), &reserve)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: release reserve: money were not reserved for order %d, user %d and service %d", orderId, userId, serviceId)
+		return err
+	} else if err != nil {
 		return err
 	}
-	// if reserve found, and it is uncompleted then return money and delete the found row
-	if !reserve.Purchased {
-		// get user
-		var user models.User
-		err = tx.QueryRow(ctx, "select * from users where id = $1;", userId).Scan(&user.ID, &user.Balance)
+	// if reserve found, and it is open then return money, the reserved amount is returned regardless of given amount
+	if reserve.Status == models.ReserveOpen {
+		loc, _ := time.LoadLocation("Europe/Moscow")
+		err = closeReserve(ctx, tx, reserve, models.ReserveReleased, time.Now().In(loc))
 		if err != nil {
 			return err
 		}
+	}
+	return err
+}
+
+// closeReserve returns money of open reserve to user's wallet, moves it from hold account back to user's wallet in ledger
+// and sets given status of the reserve, released or expired. Released reserve is reported to webhooks as refund
+func closeReserve(ctx context.Context, tx pgx.Tx, reserve models.Reserve, status string, date time.Time) error {
+	_, err := changeWallet(ctx, tx, reserve.UserID, reserve.Currency, reserve.Amount)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "update reserves set status = $2, released_at = $3 where order_id = $1",
+		reserve.OrderID, status, date)
+	if err != nil {
+		return err
+	}
 
-		// return money
-		user.Balance += amount
+	entry := models.JournalEntry{
+		Kind:      models.EntryRelease,
+		UserID:    reserve.UserID,
+		OrderID:   &reserve.OrderID,
+		CreatedAt: date,
+		Postings:  transfer(models.AccountHold, reserve.UserID, models.AccountWallet, reserve.UserID, reserve.Currency, reserve.Amount),
+	}
+	if reserve.ServiceID != 0 {
+		entry.ServiceID = &reserve.ServiceID
+	}
+	err = postEntry(ctx, tx, entry)
+	if err != nil {
+		return err
+	}
 
-		// update user
-		var updateId uint64
-		err = tx.QueryRow(ctx, "update users SET balance = $2 where id = $1 returning id", user.ID, user.Balance).Scan(&updateId)
+	event := models.WebhookEvent{
+		Type:      models.EventRefundCreated,
+		UserID:    reserve.UserID,
+		ServiceID: entry.ServiceID,
+		OrderID:   &reserve.OrderID,
+		Amount:    reserve.Amount,
+		Currency:  reserve.Currency,
+		CreatedAt: date,
+	}
+	if status == models.ReserveExpired {
+		event.Type = models.EventReserveExpired
+	}
+	return emitEvent(ctx, tx, event)
+}
+
+// GetOutstandingReserves returns open reserves grouped by service and age, totals per user and reserves
+// which are not released after their expiry time. Zero userId or serviceId means no filter by it
+func (p PgxDB) GetOutstandingReserves(userId, serviceId uint64) (models.ReservesAging, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
 		if err != nil {
-			return err
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get outstanding reserves: %v", err), nil)
 		}
+	}()
 
-		// delete reserve
-		var deleteId uint64
-		err = tx.QueryRow(ctx, "delete from reserves where order_id = $1 returning order_id",
-			orderId).Scan(&deleteId)
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return models.ReservesAging{}, err
+	}
+
+	defer func() {
 		if err != nil {
-			return err
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
 		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	now := time.Now().In(loc)
+	aging := models.ReservesAging{
+		Buckets: make([]models.ReserveAgingBucket, 0),
+		Users:   make([]models.ReserveUserTotal, 0),
+		Stuck:   make([]models.Reserve, 0),
+		Totals:  make([]models.ReserveCurrencyTotal, 0),
 	}
-	return err
+
+	// group by service, currency and age bucket, reserves of orders are split by their line items
+	rows, err := tx.Query(ctx, `select s.id, s.name, r.currency,
+		case
+			when r.reserved_at > $3::timestamp - interval '1 hour' then 0
+			when r.reserved_at > $3::timestamp - interval '1 day' then 1
+			when r.reserved_at > $3::timestamp - interval '7 days' then 2
+			else 3
+		end as age, count(distinct r.order_id), sum(coalesce(i.amount, r.amount))
+		from reserves r left join order_items i on i.order_id = r.order_id
+		join services s on s.id = coalesce(i.service_id, r.service_id)
+		where r.status = 'open' and ($1::bigint = 0 or r.user_id = $1) and ($2::bigint = 0 or s.id = $2)
+		group by s.id, s.name, r.currency, age order by s.id, r.currency, age`,
+		userId, serviceId, now)
+	if err != nil {
+		return models.ReservesAging{}, err
+	}
+	ages := []string{"<1h", "1-24h", "1-7d", ">7d"}
+	for rows.Next() {
+		var b models.ReserveAgingBucket
+		var age int
+		if err = rows.Scan(&b.ServiceID, &b.ServiceName, &b.Currency, &age, &b.Count, &b.Amount); err != nil {
+			rows.Close()
+			return models.ReservesAging{}, err
+		}
+		b.Age = ages[age]
+		aging.Buckets = append(aging.Buckets, b)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.ReservesAging{}, err
+	}
+
+	// totals per user and currency, order with multiple line items is counted once
+	rows, err = tx.Query(ctx, `select user_id, currency, count(*), sum(amount) from reserves
+		where status = 'open' and ($1::bigint = 0 or user_id = $1) and ($2::bigint = 0 or `+reserveHasService+`)
+		group by user_id, currency order by currency, sum(amount) desc, user_id`,
+		userId, serviceId)
+	if err != nil {
+		return models.ReservesAging{}, err
+	}
+	totals := make(map[string]int)
+	for rows.Next() {
+		var u models.ReserveUserTotal
+		if err = rows.Scan(&u.UserID, &u.Currency, &u.Count, &u.Amount); err != nil {
+			rows.Close()
+			return models.ReservesAging{}, err
+		}
+		aging.Users = append(aging.Users, u)
+
+		// money in different currencies is summed up separately
+		i, ok := totals[u.Currency]
+		if !ok {
+			i = len(aging.Totals)
+			totals[u.Currency] = i
+			aging.Totals = append(aging.Totals, models.ReserveCurrencyTotal{Currency: u.Currency})
+		}
+		aging.Totals[i].Count += u.Count
+		aging.Totals[i].Amount += u.Amount
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.ReservesAging{}, err
+	}
+
+	// reserves that should have been released by expiry mechanism
+	rows, err = tx.Query(ctx, `select `+reserveColumns+` from reserves
+		where status = 'open' and expires_at < $3 and ($1::bigint = 0 or user_id = $1) and ($2::bigint = 0 or `+reserveHasService+`)
+		order by expires_at`,
+		userId, serviceId, now)
+	if err != nil {
+		return models.ReservesAging{}, err
+	}
+	for rows.Next() {
+		var r models.Reserve
+		if err = scanReserve(rows, &r); err != nil {
+			rows.Close()
+			return models.ReservesAging{}, err
+		}
+		aging.Stuck = append(aging.Stuck, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.ReservesAging{}, err
+	}
+
+	return aging, err
+}
+
+// releaseOnExpiry waits for given time and marks reserve by given orderId as expired returning money to user.
+// Expiry time is read again after waiting, so reserve that was extended meanwhile is kept until its new expiry time.
+// Expiry is done by the service itself, neither by the key which created the reserve nor within its call
+func (p PgxDB) releaseOnExpiry(orderId uint64, wait time.Duration) {
+	p.Actor = 0
+	p.Ctx = nil
+	for {
+		time.Sleep(wait)
+
+		var err error
+		wait, err = p.expireReserve(orderId)
+		if err != nil || wait <= 0 {
+			return
+		}
+	}
+}
+
+// expireReserve marks reserve by given orderId as expired if it is open and its expiry time has passed,
+// otherwise returns time left until expiry. Zero time is returned for reserve which is not open
+func (p PgxDB) expireReserve(orderId uint64) (time.Duration, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: expire reserve: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+
+	// time left is calculated by database as expiry time is stored without time zone
+	var reserve models.Reserve
+	var left float64
+	err = tx.QueryRow(ctx, "select "+reserveColumns+", extract(epoch from expires_at - $2::timestamp)::float8 from reserves where order_id = $1",
+		orderId, date).Scan(&reserve.OrderID, &reserve.UserID, &reserve.ServiceID, &reserve.Amount, &reserve.Currency, &reserve.Purchased,
+		&reserve.ReservedAt, &reserve.PurchasedAt, &reserve.PriceVersion, &reserve.ExpiresAt, &reserve.Status, &reserve.ReleasedAt, &left)
+	if err != nil {
+		return 0, err
+	} else if reserve.Status != models.ReserveOpen {
+		return 0, err
+	} else if left > 0 {
+		return time.Duration(left * float64(time.Second)), err
+	}
+
+	err = closeReserve(ctx, tx, reserve, models.ReserveExpired, date)
+	if err != nil {
+		return 0, err
+	}
+	return 0, err
 }
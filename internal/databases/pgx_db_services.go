@@ -3,91 +3,390 @@ package databases
 import (
 	"balance/internal/models"
 
-	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 )
 
-// AddServices adds an array of services
-func (p PgxDB) AddServices(services []models.Service) error {
-	// create one big query with adding all given services
-	var sb strings.Builder
-	sb.WriteString("insert into services (id, name) values ")
-	for i, s := range services {
-		var row string
-		if i == 0 {
-			row = "(" + strconv.FormatUint(s.ID, 10) + ", '" + s.Name + "')"
+// serviceColumns are columns of services joined with service_prices as sp in order of scanService destinations
+const serviceColumns = "s.id, s.name, s.currency, s.active, sp.version, sp.price, sp.min_amount, sp.max_amount"
+
+// scanService scans row with serviceColumns into service
+func scanService(row pgx.Row, service *models.Service) error {
+	return row.Scan(&service.ID, &service.Name, &service.Currency, &service.Active, &service.PriceVersion,
+		&service.Price, &service.MinAmount, &service.MaxAmount)
+}
+
+// UpsertServices creates or updates an array of services with parameterised batch and returns result for every service.
+// Currencies of services must be already validated.
+//
+// 1) finds existing services by given ids and names
+//
+// 2) new service is created with the first version of price, existing service is renamed, activated or deactivated
+// and gets a new price version if price or bounds changed
+//
+// 3) service is not written and gets conflict status if its name is taken by another service, its currency differs
+// from currency of existing service or its price is not valid
+func (p PgxDB) UpsertServices(services []models.Service) ([]models.ServiceUpsertResult, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: upsert services: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
 		} else {
-			row = ", (" + strconv.FormatUint(s.ID, 10) + ", '" + s.Name + "')"
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	ids := make([]uint64, 0, len(services))
+	names := make([]string, 0, len(services))
+	for _, s := range services {
+		ids = append(ids, s.ID)
+		names = append(names, s.Name)
+	}
+
+	// find existing services by ids and names
+	rows, err := tx.Query(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = s.price_version where s.id = any($1) or s.name = any($2)",
+		ids, names)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[uint64]models.Service)
+	nameOwners := make(map[string]uint64)
+	for rows.Next() {
+		var service models.Service
+		if err = scanService(rows, &service); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byId[service.ID] = service
+		nameOwners[service.Name] = service.ID
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+	results := make([]models.ServiceUpsertResult, 0, len(services))
+	batch := &pgx.Batch{}
+	for _, s := range services {
+		result := models.ServiceUpsertResult{ID: s.ID, Name: s.Name}
+		existing, exists := byId[s.ID]
+		owner, nameTaken := nameOwners[s.Name]
+		switch {
+		case s.Name == "":
+			result.Status, result.Error = models.UpsertConflict, "name must be given"
+		case nameTaken && owner != s.ID:
+			result.Status, result.Error = models.UpsertConflict, fmt.Sprintf("name is taken by service %d", owner)
+		case exists && existing.Currency != s.Currency:
+			result.Status, result.Error = models.UpsertConflict, fmt.Sprintf("service is priced in %s, currency cannot be changed", existing.Currency)
+		default:
+			if priceErr := validateServicePrice(s.Price, s.MinAmount, s.MaxAmount); priceErr != nil {
+				result.Status, result.Error = models.UpsertConflict, priceErr.Error()
+				break
+			}
+			s.PriceVersion = 1
+			if exists {
+				result.Status = models.UpsertUpdated
+				s.PriceVersion = existing.PriceVersion
+				if !equalAmounts(existing.Price, s.Price) || !equalAmounts(existing.MinAmount, s.MinAmount) || !equalAmounts(existing.MaxAmount, s.MaxAmount) {
+					s.PriceVersion++
+					batch.Queue("insert into service_prices (service_id, version, price, min_amount, max_amount, valid_from) values ($1, $2, $3, $4, $5, $6)",
+						s.ID, s.PriceVersion, s.Price, s.MinAmount, s.MaxAmount, date)
+				}
+				batch.Queue("update services set name = $2, active = $3, price_version = $4 where id = $1",
+					s.ID, s.Name, s.Active, s.PriceVersion)
+				delete(nameOwners, existing.Name)
+			} else {
+				result.Status = models.UpsertCreated
+				batch.Queue("insert into services (id, name, currency, active, price_version) values ($1, $2, $3, $4, 1)",
+					s.ID, s.Name, s.Currency, s.Active)
+				batch.Queue("insert into service_prices (service_id, version, price, min_amount, max_amount, valid_from) values ($1, 1, $2, $3, $4, $5)",
+					s.ID, s.Price, s.MinAmount, s.MaxAmount, date)
+			}
+			// the following services of the array see the written one
+			byId[s.ID] = s
+			nameOwners[s.Name] = s.ID
+		}
+		results = append(results, result)
+	}
+
+	// exec all written services in one round trip
+	br := tx.SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err = br.Exec(); err != nil {
+			br.Close()
+			return nil, err
 		}
-		sb.WriteString(row)
+	}
+	if err = br.Close(); err != nil {
+		return nil, err
 	}
 
-	ctx := context.Background()
+	return results, err
+}
+
+// GetService returns service by given id with its current price
+func (p PgxDB) GetService(id uint64) (models.Service, error) {
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
 		if err != nil {
-			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: add services: %v", err), nil)
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get service: %v", err), nil)
 		}
 	}()
 
-	// exec the query
-	res, err := p.Exec(ctx, sb.String())
+	var service models.Service
+	err = scanService(p.QueryRow(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = s.price_version where s.id = $1;",
+		id), &service)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: get service: no such service with id %d", id)
+		return models.Service{}, err
+	} else if err != nil {
+		return models.Service{}, err
+	}
+
+	return service, err
+}
+
+// GetServices returns page of services ordered by id and total number of services matching filter.
+// Name is searched case-insensitively by substring
+func (p PgxDB) GetServices(filter models.ServicesFilter) ([]models.Service, int64, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get services: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	if res.RowsAffected() != int64(len(services)) {
-		err = errors.New("db: add services: failed to add services")
-		return err
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// special characters of like pattern are searched literally
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Name) + "%"
+	where := "where s.name ilike $1 and ($2::bool is null or s.active = $2)"
+
+	var total int64
+	err = tx.QueryRow(ctx, "select count(*) from services s "+where, pattern, filter.Active).Scan(&total)
+	if err != nil {
+		return nil, 0, err
 	}
-	return err
+
+	rows, err := tx.Query(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = s.price_version "+where+" order by s.id limit $3 offset $4",
+		pattern, filter.Active, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	services := make([]models.Service, 0)
+	for rows.Next() {
+		var service models.Service
+		if err = scanService(rows, &service); err != nil {
+			return nil, 0, err
+		}
+		services = append(services, service)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return services, total, err
 }
 
-// GetService returns service by given id
-func (p PgxDB) GetService(id uint64) (models.Service, error) {
-	ctx := context.Background()
+// UpdateService updates name, active flag, price and amount bounds of service by given id and returns updated service.
+// Change of price or bounds creates a new price version, so reserves made before keep their price
+func (p PgxDB) UpdateService(update models.ServiceUpdate) (models.Service, error) {
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
 		if err != nil {
-			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get service: %v", err), nil)
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: update service: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Service{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
 		}
 	}()
 
 	var service models.Service
-	err = p.QueryRow(ctx, "select * from services where id = $1;", id).Scan(&service.ID, &service.Name)
+	err = scanService(tx.QueryRow(ctx, "select "+serviceColumns+" from services s join service_prices sp on sp.service_id = s.id and sp.version = s.price_version where s.id = $1;",
+		update.ID), &service)
 	if err != nil && errors.Is(err, pgx.ErrNoRows) {
-		err = fmt.Errorf("db: get service: no such service with id %d", id)
+		err = newError(ErrNotFound, "db: update service: no such service with id %d", update.ID)
 		return models.Service{}, err
 	} else if err != nil {
 		return models.Service{}, err
 	}
 
+	if update.Name != nil {
+		service.Name = *update.Name
+	}
+	if update.Active != nil {
+		service.Active = *update.Active
+	}
+
+	// not given price fields are taken from the current version
+	if update.Price != nil || update.MinAmount != nil || update.MaxAmount != nil {
+		if update.Price != nil {
+			service.Price = update.Price
+		}
+		if update.MinAmount != nil {
+			service.MinAmount = update.MinAmount
+		}
+		if update.MaxAmount != nil {
+			service.MaxAmount = update.MaxAmount
+		}
+		if err = validateServicePrice(service.Price, service.MinAmount, service.MaxAmount); err != nil {
+			err = newError(ErrInvalidArgument, "db: update service: %v", err)
+			return models.Service{}, err
+		}
+
+		loc, _ := time.LoadLocation("Europe/Moscow")
+		service.PriceVersion++
+		_, err = tx.Exec(ctx, "insert into service_prices (service_id, version, price, min_amount, max_amount, valid_from) values ($1, $2, $3, $4, $5, $6)",
+			service.ID, service.PriceVersion, service.Price, service.MinAmount, service.MaxAmount, time.Now().In(loc))
+		if err != nil {
+			return models.Service{}, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, "update services set name = $2, active = $3, price_version = $4 where id = $1",
+		service.ID, service.Name, service.Active, service.PriceVersion)
+	if err != nil {
+		return models.Service{}, err
+	}
+
 	return service, err
 }
 
-// DeleteService deletes service by given id. Service cannot be deleted if referenced in reports or operations tables
-func (p PgxDB) DeleteService(id uint64) error {
-	ctx := context.Background()
+// GetServicePrices returns all price versions of service by given id ordered by version
+func (p PgxDB) GetServicePrices(id uint64) ([]models.ServicePrice, error) {
+	ctx := p.callContext()
 
 	var err error
 	defer func() {
 		if err != nil {
-			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: delete service: %v", err), nil)
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get service prices: %v", err), nil)
 		}
 	}()
 
-	res, err := p.Exec(ctx, "delete from services where id = $1", id)
+	rows, err := p.Query(ctx, "select service_id, version, price, min_amount, max_amount, valid_from from service_prices where service_id = $1 order by version", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := make([]models.ServicePrice, 0)
+	for rows.Next() {
+		var sp models.ServicePrice
+		if err = rows.Scan(&sp.ServiceID, &sp.Version, &sp.Price, &sp.MinAmount, &sp.MaxAmount, &sp.ValidFrom); err != nil {
+			return nil, err
+		}
+		prices = append(prices, sp)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(prices) == 0 {
+		err = newError(ErrNotFound, "db: get service prices: no such service with id %d", id)
+		return nil, err
+	}
+
+	return prices, err
+}
+
+// DeactivateService marks service by given id as not active instead of deleting it,
+// so operations, reserves and reports keep referencing it. Inactive service cannot be reserved
+func (p PgxDB) DeactivateService(id uint64) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: deactivate service: %v", err), nil)
+		}
+	}()
+
+	res, err := p.Exec(ctx, "update services set active = false where id = $1", id)
 	if err != nil {
 		return err
 	} else if res.RowsAffected() == 0 {
-		err = fmt.Errorf("db: delete service: no such service with id %d", id)
+		err = newError(ErrNotFound, "db: deactivate service: no such service with id %d", id)
 		return err
 	}
+	return err
+}
+
+// validateServicePrice checks that price and bounds are not negative and price is within bounds
+func validateServicePrice(price, minAmount, maxAmount *int64) error {
+	if (price != nil && *price < 0) || (minAmount != nil && *minAmount < 0) || (maxAmount != nil && *maxAmount < 0) {
+		return errors.New("price and bounds must not be negative")
+	}
+	if minAmount != nil && maxAmount != nil && *minAmount > *maxAmount {
+		return errors.New("min amount must not be greater than max amount")
+	}
+	if price != nil && ((minAmount != nil && *price < *minAmount) || (maxAmount != nil && *price > *maxAmount)) {
+		return errors.New("price must be within bounds")
+	}
 	return nil
 }
+
+// equalAmounts compares optional amounts of money
+func equalAmounts(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
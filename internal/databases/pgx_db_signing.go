@@ -0,0 +1,186 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+const signingSecretColumns = "id, api_key_id, secret, created_at, expires_at, revoked_at"
+
+// scanSigningSecret scans row selected with signingSecretColumns into secret
+func scanSigningSecret(row pgx.Row, secret *models.SigningSecret) error {
+	return row.Scan(&secret.ID, &secret.APIKeyID, &secret.Secret, &secret.CreatedAt, &secret.ExpiresAt, &secret.RevokedAt)
+}
+
+// CreateSigningSecret writes signing secret of API key by given id.
+//
+// 1) active secrets of the key keep working for grace period, so clients could switch to the new secret without downtime
+//
+// 2) secret of revoked or expired key is not written
+func (p PgxDB) CreateSigningSecret(apiKeyId uint64, secret string, grace time.Duration) (models.SigningSecret, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: create signing secret: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.SigningSecret{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	now := time.Now().In(loc)
+
+	var key models.APIKey
+	err = scanAPIKey(tx.QueryRow(ctx, "select "+apiKeyColumns+" from api_keys where id = $1 for update", apiKeyId), &key)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: create signing secret: no such key with id %d", apiKeyId)
+		return models.SigningSecret{}, err
+	} else if err != nil {
+		return models.SigningSecret{}, err
+	}
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		err = newError(ErrFailedPrecondition, "db: create signing secret: key %d is already revoked or expired", apiKeyId)
+		return models.SigningSecret{}, err
+	}
+
+	// active secrets expire at the end of grace period, secrets expiring earlier are kept as is
+	_, err = tx.Exec(ctx, `update signing_secrets set expires_at = $2 where api_key_id = $1 and revoked_at is null
+		and (expires_at is null or expires_at > $2)`, apiKeyId, now.Add(grace))
+	if err != nil {
+		return models.SigningSecret{}, err
+	}
+
+	signingSecret := models.SigningSecret{APIKeyID: apiKeyId, Secret: secret, CreatedAt: now}
+	err = tx.QueryRow(ctx, "insert into signing_secrets (api_key_id, secret, created_at) values ($1, $2, $3) returning id",
+		apiKeyId, secret, now).Scan(&signingSecret.ID)
+	if err != nil {
+		return models.SigningSecret{}, err
+	}
+	return signingSecret, err
+}
+
+// GetSigningSecrets returns all signing secrets of API key by given id ordered by id, revoked and expired ones included
+func (p PgxDB) GetSigningSecrets(apiKeyId uint64) ([]models.SigningSecret, error) {
+	return p.signingSecrets("get signing secrets", "select "+signingSecretColumns+" from signing_secrets where api_key_id = $1 order by id", apiKeyId)
+}
+
+// GetActiveSigningSecrets returns signing secrets of API key by given id which are neither revoked nor expired,
+// requests of key with active secrets must be signed
+func (p PgxDB) GetActiveSigningSecrets(apiKeyId uint64) ([]models.SigningSecret, error) {
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	return p.signingSecrets("get active signing secrets", "select "+signingSecretColumns+` from signing_secrets
+		where api_key_id = $1 and revoked_at is null and (expires_at is null or expires_at > $2) order by id`, apiKeyId, time.Now().In(loc))
+}
+
+// signingSecrets returns signing secrets selected by query with given arguments
+func (p PgxDB) signingSecrets(op string, query string, args ...interface{}) ([]models.SigningSecret, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: %s: %v", op, err), nil)
+		}
+	}()
+
+	rows, err := p.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	secrets := make([]models.SigningSecret, 0)
+	for rows.Next() {
+		var secret models.SigningSecret
+		if err = scanSigningSecret(rows, &secret); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	err = rows.Err()
+	return secrets, err
+}
+
+// RevokeSigningSecret revokes signing secret by given id of API key by given id at once.
+// Key without active secrets sends requests without signatures
+func (p PgxDB) RevokeSigningSecret(apiKeyId, id uint64) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: revoke signing secret: %v", err), nil)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	tag, err := p.Exec(ctx, "update signing_secrets set revoked_at = $3 where id = $2 and api_key_id = $1 and revoked_at is null",
+		apiKeyId, id, time.Now().In(loc))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		err = newError(ErrNotFound, "db: revoke signing secret: no such secret with id %d of key %d or it is already revoked", id, apiKeyId)
+		return err
+	}
+	return err
+}
+
+// UseSignatureNonce records nonce of signed request of API key by given id, nonce which is already used is rejected.
+// Old nonces are deleted by DeleteSignatureNonces out of requests
+func (p PgxDB) UseSignatureNonce(apiKeyId uint64, nonce string) error {
+	ctx := p.callContext()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	_, err := p.Exec(ctx, "insert into signature_nonces (api_key_id, nonce, created_at) values ($1, $2, $3)", apiKeyId, nonce, time.Now().In(loc))
+	var pgErr *pgconn.PgError
+	if err != nil && errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// replayed requests are not logged, they are answered as unauthorized
+		return newError(ErrFailedPrecondition, "db: use signature nonce: nonce %q is already used", nonce)
+	} else if err != nil {
+		p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: use signature nonce: %v", err), nil)
+		return err
+	}
+	return nil
+}
+
+// DeleteSignatureNonces deletes nonces of signed requests recorded before given time, returns number of deleted nonces
+func (p PgxDB) DeleteSignatureNonces(before time.Time) (int64, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: delete signature nonces: %v", err), nil)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	tag, err := p.Exec(ctx, "delete from signature_nonces where created_at < $1", before.In(loc))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), err
+}
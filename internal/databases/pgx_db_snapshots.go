@@ -0,0 +1,225 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// CreateSnapshot stores end of day balances and held money of all users for given day,
+// snapshot of the same day is replaced.
+//
+// 1) checks that the day is over
+//
+// 2) creates partition of snapshots table for month of the day
+//
+// 3) calculates balances from operations and reserves at the end of day and writes them into balance_snapshots table
+func (p PgxDB) CreateSnapshot(day time.Time) (models.Snapshot, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: create snapshot: %v", err), nil)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	now := time.Now().In(loc)
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	end := day.AddDate(0, 0, 1)
+	if end.After(now) {
+		err = newError(ErrInvalidArgument, "db: create snapshot: day %s is not over yet", day.Format("2006-01-02"))
+		return models.Snapshot{}, err
+	}
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, loc)
+	_, err = tx.Exec(ctx, fmt.Sprintf("create table if not exists balance_snapshots_%s partition of balance_snapshots for values from ('%s') to ('%s')",
+		month.Format("2006_01"), month.Format("2006-01-02"), month.AddDate(0, 1, 0).Format("2006-01-02")))
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+
+	_, err = tx.Exec(ctx, "delete from balance_snapshots where day = $1", day)
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+
+	snapshot := models.Snapshot{Day: day, CreatedAt: now}
+	tag, err := tx.Exec(ctx, "insert into balance_snapshots (day, user_id, currency, available, held, total, created_at) select $3::date, user_id, currency, total - held, held, total, $4 from ("+balancesAtQuery+") b",
+		nil, end, day, now)
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	snapshot.Wallets = tag.RowsAffected()
+
+	return snapshot, err
+}
+
+// GetLiabilities returns money owed to users at the end of every day of [from, to] range by snapshots
+// and its change by operations, every day is reconciled with operations table.
+//
+// 1) sums operations done before the range, that is money owed to users at the beginning
+//
+// 2) sums top-ups, purchases and other operations by days and adds them up to the journal balance
+//
+// 3) compares journal balance with snapshot at the end of every day
+func (p PgxDB) GetLiabilities(from, to time.Time) (models.LiabilitiesReport, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get liabilities: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return models.LiabilitiesReport{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	report := models.LiabilitiesReport{
+		From:       from,
+		To:         to,
+		Lines:      make([]models.LiabilitiesLine, 0),
+		Reconciled: true,
+	}
+
+	// money owed at the beginning of range
+	journal := make(map[string]int64)
+	rows, err := tx.Query(ctx, "select currency, sum(amount) from operations where done_at < $1 group by currency", from)
+	if err != nil {
+		return models.LiabilitiesReport{}, err
+	}
+	for rows.Next() {
+		var currency string
+		var amount int64
+		if err = rows.Scan(&currency, &amount); err != nil {
+			rows.Close()
+			return models.LiabilitiesReport{}, err
+		}
+		journal[currency] = amount
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.LiabilitiesReport{}, err
+	}
+
+	// lines are keyed by day and currency
+	lines := make(map[string]models.LiabilitiesLine)
+	key := func(day time.Time, currency string) string {
+		return day.Format("2006-01-02") + currency
+	}
+
+	rows, err = tx.Query(ctx, `select done_at::date, currency,
+		coalesce(sum(amount) filter (where kind = $3), 0),
+		coalesce(-sum(amount) filter (where kind = $4), 0),
+		coalesce(sum(amount) filter (where kind <> $3 and kind <> $4), 0)
+		from operations where done_at >= $1 and done_at < $2 group by 1, 2`,
+		from, to.AddDate(0, 0, 1), models.OperationTopUp, models.OperationPurchase)
+	if err != nil {
+		return models.LiabilitiesReport{}, err
+	}
+	for rows.Next() {
+		var l models.LiabilitiesLine
+		if err = rows.Scan(&l.Day, &l.Currency, &l.Inflows, &l.Outflows, &l.Other); err != nil {
+			rows.Close()
+			return models.LiabilitiesReport{}, err
+		}
+		l.NetChange = l.Inflows - l.Outflows + l.Other
+		lines[key(l.Day, l.Currency)] = l
+		if _, ok := journal[l.Currency]; !ok {
+			journal[l.Currency] = 0
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.LiabilitiesReport{}, err
+	}
+
+	rows, err = tx.Query(ctx, "select day, currency, sum(total), sum(held) from balance_snapshots where day >= $1::date and day <= $2::date group by day, currency",
+		from, to)
+	if err != nil {
+		return models.LiabilitiesReport{}, err
+	}
+	for rows.Next() {
+		var day time.Time
+		var currency string
+		var liabilities, held int64
+		if err = rows.Scan(&day, &currency, &liabilities, &held); err != nil {
+			rows.Close()
+			return models.LiabilitiesReport{}, err
+		}
+		l := lines[key(day, currency)]
+		l.Snapshot = true
+		l.Liabilities = liabilities
+		l.Held = held
+		lines[key(day, currency)] = l
+		if _, ok := journal[currency]; !ok {
+			journal[currency] = 0
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.LiabilitiesReport{}, err
+	}
+
+	currencies := make([]string, 0, len(journal))
+	for currency := range journal {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	// every day has line in every currency, journal balance is carried over from the previous day
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, currency := range currencies {
+			l := lines[key(day, currency)]
+			l.Day = day
+			l.Currency = currency
+			journal[currency] += l.NetChange
+			l.Journal = journal[currency]
+			l.Reconciled = l.Snapshot && l.Liabilities == l.Journal
+			report.Reconciled = report.Reconciled && l.Reconciled
+			report.Lines = append(report.Lines, l)
+		}
+	}
+
+	return report, err
+}
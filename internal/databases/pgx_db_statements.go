@@ -0,0 +1,116 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// GetStatement returns account statement of user by given id in given currency for operations done in [from, to) range.
+//
+// 1) calculates opening balance from operations done before the range
+//
+// 2) lists operations from the range with running balance
+//
+// 3) calculates money held in reserves and reconciles operations with users balance
+func (p PgxDB) GetStatement(userId uint64, currency string, from, to time.Time) (models.Statement, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get statement: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return models.Statement{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	statement := models.Statement{
+		UserID:   userId,
+		Currency: currency,
+		From:     from,
+		To:       to,
+	}
+
+	err = tx.QueryRow(ctx, "select coalesce(w.balance, 0) from users u left join wallets w on w.user_id = u.id and w.currency = $2 where u.id = $1;",
+		userId, currency).Scan(&statement.Balance)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: get statement: no such user with id %d", userId)
+		return models.Statement{}, err
+	} else if err != nil {
+		return models.Statement{}, err
+	}
+
+	err = tx.QueryRow(ctx, "select coalesce(sum(amount), 0) from operations where user_id = $1 and currency = $2 and done_at < $3",
+		userId, currency, from).Scan(&statement.OpeningBalance)
+	if err != nil {
+		return models.Statement{}, err
+	}
+
+	rows, err := tx.Query(ctx, "select id, user_id, service_id, service_name, amount, currency, done_at, kind, order_id, line_no, trim_scale(rate)::text, trim_scale(spread)::text from operations where user_id = $1 and currency = $2 and done_at >= $3 and done_at < $4 order by done_at, id",
+		userId, currency, from, to)
+	if err != nil {
+		return models.Statement{}, err
+	}
+	statement.Lines = make([]models.StatementLine, 0)
+	runningBalance := statement.OpeningBalance
+	for rows.Next() {
+		var l models.StatementLine
+		err = rows.Scan(&l.ID, &l.UserID, &l.ServiceID, &l.ServiceName, &l.Amount, &l.Currency, &l.DoneAt, &l.Kind, &l.OrderID, &l.LineNo, &l.Rate, &l.Spread)
+		if err != nil {
+			rows.Close()
+			return models.Statement{}, err
+		}
+		runningBalance += l.Amount
+		l.RunningBalance = runningBalance
+		statement.Lines = append(statement.Lines, l)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.Statement{}, err
+	}
+	statement.ClosingBalance = runningBalance
+
+	// money is held if it was reserved before the end of range and was not purchased or released by then,
+	// amount of reserve is taken as it was at the end of range
+	err = tx.QueryRow(ctx, "select coalesce(sum("+reserveAmountAt("$3")+"), 0) from reserves r where r.user_id = $1 and r.currency = $2 and r.reserved_at < $3 and (r.status = 'open' or coalesce(r.purchased_at, r.released_at) >= $3)",
+		userId, currency, to).Scan(&statement.Held)
+	if err != nil {
+		return models.Statement{}, err
+	}
+	statement.Available = statement.ClosingBalance - statement.Held
+
+	// all operations of user minus currently held money must be equal to balance of wallet
+	var total, held int64
+	err = tx.QueryRow(ctx, "select coalesce(sum(amount), 0) from operations where user_id = $1 and currency = $2", userId, currency).Scan(&total)
+	if err != nil {
+		return models.Statement{}, err
+	}
+	err = tx.QueryRow(ctx, "select coalesce(sum(amount), 0) from reserves where user_id = $1 and currency = $2 and status = 'open'", userId, currency).Scan(&held)
+	if err != nil {
+		return models.Statement{}, err
+	}
+	statement.Reconciled = total-held == statement.Balance
+
+	return statement, err
+}
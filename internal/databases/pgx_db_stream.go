@@ -0,0 +1,180 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// UserEventsChannel is PostgreSQL channel notified with id of user when his money moves
+const UserEventsChannel = "balance_events"
+
+// GetStreamStart returns current balances of user by given id and id of his last event,
+// stream of his events continues after it. Both are read from the same snapshot, so no event is lost or repeated
+func (p PgxDB) GetStreamStart(userId uint64) ([]models.Balance, uint64, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get stream start: %v", err), nil)
+		}
+	}()
+
+	// start read only transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var checkUserId uint64
+	err = tx.QueryRow(ctx, "select id from users where id = $1;", userId).Scan(&checkUserId)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: get stream start: no such user with id %d", userId)
+		return nil, 0, err
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	var lastEventId uint64
+	err = tx.QueryRow(ctx, "select coalesce(max(id), 0) from outbox where user_id = $1", userId).Scan(&lastEventId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	balances, err := queryBalances(ctx, tx, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return balances, lastEventId, err
+}
+
+// GetUserEvents returns at most limit money movements of user by given id after event with given id.
+//
+// 1) changes of balances are calculated from postings of user's wallets and hold accounts
+//
+// 2) reserve is open after reserve and amend movements and purchased after purchase,
+// status of released reserve is read from reserve as released and expired reserves are moved the same way
+func (p PgxDB) GetUserEvents(userId uint64, afterId uint64, limit int) ([]models.UserEvent, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get user events: %v", err), nil)
+		}
+	}()
+
+	rows, err := p.Query(ctx, `select o.id, o.payload, coalesce(r.status, '')
+		from outbox o left join reserves r on r.order_id = (o.payload->>'order_id')::bigint
+		where o.user_id = $1 and o.id > $2 and o.type = $3 and o.version = $4
+		order by o.id limit $5`,
+		userId, afterId, models.OutboxMoneyMovement, models.OutboxMoneyMovementVersion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]models.UserEvent, 0)
+	for rows.Next() {
+		var id uint64
+		var payload []byte
+		var reserveStatus string
+		if err = rows.Scan(&id, &payload, &reserveStatus); err != nil {
+			return nil, err
+		}
+		var movement models.MoneyMovementV1
+		if err = json.Unmarshal(payload, &movement); err != nil {
+			return nil, err
+		}
+
+		event := models.UserEvent{
+			ID:        id,
+			Kind:      movement.Kind,
+			ServiceID: movement.ServiceID,
+			OrderID:   movement.OrderID,
+			CreatedAt: movement.CreatedAt,
+			Changes:   make([]models.BalanceChange, 0),
+		}
+		switch movement.Kind {
+		case models.EntryReserve, models.EntryAmend:
+			event.ReserveStatus = models.ReserveOpen
+		case models.EntryPurchase:
+			event.ReserveStatus = models.ReservePurchased
+		case models.EntryRelease:
+			event.ReserveStatus = reserveStatus
+		}
+
+		currencies := make(map[string]int)
+		for _, posting := range movement.Postings {
+			if posting.OwnerID != userId || (posting.AccountKind != models.AccountWallet && posting.AccountKind != models.AccountHold) {
+				continue
+			}
+			i, ok := currencies[posting.Currency]
+			if !ok {
+				i = len(event.Changes)
+				currencies[posting.Currency] = i
+				event.Changes = append(event.Changes, models.BalanceChange{Currency: posting.Currency})
+			}
+			if posting.AccountKind == models.AccountWallet {
+				event.Changes[i].Available += posting.Amount
+			} else {
+				event.Changes[i].Held += posting.Amount
+			}
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, err
+}
+
+// ListenUserEvents listens to UserEventsChannel on dedicated connection, calls started once listening is started
+// and then notify with id of every notified user until ctx is done or connection fails
+func (p PgxDB) ListenUserEvents(ctx context.Context, started func(), notify func(userId uint64)) error {
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("db: listen user events: %v", err)
+	}
+	defer conn.Release()
+	// connection is closed, so it is not returned to pool while listening
+	defer conn.Conn().Close(context.Background())
+
+	_, err = conn.Exec(ctx, "listen "+UserEventsChannel)
+	if err != nil {
+		return fmt.Errorf("db: listen user events: %v", err)
+	}
+	started()
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("db: listen user events: %v", err)
+		}
+		userId, err := strconv.ParseUint(notification.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+		notify(userId)
+	}
+}
@@ -0,0 +1,413 @@
+package databases
+
+import (
+	"balance/internal/models"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const webhookColumns = "id, url, secret, event_types, active, failures, created_at, disabled_at"
+
+// scanWebhook scans row selected with webhookColumns into webhook
+func scanWebhook(row pgx.Row, webhook *models.Webhook) error {
+	return row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &webhook.EventTypes, &webhook.Active, &webhook.Failures,
+		&webhook.CreatedAt, &webhook.DisabledAt)
+}
+
+// checkEventTypes checks that event types are known and not empty
+func checkEventTypes(eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return errors.New("event types must be given")
+	}
+	for _, t := range eventTypes {
+		known := false
+		for _, k := range models.EventTypes {
+			known = known || t == k
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// emitEvent writes webhook event and its deliveries to active subscribed webhooks in transaction of the change,
+// so the event is delivered only after the change is committed. Event without subscribers is not written
+func emitEvent(ctx context.Context, tx pgx.Tx, event models.WebhookEvent) error {
+	_, err := tx.Exec(ctx, `with subscriptions as (
+		select id from webhook_subscriptions where active and $1::varchar = any(event_types)
+	), event as (
+		insert into webhook_events (type, user_id, service_id, order_id, amount, currency, created_at)
+		select $1, $2::bigint, $3::bigint, $4::bigint, $5::bigint, $6, $7::timestamp where exists (select 1 from subscriptions)
+		returning id
+	)
+	insert into webhook_deliveries (subscription_id, event_id, next_attempt_at)
+	select s.id, e.id, $7::timestamp from subscriptions s cross join event e`,
+		event.Type, event.UserID, event.ServiceID, event.OrderID, event.Amount, event.Currency, event.CreatedAt)
+	return err
+}
+
+// CreateWebhook creates webhook subscription to given event types
+func (p PgxDB) CreateWebhook(webhook models.Webhook) (models.Webhook, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: create webhook: %v", err), nil)
+		}
+	}()
+
+	if err = checkEventTypes(webhook.EventTypes); err != nil {
+		err = newError(ErrInvalidArgument, "db: create webhook: %v", err)
+		return models.Webhook{}, err
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	webhook.Active = true
+	webhook.CreatedAt = time.Now().In(loc)
+	err = p.QueryRow(ctx, "insert into webhook_subscriptions (url, secret, event_types, created_at) values ($1, $2, $3, $4) returning id",
+		webhook.URL, webhook.Secret, webhook.EventTypes, webhook.CreatedAt).Scan(&webhook.ID)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	return webhook, err
+}
+
+// GetWebhooks returns all webhook subscriptions ordered by id
+func (p PgxDB) GetWebhooks() ([]models.Webhook, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get webhooks: %v", err), nil)
+		}
+	}()
+
+	rows, err := p.Query(ctx, "select "+webhookColumns+" from webhook_subscriptions order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]models.Webhook, 0)
+	for rows.Next() {
+		var webhook models.Webhook
+		if err = scanWebhook(rows, &webhook); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	err = rows.Err()
+	return webhooks, err
+}
+
+// UpdateWebhook changes url, event types and active flag of webhook by given update.
+//
+// 1) enabled webhook starts counting failed deliveries anew
+//
+// 2) pending deliveries of disabled webhook are marked as failed
+func (p PgxDB) UpdateWebhook(update models.WebhookUpdate) (models.Webhook, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: update webhook: %v", err), nil)
+		}
+	}()
+
+	if update.EventTypes != nil {
+		if err = checkEventTypes(update.EventTypes); err != nil {
+			err = newError(ErrInvalidArgument, "db: update webhook: %v", err)
+			return models.Webhook{}, err
+		}
+	}
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+
+	var webhook models.Webhook
+	err = scanWebhook(tx.QueryRow(ctx, `update webhook_subscriptions set
+			url = coalesce($2, url),
+			event_types = coalesce($3, event_types),
+			active = coalesce($4, active),
+			failures = case when $4 and not active then 0 else failures end,
+			disabled_at = case when $4 then null when not $4 and active then $5::timestamp else disabled_at end
+		where id = $1 returning `+webhookColumns,
+		update.ID, update.URL, update.EventTypes, update.Active, date), &webhook)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = newError(ErrNotFound, "db: update webhook: no such webhook with id %d", update.ID)
+		return models.Webhook{}, err
+	} else if err != nil {
+		return models.Webhook{}, err
+	}
+
+	if !webhook.Active {
+		_, err = tx.Exec(ctx, "update webhook_deliveries set status = $2 where subscription_id = $1 and status = $3",
+			webhook.ID, models.DeliveryFailed, models.DeliveryPending)
+		if err != nil {
+			return models.Webhook{}, err
+		}
+	}
+	return webhook, err
+}
+
+// DeleteWebhook deletes webhook subscription with its deliveries by given id
+func (p PgxDB) DeleteWebhook(id uint64) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: delete webhook: %v", err), nil)
+		}
+	}()
+
+	tag, err := p.Exec(ctx, "delete from webhook_subscriptions where id = $1", id)
+	if err != nil {
+		return err
+	} else if tag.RowsAffected() == 0 {
+		err = newError(ErrNotFound, "db: delete webhook: no such webhook with id %d", id)
+		return err
+	}
+	return err
+}
+
+// GetWebhookDeliveries returns the latest deliveries of webhook by given id with their events and history of attempts
+func (p PgxDB) GetWebhookDeliveries(webhookId uint64, limit int) ([]models.WebhookDelivery, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: get webhook deliveries: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		DeferrableMode: pgx.Deferrable,
+		AccessMode:     pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var exists bool
+	err = tx.QueryRow(ctx, "select exists (select 1 from webhook_subscriptions where id = $1)", webhookId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		err = newError(ErrNotFound, "db: get webhook deliveries: no such webhook with id %d", webhookId)
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `select d.id, d.subscription_id, d.status, d.attempts, d.next_attempt_at, d.delivered_at,
+			e.id, e.type, e.user_id, e.service_id, e.order_id, e.amount, e.currency, e.created_at
+		from webhook_deliveries d join webhook_events e on e.id = d.event_id
+		where d.subscription_id = $1 order by d.id desc limit $2`, webhookId, limit)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]models.WebhookDelivery, 0)
+	index := make(map[uint64]int)
+	ids := make([]uint64, 0)
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err = rows.Scan(&d.ID, &d.WebhookID, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.DeliveredAt,
+			&d.Event.ID, &d.Event.Type, &d.Event.UserID, &d.Event.ServiceID, &d.Event.OrderID, &d.Event.Amount, &d.Event.Currency, &d.Event.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[d.ID] = len(deliveries)
+		ids = append(ids, d.ID)
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// attach history of attempts to deliveries
+	rows, err = tx.Query(ctx, "select delivery_id, attempted_at, status_code, error, duration_ms from webhook_attempts where delivery_id = any($1) order by id",
+		ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.WebhookAttempt
+		var message *string
+		var ms int64
+		if err = rows.Scan(&a.DeliveryID, &a.AttemptedAt, &a.StatusCode, &message, &ms); err != nil {
+			return nil, err
+		}
+		if message != nil {
+			a.Error = *message
+		}
+		a.Duration = time.Duration(ms) * time.Millisecond
+		i := index[a.DeliveryID]
+		deliveries[i].History = append(deliveries[i].History, a)
+	}
+	err = rows.Err()
+	return deliveries, err
+}
+
+// ClaimWebhookDeliveries returns pending deliveries which are due with their events, url and secret of webhook.
+// Claimed deliveries are postponed by lease time, so they are not delivered twice by concurrent instances
+func (p PgxDB) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: claim webhook deliveries: %v", err), nil)
+		}
+	}()
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	date := time.Now().In(loc)
+
+	rows, err := p.Query(ctx, `update webhook_deliveries d set next_attempt_at = $3
+		from webhook_subscriptions s, webhook_events e
+		where d.id in (
+			select id from webhook_deliveries where status = $4 and next_attempt_at <= $2::timestamp
+			order by next_attempt_at limit $1 for update skip locked
+		) and s.id = d.subscription_id and e.id = d.event_id
+		returning d.id, d.subscription_id, s.url, s.secret, d.status, d.attempts, d.next_attempt_at,
+			e.id, e.type, e.user_id, e.service_id, e.order_id, e.amount, e.currency, e.created_at`,
+		limit, date, date.Add(lease), models.DeliveryPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err = rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.Event.ID, &d.Event.Type, &d.Event.UserID, &d.Event.ServiceID, &d.Event.OrderID, &d.Event.Amount, &d.Event.Currency, &d.Event.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	err = rows.Err()
+	return deliveries, err
+}
+
+// RecordWebhookAttempt writes attempt of delivery. Attempt without error completes the delivery,
+// failed attempt is retried at given time or fails the delivery if retryAt is nil.
+//
+// 1) completed delivery resets count of failed deliveries of webhook
+//
+// 2) failed delivery increases the count, webhook is disabled when the count reaches disableAfter
+// and its pending deliveries are marked as failed
+func (p PgxDB) RecordWebhookAttempt(attempt models.WebhookAttempt, retryAt *time.Time, disableAfter int) error {
+	ctx := p.callContext()
+
+	var err error
+	defer func() {
+		if err != nil {
+			p.Logger.Log(ctx, pgx.LogLevelError, fmt.Sprintf("db: record webhook attempt: %v", err), nil)
+		}
+	}()
+
+	// start transaction and defer its closing
+	tx, err := p.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var message *string
+	if attempt.Error != "" {
+		message = &attempt.Error
+	}
+	_, err = tx.Exec(ctx, "insert into webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms) values ($1, $2, $3, $4, $5)",
+		attempt.DeliveryID, attempt.AttemptedAt, attempt.StatusCode, message, attempt.Duration.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	if attempt.Error == "" {
+		_, err = tx.Exec(ctx, `with delivery as (
+				update webhook_deliveries set status = $2, attempts = attempts + 1, delivered_at = $3 where id = $1 returning subscription_id
+			)
+			update webhook_subscriptions set failures = 0 where id = (select subscription_id from delivery)`,
+			attempt.DeliveryID, models.DeliveryDelivered, attempt.AttemptedAt)
+		return err
+	}
+
+	status := models.DeliveryPending
+	if retryAt == nil {
+		status = models.DeliveryFailed
+	}
+	var webhookId uint64
+	var failures int
+	var active bool
+	err = tx.QueryRow(ctx, `with delivery as (
+			update webhook_deliveries set status = $2, attempts = attempts + 1, next_attempt_at = coalesce($3, next_attempt_at) where id = $1 returning subscription_id
+		)
+		update webhook_subscriptions set failures = failures + case when $3::timestamp is null then 1 else 0 end
+		where id = (select subscription_id from delivery) returning id, failures, active`,
+		attempt.DeliveryID, status, retryAt).Scan(&webhookId, &failures, &active)
+	if err != nil {
+		return err
+	}
+
+	// disable webhook which keeps failing
+	if retryAt == nil && active && failures >= disableAfter {
+		_, err = tx.Exec(ctx, "update webhook_subscriptions set active = false, disabled_at = $2 where id = $1",
+			webhookId, attempt.AttemptedAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "update webhook_deliveries set status = $2 where subscription_id = $1 and status = $3",
+			webhookId, models.DeliveryFailed, models.DeliveryPending)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
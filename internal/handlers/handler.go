@@ -1,22 +1,29 @@
 package handlers
 
 import (
+	"balance/internal/auth"
 	"balance/internal/databases"
 	"balance/internal/models"
+	"balance/internal/stream"
 	"balance/internal/utils"
 	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Handler struct {
-	DB databases.DBInt
+	DB  databases.DBInt
+	Hub *stream.Hub
+	JWT *auth.JWTValidator // validator of bearer tokens, nil if tokens are not accepted
 }
 
 // NewHandler creates new Handler instance
-func NewHandler(DB databases.DBInt) *Handler {
-	return &Handler{DB: DB}
+func NewHandler(DB databases.DBInt, hub *stream.Hub, jwt *auth.JWTValidator) *Handler {
+	return &Handler{DB: DB, Hub: hub, JWT: jwt}
 }
 
 // returnBadRequest wraps bad request
@@ -26,48 +33,120 @@ func returnBadRequest(err error, c *fiber.Ctx) error {
 	})
 }
 
+// returnUnauthorized wraps request without valid API key
+func returnUnauthorized(err error, c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"message": err.Error(),
+	})
+}
+
+// returnForbidden wraps request whose API key is not allowed to perform it
+func returnForbidden(err error, c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message": err.Error(),
+	})
+}
+
+// db returns database recording API key of request as acting one
+func (h *Handler) db(c *fiber.Ctx) databases.DBInt {
+	return h.DB.WithActor(principal(c).KeyID)
+}
+
 // GetBalance gets user balance by id
-// @Description Get user balance by given id
+// @Description Get user balance by given id in given currency (RUB by default) and balances in all currencies. Balance is available money, held is money in open reserves and total is their sum. Held money is broken down by service if by_service is set
 // @Summary     Get user balance
 // @Tags        Balance
 // @Accept      json
 // @Produce     json
-// @Param       inJSON body     models.PayloadId      true "In JSON with User ID"
-// @Success     200    {object} models.PayloadBalance "User's balance"
-// @Failure     400    {object} models.PayloadErr     "Error"
+// @Param       inJSON body     models.PayloadGetBalance true "In JSON with User ID, optional currency and by_service flag"
+// @Success     200    {object} models.PayloadBalance    "User's balance"
+// @Failure     400    {object} models.PayloadErr        "Error"
+// @Security    ApiKey
 // @Router      / [get]
 func (h *Handler) GetBalance(c *fiber.Ctx) error {
-	payload := models.PayloadId{}
+	payload := models.PayloadGetBalance{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.getBalance(c, payload)
+}
 
-	balance, err := h.DB.GetBalance(payload.ID)
+// getBalance gets balance of user by parsed payload
+func (h *Handler) getBalance(c *fiber.Ctx, payload models.PayloadGetBalance) error {
+	if err := checkUser(c, payload.ID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	currency, err := utils.NormalizeCurrency(payload.Currency)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
 
-	return c.JSON(fiber.Map{
-		"balance": utils.MoneyToFloat(balance),
-	})
+	balances, err := h.db(c).GetBalanceDetails(payload.ID, payload.ByService)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	// user without wallet and reserves in currency has zero balance in it
+	outPayload := models.PayloadBalance{
+		Currency: currency,
+		Balances: make([]models.PayloadWallet, 0, len(balances)),
+	}
+	for _, b := range balances {
+		wallet := models.PayloadWallet{
+			Currency: b.Currency,
+			Balance:  utils.MoneyToFloat(b.Available, b.Currency),
+			Held:     utils.MoneyToFloat(b.Held, b.Currency),
+			Total:    utils.MoneyToFloat(b.Total, b.Currency),
+		}
+		for _, s := range b.Services {
+			wallet.Services = append(wallet.Services, models.PayloadServiceHeld{
+				ServiceID:   s.ServiceID,
+				ServiceName: s.ServiceName,
+				Held:        utils.MoneyToFloat(s.Held, b.Currency),
+			})
+		}
+		outPayload.Balances = append(outPayload.Balances, wallet)
+
+		if b.Currency == currency {
+			outPayload.Balance = wallet.Balance
+			outPayload.Available = wallet.Balance
+			outPayload.Held = wallet.Held
+			outPayload.Total = wallet.Total
+			outPayload.Services = wallet.Services
+		}
+	}
+	return c.JSON(outPayload)
 }
 
 // AddBalance adds amount money to user by id
-// @Description Add user balance by given id
+// @Description Add user balance by given id in given currency (RUB by default)
 // @Summary     Add user balance
 // @Tags        Balance
 // @Accept      json
 // @Produce     json
-// @Param       inJSON body     models.PayloadAddBalance true "In JSON with User ID and Amount"
+// @Param       inJSON body     models.PayloadAddBalance true "In JSON with User ID, Amount and optional currency"
 // @Success     200    {string} status                   "OK"
 // @Failure     400    {object} models.PayloadErr        "Error"
+// @Security    ApiKey
 // @Router      / [post]
 func (h *Handler) AddBalance(c *fiber.Ctx) error {
 	payload := models.PayloadAddBalance{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
-	err := h.DB.AddBalance(payload.ID, utils.MoneyToInt(payload.Amount))
+	return h.addBalance(c, payload)
+}
+
+// addBalance adds money to user by parsed payload
+func (h *Handler) addBalance(c *fiber.Ctx, payload models.PayloadAddBalance) error {
+	currency, err := utils.NormalizeCurrency(payload.Currency)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	err = h.db(c).AddBalance(payload.ID, utils.MoneyToInt(payload.Amount, currency), currency)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
@@ -84,14 +163,19 @@ func (h *Handler) AddBalance(c *fiber.Ctx) error {
 // @Param       inJSON body     models.PayloadId  true "In JSON with User ID"
 // @Success     200    {string} status            "OK"
 // @Failure     400    {object} models.PayloadErr "Error"
+// @Security    ApiKey
 // @Router      /users/ [delete]
 func (h *Handler) DeleteUser(c *fiber.Ctx) error {
 	payload := models.PayloadId{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.deleteUser(c, payload)
+}
 
-	err := h.DB.DeleteUser(payload.ID)
+// deleteUser deletes user by parsed payload
+func (h *Handler) deleteUser(c *fiber.Ctx, payload models.PayloadId) error {
+	err := h.db(c).DeleteUser(payload.ID)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
@@ -100,65 +184,136 @@ func (h *Handler) DeleteUser(c *fiber.Ctx) error {
 }
 
 // Reserve performs money reserve transaction for given orderId, userId, serviceId and amount.
-// @Description Reserve money for given orderId, userId, serviceId and amount.
+// @Description Reserve money for given orderId, userId, serviceId and amount. Catalog price of the service is reserved if amount is omitted, otherwise amount must be within bounds of the service. Currency defaults to currency of the service and must match it
 // @Summary     Reserve money
 // @Tags        Reserves
 // @Accept      json
 // @Produce     json
-// @Param       inJSON body     models.PayloadReserve true "In JSON with user_id, service_id, order_id and amount"
-// @Success     200    {string} status                "OK"
-// @Failure     400    {object} models.PayloadErr     "Error"
+// @Param       inJSON body     models.PayloadReserve     true "In JSON with user_id, service_id, order_id and optional amount"
+// @Success     200    {object} models.ReserveFloatAmount "Created reserve"
+// @Failure     400    {object} models.PayloadErr         "Error"
+// @Security    ApiKey
 // @Router      /reserve/ [post]
 func (h *Handler) Reserve(c *fiber.Ctx) error {
 	payload := models.PayloadReserve{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.reserve(c, payload)
+}
+
+// reserve reserves money by parsed payload
+func (h *Handler) reserve(c *fiber.Ctx, payload models.PayloadReserve) error {
+	if err := checkServices(c, payload.ServiceID); err != nil {
+		return returnForbidden(err, c)
+	}
 
-	err := h.DB.Reserve(payload.UserID, payload.ServiceID, payload.OrderID, utils.MoneyToInt(payload.Amount))
+	// if currency is not given, it is taken from the service
+	currency := ""
+	amountCurrency := utils.DefaultCurrency
+	if payload.Currency != "" {
+		var err error
+		if currency, err = utils.NormalizeCurrency(payload.Currency); err != nil {
+			return returnBadRequest(err, c)
+		}
+		amountCurrency = currency
+	}
+
+	reserve, err := h.db(c).Reserve(payload.UserID, payload.ServiceID, payload.OrderID, utils.MoneyToInt(payload.Amount, amountCurrency), currency)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return c.JSON(reserveToPayload(reserve))
 }
 
 // GetReserve gets reserve by user_id, service_id, order_id
-// @Description Get reserve by user_id, service_id, order_id
+// @Description Get reserve by user_id, service_id, order_id with its status and history of amendments. Order with multiple line items is found by any of its services
 // @Summary     Get reserve
 // @Tags        Reserves
 // @Accept      json
 // @Produce     json
-// @Param       inJSON body     models.PayloadReserve true "In JSON with user_id, service_id, order_id"
-// @Success     200    {object} models.Reserve        "Service"
-// @Failure     400    {object} models.PayloadErr     "Error"
+// @Param       inJSON body     models.PayloadReserve     true "In JSON with user_id, service_id, order_id"
+// @Success     200    {object} models.ReserveFloatAmount "Reserve"
+// @Failure     400    {object} models.PayloadErr         "Error"
+// @Security    ApiKey
 // @Router      /reserve/ [get]
 func (h *Handler) GetReserve(c *fiber.Ctx) error {
 	payload := models.PayloadReserve{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.getReserve(c, payload)
+}
 
-	reserve, err := h.DB.GetReserve(payload.UserID, payload.ServiceID, payload.OrderID)
+// getReserve gets reserve by parsed payload
+func (h *Handler) getReserve(c *fiber.Ctx, payload models.PayloadReserve) error {
+	if err := checkUser(c, payload.UserID); err != nil {
+		return returnForbidden(err, c)
+	}
+	if err := checkServices(c, payload.ServiceID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	reserve, err := h.db(c).GetReserve(payload.UserID, payload.ServiceID, payload.OrderID)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
-	outPayload := models.ReserveFloatAmount{
-		OrderID:     reserve.OrderID,
-		UserID:      reserve.UserID,
-		User:        reserve.User,
-		ServiceID:   reserve.ServiceID,
-		Service:     reserve.Service,
-		Amount:      utils.MoneyToFloat(reserve.Amount),
-		Purchased:   reserve.Purchased,
-		ReservedAt:  reserve.ReservedAt,
-		PurchasedAt: reserve.PurchasedAt,
+	return c.JSON(reserveToPayload(reserve))
+}
+
+// AmendReserve changes amount and extends expiry time of reserve for given orderId, userId and serviceId.
+// @Description Increase or decrease reserved amount and extend expiry time of not purchased reserve. Increase is checked against available balance of user, difference of decrease is returned to user. Omitted amount keeps the reserved one, extend is duration like 30m or 1h
+// @Summary     Amend reserve
+// @Tags        Reserves
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadAmendReserve true "In JSON with user_id, service_id, order_id, optional new amount and extend"
+// @Success     200    {object} models.ReserveFloatAmount  "Amended reserve"
+// @Failure     400    {object} models.PayloadErr          "Error"
+// @Security    ApiKey
+// @Router      /reserve/ [patch]
+func (h *Handler) AmendReserve(c *fiber.Ctx) error {
+	payload := models.PayloadAmendReserve{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
 	}
-	return c.JSON(outPayload)
+	return h.amendReserve(c, payload)
+}
+
+// amendReserve amends reserve by parsed payload
+func (h *Handler) amendReserve(c *fiber.Ctx, payload models.PayloadAmendReserve) error {
+	if err := checkServices(c, payload.ServiceID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	var extend time.Duration
+	if payload.Extend != "" {
+		var err error
+		if extend, err = time.ParseDuration(payload.Extend); err != nil {
+			return returnBadRequest(fmt.Errorf("handler: amend reserve: wrong extend input: %v", err), c)
+		}
+	}
+
+	// new amount is in currency of the reserve
+	var amount int64
+	if payload.Amount != 0 {
+		reserve, err := h.db(c).GetReserve(payload.UserID, payload.ServiceID, payload.OrderID)
+		if err != nil {
+			return returnBadRequest(err, c)
+		}
+		amount = utils.MoneyToInt(payload.Amount, reserve.Currency)
+	}
+
+	reserve, err := h.db(c).AmendReserve(payload.UserID, payload.ServiceID, payload.OrderID, amount, extend)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	return c.JSON(reserveToPayload(reserve))
 }
 
 // DeleteReserve remove reserve for given orderId, userId, serviceId and amount.
-// @Description Remove reserve for given orderId, userId, serviceId and amount.
+// @Description Release reserve for given orderId, userId, serviceId and amount. Money is returned to user, the reserve is kept with released status
 // @Summary     Remove reserve
 // @Tags        Reserves
 // @Accept      json
@@ -166,14 +321,28 @@ func (h *Handler) GetReserve(c *fiber.Ctx) error {
 // @Param       inJSON body     models.PayloadReserve true "In JSON with user_id, service_id, order_id and amount"
 // @Success     200    {string} status                "OK"
 // @Failure     400    {object} models.PayloadErr     "Error"
+// @Security    ApiKey
 // @Router      /reserve/ [delete]
 func (h *Handler) DeleteReserve(c *fiber.Ctx) error {
 	payload := models.PayloadReserve{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.deleteReserve(c, payload)
+}
 
-	err := h.DB.DeleteReserve(payload.UserID, payload.ServiceID, payload.OrderID, utils.MoneyToInt(payload.Amount))
+// deleteReserve releases reserve by parsed payload
+func (h *Handler) deleteReserve(c *fiber.Ctx, payload models.PayloadReserve) error {
+	if err := checkServices(c, payload.ServiceID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	currency, err := utils.NormalizeCurrency(payload.Currency)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	err = h.db(c).DeleteReserve(payload.UserID, payload.ServiceID, payload.OrderID, utils.MoneyToInt(payload.Amount, currency))
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
@@ -182,7 +351,7 @@ func (h *Handler) DeleteReserve(c *fiber.Ctx) error {
 }
 
 // Purchase performs purchase for given orderId, userId, serviceId and amount.
-// @Description Perform purchase for given orderId, userId, serviceId and amount.
+// @Description Perform purchase for given orderId, userId, serviceId and amount. Currency defaults to currency of the reserve
 // @Summary     Perform purchase
 // @Tags        Purchases
 // @Accept      json
@@ -190,14 +359,34 @@ func (h *Handler) DeleteReserve(c *fiber.Ctx) error {
 // @Param       inJSON body     models.PayloadReserve true "In JSON with user_id, service_id, order_id and amount"
 // @Success     200    {string} status                "OK"
 // @Failure     400    {object} models.PayloadErr     "Error"
+// @Security    ApiKey
 // @Router      /purchase/ [post]
 func (h *Handler) Purchase(c *fiber.Ctx) error {
 	payload := models.PayloadReserve{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.purchase(c, payload)
+}
 
-	err := h.DB.Purchase(payload.UserID, payload.ServiceID, payload.OrderID, utils.MoneyToInt(payload.Amount))
+// purchase performs purchase by parsed payload
+func (h *Handler) purchase(c *fiber.Ctx, payload models.PayloadReserve) error {
+	if err := checkServices(c, payload.ServiceID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	// if currency is not given, it is taken from the reserve
+	currency := ""
+	amountCurrency := utils.DefaultCurrency
+	if payload.Currency != "" {
+		var err error
+		if currency, err = utils.NormalizeCurrency(payload.Currency); err != nil {
+			return returnBadRequest(err, c)
+		}
+		amountCurrency = currency
+	}
+
+	err := h.db(c).Purchase(payload.UserID, payload.ServiceID, payload.OrderID, utils.MoneyToInt(payload.Amount, amountCurrency), currency)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
@@ -205,30 +394,107 @@ func (h *Handler) Purchase(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusOK)
 }
 
-// AddServices adds multiple services
-// @Description Add multiple services
-// @Summary     Add multiple services
+// UpsertServices creates or updates multiple services
+// @Description Create or update multiple services with optional catalog price and amount bounds, currency of service is RUB by default, service is active by default. Result is returned for every service: created, updated or conflict (name is taken, currency differs from currency of existing service or price is not valid)
+// @Summary     Create or update multiple services
 // @Tags        Services
 // @Accept      json
 // @Produce     json
-// @Param       inJSON body     []models.Service  true "Array of services"
-// @Success     200    {string} status            "OK"
-// @Failure     400    {object} models.PayloadErr "Error"
+// @Param       inJSON body     []models.PayloadService    true "Array of services"
+// @Success     200    {array}  models.ServiceUpsertResult "Result for every service"
+// @Failure     400    {object} models.PayloadErr          "Error"
+// @Security    ApiKey
 // @Router      /services/ [post]
-func (h *Handler) AddServices(c *fiber.Ctx) error {
+// @Router      /v2/services [post]
+func (h *Handler) UpsertServices(c *fiber.Ctx) error {
 	payload := struct {
-		Services []models.Service `json:"services"`
+		Services []models.PayloadService `json:"services"`
 	}{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
 
-	err := h.DB.AddServices(payload.Services[:])
+	services := make([]models.Service, 0, len(payload.Services))
+	for _, s := range payload.Services {
+		currency, err := utils.NormalizeCurrency(s.Currency)
+		if err != nil {
+			return returnBadRequest(err, c)
+		}
+		service := models.Service{
+			ID:        s.ID,
+			Name:      s.Name,
+			Currency:  currency,
+			Active:    s.Active == nil || *s.Active,
+			Price:     moneyToIntPtr(s.Price, currency),
+			MinAmount: moneyToIntPtr(s.MinAmount, currency),
+			MaxAmount: moneyToIntPtr(s.MaxAmount, currency),
+		}
+		services = append(services, service)
+	}
+
+	results, err := h.db(c).UpsertServices(services)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return c.JSON(results)
+}
+
+// GetServices gets page of services
+// @Description Get page of services ordered by id with case-insensitive search by name
+// @Summary     List services
+// @Tags        Services
+// @Accept      json
+// @Produce     json
+// @Param       name   query    string                 false "Substring of service name"
+// @Param       active query    bool                   false "Filter by active flag"
+// @Param       limit  query    integer                false "Page size, 20 by default, 100 at most"
+// @Param       offset query    integer                false "Number of skipped services"
+// @Success     200    {object} models.PayloadServices "Page of services"
+// @Failure     400    {object} models.PayloadErr      "Error"
+// @Security    ApiKey
+// @Router      /services/list [get]
+// @Router      /v2/services [get]
+func (h *Handler) GetServices(c *fiber.Ctx) error {
+	payload := models.PayloadServicesQuery{}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	filter := models.ServicesFilter{
+		Name:   payload.Name,
+		Limit:  payload.Limit,
+		Offset: payload.Offset,
+	}
+	if payload.Active != "" {
+		active, err := strconv.ParseBool(payload.Active)
+		if err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get services: wrong active input: %v", err), c)
+		}
+		filter.Active = &active
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 20
+	}
+	if filter.Limit < 0 || filter.Limit > 100 || filter.Offset < 0 {
+		return returnBadRequest(errors.New("handler: get services: limit must be in [1, 100] range and offset must not be negative"), c)
+	}
+
+	services, total, err := h.db(c).GetServices(filter)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := models.PayloadServices{
+		Services: make([]models.PayloadService, 0, len(services)),
+		Total:    total,
+		Limit:    filter.Limit,
+		Offset:   filter.Offset,
+	}
+	for _, service := range services {
+		outPayload.Services = append(outPayload.Services, serviceToPayload(service))
+	}
+	return c.JSON(outPayload)
 }
 
 // GetService gets service by id
@@ -237,26 +503,120 @@ func (h *Handler) AddServices(c *fiber.Ctx) error {
 // @Tags        Services
 // @Accept      json
 // @Produce     json
-// @Param       inJSON body     models.PayloadId  true "In JSON with Service ID"
-// @Success     200    {object} models.Service    "Service"
-// @Failure     400    {object} models.PayloadErr "Error"
+// @Param       inJSON body     models.PayloadId      true "In JSON with Service ID"
+// @Success     200    {object} models.PayloadService "Service"
+// @Failure     400    {object} models.PayloadErr     "Error"
+// @Security    ApiKey
 // @Router      /services/ [get]
 func (h *Handler) GetService(c *fiber.Ctx) error {
 	payload := models.PayloadId{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.getService(c, payload)
+}
+
+// getService gets service by parsed payload
+func (h *Handler) getService(c *fiber.Ctx, payload models.PayloadId) error {
+	service, err := h.db(c).GetService(payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(serviceToPayload(service))
+}
+
+// UpdateService updates service by id
+// @Description Update name, active flag, catalog price and amount bounds of service by given id. Omitted fields are left unchanged, change of price or bounds creates a new price version. Currency of service cannot be changed
+// @Summary     Update service
+// @Tags        Services
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadService true "In JSON with Service ID and changed fields"
+// @Success     200    {object} models.PayloadService "Updated service"
+// @Failure     400    {object} models.PayloadErr     "Error"
+// @Security    ApiKey
+// @Router      /services/ [put]
+func (h *Handler) UpdateService(c *fiber.Ctx) error {
+	payload := models.PayloadService{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.updateService(c, payload)
+}
+
+// updateService updates service by parsed payload
+func (h *Handler) updateService(c *fiber.Ctx, payload models.PayloadService) error {
+	if payload.Currency != "" {
+		return returnBadRequest(errors.New("handler: update service: currency of service cannot be changed"), c)
+	}
 
-	service, err := h.DB.GetService(payload.ID)
+	// price and bounds are converted in currency of the service
+	service, err := h.db(c).GetService(payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	update := models.ServiceUpdate{
+		ID:        payload.ID,
+		Active:    payload.Active,
+		Price:     moneyToIntPtr(payload.Price, service.Currency),
+		MinAmount: moneyToIntPtr(payload.MinAmount, service.Currency),
+		MaxAmount: moneyToIntPtr(payload.MaxAmount, service.Currency),
+	}
+	if payload.Name != "" {
+		update.Name = &payload.Name
+	}
+
+	service, err = h.db(c).UpdateService(update)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(serviceToPayload(service))
+}
+
+// GetServicePrices gets all price versions of service by id
+// @Description Get all versions of catalog price and amount bounds of service by given id
+// @Summary     Get service price versions
+// @Tags        Services
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer                    true "Service ID"
+// @Success     200 {array}  models.PayloadServicePrice "Price versions"
+// @Failure     400 {object} models.PayloadErr          "Error"
+// @Security    ApiKey
+// @Router      /services/{id}/prices [get]
+// @Router      /v2/services/{id}/prices [get]
+func (h *Handler) GetServicePrices(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	service, err := h.db(c).GetService(payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	prices, err := h.db(c).GetServicePrices(payload.ID)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
 
-	return c.JSON(service)
+	outPayload := make([]models.PayloadServicePrice, 0, len(prices))
+	for _, p := range prices {
+		outPayload = append(outPayload, models.PayloadServicePrice{
+			Version:   p.Version,
+			Price:     moneyToFloatPtr(p.Price, service.Currency),
+			MinAmount: moneyToFloatPtr(p.MinAmount, service.Currency),
+			MaxAmount: moneyToFloatPtr(p.MaxAmount, service.Currency),
+			ValidFrom: p.ValidFrom,
+		})
+	}
+	return c.JSON(outPayload)
 }
 
-// DeleteService deletes service by id
-// @Description Delete service by given id
+// DeleteService deactivates service by id
+// @Description Deactivate service by given id. Service is kept for operations, reserves and reports, but cannot be reserved anymore
 // @Summary     Delete service
 // @Tags        Services
 // @Accept      json
@@ -264,14 +624,19 @@ func (h *Handler) GetService(c *fiber.Ctx) error {
 // @Param       inJSON body     models.PayloadId  true "In JSON with Service ID"
 // @Success     200    {string} status            "OK"
 // @Failure     400    {object} models.PayloadErr "Error"
+// @Security    ApiKey
 // @Router      /services/ [delete]
 func (h *Handler) DeleteService(c *fiber.Ctx) error {
 	payload := models.PayloadId{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.deleteService(c, payload)
+}
 
-	err := h.DB.DeleteService(payload.ID)
+// deleteService deactivates service by parsed payload
+func (h *Handler) deleteService(c *fiber.Ctx, payload models.PayloadId) error {
+	err := h.db(c).DeactivateService(payload.ID)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
@@ -279,8 +644,8 @@ func (h *Handler) DeleteService(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusOK)
 }
 
-// GetReport returns csv report file by given year and month
-// @Description Get csv report file by given year and month
+// GetReport returns the latest version of csv report file by given year and month
+// @Description Get the latest version of csv report file by given year and month
 // @Summary     Get csv report file
 // @Tags        Reports
 // @Accept      json
@@ -290,7 +655,9 @@ func (h *Handler) DeleteService(c *fiber.Ctx) error {
 // @Success     200   {string} string            "CSV file"
 // @Failure     404   {object} models.PayloadErr "CSV file not found"
 // @Failure     400   {object} models.PayloadErr "Error"
+// @Security    ApiKey
 // @Router      /report/{year}/{month}/report.csv [get]
+// @Router      /v2/report/{year}/{month}/report.csv [get]
 func (h *Handler) GetReport(c *fiber.Ctx) error {
 	payload := models.PayloadDate{}
 	if err := c.ParamsParser(&payload); err != nil {
@@ -300,44 +667,240 @@ func (h *Handler) GetReport(c *fiber.Ctx) error {
 		return returnBadRequest(errors.New("handler: get report: wrong month input"), c)
 	}
 
-	filePath := utils.GetReportFilePath(payload.Year, payload.Month)
-	if _, err := os.Stat(filePath); err == nil {
-		return c.SendFile(filePath, false)
-	} else if errors.Is(err, os.ErrNotExist) {
+	reports, err := h.db(c).GetReports(payload.Year, payload.Month)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	if len(reports) == 0 {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": fmt.Errorf("handler: get report: report from %d.%d doesn't exist", payload.Month, payload.Year),
+			"message": fmt.Errorf("handler: get report: report from %d.%d doesn't exist", payload.Month, payload.Year).Error(),
 		})
-	} else {
+	}
+
+	return sendReportFile(utils.GetReportFilePath(payload.Year, payload.Month, reports[len(reports)-1].Version), c)
+}
+
+// GetReportVersion returns csv report file by given year, month and version
+// @Description Get csv report file by given year, month and version
+// @Summary     Get csv report file version
+// @Tags        Reports
+// @Accept      json
+// @Produce     plain
+// @Param       year    path     integer           true "Year"
+// @Param       month   path     integer           true "Month"
+// @Param       version path     integer           true "Report version"
+// @Success     200     {string} string            "CSV file"
+// @Failure     404     {object} models.PayloadErr "CSV file not found"
+// @Failure     400     {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /report/{year}/{month}/{version}/report.csv [get]
+// @Router      /v2/report/{year}/{month}/{version}/report.csv [get]
+func (h *Handler) GetReportVersion(c *fiber.Ctx) error {
+	payload := models.PayloadReportVersion{}
+	if err := c.ParamsParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	if payload.Month < 1 || payload.Month > 12 {
+		return returnBadRequest(errors.New("handler: get report version: wrong month input"), c)
+	}
+
+	return sendReportFile(utils.GetReportFilePath(payload.Year, payload.Month, payload.Version), c)
 }
 
-// CreateReport returns link to csv report file by given year and month
-// @Description Get link to csv report file by given year and month
-// @Summary     Get link to csv report file
+// GetReportDiff returns csv file with diff of report version against the previous one
+// @Description Get csv file with diff of report version against the previous version by given year, month and version
+// @Summary     Get csv report diff file
+// @Tags        Reports
+// @Accept      json
+// @Produce     plain
+// @Param       year    path     integer           true "Year"
+// @Param       month   path     integer           true "Month"
+// @Param       version path     integer           true "Report version"
+// @Success     200     {string} string            "CSV file"
+// @Failure     404     {object} models.PayloadErr "CSV file not found"
+// @Failure     400     {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /report/{year}/{month}/{version}/diff.csv [get]
+// @Router      /v2/report/{year}/{month}/{version}/diff.csv [get]
+func (h *Handler) GetReportDiff(c *fiber.Ctx) error {
+	payload := models.PayloadReportVersion{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.Month < 1 || payload.Month > 12 {
+		return returnBadRequest(errors.New("handler: get report diff: wrong month input"), c)
+	}
+
+	return sendReportFile(utils.GetReportDiffFilePath(payload.Year, payload.Month, payload.Version), c)
+}
+
+// GetReports returns all versions of report by given year and month
+// @Description Get all versions of report with their digests by given year and month
+// @Summary     Get report versions
 // @Tags        Reports
 // @Accept      json
 // @Produce     json
-// @Param       inJSON body     models.PayloadId   true "In JSON with Service ID"
-// @Success     200    {object} models.PayloadLink "Link to CSV file"
-// @Failure     400    {object} models.PayloadErr  "Error"
+// @Param       year  path     integer           true "Year"
+// @Param       month path     integer           true "Month"
+// @Success     200   {array}  models.Report     "Report versions"
+// @Failure     400   {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /report/{year}/{month} [get]
+// @Router      /v2/report/{year}/{month} [get]
+func (h *Handler) GetReports(c *fiber.Ctx) error {
+	payload := models.PayloadDate{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.Month < 1 || payload.Month > 12 {
+		return returnBadRequest(errors.New("handler: get reports: wrong month input"), c)
+	}
+
+	reports, err := h.db(c).GetReports(payload.Year, payload.Month)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	if reports == nil {
+		reports = []models.Report{}
+	}
+
+	return c.JSON(reports)
+}
+
+// CreateReport creates a new version of csv report and returns link to it by given year and month
+// @Description Create a new version of csv report by given year and month and get link to it. Previous versions are kept, diff against the previous version is returned
+// @Summary     Create csv report version
+// @Tags        Reports
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadDate   true "In JSON with year and month"
+// @Success     200    {object} models.PayloadReport "Created report version"
+// @Failure     400    {object} models.PayloadErr    "Error"
+// @Security    ApiKey
 // @Router      /report/ [post]
 func (h *Handler) CreateReport(c *fiber.Ctx) error {
 	payload := models.PayloadDate{}
 	if err := c.BodyParser(&payload); err != nil {
 		return returnBadRequest(err, c)
 	}
+	return h.createReport(c, payload)
+}
+
+// createReport creates report version by parsed payload
+func (h *Handler) createReport(c *fiber.Ctx, payload models.PayloadDate) error {
 	if payload.Month < 1 || payload.Month > 12 {
 		return returnBadRequest(errors.New("handler: get report: wrong month input"), c)
 	}
 
-	relativeLink, err := h.DB.CreateReport(payload.Year, payload.Month)
+	report, err := h.db(c).CreateReport(payload.Year, payload.Month)
 	if err != nil {
 		return returnBadRequest(err, c)
 	}
-	link := c.BaseURL() + "/api" + relativeLink
 
-	return c.JSON(fiber.Map{
-		"report_link": link,
-	})
+	return c.JSON(reportToPayload(report, c))
+}
+
+// sendReportFile sends report file by given path or not found error
+func sendReportFile(filePath string, c *fiber.Ctx) error {
+	if _, err := os.Stat(filePath); err == nil {
+		return c.SendFile(filePath, false)
+	} else if errors.Is(err, os.ErrNotExist) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "handler: get report: report file doesn't exist",
+		})
+	} else {
+		return returnBadRequest(err, c)
+	}
+}
+
+// reportToPayload converts report to payload with links to its files
+func reportToPayload(report models.Report, c *fiber.Ctx) models.PayloadReport {
+	prefix := "/api"
+	if strings.HasPrefix(c.Path(), "/api/v2") {
+		prefix = "/api/v2"
+	}
+	outPayload := models.PayloadReport{
+		ReportLink: c.BaseURL() + prefix + utils.GetReportFilePath(report.Year, report.Month, report.Version)[1:],
+		Version:    report.Version,
+		Closing:    report.Closing,
+		SHA256:     report.SHA256,
+		CreatedAt:  report.CreatedAt,
+	}
+	if report.Diff != nil {
+		outPayload.DiffLink = c.BaseURL() + prefix + utils.GetReportDiffFilePath(report.Year, report.Month, report.Version)[1:]
+		outPayload.Diff = make([]models.PayloadReportDiffLine, 0, len(report.Diff))
+		for _, l := range report.Diff {
+			outPayload.Diff = append(outPayload.Diff, models.PayloadReportDiffLine{
+				ServiceName: l.ServiceName,
+				Currency:    l.Currency,
+				Previous:    utils.MoneyToFloat(l.Previous, l.Currency),
+				Current:     utils.MoneyToFloat(l.Current, l.Currency),
+			})
+		}
+	}
+	return outPayload
+}
+
+// reserveToPayload converts reserve amount and service prices from minor units of currency
+func reserveToPayload(reserve models.Reserve) models.ReserveFloatAmount {
+	var amendments []models.PayloadReserveAmendment
+	for _, a := range reserve.Amendments {
+		amendments = append(amendments, models.PayloadReserveAmendment{
+			PreviousAmount:    utils.MoneyToFloat(a.PreviousAmount, reserve.Currency),
+			Amount:            utils.MoneyToFloat(a.Amount, reserve.Currency),
+			PreviousExpiresAt: a.PreviousExpiresAt,
+			ExpiresAt:         a.ExpiresAt,
+			AmendedAt:         a.AmendedAt,
+		})
+	}
+	return models.ReserveFloatAmount{
+		OrderID:      reserve.OrderID,
+		UserID:       reserve.UserID,
+		User:         reserve.User,
+		ServiceID:    reserve.ServiceID,
+		Service:      serviceToPayload(reserve.Service),
+		Amount:       utils.MoneyToFloat(reserve.Amount, reserve.Currency),
+		Currency:     reserve.Currency,
+		Purchased:    reserve.Purchased,
+		ReservedAt:   reserve.ReservedAt,
+		PurchasedAt:  reserve.PurchasedAt,
+		PriceVersion: reserve.PriceVersion,
+		ExpiresAt:    reserve.ExpiresAt,
+		Status:       reserve.Status,
+		ReleasedAt:   reserve.ReleasedAt,
+		Amendments:   amendments,
+	}
+}
+
+// serviceToPayload converts service prices from minor units of currency
+func serviceToPayload(service models.Service) models.PayloadService {
+	active := service.Active
+	return models.PayloadService{
+		ID:           service.ID,
+		Name:         service.Name,
+		Currency:     service.Currency,
+		Active:       &active,
+		PriceVersion: service.PriceVersion,
+		Price:        moneyToFloatPtr(service.Price, service.Currency),
+		MinAmount:    moneyToFloatPtr(service.MinAmount, service.Currency),
+		MaxAmount:    moneyToFloatPtr(service.MaxAmount, service.Currency),
+	}
+}
+
+// moneyToIntPtr converts optional money amount to minor units of currency
+func moneyToIntPtr(amount *float32, currency string) *int64 {
+	if amount == nil {
+		return nil
+	}
+	v := utils.MoneyToInt(*amount, currency)
+	return &v
+}
+
+// moneyToFloatPtr converts optional money amount from minor units of currency
+func moneyToFloatPtr(amount *int64, currency string) *float32 {
+	if amount == nil {
+		return nil
+	}
+	v := utils.MoneyToFloat(*amount, currency)
+	return &v
 }
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxEndOfDayUsers is the maximum number of users in one request of end of day balances
+const MaxEndOfDayUsers = 1000
+
+// GetBalanceAt returns balance of user at given moment
+// @Description Get balances of user in every currency and reserves open at given moment calculated from operations and reserves. Operations done exactly at the moment are not taken into account
+// @Summary     Get user balance at moment
+// @Tags        Balance
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer                 true  "User ID"
+// @Param       at  query    string                  false "Moment, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339, now by default"
+// @Success     200 {object} models.PayloadBalanceAt "User's balance at moment"
+// @Failure     400 {object} models.PayloadErr       "Error"
+// @Security    ApiKey
+// @Router      /users/{id}/balance [get]
+// @Router      /v2/users/{id}/balance/as-of [get]
+func (h *Handler) GetBalanceAt(c *fiber.Ctx) error {
+	payload := models.PayloadBalanceAtQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if err := checkUser(c, payload.ID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	at := time.Now().In(loc)
+	if payload.At != "" {
+		var err error
+		if at, err = parseRateTime(payload.At); err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get balance at: wrong at input: %v", err), c)
+		}
+	}
+
+	balance, err := h.db(c).GetBalanceAt(payload.ID, at)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	return c.JSON(balanceAtToPayload(balance))
+}
+
+// GetEndOfDayBalances returns balances of users at the end of given day
+// @Description Get balances of given users in every currency at the end of given day (Moscow time) for liability reporting
+// @Summary     Get end of day balances
+// @Tags        Balance
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadEndOfDayQuery true "In JSON with user_ids (1000 at most) and date as YYYY-MM-DD"
+// @Success     200    {array}  models.PayloadBalanceAt     "Users' balances"
+// @Failure     400    {object} models.PayloadErr           "Error"
+// @Security    ApiKey
+// @Router      /balances/end-of-day [post]
+// @Router      /v2/balances/end-of-day [post]
+func (h *Handler) GetEndOfDayBalances(c *fiber.Ctx) error {
+	payload := models.PayloadEndOfDayQuery{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if len(payload.UserIDs) == 0 || len(payload.UserIDs) > MaxEndOfDayUsers {
+		return returnBadRequest(fmt.Errorf("handler: get end of day balances: from 1 to %d users must be given", MaxEndOfDayUsers), c)
+	}
+	if payload.Date == "" {
+		return returnBadRequest(errors.New("handler: get end of day balances: date must be given"), c)
+	}
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	day, err := time.ParseInLocation("2006-01-02", payload.Date, loc)
+	if err != nil {
+		return returnBadRequest(fmt.Errorf("handler: get end of day balances: wrong date input: %v", err), c)
+	}
+
+	balances, err := h.db(c).GetEndOfDayBalances(payload.UserIDs, day)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := make([]models.PayloadBalanceAt, 0, len(balances))
+	for _, b := range balances {
+		outPayload = append(outPayload, balanceAtToPayload(b))
+	}
+	return c.JSON(outPayload)
+}
+
+// CreateSnapshot stores end of day balances of all users for given day
+// @Description Store end of day balances and held money of all users for given day which is over, snapshot of the same day is replaced. Snapshots are made by daily job, the endpoint is for backfill
+// @Summary     Create balance snapshot
+// @Tags        Balance
+// @Accept      json
+// @Produce     json
+// @Param       date path     string                 true "Day, YYYY-MM-DD"
+// @Success     200  {object} models.PayloadSnapshot "Snapshot"
+// @Failure     400  {object} models.PayloadErr      "Error"
+// @Security    ApiKey
+// @Router      /snapshots/{date} [post]
+// @Router      /v2/snapshots/{date} [post]
+func (h *Handler) CreateSnapshot(c *fiber.Ctx) error {
+	payload := models.PayloadSnapshotQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	day, err := time.ParseInLocation("2006-01-02", payload.Date, loc)
+	if err != nil {
+		return returnBadRequest(fmt.Errorf("handler: create snapshot: wrong date input: %v", err), c)
+	}
+
+	snapshot, err := h.db(c).CreateSnapshot(day)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	return c.JSON(models.PayloadSnapshot{
+		Day:       snapshot.Day.Format("2006-01-02"),
+		Wallets:   snapshot.Wallets,
+		CreatedAt: snapshot.CreatedAt,
+	})
+}
+
+// GetLiabilities returns total liabilities report for given date range
+// @Description Get money owed to users at the end of every day by snapshots with daily inflows (top-ups), outflows (purchases), other operations and net change. Every day is reconciled with balance calculated from operations
+// @Summary     Get liabilities report
+// @Tags        Reports
+// @Accept      json
+// @Produce     json
+// @Param       from query    string                    false "First day of range, YYYY-MM-DD, first day of month of yesterday by default"
+// @Param       to   query    string                    false "Last day of range, YYYY-MM-DD, yesterday by default"
+// @Success     200  {object} models.PayloadLiabilities "Liabilities report"
+// @Failure     400  {object} models.PayloadErr         "Error"
+// @Security    ApiKey
+// @Router      /liabilities [get]
+// @Router      /v2/liabilities [get]
+func (h *Handler) GetLiabilities(c *fiber.Ctx) error {
+	payload := models.PayloadLiabilitiesQuery{}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, loc)
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, loc)
+	var err error
+	if payload.From != "" {
+		if from, err = time.ParseInLocation("2006-01-02", payload.From, loc); err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get liabilities: wrong from input: %v", err), c)
+		}
+	}
+	if payload.To != "" {
+		if to, err = time.ParseInLocation("2006-01-02", payload.To, loc); err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get liabilities: wrong to input: %v", err), c)
+		}
+	}
+	if to.Before(from) {
+		return returnBadRequest(errors.New("handler: get liabilities: from must not be after to"), c)
+	} else if to.After(from.AddDate(1, 0, 0)) {
+		return returnBadRequest(errors.New("handler: get liabilities: range must not be longer than a year"), c)
+	}
+
+	report, err := h.db(c).GetLiabilities(from, to)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := models.PayloadLiabilities{
+		From:       report.From.Format("2006-01-02"),
+		To:         report.To.Format("2006-01-02"),
+		Lines:      make([]models.PayloadLiabilitiesLine, 0, len(report.Lines)),
+		Reconciled: report.Reconciled,
+	}
+	for _, l := range report.Lines {
+		outPayload.Lines = append(outPayload.Lines, models.PayloadLiabilitiesLine{
+			Day:         l.Day.Format("2006-01-02"),
+			Currency:    l.Currency,
+			Snapshot:    l.Snapshot,
+			Liabilities: utils.MoneyToFloat(l.Liabilities, l.Currency),
+			Held:        utils.MoneyToFloat(l.Held, l.Currency),
+			Inflows:     utils.MoneyToFloat(l.Inflows, l.Currency),
+			Outflows:    utils.MoneyToFloat(l.Outflows, l.Currency),
+			Other:       utils.MoneyToFloat(l.Other, l.Currency),
+			NetChange:   utils.MoneyToFloat(l.NetChange, l.Currency),
+			Journal:     utils.MoneyToFloat(l.Journal, l.Currency),
+			Reconciled:  l.Reconciled,
+		})
+	}
+	return c.JSON(outPayload)
+}
+
+// balanceAtToPayload converts money of balance at moment from minor units of currency
+func balanceAtToPayload(balance models.BalanceAt) models.PayloadBalanceAt {
+	outPayload := models.PayloadBalanceAt{
+		UserID:   balance.UserID,
+		At:       balance.At,
+		Balances: make([]models.PayloadWallet, 0, len(balance.Balances)),
+	}
+	for _, b := range balance.Balances {
+		outPayload.Balances = append(outPayload.Balances, models.PayloadWallet{
+			Currency: b.Currency,
+			Balance:  utils.MoneyToFloat(b.Available, b.Currency),
+			Held:     utils.MoneyToFloat(b.Held, b.Currency),
+			Total:    utils.MoneyToFloat(b.Total, b.Currency),
+		})
+	}
+	for _, r := range balance.Reserves {
+		outPayload.Reserves = append(outPayload.Reserves, models.PayloadOpenReserve{
+			OrderID:    r.OrderID,
+			UserID:     r.UserID,
+			ServiceID:  r.ServiceID,
+			Amount:     utils.MoneyToFloat(r.Amount, r.Currency),
+			Currency:   r.Currency,
+			ReservedAt: r.ReservedAt,
+		})
+	}
+	return outPayload
+}
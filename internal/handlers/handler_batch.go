@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"balance/internal/auth"
+	"balance/internal/databases"
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxBatchOperations is the maximum number of operations in one batch
+const MaxBatchOperations = 1000
+
+// Batch performs many credits, reserves, purchases and releases in one request
+// @Description Perform up to 1000 operations in one request: credit (user_id, amount, currency), reserve (user_id, service_id, order_id, optional amount and currency), purchase (user_id, service_id, order_id, amount, optional currency) and release (user_id, service_id, order_id). Atomic batch is applied in one transaction and the first failed operation rolls it back, the rest of operations are skipped. Operations of independent batch are applied one by one and failed ones do not affect the others. Result is returned for every operation in order of the request: applied, failed with error code (NOT_FOUND, FAILED_PRECONDITION, INVALID_ARGUMENT, ALREADY_EXISTS, ABORTED, INTERNAL) or skipped. Failed operations with ABORTED code could be retried
+// @Summary     Perform batch of operations
+// @Tags        Batch
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadBatch       true "In JSON with atomic flag and operations"
+// @Success     200    {object} models.PayloadBatchResult "Result for every operation"
+// @Failure     400    {object} models.PayloadErr         "Error"
+// @Security    ApiKey
+// @Router      /batch [post]
+// @Router      /v2/batch [post]
+func (h *Handler) Batch(c *fiber.Ctx) error {
+	payload := models.PayloadBatch{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if len(payload.Operations) == 0 || len(payload.Operations) > MaxBatchOperations {
+		return returnBadRequest(fmt.Errorf("handler: batch: number of operations must be in [1, %d] range", MaxBatchOperations), c)
+	}
+
+	// invalid operations fail without database, the rest are performed by indexes of the request
+	outPayload := models.PayloadBatchResult{Results: make([]models.PayloadBatchItemResult, len(payload.Operations))}
+	operations := make([]models.BatchOperation, 0, len(payload.Operations))
+	indexes := make([]int, 0, len(payload.Operations))
+	invalid := false
+	for i, o := range payload.Operations {
+		operation, err := batchOperation(o)
+		if err != nil {
+			outPayload.Results[i] = models.PayloadBatchItemResult{Status: models.BatchFailed, Code: databases.CodeInvalidArgument, Error: err.Error()}
+			invalid = true
+			continue
+		}
+		// credits are not made for services and require credit scope, the rest of operations are checked against services of caller
+		if operation.Type == models.BatchCredit && !auth.HasScope(principal(c), auth.ScopeCredit) {
+			return returnForbidden(fmt.Errorf("handler: batch: operation %d: %s scope is required to credit", i, auth.ScopeCredit), c)
+		} else if operation.Type != models.BatchCredit {
+			if err = checkServices(c, operation.ServiceID); err != nil {
+				return returnForbidden(fmt.Errorf("handler: batch: operation %d: %v", i, err), c)
+			}
+		}
+		operations = append(operations, operation)
+		indexes = append(indexes, i)
+	}
+
+	if invalid && payload.Atomic {
+		for _, i := range indexes {
+			outPayload.Results[i] = models.PayloadBatchItemResult{Status: models.BatchSkipped}
+		}
+	} else if len(operations) > 0 {
+		results, err := h.db(c).Batch(operations, payload.Atomic)
+		if err != nil {
+			return returnBadRequest(err, c)
+		}
+		for j, r := range results {
+			result := models.PayloadBatchItemResult{Status: r.Status, Code: r.Code, Error: r.Error}
+			if r.Reserve != nil {
+				reserve := reserveToPayload(*r.Reserve)
+				result.Reserve = &reserve
+			}
+			outPayload.Results[indexes[j]] = result
+		}
+	}
+
+	for i := range outPayload.Results {
+		outPayload.Results[i].Index = i
+		switch outPayload.Results[i].Status {
+		case models.BatchApplied:
+			outPayload.Applied++
+		case models.BatchFailed:
+			outPayload.Failed++
+		case models.BatchSkipped:
+			outPayload.Skipped++
+		}
+	}
+	return c.JSON(outPayload)
+}
+
+// batchOperation validates operation of batch and converts its amount to minor units of currency
+// the same way as single operation of its type
+func batchOperation(o models.PayloadBatchOperation) (models.BatchOperation, error) {
+	operation := models.BatchOperation{
+		Type:      o.Type,
+		UserID:    o.UserID,
+		ServiceID: o.ServiceID,
+		OrderID:   o.OrderID,
+	}
+
+	switch o.Type {
+	case models.BatchCredit, models.BatchRelease:
+		currency, err := utils.NormalizeCurrency(o.Currency)
+		if err != nil {
+			return models.BatchOperation{}, err
+		}
+		operation.Currency = currency
+		operation.Amount = utils.MoneyToInt(o.Amount, currency)
+	case models.BatchReserve, models.BatchPurchase:
+		// if currency is not given, it is taken from the service or the reserve
+		amountCurrency := utils.DefaultCurrency
+		if o.Currency != "" {
+			currency, err := utils.NormalizeCurrency(o.Currency)
+			if err != nil {
+				return models.BatchOperation{}, err
+			}
+			operation.Currency = currency
+			amountCurrency = currency
+		}
+		operation.Amount = utils.MoneyToInt(o.Amount, amountCurrency)
+	default:
+		return models.BatchOperation{}, errors.New("handler: batch: type must be credit, reserve, purchase or release")
+	}
+	return operation, nil
+}
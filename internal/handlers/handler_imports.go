@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"balance/internal/imports"
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxImportSize is the maximum size of uploaded import file bounded by body limit of the app,
+// larger files are imported by import command
+const MaxImportSize = fiber.DefaultBodyLimit
+
+// CreateImport loads CSV file of balances and applies its credits in background
+// @Description Load CSV file of user_id, amount and optional external_ref columns (header is optional) in given currency (RUB by default). Rows are validated and loaded into staging table, invalid rows are not applied. Credits are applied in background in chunks the same way as adding of balance, progress is returned by GET /imports/{id} and status of every row by GET /imports/{id}/result.csv. The same file cannot be imported twice, import interrupted by failure is resumed by POST /imports/{id}/resume. Files larger than 4 MB are imported by import command
+// @Summary     Import balances
+// @Tags        Imports
+// @Accept      multipart/form-data
+// @Produce     json
+// @Param       file     formData file              true  "CSV file"
+// @Param       currency formData string            false "Currency of amounts, RUB by default"
+// @Success     200      {object} models.Import     "Created import"
+// @Failure     400      {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /imports [post]
+// @Router      /v2/imports [post]
+func (h *Handler) CreateImport(c *fiber.Ctx) error {
+	currency, err := utils.NormalizeCurrency(c.FormValue("currency"))
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return returnBadRequest(fmt.Errorf("handler: create import: file is not uploaded: %v", err), c)
+	}
+	if header.Size > MaxImportSize {
+		return returnBadRequest(errors.New("handler: create import: file is larger than 4 MB, use import command"), c)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	defer file.Close()
+
+	// file is read twice: for checksum and for rows streamed into database
+	checksum, err := imports.Checksum(file)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	db := h.db(c)
+	imp, err := db.CreateImport(models.Import{
+		FileName: header.Filename,
+		SHA256:   checksum,
+		Currency: currency,
+	}, imports.NewReader(file, currency).Read)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	// errors of applying are logged by database layer, import is resumed then
+	go func() { _, _ = db.ApplyImport(imp.ID) }()
+
+	return c.JSON(imp)
+}
+
+// GetImport returns import with numbers of its rows by status
+// @Description Get import by given id with its status and numbers of pending, applied, invalid and failed rows
+// @Summary     Get import
+// @Tags        Imports
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer           true "Import ID"
+// @Success     200 {object} models.Import     "Import"
+// @Failure     400 {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /imports/{id} [get]
+// @Router      /v2/imports/{id} [get]
+func (h *Handler) GetImport(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	imp, err := h.db(c).GetImport(payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(imp)
+}
+
+// ResumeImport applies not applied credits of import in background
+// @Description Resume import by given id interrupted by failure, credits of pending rows are applied in background. Rows being applied by another instance are not applied twice
+// @Summary     Resume import
+// @Tags        Imports
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer           true "Import ID"
+// @Success     200 {object} models.Import     "Import"
+// @Failure     400 {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /imports/{id}/resume [post]
+// @Router      /v2/imports/{id}/resume [post]
+func (h *Handler) ResumeImport(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	db := h.db(c)
+	imp, err := db.GetImport(payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	if imp.Status == models.ImportCompleted {
+		return returnBadRequest(fmt.Errorf("handler: resume import: import %d is already completed", imp.ID), c)
+	}
+
+	go func() { _, _ = db.ApplyImport(imp.ID) }()
+
+	return c.JSON(imp)
+}
+
+// GetImportResult returns csv file with status of every row of import
+// @Description Get csv file with line, user_id, amount, external_ref, status (pending, applied, invalid or failed) and error of every row of import by given id
+// @Summary     Get import result
+// @Tags        Imports
+// @Produce     text/csv
+// @Param       id  path     integer           true "Import ID"
+// @Success     200 {file}   file              "Result file"
+// @Failure     400 {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /imports/{id}/result.csv [get]
+// @Router      /v2/imports/{id}/result.csv [get]
+func (h *Handler) GetImportResult(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	imp, err := h.db(c).GetImport(payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	rows, err := h.db(c).GetImportRows(imp.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	var buf bytes.Buffer
+	if err = imports.WriteResult(&buf, rows, imp.Currency); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="import-%d-result.csv"`, imp.ID))
+	return c.Send(buf.Bytes())
+}
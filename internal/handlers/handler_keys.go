@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"balance/internal/auth"
+	"balance/internal/models"
+
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultGracePeriod is time the old key keeps working after rotation if grace period is not given
+const DefaultGracePeriod = 24 * time.Hour
+
+// CreateAPIKey creates API key with role
+// @Description Create API key with name, role and optional services. Role is one of read-only (reads), billing-client (reads, credits, reserves, purchases, releases, orders and batches), finance (reads, credits, imports, reports, periods, rates and reconciliation) and admin (everything including users, services, webhooks and keys). Key restricted to services operates on reserves, purchases and orders of these services only. Key is returned only in this response, only its hash is stored
+// @Summary     Create API key
+// @Tags        Keys
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadCreateAPIKey true "In JSON with name, role and optional services"
+// @Success     200    {object} models.PayloadAPIKey       "Created key"
+// @Failure     400    {object} models.PayloadErr          "Error"
+// @Security    ApiKey
+// @Router      /keys [post]
+// @Router      /v2/keys [post]
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	payload := models.PayloadCreateAPIKey{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.Name == "" || len(payload.Name) > 64 {
+		return returnBadRequest(errors.New("handler: create api key: name must be given and not longer than 64 characters"), c)
+	}
+	if !auth.CheckRole(payload.Role) {
+		return returnBadRequest(fmt.Errorf("handler: create api key: role must be one of %v", models.Roles), c)
+	}
+	for _, id := range payload.Services {
+		if id == 0 {
+			return returnBadRequest(errors.New("handler: create api key: wrong service id 0"), c)
+		}
+	}
+
+	key, prefix, hash, err := auth.NewKey()
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	apiKey, err := h.db(c).CreateAPIKey(models.APIKey{
+		Name:     payload.Name,
+		Prefix:   prefix,
+		Hash:     hash,
+		Role:     payload.Role,
+		Services: payload.Services,
+	})
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := apiKeyToPayload(apiKey)
+	outPayload.Key = key
+	return c.JSON(outPayload)
+}
+
+// GetAPIKeys returns all API keys
+// @Description Get all API keys with their roles, services and state, keys themselves are not returned
+// @Summary     List API keys
+// @Tags        Keys
+// @Accept      json
+// @Produce     json
+// @Success     200 {array}  models.PayloadAPIKey "Keys"
+// @Failure     400 {object} models.PayloadErr    "Error"
+// @Security    ApiKey
+// @Router      /keys [get]
+// @Router      /v2/keys [get]
+func (h *Handler) GetAPIKeys(c *fiber.Ctx) error {
+	keys, err := h.db(c).GetAPIKeys()
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := make([]models.PayloadAPIKey, 0, len(keys))
+	for _, k := range keys {
+		outPayload = append(outPayload, apiKeyToPayload(k))
+	}
+	return c.JSON(outPayload)
+}
+
+// RotateAPIKey replaces API key with a new one
+// @Description Replace active API key by given id with a new key of the same name, role and services. The old key keeps working for grace period (duration like 1h, 24h by default, 0s ends it at once), so clients could switch to the new key. New key is returned only in this response
+// @Summary     Rotate API key
+// @Tags        Keys
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer                    true "Key ID"
+// @Param       inJSON body     models.PayloadRotateAPIKey true "In JSON with optional grace period"
+// @Success     200    {object} models.PayloadAPIKey       "New key"
+// @Failure     400    {object} models.PayloadErr          "Error"
+// @Security    ApiKey
+// @Router      /keys/{id}/rotate [post]
+// @Router      /v2/keys/{id}/rotate [post]
+func (h *Handler) RotateAPIKey(c *fiber.Ctx) error {
+	payload := models.PayloadRotateAPIKey{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&payload); err != nil {
+			return returnBadRequest(err, c)
+		}
+	}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	grace := DefaultGracePeriod
+	if payload.GracePeriod != "" {
+		var err error
+		if grace, err = time.ParseDuration(payload.GracePeriod); err != nil || grace < 0 {
+			return returnBadRequest(errors.New("handler: rotate api key: grace period must be not negative duration like 24h"), c)
+		}
+	}
+
+	key, prefix, hash, err := auth.NewKey()
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	apiKey, err := h.db(c).RotateAPIKey(payload.ID, prefix, hash, grace)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := apiKeyToPayload(apiKey)
+	outPayload.Key = key
+	return c.JSON(outPayload)
+}
+
+// RevokeAPIKey revokes API key
+// @Description Revoke API key by given id at once, requests with revoked key are unauthorized. Rotated key is revoked before end of its grace period
+// @Summary     Revoke API key
+// @Tags        Keys
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer           true "Key ID"
+// @Success     200 {string} status            "OK"
+// @Failure     400 {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /keys/{id} [delete]
+// @Router      /v2/keys/{id} [delete]
+func (h *Handler) RevokeAPIKey(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if err := h.db(c).RevokeAPIKey(payload.ID); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// apiKeyToPayload converts API key without the key itself
+func apiKeyToPayload(key models.APIKey) models.PayloadAPIKey {
+	return models.PayloadAPIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Role:      key.Role,
+		Services:  key.Services,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+		RevokedAt: key.RevokedAt,
+		RotatedTo: key.RotatedTo,
+	}
+}
+
+// CreateSigningSecret creates signing secret of API key
+// @Description Create secret of HMAC-SHA256 signatures for API key by given id. Requests of key with active secret crediting, reserving, purchasing and releasing money must be signed: X-Signature-Timestamp header with unix time in seconds (at most 5 minutes from time of the service), X-Signature-Nonce header with unique string up to 64 characters and X-Signature header with sha256=<hex HMAC-SHA256> of method, path with query, timestamp, nonce and body joined by new lines. Nonce is accepted once. Active secrets of the key keep working for grace period (duration like 1h, 24h by default, 0s ends it at once), so creating secret rotates them. Secret is returned only in this response
+// @Summary     Create signing secret
+// @Tags        Keys
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer                           true "Key ID"
+// @Param       inJSON body     models.PayloadCreateSigningSecret true "In JSON with optional grace period"
+// @Success     200    {object} models.PayloadSigningSecret       "Created secret"
+// @Failure     400    {object} models.PayloadErr                 "Error"
+// @Security    ApiKey
+// @Router      /keys/{id}/secrets [post]
+// @Router      /v2/keys/{id}/secrets [post]
+func (h *Handler) CreateSigningSecret(c *fiber.Ctx) error {
+	payload := models.PayloadCreateSigningSecret{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&payload); err != nil {
+			return returnBadRequest(err, c)
+		}
+	}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	grace := DefaultGracePeriod
+	if payload.GracePeriod != "" {
+		var err error
+		if grace, err = time.ParseDuration(payload.GracePeriod); err != nil || grace < 0 {
+			return returnBadRequest(errors.New("handler: create signing secret: grace period must be not negative duration like 24h"), c)
+		}
+	}
+
+	secret, err := auth.NewSigningSecret()
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	signingSecret, err := h.db(c).CreateSigningSecret(payload.ID, secret, grace)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := signingSecretToPayload(signingSecret)
+	outPayload.Secret = signingSecret.Secret
+	return c.JSON(outPayload)
+}
+
+// GetSigningSecrets returns signing secrets of API key
+// @Description Get all signing secrets of API key by given id with their state, secrets themselves are not returned
+// @Summary     List signing secrets
+// @Tags        Keys
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer                     true "Key ID"
+// @Success     200 {array}  models.PayloadSigningSecret "Secrets"
+// @Failure     400 {object} models.PayloadErr           "Error"
+// @Security    ApiKey
+// @Router      /keys/{id}/secrets [get]
+// @Router      /v2/keys/{id}/secrets [get]
+func (h *Handler) GetSigningSecrets(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	secrets, err := h.db(c).GetSigningSecrets(payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := make([]models.PayloadSigningSecret, 0, len(secrets))
+	for _, s := range secrets {
+		outPayload = append(outPayload, signingSecretToPayload(s))
+	}
+	return c.JSON(outPayload)
+}
+
+// RevokeSigningSecret revokes signing secret of API key
+// @Description Revoke signing secret by given id of API key by given id at once, requests signed by it are unauthorized. Key without active secrets sends requests without signatures
+// @Summary     Revoke signing secret
+// @Tags        Keys
+// @Accept      json
+// @Produce     json
+// @Param       id        path     integer           true "Key ID"
+// @Param       secret_id path     integer           true "Secret ID"
+// @Success     200       {string} status            "OK"
+// @Failure     400       {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /keys/{id}/secrets/{secret_id} [delete]
+// @Router      /v2/keys/{id}/secrets/{secret_id} [delete]
+func (h *Handler) RevokeSigningSecret(c *fiber.Ctx) error {
+	payload := models.PayloadSigningSecretId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if err := h.db(c).RevokeSigningSecret(payload.ID, payload.SecretID); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// signingSecretToPayload converts signing secret without the secret itself
+func signingSecretToPayload(secret models.SigningSecret) models.PayloadSigningSecret {
+	return models.PayloadSigningSecret{
+		ID:        secret.ID,
+		APIKeyID:  secret.APIKeyID,
+		CreatedAt: secret.CreatedAt,
+		ExpiresAt: secret.ExpiresAt,
+		RevokedAt: secret.RevokedAt,
+	}
+}
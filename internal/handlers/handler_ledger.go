@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetUserAccounts returns ledger accounts of user
+// @Description Get wallet and hold ledger accounts of user with balances derived from postings
+// @Summary     Get user ledger accounts
+// @Tags        Users
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer               true "User ID"
+// @Success     200 {array}  models.PayloadAccount "User accounts"
+// @Failure     400 {object} models.PayloadErr     "Error"
+// @Security    ApiKey
+// @Router      /users/{id}/accounts [get]
+// @Router      /v2/users/{id}/accounts [get]
+func (h *Handler) GetUserAccounts(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if err := checkUser(c, payload.ID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	accounts, err := h.db(c).GetUserAccounts(payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := make([]models.PayloadAccount, 0, len(accounts))
+	for _, a := range accounts {
+		outPayload = append(outPayload, models.PayloadAccount{
+			ID:       a.ID,
+			Kind:     a.Kind,
+			Currency: a.Currency,
+			Balance:  utils.MoneyToFloat(a.Balance, a.Currency),
+		})
+	}
+	return c.JSON(outPayload)
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReserveOrder reserves money for order with multiple line items
+// @Description Reserve money for the whole order with multiple line items at once. Catalog price of service is used for item without unit price, otherwise unit price must be within bounds of the service. Currency defaults to currency of services, all services must be priced in the same currency
+// @Summary     Reserve order
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadReserveOrder true "In JSON with user_id, order_id and items"
+// @Success     200    {object} models.PayloadOrder        "Reserved order"
+// @Failure     400    {object} models.PayloadErr          "Error"
+// @Security    ApiKey
+// @Router      /orders [post]
+// @Router      /v2/orders [post]
+func (h *Handler) ReserveOrder(c *fiber.Ctx) error {
+	payload := models.PayloadReserveOrder{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	// if currency is not given, it is taken from services
+	currency := ""
+	amountCurrency := utils.DefaultCurrency
+	if payload.Currency != "" {
+		var err error
+		if currency, err = utils.NormalizeCurrency(payload.Currency); err != nil {
+			return returnBadRequest(err, c)
+		}
+		amountCurrency = currency
+	}
+
+	items := make([]models.OrderItem, 0, len(payload.Items))
+	for _, item := range payload.Items {
+		if err := checkServices(c, item.ServiceID); err != nil {
+			return returnForbidden(err, c)
+		}
+		items = append(items, models.OrderItem{
+			ServiceID: item.ServiceID,
+			Quantity:  item.Quantity,
+			UnitPrice: utils.MoneyToInt(item.UnitPrice, amountCurrency),
+		})
+	}
+
+	order, err := h.db(c).ReserveOrder(payload.UserID, payload.OrderID, currency, items)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(orderToPayload(order))
+}
+
+// GetOrder gets order with its line items
+// @Description Get order with multiple line items by order id and user id
+// @Summary     Get order
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Param       id      path     integer             true "Order ID"
+// @Param       user_id query    integer             true "User ID"
+// @Success     200     {object} models.PayloadOrder "Order"
+// @Failure     400     {object} models.PayloadErr   "Error"
+// @Security    ApiKey
+// @Router      /orders/{id} [get]
+// @Router      /v2/orders/{id} [get]
+func (h *Handler) GetOrder(c *fiber.Ctx) error {
+	payload := models.PayloadOrderQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if err := checkUser(c, payload.UserID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	order, err := h.db(c).GetOrder(payload.UserID, payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err = checkServices(c, orderServices(order)...); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	return c.JSON(orderToPayload(order))
+}
+
+// PurchaseOrder captures all or given line items of order
+// @Description Capture given line items of order, not given items are released and money is returned to user. All items are captured if lines are omitted. Revenue is attributed to every captured line item
+// @Summary     Purchase order
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer                  true "Order ID"
+// @Param       inJSON body     models.PayloadOrderQuery true "In JSON with user_id and optional numbers of captured lines"
+// @Success     200    {object} models.PayloadOrder      "Purchased order"
+// @Failure     400    {object} models.PayloadErr        "Error"
+// @Security    ApiKey
+// @Router      /orders/{id}/purchase [post]
+// @Router      /v2/orders/{id}/purchase [post]
+func (h *Handler) PurchaseOrder(c *fiber.Ctx) error {
+	payload := models.PayloadOrderQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if err := h.checkOrder(c, payload.UserID, payload.ID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	order, err := h.db(c).PurchaseOrder(payload.UserID, payload.ID, payload.Lines)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(orderToPayload(order))
+}
+
+// ReleaseOrder removes reserve of order
+// @Description Remove reserve of order with multiple line items and return money to user
+// @Summary     Release order
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer                  true "Order ID"
+// @Param       inJSON body     models.PayloadOrderQuery true "In JSON with user_id"
+// @Success     200    {string} status                   "OK"
+// @Failure     400    {object} models.PayloadErr        "Error"
+// @Security    ApiKey
+// @Router      /orders/{id} [delete]
+func (h *Handler) ReleaseOrder(c *fiber.Ctx) error {
+	payload := models.PayloadOrderQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.releaseOrder(c, payload)
+}
+
+// releaseOrder releases order by parsed payload
+func (h *Handler) releaseOrder(c *fiber.Ctx, payload models.PayloadOrderQuery) error {
+	if err := h.checkOrder(c, payload.UserID, payload.ID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	err := h.db(c).ReleaseOrder(payload.UserID, payload.ID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// checkOrder checks that API key of request operates on every service of order,
+// order which is not found is left to the operation to fail
+func (h *Handler) checkOrder(c *fiber.Ctx, userId, orderId uint64) error {
+	if len(principal(c).Services) == 0 {
+		return nil
+	}
+	order, err := h.db(c).GetOrder(userId, orderId)
+	if err != nil {
+		return nil
+	}
+	return checkServices(c, orderServices(order)...)
+}
+
+// orderServices returns services of line items of order
+func orderServices(order models.Order) []uint64 {
+	services := make([]uint64, 0, len(order.Items))
+	for _, item := range order.Items {
+		services = append(services, item.ServiceID)
+	}
+	return services
+}
+
+// orderToPayload converts order amounts from minor units of currency
+func orderToPayload(order models.Order) models.PayloadOrder {
+	outPayload := models.PayloadOrder{
+		OrderID:     order.OrderID,
+		UserID:      order.UserID,
+		Amount:      utils.MoneyToFloat(order.Amount, order.Currency),
+		Currency:    order.Currency,
+		Purchased:   order.Purchased,
+		ReservedAt:  order.ReservedAt,
+		PurchasedAt: order.PurchasedAt,
+		ExpiresAt:   order.ExpiresAt,
+		Status:      order.Status,
+		ReleasedAt:  order.ReleasedAt,
+		Items:       make([]models.PayloadOrderLine, 0, len(order.Items)),
+	}
+	for _, item := range order.Items {
+		outPayload.Items = append(outPayload.Items, models.PayloadOrderLine{
+			LineNo:       item.LineNo,
+			ServiceID:    item.ServiceID,
+			ServiceName:  item.ServiceName,
+			Quantity:     item.Quantity,
+			UnitPrice:    utils.MoneyToFloat(item.UnitPrice, order.Currency),
+			Amount:       utils.MoneyToFloat(item.Amount, order.Currency),
+			PriceVersion: item.PriceVersion,
+			Captured:     item.Captured,
+		})
+	}
+	return outPayload
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"balance/internal/models"
+
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClosePeriod closes accounting period by given year and month
+// @Description Close accounting period by given year and month. Operations dated in closed period are rejected, closing report is frozen as a new version
+// @Summary     Close accounting period
+// @Tags        Periods
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadDate   true "In JSON with year and month"
+// @Success     200    {object} models.PayloadReport "Closing report version"
+// @Failure     400    {object} models.PayloadErr    "Error"
+// @Security    ApiKey
+// @Router      /periods/close [post]
+// @Router      /v2/periods/close [post]
+func (h *Handler) ClosePeriod(c *fiber.Ctx) error {
+	payload := models.PayloadDate{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.Month < 1 || payload.Month > 12 {
+		return returnBadRequest(errors.New("handler: close period: wrong month input"), c)
+	}
+
+	report, err := h.db(c).ClosePeriod(payload.Year, payload.Month)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(reportToPayload(report, c))
+}
+
+// GetClosedPeriods returns all closed accounting periods
+// @Description Get all closed accounting periods
+// @Summary     Get closed periods
+// @Tags        Periods
+// @Accept      json
+// @Produce     json
+// @Success     200 {array}  models.Period     "Closed periods"
+// @Failure     400 {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /periods [get]
+// @Router      /v2/periods [get]
+func (h *Handler) GetClosedPeriods(c *fiber.Ctx) error {
+	periods, err := h.db(c).GetClosedPeriods()
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	if periods == nil {
+		periods = []models.Period{}
+	}
+
+	return c.JSON(periods)
+}
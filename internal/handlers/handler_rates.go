@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AddExchangeRates uploads exchange rates with validity periods
+// @Description Upload exchange rates as JSON array or as CSV file (Content-Type: text/csv) with columns base,quote,rate,spread,valid_from,valid_to. Spread and valid_to could be empty, time is given as YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339
+// @Summary     Upload exchange rates
+// @Tags        Exchange rates
+// @Accept      json,text/csv
+// @Produce     json
+// @Param       inJSON body     []models.PayloadExchangeRate true "Array of exchange rates"
+// @Success     200    {object} models.PayloadErr            "Success"
+// @Failure     400    {object} models.PayloadErr            "Error"
+// @Security    ApiKey
+// @Router      /rates [post]
+// @Router      /v2/rates [post]
+func (h *Handler) AddExchangeRates(c *fiber.Ctx) error {
+	var rates []models.ExchangeRate
+	var err error
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), "text/csv") {
+		rates, err = exchangeRatesFromCSV(c.Body())
+		if err != nil {
+			return returnBadRequest(err, c)
+		}
+	} else {
+		var payload []models.PayloadExchangeRate
+		if err = c.BodyParser(&payload); err != nil {
+			return returnBadRequest(err, c)
+		}
+		for _, r := range payload {
+			rates = append(rates, models.ExchangeRate{
+				Base:      r.Base,
+				Quote:     r.Quote,
+				Rate:      r.Rate.String(),
+				Spread:    r.Spread.String(),
+				ValidFrom: r.ValidFrom,
+				ValidTo:   r.ValidTo,
+			})
+		}
+	}
+	if len(rates) == 0 {
+		return returnBadRequest(errors.New("handler: add exchange rates: no rates given"), c)
+	}
+	for i := range rates {
+		if err = validateExchangeRate(&rates[i]); err != nil {
+			return returnBadRequest(fmt.Errorf("handler: add exchange rates: rate %d: %v", i+1, err), c)
+		}
+	}
+
+	err = h.db(c).AddExchangeRates(rates)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "success",
+	})
+}
+
+// GetExchangeRate returns exchange rate valid at given time
+// @Description Get exchange rate from base to quote currency valid at given time. Inverse rate is used if there is no direct one
+// @Summary     Get exchange rate
+// @Tags        Exchange rates
+// @Accept      json
+// @Produce     json
+// @Param       base  query    string              true  "Base currency"
+// @Param       quote query    string              true  "Quote currency"
+// @Param       at    query    string              false "Time, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339, now by default"
+// @Success     200   {object} models.ExchangeRate "Exchange rate"
+// @Failure     400   {object} models.PayloadErr   "Error"
+// @Security    ApiKey
+// @Router      /rates [get]
+// @Router      /v2/rates [get]
+func (h *Handler) GetExchangeRate(c *fiber.Ctx) error {
+	payload := models.PayloadRateQuery{}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.Base == "" || payload.Quote == "" {
+		return returnBadRequest(errors.New("handler: get exchange rate: base and quote currencies must be given"), c)
+	}
+	base, err := utils.NormalizeCurrency(payload.Base)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	quote, err := utils.NormalizeCurrency(payload.Quote)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	at := time.Now().In(loc)
+	if payload.At != "" {
+		if at, err = parseRateTime(payload.At); err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get exchange rate: wrong at input: %v", err), c)
+		}
+	}
+
+	rate, err := h.db(c).GetExchangeRate(base, quote, at)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(rate)
+}
+
+// Convert converts money of user from one currency to another
+// @Description Convert money of user from one currency to another by the current exchange rate. Amount is debited from wallet of from currency, amount * rate * (1 - spread) is credited to wallet of to currency
+// @Summary     Convert money
+// @Tags        Exchange rates
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadConvert    true "In JSON with user_id, from, to and amount in from currency"
+// @Success     200    {object} models.PayloadConversion "Conversion"
+// @Failure     400    {object} models.PayloadErr        "Error"
+// @Security    ApiKey
+// @Router      /convert [post]
+// @Router      /v2/convert [post]
+func (h *Handler) Convert(c *fiber.Ctx) error {
+	payload := models.PayloadConvert{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.From == "" || payload.To == "" {
+		return returnBadRequest(errors.New("handler: convert: from and to currencies must be given"), c)
+	}
+	from, err := utils.NormalizeCurrency(payload.From)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	to, err := utils.NormalizeCurrency(payload.To)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	conversion, err := h.db(c).Convert(payload.UserID, from, to, utils.MoneyToInt(payload.Amount, from))
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(models.PayloadConversion{
+		UserID:    conversion.UserID,
+		From:      conversion.From,
+		To:        conversion.To,
+		Amount:    utils.MoneyToFloat(conversion.Amount, conversion.From),
+		Converted: utils.MoneyToFloat(conversion.Converted, conversion.To),
+		Rate:      conversion.Rate,
+		Spread:    conversion.Spread,
+		DoneAt:    conversion.DoneAt,
+	})
+}
+
+// GetRestatedReport returns the latest version of report restated in base currency
+// @Description Get the latest version of report by given year and month with revenue restated in given currency by exchange rates valid at the end of the month
+// @Summary     Get restated report
+// @Tags        Reports
+// @Accept      json
+// @Produce     json
+// @Param       year     path     integer                      true  "Year"
+// @Param       month    path     integer                      true  "Month"
+// @Param       currency query    string                       false "Base currency, RUB by default"
+// @Success     200      {object} models.PayloadRestatedReport "Restated report"
+// @Failure     400      {object} models.PayloadErr            "Error"
+// @Security    ApiKey
+// @Router      /report/{year}/{month}/restated [get]
+// @Router      /v2/report/{year}/{month}/restated [get]
+func (h *Handler) GetRestatedReport(c *fiber.Ctx) error {
+	payload := models.PayloadRestatedQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.Month < 1 || payload.Month > 12 {
+		return returnBadRequest(errors.New("handler: get restated report: wrong month input"), c)
+	}
+	currency, err := utils.NormalizeCurrency(payload.Currency)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	report, err := h.db(c).GetRestatedReport(payload.Year, payload.Month, currency)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := models.PayloadRestatedReport{
+		Year:     report.Year,
+		Month:    report.Month,
+		Version:  report.Version,
+		Currency: report.Currency,
+		RatesAt:  report.RatesAt,
+		Lines:    make([]models.PayloadRestatedReportLine, 0, len(report.Lines)),
+		Total:    utils.MoneyToFloat(report.Total, report.Currency),
+	}
+	for _, l := range report.Lines {
+		outPayload.Lines = append(outPayload.Lines, models.PayloadRestatedReportLine{
+			ServiceName: l.ServiceName,
+			Currency:    l.Currency,
+			Amount:      utils.MoneyToFloat(l.Amount, l.Currency),
+			Rate:        l.Rate,
+			Converted:   utils.MoneyToFloat(l.Converted, report.Currency),
+		})
+	}
+	return c.JSON(outPayload)
+}
+
+// exchangeRatesFromCSV parses exchange rates from csv file with header
+func exchangeRatesFromCSV(file []byte) ([]models.ExchangeRate, error) {
+	r := csv.NewReader(bytes.NewReader(file))
+	r.FieldsPerRecord = 6
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("handler: add exchange rates: wrong csv file: %v", err)
+	}
+	if strings.Join(header, ",") != "base,quote,rate,spread,valid_from,valid_to" {
+		return nil, errors.New("handler: add exchange rates: csv header must be base,quote,rate,spread,valid_from,valid_to")
+	}
+
+	var rates []models.ExchangeRate
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("handler: add exchange rates: wrong csv file: %v", err)
+		}
+
+		rate := models.ExchangeRate{
+			Base:   record[0],
+			Quote:  record[1],
+			Rate:   record[2],
+			Spread: record[3],
+		}
+		if rate.ValidFrom, err = parseRateTime(record[4]); err != nil {
+			return nil, fmt.Errorf("handler: add exchange rates: line %d: wrong valid_from: %v", line, err)
+		}
+		if record[5] != "" {
+			var validTo time.Time
+			if validTo, err = parseRateTime(record[5]); err != nil {
+				return nil, fmt.Errorf("handler: add exchange rates: line %d: wrong valid_to: %v", line, err)
+			}
+			rate.ValidTo = &validTo
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// validateExchangeRate checks currencies, rate, spread and validity period of exchange rate and normalizes them
+func validateExchangeRate(rate *models.ExchangeRate) error {
+	if rate.Base == "" || rate.Quote == "" {
+		return errors.New("base and quote currencies must be given")
+	}
+	var err error
+	if rate.Base, err = utils.NormalizeCurrency(rate.Base); err != nil {
+		return err
+	}
+	if rate.Quote, err = utils.NormalizeCurrency(rate.Quote); err != nil {
+		return err
+	}
+	if rate.Base == rate.Quote {
+		return errors.New("base and quote currencies must differ")
+	}
+
+	value, err := utils.ParseDecimal(rate.Rate)
+	if err != nil {
+		return err
+	} else if value.Sign() <= 0 {
+		return errors.New("rate must be positive")
+	}
+	rate.Rate = utils.FormatDecimal(value)
+
+	if rate.Spread == "" {
+		rate.Spread = "0"
+	}
+	spread, err := utils.ParseDecimal(rate.Spread)
+	if err != nil {
+		return err
+	} else if spread.Sign() < 0 || spread.Cmp(big.NewRat(1, 1)) >= 0 {
+		return errors.New("spread must be in [0, 1) range")
+	}
+	rate.Spread = utils.FormatDecimal(spread)
+
+	if rate.ValidFrom.IsZero() {
+		return errors.New("valid_from must be given")
+	}
+	if rate.ValidTo != nil && !rate.ValidTo.After(rate.ValidFrom) {
+		return errors.New("valid_to must be after valid_from")
+	}
+	return nil
+}
+
+// parseRateTime parses time of exchange rate in Moscow time zone
+func parseRateTime(value string) (time.Time, error) {
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(loc), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, loc); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
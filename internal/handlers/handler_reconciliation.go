@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Reconcile recomputes wallet balances from operations and returns mismatches
+// @Description Recompute every wallet balance from operations and open reserves and get wallets whose stored balance differs
+// @Summary     Reconcile balances
+// @Tags        Reconciliation
+// @Accept      json
+// @Produce     json
+// @Success     200 {object} models.PayloadReconciliation "Reconciliation results"
+// @Failure     400 {object} models.PayloadErr            "Error"
+// @Security    ApiKey
+// @Router      /reconciliation [get]
+// @Router      /v2/reconciliation [get]
+func (h *Handler) Reconcile(c *fiber.Ctx) error {
+	reconciliation, err := h.db(c).Reconcile()
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := models.PayloadReconciliation{
+		CheckedAt:  reconciliation.CheckedAt,
+		Wallets:    reconciliation.Wallets,
+		Mismatches: make([]models.PayloadBalanceMismatch, 0, len(reconciliation.Mismatches)),
+	}
+	for _, m := range reconciliation.Mismatches {
+		outPayload.Mismatches = append(outPayload.Mismatches, models.PayloadBalanceMismatch{
+			UserID:           m.UserID,
+			Currency:         m.Currency,
+			Balance:          utils.MoneyToFloat(m.Balance, m.Currency),
+			Journal:          utils.MoneyToFloat(m.Journal, m.Currency),
+			Held:             utils.MoneyToFloat(m.Held, m.Currency),
+			Difference:       utils.MoneyToFloat(m.Difference, m.Currency),
+			Wallet:           utils.MoneyToFloat(m.Wallet, m.Currency),
+			WalletDifference: utils.MoneyToFloat(m.WalletDifference, m.Currency),
+		})
+	}
+	return c.JSON(outPayload)
+}
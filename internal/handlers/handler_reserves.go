@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetReserves returns page of reserves
+// @Description Get page of reserves ordered by reserve time descending with filters by user, service, status and reserve time range. Order with multiple line items is found by any of its services. Page is continued by next_cursor of previous page
+// @Summary     List reserves
+// @Tags        Reserves
+// @Accept      json
+// @Produce     json
+// @Param       user_id    query    integer                false "Filter by User ID"
+// @Param       service_id query    integer                false "Filter by Service ID"
+// @Param       status     query    string                 false "Filter by status: open, purchased, released or expired"
+// @Param       from       query    string                 false "Reserved at or after, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339"
+// @Param       to         query    string                 false "Reserved before, YYYY-MM-DD, YYYY-MM-DD HH:MM:SS or RFC 3339"
+// @Param       cursor     query    string                 false "Cursor of the next page"
+// @Param       limit      query    integer                false "Page size, 20 by default, 100 at most"
+// @Success     200        {object} models.PayloadReserves "Page of reserves"
+// @Failure     400        {object} models.PayloadErr      "Error"
+// @Security    ApiKey
+// @Router      /reserves [get]
+// @Router      /v2/reserves [get]
+func (h *Handler) GetReserves(c *fiber.Ctx) error {
+	payload := models.PayloadReservesQuery{}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	// caller restricted to services lists reserves of one of its services, end-user token lists reserves of its user
+	if err := checkUser(c, payload.UserID); err != nil {
+		return returnForbidden(err, c)
+	}
+	if err := checkServices(c, payload.ServiceID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	filter := models.ReservesFilter{
+		UserID:    payload.UserID,
+		ServiceID: payload.ServiceID,
+		Status:    payload.Status,
+		Limit:     payload.Limit,
+	}
+	switch filter.Status {
+	case "", models.ReserveOpen, models.ReservePurchased, models.ReserveReleased, models.ReserveExpired:
+	default:
+		return returnBadRequest(fmt.Errorf("handler: get reserves: unknown status %s", filter.Status), c)
+	}
+	if payload.From != "" {
+		from, err := parseRateTime(payload.From)
+		if err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get reserves: wrong from input: %v", err), c)
+		}
+		filter.From = &from
+	}
+	if payload.To != "" {
+		to, err := parseRateTime(payload.To)
+		if err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get reserves: wrong to input: %v", err), c)
+		}
+		filter.To = &to
+	}
+	if payload.Cursor != "" {
+		cursor, err := decodeReserveCursor(payload.Cursor)
+		if err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get reserves: wrong cursor input: %v", err), c)
+		}
+		filter.After = &cursor
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 20
+	}
+	if filter.Limit < 0 || filter.Limit > 100 {
+		return returnBadRequest(errors.New("handler: get reserves: limit must be in [1, 100] range"), c)
+	}
+
+	reserves, next, err := h.db(c).GetReserves(filter)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := models.PayloadReserves{
+		Reserves: make([]models.ReserveFloatAmount, 0, len(reserves)),
+	}
+	for _, reserve := range reserves {
+		outPayload.Reserves = append(outPayload.Reserves, reserveToPayload(reserve))
+	}
+	if next != nil {
+		outPayload.NextCursor = encodeReserveCursor(*next)
+	}
+	return c.JSON(outPayload)
+}
+
+// GetOutstandingReserves returns open reserves aging report
+// @Description Get open reserves grouped by service, currency and age (<1h, 1-24h, 1-7d, >7d), totals per user and currency, totals per currency and reserves which expiry mechanism failed to release
+// @Summary     Get outstanding reserves
+// @Tags        Reserves
+// @Accept      json
+// @Produce     json
+// @Param       user_id    query    integer                     false "Filter by User ID"
+// @Param       service_id query    integer                     false "Filter by Service ID"
+// @Success     200        {object} models.PayloadReservesAging "Outstanding reserves"
+// @Failure     400        {object} models.PayloadErr           "Error"
+// @Security    ApiKey
+// @Router      /reserves/outstanding [get]
+// @Router      /v2/reserves/outstanding [get]
+func (h *Handler) GetOutstandingReserves(c *fiber.Ctx) error {
+	payload := models.PayloadReservesFilter{}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if err := checkServices(c, payload.ServiceID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	aging, err := h.db(c).GetOutstandingReserves(payload.UserID, payload.ServiceID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := models.PayloadReservesAging{
+		Buckets: make([]models.PayloadReserveAgingBucket, 0, len(aging.Buckets)),
+		Users:   make([]models.PayloadReserveUserTotal, 0, len(aging.Users)),
+		Stuck:   make([]models.PayloadOpenReserve, 0, len(aging.Stuck)),
+		Totals:  make([]models.PayloadReserveCurrencyTotal, 0, len(aging.Totals)),
+	}
+	for _, b := range aging.Buckets {
+		outPayload.Buckets = append(outPayload.Buckets, models.PayloadReserveAgingBucket{
+			ServiceID:   b.ServiceID,
+			ServiceName: b.ServiceName,
+			Currency:    b.Currency,
+			Age:         b.Age,
+			Count:       b.Count,
+			Amount:      utils.MoneyToFloat(b.Amount, b.Currency),
+		})
+	}
+	for _, u := range aging.Users {
+		outPayload.Users = append(outPayload.Users, models.PayloadReserveUserTotal{
+			UserID:   u.UserID,
+			Currency: u.Currency,
+			Count:    u.Count,
+			Amount:   utils.MoneyToFloat(u.Amount, u.Currency),
+		})
+	}
+	for _, r := range aging.Stuck {
+		outPayload.Stuck = append(outPayload.Stuck, models.PayloadOpenReserve{
+			OrderID:    r.OrderID,
+			UserID:     r.UserID,
+			ServiceID:  r.ServiceID,
+			Amount:     utils.MoneyToFloat(r.Amount, r.Currency),
+			Currency:   r.Currency,
+			ReservedAt: r.ReservedAt,
+		})
+	}
+	for _, t := range aging.Totals {
+		outPayload.Totals = append(outPayload.Totals, models.PayloadReserveCurrencyTotal{
+			Currency: t.Currency,
+			Count:    t.Count,
+			Amount:   utils.MoneyToFloat(t.Amount, t.Currency),
+		})
+	}
+	return c.JSON(outPayload)
+}
+
+// reserveCursorLayout is layout of reserve time in cursor, reserve time is stored without time zone
+const reserveCursorLayout = "2006-01-02T15:04:05.999999"
+
+// encodeReserveCursor encodes reserve time and order id of the last reserve of page into opaque string
+func encodeReserveCursor(cursor models.ReserveCursor) string {
+	value := cursor.ReservedAt.Format(reserveCursorLayout) + "," + strconv.FormatUint(cursor.OrderID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// decodeReserveCursor decodes cursor encoded by encodeReserveCursor
+func decodeReserveCursor(value string) (models.ReserveCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return models.ReserveCursor{}, err
+	}
+	parts := strings.Split(string(decoded), ",")
+	if len(parts) != 2 {
+		return models.ReserveCursor{}, errors.New("malformed cursor")
+	}
+	reservedAt, err := time.Parse(reserveCursorLayout, parts[0])
+	if err != nil {
+		return models.ReserveCursor{}, err
+	}
+	orderId, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return models.ReserveCursor{}, err
+	}
+	return models.ReserveCursor{ReservedAt: reservedAt, OrderID: orderId}, nil
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetStatement returns account statement of user for given date range
+// @Description Get account statement of user for given date range with opening balance, operations with running balance, held and closing balance
+// @Summary     Get user statement
+// @Tags        Users
+// @Accept      json
+// @Produce     json,text/csv,application/pdf
+// @Param       id       path     integer                 true  "User ID"
+// @Param       currency query    string                  false "Currency of statement, RUB by default"
+// @Param       from     query    string                  false "First day of range, YYYY-MM-DD, first day of current month by default"
+// @Param       to       query    string                  false "Last day of range, YYYY-MM-DD, today by default"
+// @Param       format   query    string                  false "Statement format: json (default), csv or pdf"
+// @Success     200      {object} models.PayloadStatement "User statement"
+// @Failure     400      {object} models.PayloadErr       "Error"
+// @Security    ApiKey
+// @Router      /users/{id}/statement [get]
+// @Router      /v2/users/{id}/statement [get]
+func (h *Handler) GetStatement(c *fiber.Ctx) error {
+	payload := models.PayloadStatementQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	// parse date range, the last day is included into the range
+	if err := checkUser(c, payload.ID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	var err error
+	if payload.From != "" {
+		if from, err = time.ParseInLocation("2006-01-02", payload.From, loc); err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get statement: wrong from input: %v", err), c)
+		}
+	}
+	if payload.To != "" {
+		if to, err = time.ParseInLocation("2006-01-02", payload.To, loc); err != nil {
+			return returnBadRequest(fmt.Errorf("handler: get statement: wrong to input: %v", err), c)
+		}
+	}
+	to = to.AddDate(0, 0, 1)
+	if !from.Before(to) {
+		return returnBadRequest(errors.New("handler: get statement: from must not be after to"), c)
+	}
+
+	currency, err := utils.NormalizeCurrency(payload.Currency)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	statement, err := h.db(c).GetStatement(payload.ID, currency, from, to)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	switch payload.Format {
+	case "", "json":
+		return c.JSON(statementToPayload(statement))
+	case "csv":
+		file, err := statementToCSV(statement)
+		if err != nil {
+			return returnBadRequest(err, c)
+		}
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"statement_%d.csv\"", statement.UserID))
+		return c.Send(file)
+	case "pdf":
+		file, err := utils.TextPDF(statementToText(statement))
+		if err != nil {
+			return returnBadRequest(err, c)
+		}
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"statement_%d.pdf\"", statement.UserID))
+		return c.Send(file)
+	default:
+		return returnBadRequest(fmt.Errorf("handler: get statement: unknown format %q", payload.Format), c)
+	}
+}
+
+// statementToPayload converts statement amounts from minor units of currency
+func statementToPayload(statement models.Statement) models.PayloadStatement {
+	outPayload := models.PayloadStatement{
+		UserID:         statement.UserID,
+		Currency:       statement.Currency,
+		From:           statement.From,
+		To:             statement.To,
+		OpeningBalance: utils.MoneyToFloat(statement.OpeningBalance, statement.Currency),
+		Lines:          make([]models.PayloadStatementLine, 0, len(statement.Lines)),
+		ClosingBalance: utils.MoneyToFloat(statement.ClosingBalance, statement.Currency),
+		Held:           utils.MoneyToFloat(statement.Held, statement.Currency),
+		Available:      utils.MoneyToFloat(statement.Available, statement.Currency),
+		Balance:        utils.MoneyToFloat(statement.Balance, statement.Currency),
+		Reconciled:     statement.Reconciled,
+	}
+	for _, l := range statement.Lines {
+		outPayload.Lines = append(outPayload.Lines, models.PayloadStatementLine{
+			ID:             l.ID,
+			ServiceID:      l.ServiceID,
+			ServiceName:    l.ServiceName,
+			Amount:         utils.MoneyToFloat(l.Amount, statement.Currency),
+			RunningBalance: utils.MoneyToFloat(l.RunningBalance, statement.Currency),
+			DoneAt:         l.DoneAt,
+			Kind:           l.Kind,
+			Rate:           l.Rate,
+			Spread:         l.Spread,
+		})
+	}
+	return outPayload
+}
+
+// statementToCSV converts statement to csv table with summary rows around operations
+func statementToCSV(statement models.Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	rows := [][]string{
+		{"operation_id", "done_at", "description", "amount", "running_balance"},
+		{"", statement.From.Format("2006-01-02"), "opening balance", "", utils.FormatMoney(statement.OpeningBalance, statement.Currency)},
+	}
+	for _, l := range statement.Lines {
+		rows = append(rows, []string{
+			strconv.FormatUint(l.ID, 10),
+			l.DoneAt.Format("2006-01-02 15:04:05"),
+			operationDescription(l.Operation),
+			utils.FormatMoney(l.Amount, statement.Currency),
+			utils.FormatMoney(l.RunningBalance, statement.Currency),
+		})
+	}
+	lastDay := statement.To.AddDate(0, 0, -1).Format("2006-01-02")
+	rows = append(rows,
+		[]string{"", lastDay, "closing balance", "", utils.FormatMoney(statement.ClosingBalance, statement.Currency)},
+		[]string{"", lastDay, "held", "", utils.FormatMoney(statement.Held, statement.Currency)},
+		[]string{"", lastDay, "available", "", utils.FormatMoney(statement.Available, statement.Currency)},
+	)
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// statementToText converts statement to text lines for pdf document
+func statementToText(statement models.Statement) []string {
+	lastDay := statement.To.AddDate(0, 0, -1).Format("2006-01-02")
+	lines := []string{
+		fmt.Sprintf("Account statement of user %d, %s", statement.UserID, statement.Currency),
+		fmt.Sprintf("Period: %s - %s", statement.From.Format("2006-01-02"), lastDay),
+		"",
+		fmt.Sprintf("%-20s %-30s %14s %14s", "Date", "Operation", "Amount", "Balance"),
+		fmt.Sprintf("%-20s %-30s %14s %14s", statement.From.Format("2006-01-02"), "Opening balance", "", utils.FormatMoney(statement.OpeningBalance, statement.Currency)),
+	}
+	for _, l := range statement.Lines {
+		description := operationDescription(l.Operation)
+		if runes := []rune(description); len(runes) > 30 {
+			description = string(runes[:27]) + "..."
+		}
+		lines = append(lines, fmt.Sprintf("%-20s %-30s %14s %14s",
+			l.DoneAt.Format("2006-01-02 15:04:05"), description, utils.FormatMoney(l.Amount, statement.Currency), utils.FormatMoney(l.RunningBalance, statement.Currency)))
+	}
+	lines = append(lines,
+		fmt.Sprintf("%-20s %-30s %14s %14s", lastDay, "Closing balance", "", utils.FormatMoney(statement.ClosingBalance, statement.Currency)),
+		"",
+		fmt.Sprintf("Held in reserves: %s", utils.FormatMoney(statement.Held, statement.Currency)),
+		fmt.Sprintf("Available:        %s", utils.FormatMoney(statement.Available, statement.Currency)),
+	)
+	return lines
+}
+
+// operationDescription returns human-readable operation description
+func operationDescription(operation models.Operation) string {
+	switch {
+	case operation.ServiceName != nil:
+		return "Purchase: " + *operation.ServiceName
+	case operation.Kind == models.OperationCorrection:
+		return "Correction"
+	case operation.Kind == models.OperationConversion && operation.Rate != nil:
+		return "Conversion at " + *operation.Rate
+	default:
+		return "Top-up"
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// streamBatch is number of events read from database at once
+	streamBatch = 100
+	// streamKeepAlive is interval of comments sent to idle stream, they keep proxies from closing it and detect gone clients
+	streamKeepAlive = 15 * time.Second
+	// streamRetry is delay of reconnection of client in milliseconds
+	streamRetry = 3000
+)
+
+// StreamBalance streams changes of balances and reserves of user by Server-Sent Events
+// @Description Stream changes of balances and reserve statuses of user by given id as Server-Sent Events. Stream starts with "balance" event with current balances of user, then "movement" event is sent for every money movement with changes of available and held money and status of its reserve. Reconnected client continues from the last received event by Last-Event-ID header or last_event_id query parameter, the "balance" event is not sent then. Changes made through any instance of service are streamed
+// @Summary     Stream balance changes
+// @Tags        Balance
+// @Produce     text/event-stream
+// @Param       id            path     integer                      true  "User ID"
+// @Param       Last-Event-ID header   integer                      false "ID of the last received event"
+// @Param       last_event_id query    integer                      false "ID of the last received event, used if header is not set"
+// @Success     200           {object} models.PayloadStreamMovement "Stream of events"
+// @Failure     400           {object} models.PayloadErr            "Error"
+// @Security    ApiKey
+// @Router      /users/{id}/events [get]
+// @Router      /v2/users/{id}/events [get]
+func (h *Handler) StreamBalance(c *fiber.Ctx) error {
+	payload := models.PayloadStreamQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := checkUser(c, payload.ID); err != nil {
+		return returnForbidden(err, c)
+	}
+
+	if header := c.Get("Last-Event-ID"); header != "" {
+		lastEventId, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			return returnBadRequest(fmt.Errorf("handler: stream balance: wrong Last-Event-ID %q", header), c)
+		}
+		payload.LastEventID = &lastEventId
+	}
+
+	// subscribe before reading of events, so events committed meanwhile wake the stream
+	wake, unsubscribe := h.Hub.Subscribe(payload.ID)
+
+	var start []byte
+	var lastEventId uint64
+	if payload.LastEventID != nil {
+		lastEventId = *payload.LastEventID
+	} else {
+		balances, eventId, err := h.DB.GetStreamStart(payload.ID)
+		if err != nil {
+			unsubscribe()
+			return returnBadRequest(err, c)
+		}
+		data := models.PayloadStreamBalances{Balances: make([]models.PayloadWallet, 0, len(balances))}
+		for _, b := range balances {
+			data.Balances = append(data.Balances, models.PayloadWallet{
+				Currency: b.Currency,
+				Balance:  utils.MoneyToFloat(b.Available, b.Currency),
+				Held:     utils.MoneyToFloat(b.Held, b.Currency),
+				Total:    utils.MoneyToFloat(b.Total, b.Currency),
+			})
+		}
+		if start, err = encodeEvent(eventId, "balance", data); err != nil {
+			unsubscribe()
+			return returnBadRequest(err, c)
+		}
+		lastEventId = eventId
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	userId := payload.ID
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+		_, _ = w.Write(start)
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			// send all events after the last sent one
+			for {
+				events, err := h.DB.GetUserEvents(userId, lastEventId, streamBatch)
+				if err != nil {
+					// client reconnects and continues from the last sent event
+					fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+					_ = w.Flush()
+					return
+				}
+				for _, e := range events {
+					data, err := encodeEvent(e.ID, "movement", userEventToPayload(e))
+					if err != nil {
+						return
+					}
+					_, _ = w.Write(data)
+					lastEventId = e.ID
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+				if len(events) < streamBatch {
+					break
+				}
+			}
+
+			select {
+			case <-wake:
+			case <-keepAlive.C:
+				_, _ = w.WriteString(": keep-alive\n\n")
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// encodeEvent encodes Server-Sent Event with given id, name and data in JSON
+func encodeEvent(id uint64, name string, data interface{}) ([]byte, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", id, name, body)), nil
+}
+
+// userEventToPayload converts changes of event from minor units of currency
+func userEventToPayload(e models.UserEvent) models.PayloadStreamMovement {
+	event := models.PayloadStreamMovement{
+		ID:            e.ID,
+		Kind:          e.Kind,
+		ServiceID:     e.ServiceID,
+		OrderID:       e.OrderID,
+		ReserveStatus: e.ReserveStatus,
+		CreatedAt:     e.CreatedAt,
+		Changes:       make([]models.PayloadBalanceChange, 0, len(e.Changes)),
+	}
+	for _, change := range e.Changes {
+		event.Changes = append(event.Changes, models.PayloadBalanceChange{
+			Currency:  change.Currency,
+			Available: utils.MoneyToFloat(change.Available, change.Currency),
+			Held:      utils.MoneyToFloat(change.Held, change.Currency),
+		})
+	}
+	return event
+}
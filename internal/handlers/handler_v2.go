@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"balance/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Handlers of v2 API take identifiers from path and filters from query instead of request body,
+// then do the same as v1 handlers. Responses are wrapped by Envelope middleware.
+
+// GetBalanceV2 gets user balance by id
+// @Description Get user balance by given id in given currency (RUB by default) and balances in all currencies. Balance is available money, held is money in open reserves and total is their sum. Held money is broken down by service if by_service is set
+// @Summary     Get user balance
+// @Tags        Balance
+// @Accept      json
+// @Produce     json
+// @Param       id         path     integer               true  "User ID"
+// @Param       currency   query    string                false "Currency, RUB by default"
+// @Param       by_service query    bool                  false "Break down held money by service"
+// @Success     200        {object} models.PayloadBalance "User's balance"
+// @Failure     400        {object} models.PayloadErr     "Error"
+// @Security    ApiKey
+// @Router      /v2/users/{id}/balance [get]
+func (h *Handler) GetBalanceV2(c *fiber.Ctx) error {
+	payload := models.PayloadGetBalance{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.getBalance(c, payload)
+}
+
+// AddBalanceV2 adds user balance by id
+// @Description Add user balance by given id in given currency (RUB by default)
+// @Summary     Add user balance
+// @Tags        Balance
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer                  true "User ID"
+// @Param       inJSON body     models.PayloadAddBalance true "In JSON with Amount and optional currency"
+// @Success     200    {string} status                   "OK"
+// @Failure     400    {object} models.PayloadErr        "Error"
+// @Security    ApiKey
+// @Router      /v2/users/{id}/balance [post]
+func (h *Handler) AddBalanceV2(c *fiber.Ctx) error {
+	payload := models.PayloadAddBalance{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.addBalance(c, payload)
+}
+
+// DeleteUserV2 deletes user by id
+// @Description Delete user by given id
+// @Summary     Delete user
+// @Tags        Users
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer           true "User ID"
+// @Success     200 {string} status            "OK"
+// @Failure     400 {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /v2/users/{id} [delete]
+func (h *Handler) DeleteUserV2(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.deleteUser(c, payload)
+}
+
+// ReserveV2 reserves money for order
+// @Description Reserve money for given order, user_id, service_id and amount. Catalog price of the service is reserved if amount is omitted, otherwise amount must be within bounds of the service. Currency defaults to currency of the service and must match it
+// @Summary     Reserve money
+// @Tags        Reserves
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer                   true "Order ID"
+// @Param       inJSON body     models.PayloadReserve     true "In JSON with user_id, service_id and optional amount"
+// @Success     200    {object} models.ReserveFloatAmount "Created reserve"
+// @Failure     400    {object} models.PayloadErr         "Error"
+// @Security    ApiKey
+// @Router      /v2/orders/{id}/reserve [post]
+func (h *Handler) ReserveV2(c *fiber.Ctx) error {
+	payload := models.PayloadReserve{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.reserve(c, payload)
+}
+
+// GetReserveV2 returns reserve of order
+// @Description Get reserve of order by user_id and service_id with its status and history of amendments. Order with multiple line items is found by any of its services
+// @Summary     Get reserve
+// @Tags        Reserves
+// @Accept      json
+// @Produce     json
+// @Param       id         path     integer                   true "Order ID"
+// @Param       user_id    query    integer                   true "User ID"
+// @Param       service_id query    integer                   true "Service ID"
+// @Success     200        {object} models.ReserveFloatAmount "Reserve"
+// @Failure     400        {object} models.PayloadErr         "Error"
+// @Security    ApiKey
+// @Router      /v2/orders/{id}/reserve [get]
+func (h *Handler) GetReserveV2(c *fiber.Ctx) error {
+	payload := models.PayloadReserve{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.getReserve(c, payload)
+}
+
+// AmendReserveV2 changes amount and expiry time of reserve of order
+// @Description Increase or decrease reserved amount and extend expiry time of not purchased reserve. Increase is checked against available balance of user, difference of decrease is returned to user. Omitted amount keeps the reserved one, extend is duration like 30m or 1h
+// @Summary     Amend reserve
+// @Tags        Reserves
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer                    true "Order ID"
+// @Param       inJSON body     models.PayloadAmendReserve true "In JSON with user_id, service_id, optional new amount and extend"
+// @Success     200    {object} models.ReserveFloatAmount  "Amended reserve"
+// @Failure     400    {object} models.PayloadErr          "Error"
+// @Security    ApiKey
+// @Router      /v2/orders/{id}/reserve [patch]
+func (h *Handler) AmendReserveV2(c *fiber.Ctx) error {
+	payload := models.PayloadAmendReserve{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.amendReserve(c, payload)
+}
+
+// DeleteReserveV2 releases reserve of order
+// @Description Release reserve of order by user_id and service_id. Money is returned to user, the reserve is kept with released status
+// @Summary     Remove reserve
+// @Tags        Reserves
+// @Accept      json
+// @Produce     json
+// @Param       id         path     integer           true "Order ID"
+// @Param       user_id    query    integer           true "User ID"
+// @Param       service_id query    integer           true "Service ID"
+// @Success     200        {string} status            "OK"
+// @Failure     400        {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /v2/orders/{id}/reserve [delete]
+func (h *Handler) DeleteReserveV2(c *fiber.Ctx) error {
+	payload := models.PayloadReserve{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.deleteReserve(c, payload)
+}
+
+// PurchaseV2 performs purchase of reserve of order
+// @Description Perform purchase of reserve of order by user_id, service_id and amount. Currency defaults to currency of the reserve
+// @Summary     Perform purchase
+// @Tags        Purchases
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer               true "Order ID"
+// @Param       inJSON body     models.PayloadReserve true "In JSON with user_id, service_id and amount"
+// @Success     200    {string} status                "OK"
+// @Failure     400    {object} models.PayloadErr     "Error"
+// @Security    ApiKey
+// @Router      /v2/orders/{id}/reserve/purchase [post]
+func (h *Handler) PurchaseV2(c *fiber.Ctx) error {
+	payload := models.PayloadReserve{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.purchase(c, payload)
+}
+
+// ReleaseOrderV2 removes reserve of order
+// @Description Remove reserve of order with multiple line items and return money to user
+// @Summary     Release order
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Param       id      path     integer           true "Order ID"
+// @Param       user_id query    integer           true "User ID"
+// @Success     200     {string} status            "OK"
+// @Failure     400     {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /v2/orders/{id} [delete]
+func (h *Handler) ReleaseOrderV2(c *fiber.Ctx) error {
+	payload := models.PayloadOrderQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.releaseOrder(c, payload)
+}
+
+// GetServiceV2 gets service by id
+// @Description Get service by given id
+// @Summary     Get service
+// @Tags        Services
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer               true "Service ID"
+// @Success     200 {object} models.PayloadService "Service"
+// @Failure     400 {object} models.PayloadErr     "Error"
+// @Security    ApiKey
+// @Router      /v2/services/{id} [get]
+func (h *Handler) GetServiceV2(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.getService(c, payload)
+}
+
+// UpdateServiceV2 updates service by id
+// @Description Update name, active flag, catalog price and amount bounds of service by given id. Omitted fields are left unchanged, change of price or bounds creates a new price version. Currency of service cannot be changed
+// @Summary     Update service
+// @Tags        Services
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer               true "Service ID"
+// @Param       inJSON body     models.PayloadService true "In JSON with changed fields"
+// @Success     200    {object} models.PayloadService "Updated service"
+// @Failure     400    {object} models.PayloadErr     "Error"
+// @Security    ApiKey
+// @Router      /v2/services/{id} [put]
+func (h *Handler) UpdateServiceV2(c *fiber.Ctx) error {
+	payload := models.PayloadService{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.updateService(c, payload)
+}
+
+// DeleteServiceV2 deactivates service by id
+// @Description Deactivate service by given id. Service is kept for operations, reserves and reports, but cannot be reserved anymore
+// @Summary     Delete service
+// @Tags        Services
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer           true "Service ID"
+// @Success     200 {string} status            "OK"
+// @Failure     400 {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /v2/services/{id} [delete]
+func (h *Handler) DeleteServiceV2(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.deleteService(c, payload)
+}
+
+// CreateReportV2 creates a new version of csv report by given year and month
+// @Description Create a new version of csv report by given year and month and get link to it. Previous versions are kept, diff against the previous version is returned
+// @Summary     Create csv report version
+// @Tags        Reports
+// @Accept      json
+// @Produce     json
+// @Param       year  path     integer              true "Year"
+// @Param       month path     integer              true "Month"
+// @Success     200   {object} models.PayloadReport "Created report version"
+// @Failure     400   {object} models.PayloadErr    "Error"
+// @Security    ApiKey
+// @Router      /v2/report/{year}/{month} [post]
+func (h *Handler) CreateReportV2(c *fiber.Ctx) error {
+	payload := models.PayloadDate{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	return h.createReport(c, payload)
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"balance/internal/models"
+	"balance/internal/webhooks"
+
+	"errors"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxWebhookDeliveries is the maximum number of deliveries in one response
+const MaxWebhookDeliveries = 100
+
+// checkWebhookURL checks that webhook url is absolute http or https url
+func checkWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("handler: webhook: url must be absolute http or https url")
+	}
+	return nil
+}
+
+// CreateWebhook subscribes url to events
+// @Description Subscribe url to balance events: balance.credited, reserve.created, reserve.expired, purchase.completed, refund.created. Events are sent by POST after the change is committed, signed with HMAC-SHA256 of "timestamp.body" in X-Balance-Signature header. Failed deliveries are retried with exponential backoff, webhook is disabled after repeated failed deliveries. Secret is generated if omitted and returned only in this response
+// @Summary     Create webhook
+// @Tags        Webhooks
+// @Accept      json
+// @Produce     json
+// @Param       inJSON body     models.PayloadCreateWebhook true "In JSON with url, event_types and optional secret"
+// @Success     200    {object} models.PayloadWebhook       "Created webhook with secret"
+// @Failure     400    {object} models.PayloadErr           "Error"
+// @Security    ApiKey
+// @Router      /webhooks [post]
+// @Router      /v2/webhooks [post]
+func (h *Handler) CreateWebhook(c *fiber.Ctx) error {
+	payload := models.PayloadCreateWebhook{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := checkWebhookURL(payload.URL); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if payload.Secret == "" {
+		var err error
+		if payload.Secret, err = webhooks.NewSecret(); err != nil {
+			return returnBadRequest(err, c)
+		}
+	}
+
+	webhook, err := h.db(c).CreateWebhook(models.Webhook{
+		URL:        payload.URL,
+		Secret:     payload.Secret,
+		EventTypes: payload.EventTypes,
+	})
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := webhookToPayload(webhook)
+	outPayload.Secret = webhook.Secret
+	return c.JSON(outPayload)
+}
+
+// GetWebhooks returns all webhooks
+// @Description Get all webhooks with their state, secrets are not returned
+// @Summary     List webhooks
+// @Tags        Webhooks
+// @Accept      json
+// @Produce     json
+// @Success     200 {array}  models.PayloadWebhook "Webhooks"
+// @Failure     400 {object} models.PayloadErr     "Error"
+// @Security    ApiKey
+// @Router      /webhooks [get]
+// @Router      /v2/webhooks [get]
+func (h *Handler) GetWebhooks(c *fiber.Ctx) error {
+	list, err := h.db(c).GetWebhooks()
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := make([]models.PayloadWebhook, 0, len(list))
+	for _, w := range list {
+		outPayload = append(outPayload, webhookToPayload(w))
+	}
+	return c.JSON(outPayload)
+}
+
+// UpdateWebhook changes url, event types or active flag of webhook
+// @Description Change url, event types or active flag of webhook by given id. Enabling of webhook resets count of failed deliveries, pending deliveries of disabled webhook fail
+// @Summary     Update webhook
+// @Tags        Webhooks
+// @Accept      json
+// @Produce     json
+// @Param       id     path     integer                     true "Webhook ID"
+// @Param       inJSON body     models.PayloadUpdateWebhook true "In JSON with changed fields"
+// @Success     200    {object} models.PayloadWebhook       "Updated webhook"
+// @Failure     400    {object} models.PayloadErr           "Error"
+// @Security    ApiKey
+// @Router      /webhooks/{id} [patch]
+// @Router      /v2/webhooks/{id} [patch]
+func (h *Handler) UpdateWebhook(c *fiber.Ctx) error {
+	payload := models.PayloadUpdateWebhook{}
+	if err := c.BodyParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.URL != nil {
+		if err := checkWebhookURL(*payload.URL); err != nil {
+			return returnBadRequest(err, c)
+		}
+	}
+
+	webhook, err := h.db(c).UpdateWebhook(models.WebhookUpdate{
+		ID:         payload.ID,
+		URL:        payload.URL,
+		EventTypes: payload.EventTypes,
+		Active:     payload.Active,
+	})
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.JSON(webhookToPayload(webhook))
+}
+
+// DeleteWebhook deletes webhook with its deliveries
+// @Description Delete webhook by given id with its deliveries
+// @Summary     Delete webhook
+// @Tags        Webhooks
+// @Accept      json
+// @Produce     json
+// @Param       id  path     integer           true "Webhook ID"
+// @Success     200 {string} status            "OK"
+// @Failure     400 {object} models.PayloadErr "Error"
+// @Security    ApiKey
+// @Router      /webhooks/{id} [delete]
+// @Router      /v2/webhooks/{id} [delete]
+func (h *Handler) DeleteWebhook(c *fiber.Ctx) error {
+	payload := models.PayloadId{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	if err := h.db(c).DeleteWebhook(payload.ID); err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// GetWebhookDeliveries returns the latest deliveries of webhook with history of attempts
+// @Description Get the latest deliveries of webhook by given id with their events, statuses and history of attempts
+// @Summary     Get webhook deliveries
+// @Tags        Webhooks
+// @Accept      json
+// @Produce     json
+// @Param       id    path     integer                       true  "Webhook ID"
+// @Param       limit query    integer                       false "Number of deliveries, 20 by default, 100 at most"
+// @Success     200   {array}  models.PayloadWebhookDelivery "Deliveries"
+// @Failure     400   {object} models.PayloadErr             "Error"
+// @Security    ApiKey
+// @Router      /webhooks/{id}/deliveries [get]
+// @Router      /v2/webhooks/{id}/deliveries [get]
+func (h *Handler) GetWebhookDeliveries(c *fiber.Ctx) error {
+	payload := models.PayloadWebhookDeliveriesQuery{}
+	if err := c.ParamsParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if err := c.QueryParser(&payload); err != nil {
+		return returnBadRequest(err, c)
+	}
+	if payload.Limit == 0 {
+		payload.Limit = 20
+	}
+	if payload.Limit < 0 || payload.Limit > MaxWebhookDeliveries {
+		return returnBadRequest(errors.New("handler: get webhook deliveries: limit must be in [1, 100] range"), c)
+	}
+
+	deliveries, err := h.db(c).GetWebhookDeliveries(payload.ID, payload.Limit)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	outPayload := make([]models.PayloadWebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		delivery := models.PayloadWebhookDelivery{
+			ID:            d.ID,
+			Event:         webhooks.EventToPayload(d.Event),
+			Status:        d.Status,
+			Attempts:      d.Attempts,
+			NextAttemptAt: d.NextAttemptAt,
+			DeliveredAt:   d.DeliveredAt,
+		}
+		for _, a := range d.History {
+			delivery.History = append(delivery.History, models.PayloadWebhookAttempt{
+				AttemptedAt: a.AttemptedAt,
+				StatusCode:  a.StatusCode,
+				Error:       a.Error,
+				DurationMs:  a.Duration.Milliseconds(),
+			})
+		}
+		outPayload = append(outPayload, delivery)
+	}
+	return c.JSON(outPayload)
+}
+
+// webhookToPayload converts webhook without its secret
+func webhookToPayload(webhook models.Webhook) models.PayloadWebhook {
+	return models.PayloadWebhook{
+		ID:         webhook.ID,
+		URL:        webhook.URL,
+		EventTypes: webhook.EventTypes,
+		Active:     webhook.Active,
+		Failures:   webhook.Failures,
+		CreatedAt:  webhook.CreatedAt,
+		DisabledAt: webhook.DisabledAt,
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"balance/internal/auth"
+	"balance/internal/databases"
+	"balance/internal/models"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Envelope wraps JSON and text responses of v2 API into {"data": ...} on success and {"error": {"message": ...}} on failure,
+// files and event streams are sent as is
+func Envelope(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		code := fiber.StatusInternalServerError
+		var e *fiber.Error
+		if errors.As(err, &e) {
+			code = e.Code
+		}
+		return c.Status(code).JSON(models.PayloadEnvelope{Error: &models.PayloadErr{Message: err.Error()}})
+	}
+
+	// other responses, e.g. files and event streams, are sent as is, their body is not read
+	contentType := string(c.Response().Header.ContentType())
+	if !strings.HasPrefix(contentType, fiber.MIMEApplicationJSON) && !strings.HasPrefix(contentType, fiber.MIMETextPlain) {
+		return nil
+	}
+	body := append([]byte(nil), c.Response().Body()...)
+	failed := c.Response().StatusCode() >= fiber.StatusBadRequest
+
+	envelope := models.PayloadEnvelope{}
+	switch {
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		if failed {
+			envelope.Error = &models.PayloadErr{}
+			if err := json.Unmarshal(body, envelope.Error); err != nil {
+				envelope.Error.Message = string(body)
+			}
+		} else if len(body) > 0 {
+			envelope.Data = json.RawMessage(body)
+		}
+	case strings.HasPrefix(contentType, fiber.MIMETextPlain):
+		if failed {
+			envelope.Error = &models.PayloadErr{Message: string(body)}
+		}
+	}
+	return c.JSON(envelope)
+}
+
+// Deprecated marks responses of v1 API as deprecated and links them to v2 API
+func Deprecated(c *fiber.Ctx) error {
+	if !strings.HasPrefix(c.Path(), "/api/v2") {
+		c.Set("Deprecation", "true")
+		c.Set(fiber.HeaderLink, `</api/v2>; rel="successor-version"`)
+	}
+	return c.Next()
+}
+
+// principalLocal is name of local value holding caller of authenticated request
+const principalLocal = "principal"
+
+// Authenticate finds caller of request by bearer token validated against JWKS if tokens are configured
+// or by active API key sent in X-API-Key header or as bearer token, requests without valid credentials are unauthorized
+func (h *Handler) Authenticate(c *fiber.Ctx) error {
+	// request of v2 API is authenticated once, though it also matches v1 group
+	if _, ok := c.Locals(principalLocal).(models.Principal); ok {
+		return c.Next()
+	}
+
+	key := auth.FromHeaders(c.Get(auth.KeyHeader), c.Get(fiber.HeaderAuthorization))
+	if key == "" {
+		return returnUnauthorized(errors.New("handler: authenticate: API key or token is not given"), c)
+	}
+	if h.JWT != nil && auth.IsJWT(key) {
+		principal, err := h.JWT.Validate(key)
+		if err != nil {
+			return returnUnauthorized(fmt.Errorf("handler: authenticate: %v", err), c)
+		}
+		c.Locals(principalLocal, principal)
+		return c.Next()
+	}
+
+	apiKey, err := h.DB.GetActiveAPIKey(auth.Hash(key))
+	if err != nil && databases.ErrorCode(err) == databases.CodeNotFound {
+		return returnUnauthorized(errors.New("handler: authenticate: API key is not valid, revoked or expired"), c)
+	} else if err != nil {
+		return returnBadRequest(err, c)
+	}
+
+	c.Locals(principalLocal, auth.KeyPrincipal(apiKey))
+	return c.Next()
+}
+
+// VerifySignature checks HMAC-SHA256 signature of request moving money if API key of caller has active signing secrets.
+// Signature is made over method, path with query, timestamp, nonce and body, timestamp must be within clock skew tolerance
+// and nonce is accepted once. Requests of keys without secrets and of tokens are let through unsigned
+func (h *Handler) VerifySignature(c *fiber.Ctx) error {
+	p := principal(c)
+	if p.KeyID == 0 {
+		return c.Next()
+	}
+
+	secrets, err := h.DB.GetActiveSigningSecrets(p.KeyID)
+	if err != nil {
+		return returnBadRequest(err, c)
+	}
+	if len(secrets) == 0 {
+		if c.Get(auth.SignatureHeader) != "" {
+			return returnUnauthorized(errors.New("handler: verify signature: API key has no active signing secret"), c)
+		}
+		return c.Next()
+	}
+
+	values := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		values = append(values, s.Secret)
+	}
+	request := auth.SignedRequest{
+		Method:    c.Method(),
+		Path:      c.OriginalURL(),
+		Timestamp: c.Get(auth.SignatureTimestampHeader),
+		Nonce:     c.Get(auth.SignatureNonceHeader),
+		Signature: c.Get(auth.SignatureHeader),
+		Body:      c.Body(),
+	}
+	if err = request.Verify(values, time.Now()); err != nil {
+		return returnUnauthorized(fmt.Errorf("handler: verify signature: %v", err), c)
+	}
+
+	// nonce is used after signature is verified, so requests with wrong signature do not burn nonces
+	err = h.DB.UseSignatureNonce(p.KeyID, request.Nonce)
+	if err != nil && databases.ErrorCode(err) == databases.CodeFailedPrecondition {
+		return returnUnauthorized(fmt.Errorf("handler: verify signature: %v", err), c)
+	} else if err != nil {
+		return returnBadRequest(err, c)
+	}
+	return c.Next()
+}
+
+// Allow lets through callers with given scope, end-user tokens are not let through
+func Allow(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if principal(c).UserID != 0 {
+			return returnForbidden(fmt.Errorf("handler: end-user token is not allowed to %s %s", c.Method(), c.Path()), c)
+		}
+		return checkScope(c, scope)
+	}
+}
+
+// AllowOwn lets through callers with given scope including end-user tokens,
+// handler of the route checks that end-user token operates on its own user
+func AllowOwn(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return checkScope(c, scope)
+	}
+}
+
+// checkScope lets through caller with given scope
+func checkScope(c *fiber.Ctx, scope string) error {
+	if !auth.HasScope(principal(c), scope) {
+		return returnForbidden(fmt.Errorf("handler: %s scope is required to %s %s", scope, c.Method(), c.Path()), c)
+	}
+	return c.Next()
+}
+
+// principal returns caller of authenticated request
+func principal(c *fiber.Ctx) models.Principal {
+	p, _ := c.Locals(principalLocal).(models.Principal)
+	return p
+}
+
+// checkServices checks that caller of request operates on every given service,
+// zero service is not allowed to caller restricted to services
+func checkServices(c *fiber.Ctx, serviceIds ...uint64) error {
+	p := principal(c)
+	for _, id := range serviceIds {
+		if id == 0 && len(p.Services) > 0 {
+			return fmt.Errorf("handler: caller operates on services %v only, service must be given", p.Services)
+		}
+		if !auth.AllowsService(p, id) {
+			return fmt.Errorf("handler: caller is not allowed to operate on service %d", id)
+		}
+	}
+	return nil
+}
+
+// checkUser checks that end-user token of request operates on its own user
+func checkUser(c *fiber.Ctx, userId uint64) error {
+	if !auth.AllowsUser(principal(c), userId) {
+		return fmt.Errorf("handler: end-user token is not allowed to operate on user %d", userId)
+	}
+	return nil
+}
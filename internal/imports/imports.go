@@ -0,0 +1,126 @@
+package imports
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxExternalRef is the maximum length of external reference of row
+const MaxExternalRef = 128
+
+// Reader reads rows of CSV file with user_id, amount in major units of given currency and optional external_ref columns
+// one by one, so file of any size is loaded without holding its rows in memory. Header is optional.
+// Invalid row is returned with invalid status and error, external reference must be unique within the file
+type Reader struct {
+	reader   *csv.Reader
+	currency string
+	refs     map[string]int // lines of external references read so far
+	first    bool
+}
+
+// NewReader creates reader of rows of CSV file in given currency
+func NewReader(r io.Reader, currency string) *Reader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return &Reader{reader: reader, currency: currency, refs: make(map[string]int), first: true}
+}
+
+// Read returns the next row of file and io.EOF after the last one, malformed CSV fails the whole file
+func (r *Reader) Read() (models.ImportRow, error) {
+	for {
+		record, err := r.reader.Read()
+		if errors.Is(err, io.EOF) {
+			return models.ImportRow{}, io.EOF
+		} else if err != nil {
+			return models.ImportRow{}, fmt.Errorf("imports: %v", err)
+		}
+		first := r.first
+		r.first = false
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "user_id") {
+			continue
+		}
+
+		line, _ := r.reader.FieldPos(0)
+		row := models.ImportRow{Line: line, Status: models.ImportRowPending}
+		if err = parseRow(record, r.currency, &row); err == nil && row.ExternalRef != "" {
+			if firstLine, ok := r.refs[row.ExternalRef]; ok {
+				err = fmt.Errorf("external reference %q is repeated, first at line %d", row.ExternalRef, firstLine)
+			} else {
+				r.refs[row.ExternalRef] = line
+			}
+		}
+		if err != nil {
+			row = models.ImportRow{Line: line, ExternalRef: row.ExternalRef, Status: models.ImportRowInvalid, Error: err.Error()}
+		}
+		return row, nil
+	}
+}
+
+// Checksum returns hex SHA-256 of file, the same file is not imported twice
+func Checksum(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", fmt.Errorf("imports: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// parseRow parses fields of row
+func parseRow(record []string, currency string, row *models.ImportRow) error {
+	if len(record) < 2 || len(record) > 3 {
+		return fmt.Errorf("expected user_id, amount and optional external_ref, got %d fields", len(record))
+	}
+	if len(record) == 3 {
+		row.ExternalRef = strings.TrimSpace(record[2])
+		if len(row.ExternalRef) > MaxExternalRef {
+			row.ExternalRef = ""
+			return fmt.Errorf("external reference is longer than %d characters", MaxExternalRef)
+		}
+	}
+
+	userId, err := strconv.ParseUint(strings.TrimSpace(record[0]), 10, 64)
+	if err != nil || userId == 0 {
+		return fmt.Errorf("wrong user id %q", record[0])
+	}
+	amount, err := utils.ParseMoney(record[1], currency)
+	if err != nil {
+		return err
+	} else if amount <= 0 {
+		return fmt.Errorf("amount %q must be positive", record[1])
+	}
+
+	row.UserID = userId
+	row.Amount = amount
+	return nil
+}
+
+// WriteResult writes CSV file with status of every row of import in given currency
+func WriteResult(w io.Writer, rows []models.ImportRow, currency string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"line", "user_id", "amount", "external_ref", "status", "error"}); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		userId, amount := "", ""
+		if row.Status != models.ImportRowInvalid {
+			userId = strconv.FormatUint(row.UserID, 10)
+			amount = utils.FormatMoney(row.Amount, currency)
+		}
+		err := writer.Write([]string{strconv.Itoa(row.Line), userId, amount, row.ExternalRef, row.Status, row.Error})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,135 @@
+package imports
+
+import (
+	"balance/internal/models"
+
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readAll reads all rows of file
+func readAll(file, currency string) ([]models.ImportRow, error) {
+	r := NewReader(strings.NewReader(file), currency)
+	rows := make([]models.ImportRow, 0)
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		} else if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestReader(t *testing.T) {
+	longRef := strings.Repeat("r", MaxExternalRef+1)
+	tests := []struct {
+		name     string
+		file     string
+		currency string
+		want     []models.ImportRow
+		wantErr  bool
+	}{
+		{"empty file", "", "RUB", []models.ImportRow{}, false},
+		{"header only", "user_id,amount,external_ref\n", "RUB", []models.ImportRow{}, false},
+		{"rows with header", "user_id,amount,external_ref\n1,10.50,a\n2,3,b\n", "RUB", []models.ImportRow{
+			{Line: 2, UserID: 1, Amount: 1050, ExternalRef: "a", Status: models.ImportRowPending},
+			{Line: 3, UserID: 2, Amount: 300, ExternalRef: "b", Status: models.ImportRowPending},
+		}, false},
+		{"rows without header and reference", "1,10.50\n2, 0.01\n", "RUB", []models.ImportRow{
+			{Line: 1, UserID: 1, Amount: 1050, Status: models.ImportRowPending},
+			{Line: 2, UserID: 2, Amount: 1, Status: models.ImportRowPending},
+		}, false},
+		{"header in upper case", "USER_ID,AMOUNT\n1,1\n", "USD", []models.ImportRow{
+			{Line: 2, UserID: 1, Amount: 100, Status: models.ImportRowPending},
+		}, false},
+		{"header is skipped only in the first line", "1,1\nuser_id,amount\n", "RUB", []models.ImportRow{
+			{Line: 1, UserID: 1, Amount: 100, Status: models.ImportRowPending},
+			{Line: 2, Status: models.ImportRowInvalid, Error: `wrong user id "user_id"`},
+		}, false},
+		{"invalid rows", "0,1\nabc,1\n1,-5\n1,0\n1,1.001\n1,ten\n1\n1,2,3,4\n", "RUB", []models.ImportRow{
+			{Line: 1, Status: models.ImportRowInvalid, Error: `wrong user id "0"`},
+			{Line: 2, Status: models.ImportRowInvalid, Error: `wrong user id "abc"`},
+			{Line: 3, Status: models.ImportRowInvalid, Error: `amount "-5" must be positive`},
+			{Line: 4, Status: models.ImportRowInvalid, Error: `amount "0" must be positive`},
+			{Line: 5, Status: models.ImportRowInvalid, Error: `amount "1.001" has more than 2 digits after point`},
+			{Line: 6, Status: models.ImportRowInvalid, Error: `wrong amount "ten"`},
+			{Line: 7, Status: models.ImportRowInvalid, Error: "expected user_id, amount and optional external_ref, got 1 fields"},
+			{Line: 8, Status: models.ImportRowInvalid, Error: "expected user_id, amount and optional external_ref, got 4 fields"},
+		}, false},
+		{"repeated reference", "1,1,a\n2,2,b\n3,3,a\n", "RUB", []models.ImportRow{
+			{Line: 1, UserID: 1, Amount: 100, ExternalRef: "a", Status: models.ImportRowPending},
+			{Line: 2, UserID: 2, Amount: 200, ExternalRef: "b", Status: models.ImportRowPending},
+			{Line: 3, ExternalRef: "a", Status: models.ImportRowInvalid, Error: `external reference "a" is repeated, first at line 1`},
+		}, false},
+		{"reference of invalid row is not taken", "0,1,a\n1,1,a\n", "RUB", []models.ImportRow{
+			{Line: 1, ExternalRef: "a", Status: models.ImportRowInvalid, Error: `wrong user id "0"`},
+			{Line: 2, UserID: 1, Amount: 100, ExternalRef: "a", Status: models.ImportRowPending},
+		}, false},
+		{"too long reference", "1,1," + longRef + "\n", "RUB", []models.ImportRow{
+			{Line: 1, Status: models.ImportRowInvalid, Error: "external reference is longer than 128 characters"},
+		}, false},
+		{"quoted fields", "\"1\",\"10.50\",\"ref, with comma\"\n", "RUB", []models.ImportRow{
+			{Line: 1, UserID: 1, Amount: 1050, ExternalRef: "ref, with comma", Status: models.ImportRowPending},
+		}, false},
+		{"malformed CSV fails the file", "1,1\n2,\"3\n", "RUB", []models.ImportRow{
+			{Line: 1, UserID: 1, Amount: 100, Status: models.ImportRowPending},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readAll(tt.file, tt.currency)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("rows = %+v, want %+v", rows, tt.want)
+			}
+			for i := range rows {
+				if rows[i] != tt.want[i] {
+					t.Errorf("row %d = %+v, want %+v", i, rows[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"1,10.50\n", "6ee88920e5a28a53d403934f2ac168d63fb04a80c7645f36af658874daa6ae58"},
+	}
+	for _, tt := range tests {
+		got, err := Checksum(strings.NewReader(tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Checksum(%q) = %s, want %s", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	rows := []models.ImportRow{
+		{Line: 1, UserID: 1, Amount: 1050, ExternalRef: "a", Status: models.ImportRowPending},
+		{Line: 2, UserID: 9, Amount: 5, Status: models.ImportRowInvalid, Error: "wrong user id \"x\""},
+	}
+	var buf bytes.Buffer
+	if err := WriteResult(&buf, rows, "RUB"); err != nil {
+		t.Fatal(err)
+	}
+	want := "line,user_id,amount,external_ref,status,error\n" +
+		"1,1,10.50,a," + models.ImportRowPending + ",\n" +
+		"2,,,," + models.ImportRowInvalid + ",\"wrong user id \"\"x\"\"\"\n"
+	if buf.String() != want {
+		t.Errorf("result = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"balance/internal/auth"
+	"balance/internal/databases"
+
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunNonceCleanup deletes nonces of signed requests older than auth.NonceRetention once
+func RunNonceCleanup(db databases.DBInt, logger *zap.Logger) error {
+	deleted, err := db.DeleteSignatureNonces(time.Now().Add(-auth.NonceRetention))
+	if err != nil {
+		return err
+	}
+	logger.Debug("nonces: cleanup done", zap.Int64("deleted", deleted))
+	return nil
+}
+
+// StartNonceCleanup deletes old nonces of signed requests every interval until ctx is done
+func StartNonceCleanup(ctx context.Context, db databases.DBInt, interval time.Duration, logger *zap.Logger) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := RunNonceCleanup(db, logger); err != nil {
+					logger.Error("nonces: cleanup failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"balance/internal/auth"
+	"balance/internal/databases"
+
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeNonceDB records cutoff of deleted nonces, other methods of DBInt are not implemented
+type fakeNonceDB struct {
+	databases.DBInt
+	before time.Time
+	err    error
+}
+
+func (db *fakeNonceDB) DeleteSignatureNonces(before time.Time) (int64, error) {
+	db.before = before
+	return 3, db.err
+}
+
+func TestRunNonceCleanup(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{"deleted", nil, false},
+		{"failed", errors.New("db: delete signature nonces: connection refused"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeNonceDB{err: tt.err}
+			start := time.Now()
+			err := RunNonceCleanup(db, zap.NewNop())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			// nonces are kept while their requests could pass timestamp check
+			if db.before.Before(start.Add(-auth.NonceRetention)) || db.before.After(time.Now().Add(-auth.NonceRetention)) {
+				t.Errorf("nonces are deleted before %v, want %v ago", db.before, auth.NonceRetention)
+			}
+			if auth.NonceRetention < auth.SignatureTolerance {
+				t.Errorf("nonces are kept %v, shorter than tolerance %v", auth.NonceRetention, auth.SignatureTolerance)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"balance/internal/databases"
+	"balance/internal/outbox"
+
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// outboxBatch is number of outbox messages claimed for publishing at once
+const outboxBatch = 500
+
+// RunOutbox publishes outbox messages until none is left or publishing fails
+func RunOutbox(db databases.DBInt, publisher outbox.Publisher) error {
+	for {
+		n, err := db.RelayOutbox(outboxBatch, publisher.Publish)
+		if err != nil {
+			return err
+		}
+		if n < outboxBatch {
+			return nil
+		}
+	}
+}
+
+// StartOutbox publishes outbox messages every interval until ctx is done
+func StartOutbox(ctx context.Context, db databases.DBInt, publisher outbox.Publisher, interval time.Duration, logger *zap.Logger) {
+	go func() {
+		defer publisher.Close()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := RunOutbox(db, publisher); err != nil {
+					logger.Error("outbox: failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"balance/internal/databases"
+	"balance/internal/metrics"
+
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ReconciliationMismatchesMetric is the name of gauge with number of users whose balance doesn't match operations
+const ReconciliationMismatchesMetric = "balance_reconciliation_mismatches"
+
+// RunReconciliation reconciles balances once, logs every mismatch and updates mismatch metric
+func RunReconciliation(db databases.DBInt, logger *zap.Logger) error {
+	reconciliation, err := db.Reconcile()
+	if err != nil {
+		return err
+	}
+
+	metrics.SetGauge(ReconciliationMismatchesMetric, "Number of users whose balance doesn't match their operations",
+		float64(len(reconciliation.Mismatches)))
+	for _, m := range reconciliation.Mismatches {
+		logger.Warn("reconciliation: balance mismatch",
+			zap.Uint64("user_id", m.UserID),
+			zap.String("currency", m.Currency),
+			zap.Int64("balance", m.Balance),
+			zap.Int64("journal", m.Journal),
+			zap.Int64("held", m.Held),
+			zap.Int64("difference", m.Difference),
+			zap.Int64("wallet", m.Wallet),
+			zap.Int64("wallet_difference", m.WalletDifference))
+	}
+	logger.Info("reconciliation: done",
+		zap.Int64("wallets", reconciliation.Wallets),
+		zap.Int("mismatches", len(reconciliation.Mismatches)))
+	return nil
+}
+
+// StartReconciliation runs reconciliation every interval until ctx is done
+func StartReconciliation(ctx context.Context, db databases.DBInt, interval time.Duration, logger *zap.Logger) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := RunReconciliation(db, logger); err != nil {
+					logger.Error("reconciliation: failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
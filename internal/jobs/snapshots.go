@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"balance/internal/databases"
+
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SnapshotDelay is time after midnight when snapshot of the previous day is made,
+// so operations of the day are committed by then
+const SnapshotDelay = 5 * time.Minute
+
+// RunSnapshot stores end of day balances of all users for given day
+func RunSnapshot(db databases.DBInt, day time.Time, logger *zap.Logger) error {
+	snapshot, err := db.CreateSnapshot(day)
+	if err != nil {
+		return err
+	}
+	logger.Info("snapshot: done",
+		zap.String("day", snapshot.Day.Format("2006-01-02")),
+		zap.Int64("wallets", snapshot.Wallets))
+	return nil
+}
+
+// StartSnapshots makes snapshot of the previous day at start and then every day after midnight until ctx is done
+func StartSnapshots(ctx context.Context, db databases.DBInt, logger *zap.Logger) {
+	go func() {
+		loc, _ := time.LoadLocation("Europe/Moscow")
+		for {
+			now := time.Now().In(loc)
+			today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+			if err := RunSnapshot(db, today.AddDate(0, 0, -1), logger); err != nil {
+				logger.Error("snapshot: failed", zap.Error(err))
+			}
+
+			timer := time.NewTimer(time.Until(today.AddDate(0, 0, 1).Add(SnapshotDelay)))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
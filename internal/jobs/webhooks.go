@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"balance/internal/databases"
+	"balance/internal/models"
+	"balance/internal/webhooks"
+
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// WebhookMaxAttempts is number of attempts after which delivery fails
+	WebhookMaxAttempts = 10
+	// WebhookDisableAfter is number of failed deliveries in a row after which webhook is disabled
+	WebhookDisableAfter = 5
+	// WebhookRetryDelay is delay of the first retry, it doubles with every failed attempt up to WebhookMaxRetryDelay
+	WebhookRetryDelay    = 30 * time.Second
+	WebhookMaxRetryDelay = 6 * time.Hour
+)
+
+const (
+	// webhookBatch is number of deliveries claimed at once
+	webhookBatch = 100
+	// webhookWorkers is number of deliveries sent concurrently
+	webhookWorkers = 10
+	// webhookLease is time claimed deliveries are hidden from other instances, it covers sending of the whole batch
+	webhookLease = 5 * time.Minute
+)
+
+// webhookRetryAt returns time of retry after given number of attempts or nil if attempts are exhausted
+func webhookRetryAt(attempts int, attemptedAt time.Time) *time.Time {
+	if attempts >= WebhookMaxAttempts {
+		return nil
+	}
+	delay := WebhookRetryDelay
+	for i := 1; i < attempts && delay < WebhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > WebhookMaxRetryDelay {
+		delay = WebhookMaxRetryDelay
+	}
+	retryAt := attemptedAt.Add(delay)
+	return &retryAt
+}
+
+// RunWebhooks sends deliveries which are due until none is left and records their attempts
+func RunWebhooks(db databases.DBInt, client *http.Client, logger *zap.Logger) error {
+	for {
+		deliveries, err := db.ClaimWebhookDeliveries(webhookBatch, webhookLease)
+		if err != nil {
+			return err
+		}
+
+		queue := make(chan models.WebhookDelivery)
+		var wg sync.WaitGroup
+		for i := 0; i < webhookWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for d := range queue {
+					attempt := webhooks.Deliver(client, d)
+					var retryAt *time.Time
+					if attempt.Error != "" {
+						retryAt = webhookRetryAt(d.Attempts+1, attempt.AttemptedAt)
+						logger.Warn("webhooks: delivery attempt failed",
+							zap.Uint64("delivery_id", d.ID),
+							zap.Uint64("webhook_id", d.WebhookID),
+							zap.Int("attempt", d.Attempts+1),
+							zap.String("error", attempt.Error))
+					}
+					if err := db.RecordWebhookAttempt(attempt, retryAt, WebhookDisableAfter); err != nil {
+						logger.Error("webhooks: attempt is not recorded", zap.Uint64("delivery_id", d.ID), zap.Error(err))
+					}
+				}
+			}()
+		}
+		for _, d := range deliveries {
+			queue <- d
+		}
+		close(queue)
+		wg.Wait()
+
+		if len(deliveries) < webhookBatch {
+			return nil
+		}
+	}
+}
+
+// StartWebhooks sends due webhook deliveries every interval until ctx is done
+func StartWebhooks(ctx context.Context, db databases.DBInt, interval time.Duration, logger *zap.Logger) {
+	go func() {
+		client := &http.Client{Timeout: webhooks.Timeout}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := RunWebhooks(db, client, logger); err != nil {
+					logger.Error("webhooks: failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
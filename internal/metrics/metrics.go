@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+type gauge struct {
+	help  string
+	value float64
+}
+
+var (
+	mu     sync.RWMutex
+	gauges = make(map[string]gauge)
+)
+
+// SetGauge sets value of gauge metric by given name
+func SetGauge(name, help string, value float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	gauges[name] = gauge{help: help, value: value}
+}
+
+// WriteText writes all metrics in Prometheus text exposition format
+func WriteText(w io.Writer) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(gauges))
+	for name := range gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		g := gauges[name]
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, g.help, name, name, g.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,35 +3,633 @@ package models
 import "time"
 
 type User struct {
-	ID      uint64 `json:"id" gorm:"primaryKey"`
-	Balance int64  `json:"balance"`
+	ID      uint64   `json:"id" gorm:"primaryKey"`
+	Wallets []Wallet `json:"wallets,omitempty"` // balances of user in every currency
+}
+
+type Wallet struct {
+	Currency string `json:"currency"` // ISO 4217 currency code
+	Balance  int64  `json:"balance"`  // amount of money stored in minor units of currency
+}
+
+// Balance is money of user in one currency, total amount is available money and money held in open reserves
+type Balance struct {
+	Currency  string        `json:"currency"`
+	Available int64         `json:"available"`          // balance of wallet, reserved money is already subtracted
+	Held      int64         `json:"held"`               // money held in open reserves
+	Total     int64         `json:"total"`              // available + held
+	Services  []ServiceHeld `json:"services,omitempty"` // held money broken down by service
+}
+
+// BalanceAt is money of user at given moment calculated from operations and reserves
+type BalanceAt struct {
+	UserID   uint64    `json:"user_id"`
+	At       time.Time `json:"at"`
+	Balances []Balance `json:"balances"`
+	Reserves []Reserve `json:"reserves,omitempty"` // reserves open at the moment with amounts they had then
+}
+
+type ServiceHeld struct {
+	ServiceID   uint64 `json:"service_id"`
+	ServiceName string `json:"service_name"`
+	Held        int64  `json:"held"` // amount of money stored in minor units of currency
 }
 
 type Service struct {
-	ID   uint64 `json:"id" gorm:"primaryKey"`
-	Name string `json:"name"`
+	ID           uint64 `json:"id" gorm:"primaryKey"`
+	Name         string `json:"name"`
+	Currency     string `json:"currency"` // currency the service is priced in
+	Active       bool   `json:"active"`   // inactive service cannot be reserved
+	PriceVersion int    `json:"price_version"`
+	Price        *int64 `json:"price,omitempty"`      // catalog price stored in minor units, nullable if service has no fixed price
+	MinAmount    *int64 `json:"min_amount,omitempty"` // lower bound of reserved amount, nullable if not bounded
+	MaxAmount    *int64 `json:"max_amount,omitempty"` // upper bound of reserved amount, nullable if not bounded
+}
+
+type ServicePrice struct {
+	ServiceID uint64    `json:"service_id"`
+	Version   int       `json:"version"`
+	Price     *int64    `json:"price,omitempty"`      // catalog price stored in minor units of service currency
+	MinAmount *int64    `json:"min_amount,omitempty"` // lower bound of reserved amount
+	MaxAmount *int64    `json:"max_amount,omitempty"` // upper bound of reserved amount
+	ValidFrom time.Time `json:"valid_from"`           // time when price version was created
+}
+
+// Statuses of service upsert
+const (
+	UpsertCreated  = "created"
+	UpsertUpdated  = "updated"
+	UpsertConflict = "conflict" // service was not written
+)
+
+type ServiceUpsertResult struct {
+	ID     uint64 `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`          // one of upsert statuses
+	Error  string `json:"error,omitempty"` // reason of conflict
+}
+
+type ServicesFilter struct {
+	Name   string // substring of name, empty for all services
+	Active *bool  // nullable for active and inactive services
+	Limit  int
+	Offset int
+}
+
+// ServiceUpdate holds changed fields of service, nil fields are left unchanged.
+// Change of price or bounds creates a new price version
+type ServiceUpdate struct {
+	ID        uint64
+	Name      *string
+	Active    *bool
+	Price     *int64
+	MinAmount *int64
+	MaxAmount *int64
 }
 
 type Reserve struct {
-	OrderID     uint64     `json:"order_id" gorm:"primaryKey;autoIncrement:false"`
-	UserID      uint64     `json:"-"`
-	User        User       `json:"user"`
-	ServiceID   uint64     `json:"-"`
-	Service     Service    `json:"service"`
-	Amount      int64      `json:"amount"`                 // amount of money stored in cents
-	Purchased   bool       `json:"purchased"`              // purchase status
-	ReservedAt  time.Time  `json:"reserved_at"`            // time when reserve happend
-	PurchasedAt *time.Time `json:"purchased_at,omitempty"` // time when purchase happened, could be nullable
+	OrderID      uint64             `json:"order_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID       uint64             `json:"-"`
+	User         User               `json:"user"`
+	ServiceID    uint64             `json:"-"`
+	Service      Service            `json:"service"`
+	Amount       int64              `json:"amount"`                 // amount of money stored in minor units of currency
+	Currency     string             `json:"currency"`               // ISO 4217 currency code
+	Purchased    bool               `json:"purchased"`              // purchase status
+	ReservedAt   time.Time          `json:"reserved_at"`            // time when reserve happend
+	PurchasedAt  *time.Time         `json:"purchased_at,omitempty"` // time when purchase happened, could be nullable
+	PriceVersion int                `json:"price_version"`          // version of service price at the moment of reserve
+	ExpiresAt    time.Time          `json:"expires_at"`             // time when not purchased reserve is released
+	Status       string             `json:"status"`                 // one of reserve statuses
+	ReleasedAt   *time.Time         `json:"released_at,omitempty"`  // time when reserve was released or expired, could be nullable
+	Amendments   []ReserveAmendment `json:"amendments,omitempty"`   // history of changes of amount and expiry time
+}
+
+// Statuses of reserve
+const (
+	ReserveOpen      = "open"      // money is held
+	ReservePurchased = "purchased" // money is moved to revenue
+	ReserveReleased  = "released"  // money is returned to user by request
+	ReserveExpired   = "expired"   // money is returned to user after expiry time
+)
+
+// ReservesFilter holds filters and cursor of reserves listing, zero fields mean no filter
+type ReservesFilter struct {
+	UserID    uint64
+	ServiceID uint64
+	Status    string
+	From      *time.Time // reserved at or after
+	To        *time.Time // reserved before
+	After     *ReserveCursor
+	Limit     int
+}
+
+// ReserveCursor is position of the last reserve of page, reserves are ordered by reserve time and order id descending
+type ReserveCursor struct {
+	ReservedAt time.Time
+	OrderID    uint64
+}
+
+type ReserveAmendment struct {
+	PreviousAmount    int64     `json:"previous_amount"` // amount of money stored in minor units of currency
+	Amount            int64     `json:"amount"`          // amount of money stored in minor units of currency
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	AmendedAt         time.Time `json:"amended_at"`
 }
 
 type ReserveFloatAmount struct {
-	OrderID     uint64     `json:"order_id" gorm:"primaryKey;autoIncrement:false"`
-	UserID      uint64     `json:"-"`
-	User        User       `json:"user"`
-	ServiceID   uint64     `json:"-"`
-	Service     Service    `json:"service"`
-	Amount      float32    `json:"amount"`                 // amount of money stored in cents
-	Purchased   bool       `json:"purchased"`              // purchase status
-	ReservedAt  time.Time  `json:"reserved_at"`            // time when reserve happend
-	PurchasedAt *time.Time `json:"purchased_at,omitempty"` // time when purchase happened, could be nullable
+	OrderID      uint64                    `json:"order_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID       uint64                    `json:"-"`
+	User         User                      `json:"user"`
+	ServiceID    uint64                    `json:"-"`
+	Service      PayloadService            `json:"service"`
+	Amount       float32                   `json:"amount"`                 // amount of money stored in cents
+	Currency     string                    `json:"currency"`               // ISO 4217 currency code
+	Purchased    bool                      `json:"purchased"`              // purchase status
+	ReservedAt   time.Time                 `json:"reserved_at"`            // time when reserve happend
+	PurchasedAt  *time.Time                `json:"purchased_at,omitempty"` // time when purchase happened, could be nullable
+	PriceVersion int                       `json:"price_version"`          // version of service price at the moment of reserve
+	ExpiresAt    time.Time                 `json:"expires_at"`             // time when not purchased reserve is released
+	Status       string                    `json:"status"`                 // one of reserve statuses
+	ReleasedAt   *time.Time                `json:"released_at,omitempty"`  // time when reserve was released or expired, could be nullable
+	Amendments   []PayloadReserveAmendment `json:"amendments,omitempty"`
+}
+
+type OrderItem struct {
+	LineNo       int    `json:"line_no"` // number of line in order starting from 1
+	ServiceID    uint64 `json:"service_id"`
+	ServiceName  string `json:"service_name"`
+	Quantity     int64  `json:"quantity"`
+	UnitPrice    int64  `json:"unit_price"`    // price of one unit stored in minor units of currency
+	Amount       int64  `json:"amount"`        // quantity * unit price
+	PriceVersion int    `json:"price_version"` // version of service price at the moment of reserve
+	Captured     bool   `json:"captured"`      // item was captured by purchase, not captured items are released
+}
+
+type Order struct {
+	OrderID     uint64      `json:"order_id"`
+	UserID      uint64      `json:"user_id"`
+	Amount      int64       `json:"amount"` // total amount of items stored in minor units of currency
+	Currency    string      `json:"currency"`
+	Purchased   bool        `json:"purchased"`
+	ReservedAt  time.Time   `json:"reserved_at"`
+	PurchasedAt *time.Time  `json:"purchased_at,omitempty"`
+	ExpiresAt   time.Time   `json:"expires_at"` // time when not purchased order is released
+	Status      string      `json:"status"`     // one of reserve statuses
+	ReleasedAt  *time.Time  `json:"released_at,omitempty"`
+	Items       []OrderItem `json:"items"`
+}
+
+type Period struct {
+	Year     int       `json:"year"`
+	Month    int       `json:"month"`
+	ClosedAt time.Time `json:"closed_at"` // time when period was closed
+}
+
+type Report struct {
+	ID        uint64           `json:"-"`
+	Year      int              `json:"year"`
+	Month     int              `json:"month"`
+	Version   int              `json:"version"`
+	Closing   bool             `json:"closing"`        // report was frozen when the period was closed
+	SHA256    string           `json:"sha256"`         // hex digest of the csv file
+	CreatedAt time.Time        `json:"created_at"`     // time when report version was created
+	Diff      []ReportDiffLine `json:"diff,omitempty"` // changes against the previous version
+}
+
+type ReportDiffLine struct {
+	ServiceName string `json:"service_name"`
+	Currency    string `json:"currency"`
+	Previous    int64  `json:"previous"` // amount of money stored in minor units of currency
+	Current     int64  `json:"current"`  // amount of money stored in minor units of currency
+}
+
+// Kinds of operations
+const (
+	OperationTopUp      = "top_up"
+	OperationPurchase   = "purchase"
+	OperationCorrection = "correction" // correcting entry written by reconciliation
+	OperationConversion = "conversion" // one side of currency conversion
+)
+
+type Operation struct {
+	ID          uint64    `json:"id"`
+	UserID      uint64    `json:"user_id"`
+	ServiceID   *uint64   `json:"service_id,omitempty"`   // nullable for top-ups
+	ServiceName *string   `json:"service_name,omitempty"` // nullable for top-ups
+	Amount      int64     `json:"amount"`                 // amount of money stored in minor units, negative for purchases
+	Currency    string    `json:"currency"`               // ISO 4217 currency code
+	DoneAt      time.Time `json:"done_at"`                // time when operation happened
+	Kind        string    `json:"kind"`                   // one of operation kinds
+	OrderID     *uint64   `json:"order_id,omitempty"`     // order of purchase, nullable for operations other than purchase
+	LineNo      *int      `json:"line_no,omitempty"`      // line item of order the purchase is attributed to, nullable for single service reserves
+	Rate        *string   `json:"rate,omitempty"`         // applied exchange rate, nullable for operations other than conversion
+	Spread      *string   `json:"spread,omitempty"`       // applied spread, nullable for operations other than conversion
+}
+
+type StatementLine struct {
+	Operation
+	RunningBalance int64 `json:"running_balance"` // balance after the operation
+}
+
+type Statement struct {
+	UserID         uint64          `json:"user_id"`
+	Currency       string          `json:"currency"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance int64           `json:"opening_balance"` // sum of operations before From
+	Lines          []StatementLine `json:"lines"`
+	ClosingBalance int64           `json:"closing_balance"` // sum of operations before To
+	Held           int64           `json:"held"`            // money held in reserves not purchased by To
+	Available      int64           `json:"available"`       // closing balance without held money
+	Balance        int64           `json:"balance"`         // current balance stored in wallets table
+	Reconciled     bool            `json:"reconciled"`      // all operations minus currently held money equal balance
+}
+
+type ReserveAgingBucket struct {
+	ServiceID   uint64 `json:"service_id"`
+	ServiceName string `json:"service_name"`
+	Currency    string `json:"currency"`
+	Age         string `json:"age"` // one of <1h, 1-24h, 1-7d, >7d
+	Count       int64  `json:"count"`
+	Amount      int64  `json:"amount"` // amount of money stored in minor units of currency
+}
+
+type ReserveUserTotal struct {
+	UserID   uint64 `json:"user_id"`
+	Currency string `json:"currency"`
+	Count    int64  `json:"count"`
+	Amount   int64  `json:"amount"` // amount of money stored in minor units of currency
+}
+
+type ReserveCurrencyTotal struct {
+	Currency string `json:"currency"`
+	Count    int64  `json:"count"`
+	Amount   int64  `json:"amount"` // amount of money stored in minor units of currency
+}
+
+type ReservesAging struct {
+	Buckets []ReserveAgingBucket   `json:"buckets"` // open reserves grouped by service, currency and age
+	Users   []ReserveUserTotal     `json:"users"`   // open reserves totals per user and currency
+	Stuck   []Reserve              `json:"stuck"`   // open reserves older than expiry timeout
+	Totals  []ReserveCurrencyTotal `json:"totals"`  // open reserves totals per currency
+}
+
+type BalanceMismatch struct {
+	UserID           uint64 `json:"user_id"`
+	Currency         string `json:"currency"`
+	Balance          int64  `json:"balance"`           // balance stored in wallets table
+	Journal          int64  `json:"journal"`           // sum of all operations of user
+	Held             int64  `json:"held"`              // money held in not purchased reserves
+	Difference       int64  `json:"difference"`        // balance - (journal - held)
+	Wallet           int64  `json:"wallet"`            // balance of wallet derived from ledger postings
+	WalletDifference int64  `json:"wallet_difference"` // balance - wallet
+}
+
+type Reconciliation struct {
+	CheckedAt  time.Time         `json:"checked_at"`
+	Wallets    int64             `json:"wallets"` // number of checked wallets
+	Mismatches []BalanceMismatch `json:"mismatches"`
+}
+
+// Snapshot is result of storing end of day balances of all users
+type Snapshot struct {
+	Day       time.Time `json:"day"`
+	Wallets   int64     `json:"wallets"` // number of stored balances
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LiabilitiesLine is money owed to users in one currency at the end of day and its change during the day
+type LiabilitiesLine struct {
+	Day         time.Time `json:"day"`
+	Currency    string    `json:"currency"`
+	Snapshot    bool      `json:"snapshot"`    // snapshot of the day was made
+	Liabilities int64     `json:"liabilities"` // total balances of users by snapshot
+	Held        int64     `json:"held"`        // money held in reserves by snapshot
+	Inflows     int64     `json:"inflows"`     // top-ups
+	Outflows    int64     `json:"outflows"`    // purchases, positive
+	Other       int64     `json:"other"`       // corrections and conversions
+	NetChange   int64     `json:"net_change"`  // inflows - outflows + other
+	Journal     int64     `json:"journal"`     // total balances of users by operations
+	Reconciled  bool      `json:"reconciled"`  // liabilities by snapshot are equal to journal
+}
+
+type LiabilitiesReport struct {
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Lines      []LiabilitiesLine `json:"lines"`
+	Reconciled bool              `json:"reconciled"` // every line is reconciled
+}
+
+// Kinds of ledger accounts
+const (
+	AccountFunding  = "funding"  // system account money comes from
+	AccountWallet   = "wallet"   // money available to user
+	AccountHold     = "hold"     // money of user held in reserves
+	AccountRevenue  = "revenue"  // money earned by service
+	AccountExchange = "exchange" // system account currencies are exchanged through, keeps spread
+)
+
+// Kinds of journal entries
+const (
+	EntryTopUp      = "top_up"
+	EntryReserve    = "reserve"
+	EntryPurchase   = "purchase"
+	EntryRelease    = "release"
+	EntryCorrection = "correction"
+	EntryConversion = "conversion"
+	EntryAmend      = "amend"
+)
+
+type Account struct {
+	ID       uint64 `json:"id"`
+	Kind     string `json:"kind"`     // one of account kinds
+	OwnerID  uint64 `json:"owner_id"` // user id for wallet and hold, service id for revenue, 0 for funding
+	Currency string `json:"currency"`
+	Balance  int64  `json:"balance"` // sum of account postings stored in minor units of currency
+}
+
+type JournalEntry struct {
+	ID        uint64    `json:"id"`
+	Kind      string    `json:"kind"` // one of journal entry kinds
+	UserID    uint64    `json:"user_id"`
+	ServiceID *uint64   `json:"service_id,omitempty"`
+	OrderID   *uint64   `json:"order_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Postings  []Posting `json:"postings"`
+}
+
+type Posting struct {
+	AccountKind string `json:"account_kind"`
+	OwnerID     uint64 `json:"owner_id"`
+	Currency    string `json:"currency"`
+	Amount      int64  `json:"amount"` // amount of money stored in minor units, postings of entry sum to zero in every currency
+}
+
+type ExchangeRate struct {
+	ID        uint64     `json:"id"`
+	Base      string     `json:"base"`               // currency which is sold
+	Quote     string     `json:"quote"`              // currency which is bought
+	Rate      string     `json:"rate"`               // amount of quote currency for one unit of base currency, exact decimal
+	Spread    string     `json:"spread"`             // fraction of converted amount kept by service, exact decimal
+	ValidFrom time.Time  `json:"valid_from"`         // time since rate is valid
+	ValidTo   *time.Time `json:"valid_to,omitempty"` // time until rate is valid, nullable for rates valid until superseded
+	CreatedAt time.Time  `json:"created_at"`         // time when rate was uploaded
+}
+
+type Conversion struct {
+	UserID    uint64    `json:"user_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Amount    int64     `json:"amount"`    // debited amount stored in minor units of from currency
+	Converted int64     `json:"converted"` // credited amount stored in minor units of to currency
+	Rate      string    `json:"rate"`      // applied exchange rate
+	Spread    string    `json:"spread"`    // applied spread
+	DoneAt    time.Time `json:"done_at"`
+}
+
+type RestatedReportLine struct {
+	ServiceName string `json:"service_name"`
+	Currency    string `json:"currency"`  // original currency of revenue
+	Amount      int64  `json:"amount"`    // amount of money stored in minor units of original currency
+	Rate        string `json:"rate"`      // rate used for restatement
+	Converted   int64  `json:"converted"` // amount of money stored in minor units of base currency
+}
+
+type RestatedReport struct {
+	Report
+	Currency string               `json:"currency"` // base currency report is restated in
+	RatesAt  time.Time            `json:"rates_at"` // time rates were taken at
+	Lines    []RestatedReportLine `json:"lines"`
+	Total    int64                `json:"total"` // total revenue stored in minor units of base currency
+}
+
+// Types of webhook events
+const (
+	EventBalanceCredited   = "balance.credited"
+	EventReserveCreated    = "reserve.created"
+	EventReserveExpired    = "reserve.expired"
+	EventPurchaseCompleted = "purchase.completed"
+	EventRefundCreated     = "refund.created" // money of reserve is returned to user by request or after partial purchase
+)
+
+// EventTypes are all types of webhook events
+var EventTypes = []string{EventBalanceCredited, EventReserveCreated, EventReserveExpired, EventPurchaseCompleted, EventRefundCreated}
+
+type WebhookEvent struct {
+	ID        uint64    `json:"id"`
+	Type      string    `json:"type"` // one of event types
+	UserID    uint64    `json:"user_id"`
+	ServiceID *uint64   `json:"service_id,omitempty"`
+	OrderID   *uint64   `json:"order_id,omitempty"`
+	Amount    int64     `json:"amount"` // amount of money stored in minor units of currency
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Webhook struct {
+	ID         uint64     `json:"id"`
+	URL        string     `json:"url"`
+	Secret     string     `json:"secret"`      // key of HMAC-SHA256 signature of deliveries
+	EventTypes []string   `json:"event_types"` // types of events delivered to the webhook
+	Active     bool       `json:"active"`
+	Failures   int        `json:"failures"` // failed deliveries in a row
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"` // time when webhook was disabled after repeated failures, could be nullable
+}
+
+// WebhookUpdate holds changed fields of webhook, nil fields are left unchanged.
+// Enabled webhook starts counting failed deliveries anew
+type WebhookUpdate struct {
+	ID         uint64
+	URL        *string
+	EventTypes []string
+	Active     *bool
+}
+
+// Statuses of webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // attempts are exhausted or webhook was disabled
+)
+
+type WebhookDelivery struct {
+	ID            uint64           `json:"id"`
+	WebhookID     uint64           `json:"webhook_id"`
+	URL           string           `json:"-"`
+	Secret        string           `json:"-"`
+	Event         WebhookEvent     `json:"event"`
+	Status        string           `json:"status"` // one of delivery statuses
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt time.Time        `json:"next_attempt_at"`
+	DeliveredAt   *time.Time       `json:"delivered_at,omitempty"`
+	History       []WebhookAttempt `json:"history,omitempty"`
+}
+
+type WebhookAttempt struct {
+	DeliveryID  uint64        `json:"-"`
+	AttemptedAt time.Time     `json:"attempted_at"`
+	StatusCode  *int          `json:"status_code,omitempty"` // nullable if response was not received
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// Types of outbox events and current versions of their schemas
+const (
+	OutboxMoneyMovement        = "money_movement"
+	OutboxMoneyMovementVersion = 1
+)
+
+type OutboxMessage struct {
+	ID        uint64    `json:"id"`
+	UserID    uint64    `json:"user_id"`
+	Type      string    `json:"type"`    // one of outbox event types
+	Version   int       `json:"version"` // version of event schema
+	Payload   []byte    `json:"payload"` // event in JSON
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MoneyMovementV1 is schema of money_movement event version 1. Schema is not changed once published,
+// changes are published as a new version
+type MoneyMovementV1 struct {
+	EntryID   uint64    `json:"entry_id"`
+	Kind      string    `json:"kind"` // one of journal entry kinds
+	UserID    uint64    `json:"user_id"`
+	ServiceID *uint64   `json:"service_id,omitempty"`
+	OrderID   *uint64   `json:"order_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Postings  []Posting `json:"postings"`
+}
+
+// UserEvent is money movement of user streamed to his clients with changes of his balances
+type UserEvent struct {
+	ID            uint64          `json:"id"` // id of outbox message, events of user are ordered by it
+	Kind          string          `json:"kind"`
+	ServiceID     *uint64         `json:"service_id,omitempty"`
+	OrderID       *uint64         `json:"order_id,omitempty"`
+	ReserveStatus string          `json:"reserve_status,omitempty"` // status of reserve after movement, empty if movement has no reserve
+	CreatedAt     time.Time       `json:"created_at"`
+	Changes       []BalanceChange `json:"changes"`
+}
+
+type BalanceChange struct {
+	Currency  string `json:"currency"`
+	Available int64  `json:"available"` // change of available money in minor units
+	Held      int64  `json:"held"`      // change of held money in minor units
+}
+
+// Types of batch operations
+const (
+	BatchCredit   = "credit"   // adds money to user
+	BatchReserve  = "reserve"  // reserves money of user for order
+	BatchPurchase = "purchase" // purchases reserve of order
+	BatchRelease  = "release"  // returns money of reserve to user
+)
+
+// Statuses of batch operations
+const (
+	BatchApplied = "applied"
+	BatchFailed  = "failed"
+	BatchSkipped = "skipped" // operation was not applied as another operation of atomic batch failed
+)
+
+type BatchOperation struct {
+	Type      string // one of batch operation types
+	UserID    uint64
+	ServiceID uint64
+	OrderID   uint64
+	Amount    int64  // amount of money in minor units
+	Currency  string // empty currency of reserve and purchase is taken from service and reserve
+}
+
+type BatchResult struct {
+	Status  string   // one of batch operation statuses
+	Code    string   // code of error of failed operation
+	Error   string   // error of failed operation
+	Reserve *Reserve // reserve created by reserve operation
+}
+
+// Statuses of imports
+const (
+	ImportPending   = "pending"   // some rows are not applied yet, import could be resumed
+	ImportCompleted = "completed" // every row is applied or failed
+)
+
+// Statuses of rows of imports
+const (
+	ImportRowPending = "pending"
+	ImportRowApplied = "applied"
+	ImportRowInvalid = "invalid" // row is not valid, credit is not applied
+	ImportRowFailed  = "failed"  // credit of row is failed
+)
+
+type Import struct {
+	ID          uint64     `json:"id"`
+	FileName    string     `json:"file_name"`
+	SHA256      string     `json:"sha256"` // checksum of file, the same file cannot be imported twice
+	Currency    string     `json:"currency"`
+	Status      string     `json:"status"` // one of import statuses
+	Rows        int        `json:"rows"`
+	Pending     int        `json:"pending"`
+	Applied     int        `json:"applied"`
+	Invalid     int        `json:"invalid"`
+	Failed      int        `json:"failed"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+type ImportRow struct {
+	Line        int    `json:"line"`    // line of row in file
+	UserID      uint64 `json:"user_id"` // zero for invalid row
+	Amount      int64  `json:"amount"`  // amount of money stored in minor units, zero for invalid row
+	ExternalRef string `json:"external_ref,omitempty"`
+	Status      string `json:"status"` // one of import row statuses
+	Error       string `json:"error,omitempty"`
+}
+
+// Roles of API keys
+const (
+	RoleReadOnly      = "read-only"      // reads balances, reserves, orders, services and reports
+	RoleBillingClient = "billing-client" // reads and moves money of users: credits, reserves, purchases and releases
+	RoleFinance       = "finance"        // reads, credits, imports, reports, periods, rates and reconciliation
+	RoleAdmin         = "admin"          // everything including users, services, webhooks and keys
+)
+
+// Roles are all roles of API keys
+var Roles = []string{RoleReadOnly, RoleBillingClient, RoleFinance, RoleAdmin}
+
+// APIKey is key of API client, the key itself is not stored, only its SHA-256 hash
+type APIKey struct {
+	ID        uint64     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"` // beginning of key to recognize it
+	Hash      string     `json:"-"`
+	Role      string     `json:"role"`     // one of roles
+	Services  []uint64   `json:"services"` // services the key operates on, empty for all services
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // set when key is rotated, the old key works until then
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RotatedTo *uint64    `json:"rotated_to,omitempty"` // key which replaced this one
+}
+
+// Principal is authenticated caller of API by API key or bearer token
+type Principal struct {
+	KeyID    uint64   // API key of caller, zero for token
+	Subject  string   // name of API key or subject of token
+	Scopes   []string // operations the caller is allowed
+	Services []uint64 // services the caller operates on, empty for all services
+	UserID   uint64   // user the end-user token is restricted to, zero for all users
+}
+
+// SigningSecret is secret of API key for HMAC-SHA256 signatures of money moving requests,
+// requests of key with active secret must be signed by one of them
+type SigningSecret struct {
+	ID        uint64     `json:"id"`
+	APIKeyID  uint64     `json:"api_key_id"`
+	Secret    string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // set when secret is rotated, the old secret works until then
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
 }
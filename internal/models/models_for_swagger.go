@@ -1,14 +1,26 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Payloads for correct swagger generation
 
 type PayloadId struct {
-	ID uint64 `json:"id"`
+	ID uint64 `params:"id" json:"id"`
+}
+
+type PayloadGetBalance struct {
+	ID        uint64 `params:"id" json:"id"`
+	Currency  string `query:"currency" json:"currency,omitempty"`
+	ByService bool   `query:"by_service" json:"by_service,omitempty"`
 }
 
 type PayloadAddBalance struct {
-	ID     uint64  `json:"id"`
-	Amount float32 `json:"amount"`
+	ID       uint64  `params:"id" json:"id"`
+	Amount   float32 `json:"amount"`
+	Currency string  `json:"currency,omitempty"`
 }
 
 type PayloadDate struct {
@@ -20,17 +32,545 @@ type PayloadErr struct {
 	Message string `json:"message"`
 }
 
+// PayloadEnvelope is response of v2 API, data is response of the endpoint, error is set instead of data on failure
+type PayloadEnvelope struct {
+	Data  interface{} `json:"data"`
+	Error *PayloadErr `json:"error,omitempty"`
+}
+
 type PayloadBalance struct {
-	Balance float32 `json:"balance"`
+	Balance   float32              `json:"balance"`
+	Currency  string               `json:"currency"`
+	Available float32              `json:"available"`
+	Held      float32              `json:"held"`
+	Total     float32              `json:"total"`
+	Services  []PayloadServiceHeld `json:"services,omitempty"`
+	Balances  []PayloadWallet      `json:"balances"`
+}
+
+type PayloadWallet struct {
+	Currency string               `json:"currency"`
+	Balance  float32              `json:"balance"`
+	Held     float32              `json:"held"`
+	Total    float32              `json:"total"`
+	Services []PayloadServiceHeld `json:"services,omitempty"`
+}
+
+type PayloadBalanceAtQuery struct {
+	ID uint64 `params:"id"`
+	At string `query:"at"`
+}
+
+type PayloadEndOfDayQuery struct {
+	UserIDs []uint64 `json:"user_ids"`
+	Date    string   `json:"date"`
+}
+
+type PayloadBalanceAt struct {
+	UserID   uint64               `json:"user_id"`
+	At       time.Time            `json:"at"`
+	Balances []PayloadWallet      `json:"balances"`
+	Reserves []PayloadOpenReserve `json:"reserves,omitempty"`
+}
+
+type PayloadServiceHeld struct {
+	ServiceID   uint64  `json:"service_id"`
+	ServiceName string  `json:"service_name"`
+	Held        float32 `json:"held"`
 }
 
 type PayloadReserve struct {
+	UserID    uint64  `query:"user_id" json:"user_id"`
+	ServiceID uint64  `query:"service_id" json:"service_id"`
+	OrderID   uint64  `params:"id" json:"order_id"`
+	Amount    float32 `json:"amount,omitempty"`
+	Currency  string  `json:"currency,omitempty"`
+}
+
+type PayloadAmendReserve struct {
 	UserID    uint64  `json:"user_id"`
 	ServiceID uint64  `json:"service_id"`
-	OrderID   uint64  `json:"order_id"`
-	Amount    float32 `json:"amount,omitempty"`
+	OrderID   uint64  `params:"id" json:"order_id"`
+	Amount    float32 `json:"amount,omitempty"` // new amount in currency of the reserve
+	Extend    string  `json:"extend,omitempty"`
+}
+
+type PayloadReserveAmendment struct {
+	PreviousAmount    float32   `json:"previous_amount"`
+	Amount            float32   `json:"amount"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	AmendedAt         time.Time `json:"amended_at"`
 }
 
 type PayloadLink struct {
 	Balance float32 `json:"report_link"`
 }
+
+type PayloadReportVersion struct {
+	Year    int `params:"year"`
+	Month   int `params:"month"`
+	Version int `params:"version"`
+}
+
+type PayloadReport struct {
+	ReportLink string                  `json:"report_link"`
+	DiffLink   string                  `json:"diff_link,omitempty"`
+	Version    int                     `json:"version"`
+	Closing    bool                    `json:"closing"`
+	SHA256     string                  `json:"sha256"`
+	CreatedAt  time.Time               `json:"created_at"`
+	Diff       []PayloadReportDiffLine `json:"diff,omitempty"`
+}
+
+type PayloadReportDiffLine struct {
+	ServiceName string  `json:"service_name"`
+	Currency    string  `json:"currency"`
+	Previous    float32 `json:"previous"`
+	Current     float32 `json:"current"`
+}
+
+type PayloadStatementQuery struct {
+	ID       uint64 `params:"id"`
+	Currency string `query:"currency"`
+	From     string `query:"from"`
+	To       string `query:"to"`
+	Format   string `query:"format"`
+}
+
+type PayloadStatement struct {
+	UserID         uint64                 `json:"user_id"`
+	Currency       string                 `json:"currency"`
+	From           time.Time              `json:"from"`
+	To             time.Time              `json:"to"`
+	OpeningBalance float32                `json:"opening_balance"`
+	Lines          []PayloadStatementLine `json:"lines"`
+	ClosingBalance float32                `json:"closing_balance"`
+	Held           float32                `json:"held"`
+	Available      float32                `json:"available"`
+	Balance        float32                `json:"balance"`
+	Reconciled     bool                   `json:"reconciled"`
+}
+
+type PayloadStatementLine struct {
+	ID             uint64    `json:"id"`
+	ServiceID      *uint64   `json:"service_id,omitempty"`
+	ServiceName    *string   `json:"service_name,omitempty"`
+	Amount         float32   `json:"amount"`
+	RunningBalance float32   `json:"running_balance"`
+	DoneAt         time.Time `json:"done_at"`
+	Kind           string    `json:"kind"`
+	Rate           *string   `json:"rate,omitempty"`
+	Spread         *string   `json:"spread,omitempty"`
+}
+
+type PayloadReservesFilter struct {
+	UserID    uint64 `query:"user_id"`
+	ServiceID uint64 `query:"service_id"`
+}
+
+type PayloadReservesQuery struct {
+	UserID    uint64 `query:"user_id"`
+	ServiceID uint64 `query:"service_id"`
+	Status    string `query:"status"`
+	From      string `query:"from"`
+	To        string `query:"to"`
+	Cursor    string `query:"cursor"`
+	Limit     int    `query:"limit"`
+}
+
+type PayloadReserves struct {
+	Reserves   []ReserveFloatAmount `json:"reserves"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+type PayloadReservesAging struct {
+	Buckets []PayloadReserveAgingBucket   `json:"buckets"`
+	Users   []PayloadReserveUserTotal     `json:"users"`
+	Stuck   []PayloadOpenReserve          `json:"stuck"`
+	Totals  []PayloadReserveCurrencyTotal `json:"totals"`
+}
+
+type PayloadReserveCurrencyTotal struct {
+	Currency string  `json:"currency"`
+	Count    int64   `json:"count"`
+	Amount   float32 `json:"amount"`
+}
+
+type PayloadReserveAgingBucket struct {
+	ServiceID   uint64  `json:"service_id"`
+	ServiceName string  `json:"service_name"`
+	Currency    string  `json:"currency"`
+	Age         string  `json:"age"`
+	Count       int64   `json:"count"`
+	Amount      float32 `json:"amount"`
+}
+
+type PayloadReserveUserTotal struct {
+	UserID   uint64  `json:"user_id"`
+	Currency string  `json:"currency"`
+	Count    int64   `json:"count"`
+	Amount   float32 `json:"amount"`
+}
+
+type PayloadOpenReserve struct {
+	OrderID    uint64    `json:"order_id"`
+	UserID     uint64    `json:"user_id"`
+	ServiceID  uint64    `json:"service_id"`
+	Amount     float32   `json:"amount"`
+	Currency   string    `json:"currency"`
+	ReservedAt time.Time `json:"reserved_at"`
+}
+
+type PayloadReconciliation struct {
+	CheckedAt  time.Time                `json:"checked_at"`
+	Wallets    int64                    `json:"wallets"`
+	Mismatches []PayloadBalanceMismatch `json:"mismatches"`
+}
+
+type PayloadBalanceMismatch struct {
+	UserID           uint64  `json:"user_id"`
+	Currency         string  `json:"currency"`
+	Balance          float32 `json:"balance"`
+	Journal          float32 `json:"journal"`
+	Held             float32 `json:"held"`
+	Difference       float32 `json:"difference"`
+	Wallet           float32 `json:"wallet"`
+	WalletDifference float32 `json:"wallet_difference"`
+}
+
+type PayloadAccount struct {
+	ID       uint64  `json:"id"`
+	Kind     string  `json:"kind"`
+	Currency string  `json:"currency"`
+	Balance  float32 `json:"balance"`
+}
+
+type PayloadExchangeRate struct {
+	Base      string      `json:"base"`
+	Quote     string      `json:"quote"`
+	Rate      json.Number `json:"rate" swaggertype:"number"`
+	Spread    json.Number `json:"spread,omitempty" swaggertype:"number"`
+	ValidFrom time.Time   `json:"valid_from"`
+	ValidTo   *time.Time  `json:"valid_to,omitempty"`
+}
+
+type PayloadRateQuery struct {
+	Base  string `query:"base"`
+	Quote string `query:"quote"`
+	At    string `query:"at"`
+}
+
+type PayloadConvert struct {
+	UserID uint64  `json:"user_id"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float32 `json:"amount"`
+}
+
+type PayloadConversion struct {
+	UserID    uint64    `json:"user_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Amount    float32   `json:"amount"`
+	Converted float32   `json:"converted"`
+	Rate      string    `json:"rate"`
+	Spread    string    `json:"spread"`
+	DoneAt    time.Time `json:"done_at"`
+}
+
+type PayloadRestatedQuery struct {
+	Year     int    `params:"year"`
+	Month    int    `params:"month"`
+	Currency string `query:"currency"`
+}
+
+type PayloadRestatedReport struct {
+	Year     int                         `json:"year"`
+	Month    int                         `json:"month"`
+	Version  int                         `json:"version"`
+	Currency string                      `json:"currency"`
+	RatesAt  time.Time                   `json:"rates_at"`
+	Lines    []PayloadRestatedReportLine `json:"lines"`
+	Total    float32                     `json:"total"`
+}
+
+type PayloadRestatedReportLine struct {
+	ServiceName string  `json:"service_name"`
+	Currency    string  `json:"currency"`
+	Amount      float32 `json:"amount"`
+	Rate        string  `json:"rate"`
+	Converted   float32 `json:"converted"`
+}
+
+type PayloadService struct {
+	ID           uint64   `params:"id" json:"id"`
+	Name         string   `json:"name,omitempty"`
+	Currency     string   `json:"currency,omitempty"`
+	Active       *bool    `json:"active,omitempty"`
+	PriceVersion int      `json:"price_version,omitempty"`
+	Price        *float32 `json:"price,omitempty"`
+	MinAmount    *float32 `json:"min_amount,omitempty"`
+	MaxAmount    *float32 `json:"max_amount,omitempty"`
+}
+
+type PayloadServicePrice struct {
+	Version   int       `json:"version"`
+	Price     *float32  `json:"price,omitempty"`
+	MinAmount *float32  `json:"min_amount,omitempty"`
+	MaxAmount *float32  `json:"max_amount,omitempty"`
+	ValidFrom time.Time `json:"valid_from"`
+}
+
+type PayloadServicesQuery struct {
+	Name   string `query:"name"`
+	Active string `query:"active"`
+	Limit  int    `query:"limit"`
+	Offset int    `query:"offset"`
+}
+
+type PayloadServices struct {
+	Services []PayloadService `json:"services"`
+	Total    int64            `json:"total"`
+	Limit    int              `json:"limit"`
+	Offset   int              `json:"offset"`
+}
+
+type PayloadOrderItem struct {
+	ServiceID uint64  `json:"service_id"`
+	Quantity  int64   `json:"quantity"`
+	UnitPrice float32 `json:"unit_price,omitempty"`
+}
+
+type PayloadReserveOrder struct {
+	UserID   uint64             `json:"user_id"`
+	OrderID  uint64             `json:"order_id"`
+	Currency string             `json:"currency,omitempty"`
+	Items    []PayloadOrderItem `json:"items"`
+}
+
+type PayloadOrderQuery struct {
+	ID     uint64 `params:"id" json:"-"`
+	UserID uint64 `query:"user_id" json:"user_id"`
+	Lines  []int  `json:"lines,omitempty"`
+}
+
+type PayloadOrder struct {
+	OrderID     uint64             `json:"order_id"`
+	UserID      uint64             `json:"user_id"`
+	Amount      float32            `json:"amount"`
+	Currency    string             `json:"currency"`
+	Purchased   bool               `json:"purchased"`
+	ReservedAt  time.Time          `json:"reserved_at"`
+	PurchasedAt *time.Time         `json:"purchased_at,omitempty"`
+	ExpiresAt   time.Time          `json:"expires_at"`
+	Status      string             `json:"status"`
+	ReleasedAt  *time.Time         `json:"released_at,omitempty"`
+	Items       []PayloadOrderLine `json:"items"`
+}
+
+type PayloadOrderLine struct {
+	LineNo       int     `json:"line_no"`
+	ServiceID    uint64  `json:"service_id"`
+	ServiceName  string  `json:"service_name"`
+	Quantity     int64   `json:"quantity"`
+	UnitPrice    float32 `json:"unit_price"`
+	Amount       float32 `json:"amount"`
+	PriceVersion int     `json:"price_version"`
+	Captured     bool    `json:"captured"`
+}
+
+type PayloadSnapshotQuery struct {
+	Date string `params:"date"`
+}
+
+type PayloadSnapshot struct {
+	Day       string    `json:"day"`
+	Wallets   int64     `json:"wallets"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PayloadLiabilitiesQuery struct {
+	From string `query:"from"`
+	To   string `query:"to"`
+}
+
+type PayloadLiabilities struct {
+	From       string                   `json:"from"`
+	To         string                   `json:"to"`
+	Lines      []PayloadLiabilitiesLine `json:"lines"`
+	Reconciled bool                     `json:"reconciled"`
+}
+
+type PayloadLiabilitiesLine struct {
+	Day         string  `json:"day"`
+	Currency    string  `json:"currency"`
+	Snapshot    bool    `json:"snapshot"`
+	Liabilities float32 `json:"liabilities"`
+	Held        float32 `json:"held"`
+	Inflows     float32 `json:"inflows"`
+	Outflows    float32 `json:"outflows"`
+	Other       float32 `json:"other"`
+	NetChange   float32 `json:"net_change"`
+	Journal     float32 `json:"journal"`
+	Reconciled  bool    `json:"reconciled"`
+}
+
+// PayloadWebhookEvent is body of request sent to webhook
+type PayloadWebhookEvent struct {
+	ID        uint64                  `json:"id"`
+	Type      string                  `json:"type"`
+	CreatedAt time.Time               `json:"created_at"`
+	Data      PayloadWebhookEventData `json:"data"`
+}
+
+type PayloadWebhookEventData struct {
+	UserID    uint64  `json:"user_id"`
+	ServiceID *uint64 `json:"service_id,omitempty"`
+	OrderID   *uint64 `json:"order_id,omitempty"`
+	Amount    float32 `json:"amount"`
+	Currency  string  `json:"currency"`
+}
+
+type PayloadCreateWebhook struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret,omitempty"` // generated if omitted
+}
+
+type PayloadUpdateWebhook struct {
+	ID         uint64   `params:"id" json:"-"`
+	URL        *string  `json:"url,omitempty"`
+	EventTypes []string `json:"event_types,omitempty"`
+	Active     *bool    `json:"active,omitempty"`
+}
+
+type PayloadWebhook struct {
+	ID         uint64     `json:"id"`
+	URL        string     `json:"url"`
+	Secret     string     `json:"secret,omitempty"` // returned only when webhook is created
+	EventTypes []string   `json:"event_types"`
+	Active     bool       `json:"active"`
+	Failures   int        `json:"failures"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+type PayloadWebhookDeliveriesQuery struct {
+	ID    uint64 `params:"id"`
+	Limit int    `query:"limit"`
+}
+
+type PayloadWebhookDelivery struct {
+	ID            uint64                  `json:"id"`
+	Event         PayloadWebhookEvent     `json:"event"`
+	Status        string                  `json:"status"`
+	Attempts      int                     `json:"attempts"`
+	NextAttemptAt time.Time               `json:"next_attempt_at"`
+	DeliveredAt   *time.Time              `json:"delivered_at,omitempty"`
+	History       []PayloadWebhookAttempt `json:"history,omitempty"`
+}
+
+type PayloadWebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  *int      `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+type PayloadStreamQuery struct {
+	ID          uint64  `params:"id"`
+	LastEventID *uint64 `query:"last_event_id"`
+}
+
+type PayloadStreamBalances struct {
+	Balances []PayloadWallet `json:"balances"`
+}
+
+type PayloadStreamMovement struct {
+	ID            uint64                 `json:"id"`
+	Kind          string                 `json:"kind"`
+	ServiceID     *uint64                `json:"service_id,omitempty"`
+	OrderID       *uint64                `json:"order_id,omitempty"`
+	ReserveStatus string                 `json:"reserve_status,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Changes       []PayloadBalanceChange `json:"changes"`
+}
+
+type PayloadBalanceChange struct {
+	Currency  string  `json:"currency"`
+	Available float32 `json:"available"`
+	Held      float32 `json:"held"`
+}
+
+type PayloadBatch struct {
+	Atomic     bool                    `json:"atomic"` // all operations are applied or none
+	Operations []PayloadBatchOperation `json:"operations"`
+}
+
+type PayloadBatchOperation struct {
+	Type      string  `json:"type"` // credit, reserve, purchase or release
+	UserID    uint64  `json:"user_id"`
+	ServiceID uint64  `json:"service_id,omitempty"`
+	OrderID   uint64  `json:"order_id,omitempty"`
+	Amount    float32 `json:"amount,omitempty"`
+	Currency  string  `json:"currency,omitempty"`
+}
+
+type PayloadBatchResult struct {
+	Applied int                      `json:"applied"`
+	Failed  int                      `json:"failed"`
+	Skipped int                      `json:"skipped"`
+	Results []PayloadBatchItemResult `json:"results"`
+}
+
+type PayloadBatchItemResult struct {
+	Index   int                 `json:"index"`
+	Status  string              `json:"status"`         // applied, failed or skipped
+	Code    string              `json:"code,omitempty"` // NOT_FOUND, FAILED_PRECONDITION, INVALID_ARGUMENT, ALREADY_EXISTS, ABORTED or INTERNAL
+	Error   string              `json:"error,omitempty"`
+	Reserve *ReserveFloatAmount `json:"reserve,omitempty"`
+}
+
+type PayloadCreateAPIKey struct {
+	Name     string   `json:"name"`
+	Role     string   `json:"role"`               // read-only, billing-client, finance or admin
+	Services []uint64 `json:"services,omitempty"` // services the key operates on, all services if omitted
+}
+
+type PayloadRotateAPIKey struct {
+	ID          uint64 `params:"id" json:"-"`
+	GracePeriod string `json:"grace_period,omitempty"` // time the old key keeps working, 24h by default
+}
+
+type PayloadAPIKey struct {
+	ID        uint64     `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"` // returned only when key is created or rotated
+	Prefix    string     `json:"prefix"`
+	Role      string     `json:"role"`
+	Services  []uint64   `json:"services"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RotatedTo *uint64    `json:"rotated_to,omitempty"`
+}
+
+type PayloadCreateSigningSecret struct {
+	ID          uint64 `params:"id" json:"-"`
+	GracePeriod string `json:"grace_period,omitempty"` // time the former secrets keep working, 24h by default
+}
+
+type PayloadSigningSecretId struct {
+	ID       uint64 `params:"id"`
+	SecretID uint64 `params:"secret_id"`
+}
+
+type PayloadSigningSecret struct {
+	ID        uint64     `json:"id"`
+	APIKeyID  uint64     `json:"api_key_id"`
+	Secret    string     `json:"secret,omitempty"` // returned only when secret is created
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
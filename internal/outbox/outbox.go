@@ -0,0 +1,107 @@
+package outbox
+
+import (
+	"balance/internal/models"
+
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+const (
+	// StreamName is name of JetStream stream with events of balance
+	StreamName = "BALANCE"
+	// SchemaHeader is header with type and version of event schema, e.g. money_movement.v1
+	SchemaHeader = "Balance-Schema"
+	// duplicatesWindow is time during which stream drops messages with the same id
+	duplicatesWindow = 10 * time.Minute
+)
+
+// Publisher publishes outbox messages to message broker
+type Publisher interface {
+	Publish(message models.OutboxMessage) error
+	Close()
+}
+
+// Schema returns type and version of message schema, e.g. money_movement.v1
+func Schema(message models.OutboxMessage) string {
+	return fmt.Sprintf("%s.v%d", message.Type, message.Version)
+}
+
+// Subject returns subject of message, e.g. balance.money_movement.v1.42 for user 42,
+// consumers keep per-user order by subscribing to subjects of users
+func Subject(message models.OutboxMessage) string {
+	return fmt.Sprintf("balance.%s.%d", Schema(message), message.UserID)
+}
+
+// NATSPublisher publishes messages to JetStream stream, id of outbox message is id of broker message,
+// so stream drops messages published again
+type NATSPublisher struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+// NewNATSPublisher connects to NATS server and creates stream if it doesn't exist
+func NewNATSPublisher(url string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("outbox: connect to nats: %v", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("outbox: jetstream: %v", err)
+	}
+
+	_, err = js.StreamInfo(StreamName)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:       StreamName,
+			Subjects:   []string{"balance.>"},
+			Storage:    nats.FileStorage,
+			Duplicates: duplicatesWindow,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("outbox: stream %s: %v", StreamName, err)
+	}
+
+	return &NATSPublisher{conn: conn, js: js}, nil
+}
+
+// Publish publishes message and waits for its acknowledgement by stream
+func (p *NATSPublisher) Publish(message models.OutboxMessage) error {
+	msg := nats.NewMsg(Subject(message))
+	msg.Data = message.Payload
+	msg.Header.Set(nats.MsgIdHdr, strconv.FormatUint(message.ID, 10))
+	msg.Header.Set(SchemaHeader, Schema(message))
+	_, err := p.js.PublishMsg(msg)
+	return err
+}
+
+// Close drains connection to NATS server
+func (p *NATSPublisher) Close() {
+	_ = p.conn.Drain()
+}
+
+// LogPublisher is stand-in of message broker for local runs, it writes messages to log
+type LogPublisher struct {
+	Logger *zap.Logger
+}
+
+// Publish writes message to log
+func (p LogPublisher) Publish(message models.OutboxMessage) error {
+	p.Logger.Info("outbox: message",
+		zap.Uint64("id", message.ID),
+		zap.String("subject", Subject(message)),
+		zap.ByteString("payload", message.Payload))
+	return nil
+}
+
+// Close does nothing
+func (p LogPublisher) Close() {}
@@ -0,0 +1,487 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: balance/v1/balance.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BalanceServiceClient is the client API for BalanceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BalanceServiceClient interface {
+	// GetBalance returns available, held and total money of user in every currency
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error)
+	// AddBalance credits wallet of user, the user is created on the first credit
+	AddBalance(ctx context.Context, in *AddBalanceRequest, opts ...grpc.CallOption) (*AddBalanceResponse, error)
+	// CreateReserve holds money of user for order
+	CreateReserve(ctx context.Context, in *CreateReserveRequest, opts ...grpc.CallOption) (*Reserve, error)
+	// GetReserve returns reserve with its status and history of amendments
+	GetReserve(ctx context.Context, in *GetReserveRequest, opts ...grpc.CallOption) (*Reserve, error)
+	// AmendReserve changes reserved amount and extends expiry time of open reserve
+	AmendReserve(ctx context.Context, in *AmendReserveRequest, opts ...grpc.CallOption) (*Reserve, error)
+	// ReleaseReserve returns reserved money to user, the reserve is kept with released status
+	ReleaseReserve(ctx context.Context, in *ReleaseReserveRequest, opts ...grpc.CallOption) (*ReleaseReserveResponse, error)
+	// Purchase moves reserved money to revenue
+	Purchase(ctx context.Context, in *PurchaseRequest, opts ...grpc.CallOption) (*PurchaseResponse, error)
+	// GetService returns service with its current price
+	GetService(ctx context.Context, in *GetServiceRequest, opts ...grpc.CallOption) (*Service, error)
+	// ListServices returns page of services ordered by id
+	ListServices(ctx context.Context, in *ListServicesRequest, opts ...grpc.CallOption) (*ListServicesResponse, error)
+	// CreateReport creates a new version of monthly csv report
+	CreateReport(ctx context.Context, in *CreateReportRequest, opts ...grpc.CallOption) (*Report, error)
+	// ListReports returns all versions of monthly report
+	ListReports(ctx context.Context, in *ListReportsRequest, opts ...grpc.CallOption) (*ListReportsResponse, error)
+}
+
+type balanceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBalanceServiceClient(cc grpc.ClientConnInterface) BalanceServiceClient {
+	return &balanceServiceClient{cc}
+}
+
+func (c *balanceServiceClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error) {
+	out := new(GetBalanceResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/GetBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) AddBalance(ctx context.Context, in *AddBalanceRequest, opts ...grpc.CallOption) (*AddBalanceResponse, error) {
+	out := new(AddBalanceResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/AddBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) CreateReserve(ctx context.Context, in *CreateReserveRequest, opts ...grpc.CallOption) (*Reserve, error) {
+	out := new(Reserve)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/CreateReserve", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) GetReserve(ctx context.Context, in *GetReserveRequest, opts ...grpc.CallOption) (*Reserve, error) {
+	out := new(Reserve)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/GetReserve", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) AmendReserve(ctx context.Context, in *AmendReserveRequest, opts ...grpc.CallOption) (*Reserve, error) {
+	out := new(Reserve)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/AmendReserve", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) ReleaseReserve(ctx context.Context, in *ReleaseReserveRequest, opts ...grpc.CallOption) (*ReleaseReserveResponse, error) {
+	out := new(ReleaseReserveResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/ReleaseReserve", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) Purchase(ctx context.Context, in *PurchaseRequest, opts ...grpc.CallOption) (*PurchaseResponse, error) {
+	out := new(PurchaseResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/Purchase", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) GetService(ctx context.Context, in *GetServiceRequest, opts ...grpc.CallOption) (*Service, error) {
+	out := new(Service)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/GetService", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) ListServices(ctx context.Context, in *ListServicesRequest, opts ...grpc.CallOption) (*ListServicesResponse, error) {
+	out := new(ListServicesResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/ListServices", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) CreateReport(ctx context.Context, in *CreateReportRequest, opts ...grpc.CallOption) (*Report, error) {
+	out := new(Report)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/CreateReport", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) ListReports(ctx context.Context, in *ListReportsRequest, opts ...grpc.CallOption) (*ListReportsResponse, error) {
+	out := new(ListReportsResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/ListReports", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BalanceServiceServer is the server API for BalanceService service.
+// All implementations must embed UnimplementedBalanceServiceServer
+// for forward compatibility
+type BalanceServiceServer interface {
+	// GetBalance returns available, held and total money of user in every currency
+	GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error)
+	// AddBalance credits wallet of user, the user is created on the first credit
+	AddBalance(context.Context, *AddBalanceRequest) (*AddBalanceResponse, error)
+	// CreateReserve holds money of user for order
+	CreateReserve(context.Context, *CreateReserveRequest) (*Reserve, error)
+	// GetReserve returns reserve with its status and history of amendments
+	GetReserve(context.Context, *GetReserveRequest) (*Reserve, error)
+	// AmendReserve changes reserved amount and extends expiry time of open reserve
+	AmendReserve(context.Context, *AmendReserveRequest) (*Reserve, error)
+	// ReleaseReserve returns reserved money to user, the reserve is kept with released status
+	ReleaseReserve(context.Context, *ReleaseReserveRequest) (*ReleaseReserveResponse, error)
+	// Purchase moves reserved money to revenue
+	Purchase(context.Context, *PurchaseRequest) (*PurchaseResponse, error)
+	// GetService returns service with its current price
+	GetService(context.Context, *GetServiceRequest) (*Service, error)
+	// ListServices returns page of services ordered by id
+	ListServices(context.Context, *ListServicesRequest) (*ListServicesResponse, error)
+	// CreateReport creates a new version of monthly csv report
+	CreateReport(context.Context, *CreateReportRequest) (*Report, error)
+	// ListReports returns all versions of monthly report
+	ListReports(context.Context, *ListReportsRequest) (*ListReportsResponse, error)
+	mustEmbedUnimplementedBalanceServiceServer()
+}
+
+// UnimplementedBalanceServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedBalanceServiceServer struct {
+}
+
+func (UnimplementedBalanceServiceServer) GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedBalanceServiceServer) AddBalance(context.Context, *AddBalanceRequest) (*AddBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddBalance not implemented")
+}
+func (UnimplementedBalanceServiceServer) CreateReserve(context.Context, *CreateReserveRequest) (*Reserve, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateReserve not implemented")
+}
+func (UnimplementedBalanceServiceServer) GetReserve(context.Context, *GetReserveRequest) (*Reserve, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReserve not implemented")
+}
+func (UnimplementedBalanceServiceServer) AmendReserve(context.Context, *AmendReserveRequest) (*Reserve, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AmendReserve not implemented")
+}
+func (UnimplementedBalanceServiceServer) ReleaseReserve(context.Context, *ReleaseReserveRequest) (*ReleaseReserveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseReserve not implemented")
+}
+func (UnimplementedBalanceServiceServer) Purchase(context.Context, *PurchaseRequest) (*PurchaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purchase not implemented")
+}
+func (UnimplementedBalanceServiceServer) GetService(context.Context, *GetServiceRequest) (*Service, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetService not implemented")
+}
+func (UnimplementedBalanceServiceServer) ListServices(context.Context, *ListServicesRequest) (*ListServicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListServices not implemented")
+}
+func (UnimplementedBalanceServiceServer) CreateReport(context.Context, *CreateReportRequest) (*Report, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateReport not implemented")
+}
+func (UnimplementedBalanceServiceServer) ListReports(context.Context, *ListReportsRequest) (*ListReportsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListReports not implemented")
+}
+func (UnimplementedBalanceServiceServer) mustEmbedUnimplementedBalanceServiceServer() {}
+
+// UnsafeBalanceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BalanceServiceServer will
+// result in compilation errors.
+type UnsafeBalanceServiceServer interface {
+	mustEmbedUnimplementedBalanceServiceServer()
+}
+
+func RegisterBalanceServiceServer(s grpc.ServiceRegistrar, srv BalanceServiceServer) {
+	s.RegisterService(&BalanceService_ServiceDesc, srv)
+}
+
+func _BalanceService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/GetBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_AddBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).AddBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/AddBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).AddBalance(ctx, req.(*AddBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_CreateReserve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateReserveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).CreateReserve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/CreateReserve",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).CreateReserve(ctx, req.(*CreateReserveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_GetReserve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReserveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).GetReserve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/GetReserve",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).GetReserve(ctx, req.(*GetReserveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_AmendReserve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AmendReserveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).AmendReserve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/AmendReserve",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).AmendReserve(ctx, req.(*AmendReserveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_ReleaseReserve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseReserveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).ReleaseReserve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/ReleaseReserve",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).ReleaseReserve(ctx, req.(*ReleaseReserveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_Purchase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurchaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).Purchase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/Purchase",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).Purchase(ctx, req.(*PurchaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_GetService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).GetService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/GetService",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).GetService(ctx, req.(*GetServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_ListServices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).ListServices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/ListServices",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).ListServices(ctx, req.(*ListServicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_CreateReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).CreateReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/CreateReport",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).CreateReport(ctx, req.(*CreateReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_ListReports_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListReportsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).ListReports(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/ListReports",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).ListReports(ctx, req.(*ListReportsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// BalanceService_ServiceDesc is the grpc.ServiceDesc for BalanceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BalanceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "balance.v1.BalanceService",
+	HandlerType: (*BalanceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBalance",
+			Handler:    _BalanceService_GetBalance_Handler,
+		},
+		{
+			MethodName: "AddBalance",
+			Handler:    _BalanceService_AddBalance_Handler,
+		},
+		{
+			MethodName: "CreateReserve",
+			Handler:    _BalanceService_CreateReserve_Handler,
+		},
+		{
+			MethodName: "GetReserve",
+			Handler:    _BalanceService_GetReserve_Handler,
+		},
+		{
+			MethodName: "AmendReserve",
+			Handler:    _BalanceService_AmendReserve_Handler,
+		},
+		{
+			MethodName: "ReleaseReserve",
+			Handler:    _BalanceService_ReleaseReserve_Handler,
+		},
+		{
+			MethodName: "Purchase",
+			Handler:    _BalanceService_Purchase_Handler,
+		},
+		{
+			MethodName: "GetService",
+			Handler:    _BalanceService_GetService_Handler,
+		},
+		{
+			MethodName: "ListServices",
+			Handler:    _BalanceService_ListServices_Handler,
+		},
+		{
+			MethodName: "CreateReport",
+			Handler:    _BalanceService_CreateReport_Handler,
+		},
+		{
+			MethodName: "ListReports",
+			Handler:    _BalanceService_ListReports_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "balance/v1/balance.proto",
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"balance/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func InitializeMetricsRoute(a *fiber.App) {
+	a.Get("/metrics", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4")
+		return metrics.WriteText(c)
+	})
+}
@@ -1,24 +1,141 @@
 package routes
 
 import (
+	"balance/internal/auth"
 	"balance/internal/handlers"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// InitializeRoutes registers routes of v2 and v1 API, every route requires caller with its scope,
+// end-user tokens are allowed only routes of their own user
 func InitializeRoutes(a *fiber.App, handler *handlers.Handler) {
-	route := a.Group("/api")
+	read := handlers.Allow(auth.ScopeRead)
+	readOwn := handlers.AllowOwn(auth.ScopeRead)
+	billing := handlers.Allow(auth.ScopeBilling)
+	finance := handlers.Allow(auth.ScopeFinance)
+	money := handlers.Allow(auth.ScopeCredit)
+	admin := handlers.Allow(auth.ScopeAdmin)
+	// requests moving money are signed if API key of caller has signing secret
+	signed := handler.VerifySignature
 
-	route.Get("", handler.GetBalance)
-	route.Post("", handler.AddBalance)
-	route.Delete("/users", handler.DeleteUser)
-	route.Post("/reserve", handler.Reserve)
-	route.Get("/reserve", handler.GetReserve)
-	route.Delete("/reserve", handler.DeleteReserve)
-	route.Post("/purchase", handler.Purchase)
-	route.Post("/services", handler.AddServices)
-	route.Get("/services", handler.GetService)
-	route.Delete("/services", handler.DeleteService)
-	route.Get("/report/:year/:month/report.csv", handler.GetReport)
-	route.Get("/report", handler.CreateReport)
+	v2 := a.Group("/api/v2", handlers.Envelope, handler.Authenticate)
+
+	v2.Get("/users/:id/balance", readOwn, handler.GetBalanceV2)
+	v2.Post("/users/:id/balance", money, signed, handler.AddBalanceV2)
+	v2.Get("/users/:id/balance/as-of", readOwn, handler.GetBalanceAt)
+	v2.Delete("/users/:id", admin, handler.DeleteUserV2)
+	v2.Get("/users/:id/statement", readOwn, handler.GetStatement)
+	v2.Get("/users/:id/accounts", readOwn, handler.GetUserAccounts)
+	v2.Get("/users/:id/events", readOwn, handler.StreamBalance)
+	v2.Post("/balances/end-of-day", read, handler.GetEndOfDayBalances)
+	v2.Post("/snapshots/:date", finance, handler.CreateSnapshot)
+	v2.Get("/liabilities", read, handler.GetLiabilities)
+	v2.Get("/reserves", readOwn, handler.GetReserves)
+	v2.Get("/reserves/outstanding", read, handler.GetOutstandingReserves)
+	v2.Post("/orders", billing, signed, handler.ReserveOrder)
+	v2.Get("/orders/:id", readOwn, handler.GetOrder)
+	v2.Post("/orders/:id/purchase", billing, signed, handler.PurchaseOrder)
+	v2.Delete("/orders/:id", billing, signed, handler.ReleaseOrderV2)
+	v2.Post("/orders/:id/reserve", billing, signed, handler.ReserveV2)
+	v2.Get("/orders/:id/reserve", readOwn, handler.GetReserveV2)
+	v2.Patch("/orders/:id/reserve", billing, signed, handler.AmendReserveV2)
+	v2.Delete("/orders/:id/reserve", billing, signed, handler.DeleteReserveV2)
+	v2.Post("/orders/:id/reserve/purchase", billing, signed, handler.PurchaseV2)
+	v2.Post("/services", admin, handler.UpsertServices)
+	v2.Get("/services", read, handler.GetServices)
+	v2.Get("/services/:id", read, handler.GetServiceV2)
+	v2.Put("/services/:id", admin, handler.UpdateServiceV2)
+	v2.Delete("/services/:id", admin, handler.DeleteServiceV2)
+	v2.Get("/services/:id/prices", read, handler.GetServicePrices)
+	v2.Get("/report/:year/:month", read, handler.GetReports)
+	v2.Post("/report/:year/:month", finance, handler.CreateReportV2)
+	v2.Get("/report/:year/:month/report.csv", read, handler.GetReport)
+	v2.Get("/report/:year/:month/:version/report.csv", read, handler.GetReportVersion)
+	v2.Get("/report/:year/:month/:version/diff.csv", read, handler.GetReportDiff)
+	v2.Get("/report/:year/:month/restated", read, handler.GetRestatedReport)
+	v2.Post("/periods/close", finance, handler.ClosePeriod)
+	v2.Get("/periods", read, handler.GetClosedPeriods)
+	v2.Get("/reconciliation", finance, handler.Reconcile)
+	v2.Post("/rates", finance, handler.AddExchangeRates)
+	v2.Get("/rates", read, handler.GetExchangeRate)
+	v2.Post("/convert", money, signed, handler.Convert)
+	v2.Post("/batch", billing, signed, handler.Batch)
+	v2.Post("/imports", finance, handler.CreateImport)
+	v2.Get("/imports/:id", finance, handler.GetImport)
+	v2.Post("/imports/:id/resume", finance, handler.ResumeImport)
+	v2.Get("/imports/:id/result.csv", finance, handler.GetImportResult)
+	v2.Post("/webhooks", admin, handler.CreateWebhook)
+	v2.Get("/webhooks", admin, handler.GetWebhooks)
+	v2.Patch("/webhooks/:id", admin, handler.UpdateWebhook)
+	v2.Delete("/webhooks/:id", admin, handler.DeleteWebhook)
+	v2.Get("/webhooks/:id/deliveries", admin, handler.GetWebhookDeliveries)
+	v2.Post("/keys", admin, handler.CreateAPIKey)
+	v2.Get("/keys", admin, handler.GetAPIKeys)
+	v2.Post("/keys/:id/rotate", admin, handler.RotateAPIKey)
+	v2.Delete("/keys/:id", admin, handler.RevokeAPIKey)
+	v2.Post("/keys/:id/secrets", admin, handler.CreateSigningSecret)
+	v2.Get("/keys/:id/secrets", admin, handler.GetSigningSecrets)
+	v2.Delete("/keys/:id/secrets/:secret_id", admin, handler.RevokeSigningSecret)
+
+	route := a.Group("/api", handlers.Deprecated, handler.Authenticate)
+
+	route.Get("", readOwn, handler.GetBalance)
+	route.Post("", money, signed, handler.AddBalance)
+	route.Delete("/users", admin, handler.DeleteUser)
+	route.Get("/users/:id/statement", readOwn, handler.GetStatement)
+	route.Get("/users/:id/balance", readOwn, handler.GetBalanceAt)
+	route.Post("/balances/end-of-day", read, handler.GetEndOfDayBalances)
+	route.Post("/snapshots/:date", finance, handler.CreateSnapshot)
+	route.Get("/liabilities", read, handler.GetLiabilities)
+	route.Get("/users/:id/accounts", readOwn, handler.GetUserAccounts)
+	route.Get("/users/:id/events", readOwn, handler.StreamBalance)
+	route.Post("/reserve", billing, signed, handler.Reserve)
+	route.Get("/reserve", readOwn, handler.GetReserve)
+	route.Delete("/reserve", billing, signed, handler.DeleteReserve)
+	route.Patch("/reserve", billing, signed, handler.AmendReserve)
+	route.Get("/reserves", readOwn, handler.GetReserves)
+	route.Get("/reserves/outstanding", read, handler.GetOutstandingReserves)
+	route.Post("/purchase", billing, signed, handler.Purchase)
+	route.Post("/orders", billing, signed, handler.ReserveOrder)
+	route.Get("/orders/:id", readOwn, handler.GetOrder)
+	route.Post("/orders/:id/purchase", billing, signed, handler.PurchaseOrder)
+	route.Delete("/orders/:id", billing, signed, handler.ReleaseOrder)
+	route.Post("/services", admin, handler.UpsertServices)
+	route.Get("/services/list", read, handler.GetServices)
+	route.Get("/services", read, handler.GetService)
+	route.Put("/services", admin, handler.UpdateService)
+	route.Get("/services/:id/prices", read, handler.GetServicePrices)
+	route.Delete("/services", admin, handler.DeleteService)
+	route.Get("/report/:year/:month", read, handler.GetReports)
+	route.Get("/report/:year/:month/report.csv", read, handler.GetReport)
+	route.Get("/report/:year/:month/:version/report.csv", read, handler.GetReportVersion)
+	route.Get("/report/:year/:month/:version/diff.csv", read, handler.GetReportDiff)
+	route.Get("/report/:year/:month/restated", read, handler.GetRestatedReport)
+	route.Post("/report", finance, handler.CreateReport)
+	// kept for clients of the former GET route
+	route.Get("/report", finance, handler.CreateReport)
+	route.Post("/periods/close", finance, handler.ClosePeriod)
+	route.Get("/periods", read, handler.GetClosedPeriods)
+	route.Get("/reconciliation", finance, handler.Reconcile)
+	route.Post("/rates", finance, handler.AddExchangeRates)
+	route.Get("/rates", read, handler.GetExchangeRate)
+	route.Post("/convert", money, signed, handler.Convert)
+	route.Post("/batch", billing, signed, handler.Batch)
+	route.Post("/imports", finance, handler.CreateImport)
+	route.Get("/imports/:id", finance, handler.GetImport)
+	route.Post("/imports/:id/resume", finance, handler.ResumeImport)
+	route.Get("/imports/:id/result.csv", finance, handler.GetImportResult)
+	route.Post("/webhooks", admin, handler.CreateWebhook)
+	route.Get("/webhooks", admin, handler.GetWebhooks)
+	route.Patch("/webhooks/:id", admin, handler.UpdateWebhook)
+	route.Delete("/webhooks/:id", admin, handler.DeleteWebhook)
+	route.Get("/webhooks/:id/deliveries", admin, handler.GetWebhookDeliveries)
+	route.Post("/keys", admin, handler.CreateAPIKey)
+	route.Get("/keys", admin, handler.GetAPIKeys)
+	route.Post("/keys/:id/rotate", admin, handler.RotateAPIKey)
+	route.Delete("/keys/:id", admin, handler.RevokeAPIKey)
+	route.Post("/keys/:id/secrets", admin, handler.CreateSigningSecret)
+	route.Get("/keys/:id/secrets", admin, handler.GetSigningSecrets)
+	route.Delete("/keys/:id/secrets/:secret_id", admin, handler.RevokeSigningSecret)
 }
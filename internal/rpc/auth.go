@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"balance/internal/auth"
+	"balance/internal/databases"
+	"balance/internal/models"
+
+	"context"
+	"path"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// methodScopes maps methods to scopes required to call them the same way as routes of HTTP API,
+// methods missing here require admin scope
+var methodScopes = map[string]string{
+	"GetBalance":     auth.ScopeRead,
+	"AddBalance":     auth.ScopeCredit,
+	"CreateReserve":  auth.ScopeBilling,
+	"GetReserve":     auth.ScopeRead,
+	"AmendReserve":   auth.ScopeBilling,
+	"ReleaseReserve": auth.ScopeBilling,
+	"Purchase":       auth.ScopeBilling,
+	"GetService":     auth.ScopeRead,
+	"ListServices":   auth.ScopeRead,
+	"CreateReport":   auth.ScopeFinance,
+	"ListReports":    auth.ScopeRead,
+}
+
+// ownMethods are methods allowed to end-user tokens, they check that the token operates on its own user
+var ownMethods = map[string]bool{
+	"GetBalance": true,
+	"GetReserve": true,
+}
+
+// signedMethods are methods moving money, they are signed in HTTP API only,
+// so API keys with active signing secrets are not allowed to call them
+var signedMethods = map[string]bool{
+	"AddBalance":     true,
+	"CreateReserve":  true,
+	"AmendReserve":   true,
+	"ReleaseReserve": true,
+	"Purchase":       true,
+}
+
+// principalContextKey is key of caller of authenticated call in its context
+type principalContextKey struct{}
+
+// authenticate finds caller by bearer token validated against JWKS if tokens are configured or by active API key
+// sent in x-api-key metadata or as bearer token of authorization metadata, and checks that it has scope of the method
+func authenticate(db databases.DBInt, jwt *auth.JWTValidator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		key := auth.FromHeaders(firstValue(md, auth.KeyHeader), firstValue(md, "authorization"))
+		if key == "" {
+			return nil, status.Error(codes.Unauthenticated, "rpc: authenticate: API key or token is not given")
+		}
+
+		var principal models.Principal
+		if jwt != nil && auth.IsJWT(key) {
+			var err error
+			if principal, err = jwt.Validate(key); err != nil {
+				return nil, status.Errorf(codes.Unauthenticated, "rpc: authenticate: %v", err)
+			}
+		} else {
+			apiKey, err := db.GetActiveAPIKey(auth.Hash(key))
+			if err != nil && databases.ErrorCode(err) == databases.CodeNotFound {
+				return nil, status.Error(codes.Unauthenticated, "rpc: authenticate: API key is not valid, revoked or expired")
+			} else if err != nil {
+				return nil, toStatus(err)
+			}
+			principal = auth.KeyPrincipal(apiKey)
+		}
+
+		method := path.Base(info.FullMethod)
+		scope, ok := methodScopes[method]
+		if !ok {
+			scope = auth.ScopeAdmin
+		}
+		if principal.UserID != 0 && !ownMethods[method] {
+			return nil, status.Errorf(codes.PermissionDenied, "rpc: end-user token is not allowed to call %s", method)
+		}
+		if !auth.HasScope(principal, scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "rpc: %s scope is required to call %s", scope, method)
+		}
+		if principal.KeyID != 0 && signedMethods[method] {
+			secrets, err := db.GetActiveSigningSecrets(principal.KeyID)
+			if err != nil {
+				return nil, toStatus(err)
+			}
+			if len(secrets) > 0 {
+				return nil, status.Errorf(codes.PermissionDenied, "rpc: API key with signing secret must call %s by signed request of HTTP API", method)
+			}
+		}
+		return handler(context.WithValue(ctx, principalContextKey{}, principal), req)
+	}
+}
+
+// firstValue returns the first value of metadata by case insensitive key
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(strings.ToLower(key)); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// principalOf returns caller of authenticated call
+func principalOf(ctx context.Context) models.Principal {
+	principal, _ := ctx.Value(principalContextKey{}).(models.Principal)
+	return principal
+}
+
+// db returns database recording API key of call as acting one, its operations are cancelled with the call
+func (s *Server) db(ctx context.Context) databases.DBInt {
+	return s.DB.WithActor(principalOf(ctx).KeyID).WithContext(ctx)
+}
+
+// checkService checks that caller operates on given service
+func checkService(ctx context.Context, serviceId uint64) error {
+	if !auth.AllowsService(principalOf(ctx), serviceId) {
+		return status.Errorf(codes.PermissionDenied, "rpc: caller is not allowed to operate on service %d", serviceId)
+	}
+	return nil
+}
+
+// checkUser checks that end-user token operates on its own user
+func checkUser(ctx context.Context, userId uint64) error {
+	if !auth.AllowsUser(principalOf(ctx), userId) {
+		return status.Errorf(codes.PermissionDenied, "rpc: end-user token is not allowed to operate on user %d", userId)
+	}
+	return nil
+}
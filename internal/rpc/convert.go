@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"balance/internal/models"
+	"balance/internal/pb"
+	"balance/internal/utils"
+
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// timeToProto converts nullable time to timestamp
+func timeToProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// balanceToProto converts balance of user in currency
+func balanceToProto(b models.Balance) *pb.Balance {
+	balance := &pb.Balance{
+		Currency:  b.Currency,
+		Available: b.Available,
+		Held:      b.Held,
+		Total:     b.Total,
+	}
+	for _, s := range b.Services {
+		balance.Services = append(balance.Services, &pb.ServiceHeld{
+			ServiceId:   s.ServiceID,
+			ServiceName: s.ServiceName,
+			Held:        s.Held,
+		})
+	}
+	return balance
+}
+
+// serviceToProto converts service with its current price
+func serviceToProto(s models.Service) *pb.Service {
+	return &pb.Service{
+		Id:           s.ID,
+		Name:         s.Name,
+		Currency:     s.Currency,
+		Active:       s.Active,
+		PriceVersion: int32(s.PriceVersion),
+		Price:        s.Price,
+		MinAmount:    s.MinAmount,
+		MaxAmount:    s.MaxAmount,
+	}
+}
+
+// reserveToProto converts reserve with its service and amendments
+func reserveToProto(r models.Reserve) *pb.Reserve {
+	reserve := &pb.Reserve{
+		OrderId:      r.OrderID,
+		UserId:       r.UserID,
+		Amount:       r.Amount,
+		Currency:     r.Currency,
+		Status:       r.Status,
+		PriceVersion: int32(r.PriceVersion),
+		ReservedAt:   timestamppb.New(r.ReservedAt),
+		ExpiresAt:    timestamppb.New(r.ExpiresAt),
+		PurchasedAt:  timeToProto(r.PurchasedAt),
+		ReleasedAt:   timeToProto(r.ReleasedAt),
+	}
+	if r.ServiceID != 0 {
+		reserve.Service = serviceToProto(r.Service)
+	}
+	for _, a := range r.Amendments {
+		reserve.Amendments = append(reserve.Amendments, &pb.ReserveAmendment{
+			PreviousAmount:    a.PreviousAmount,
+			Amount:            a.Amount,
+			PreviousExpiresAt: timestamppb.New(a.PreviousExpiresAt),
+			ExpiresAt:         timestamppb.New(a.ExpiresAt),
+			AmendedAt:         timestamppb.New(a.AmendedAt),
+		})
+	}
+	return reserve
+}
+
+// reportToProto converts report version with path to its csv file in HTTP API
+func reportToProto(r models.Report) *pb.Report {
+	report := &pb.Report{
+		Year:       int32(r.Year),
+		Month:      int32(r.Month),
+		Version:    int32(r.Version),
+		Closing:    r.Closing,
+		Sha256:     r.SHA256,
+		CreatedAt:  timestamppb.New(r.CreatedAt),
+		ReportPath: "/api" + utils.GetReportFilePath(r.Year, r.Month, r.Version)[1:],
+	}
+	for _, l := range r.Diff {
+		report.Diff = append(report.Diff, &pb.ReportDiffLine{
+			ServiceName: l.ServiceName,
+			Currency:    l.Currency,
+			Previous:    l.Previous,
+			Current:     l.Current,
+		})
+	}
+	return report
+}
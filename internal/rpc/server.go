@@ -0,0 +1,286 @@
+package rpc
+
+import (
+	"balance/internal/auth"
+	"balance/internal/databases"
+	"balance/internal/models"
+	"balance/internal/pb"
+	"balance/internal/utils"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultTimeout is deadline of call if client has not set it
+const DefaultTimeout = 10 * time.Second
+
+// Server implements gRPC API with the same database as HTTP API
+type Server struct {
+	pb.UnimplementedBalanceServiceServer
+	DB databases.DBInt
+}
+
+// NewServer creates gRPC server with registered balance service and server reflection.
+// Calls without deadline get the given timeout, every call requires API key or token with scope of the method
+func NewServer(db databases.DBInt, jwt *auth.JWTValidator, timeout time.Duration, logger *zap.Logger) *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		logErrors(logger),
+		withDeadline(timeout),
+		authenticate(db, jwt),
+	))
+	pb.RegisterBalanceServiceServer(server, &Server{DB: db})
+	reflection.Register(server)
+	return server
+}
+
+// withDeadline sets default deadline of call. Database operations of the call are bound to its context,
+// so operation which has not completed by the deadline is cancelled and rolled back. Handler is awaited and its
+// result is returned as is, the call is not answered with DeadlineExceeded while its operation could still commit
+func withDeadline(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// logErrors logs failed calls
+func logErrors(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			logger.Warn("rpc: call failed",
+				zap.String("method", info.FullMethod),
+				zap.String("code", status.Code(err).String()),
+				zap.Error(err))
+		}
+		return resp, err
+	}
+}
+
+// statusCodes maps codes of errors of database layer to status codes
+var statusCodes = map[string]codes.Code{
+	databases.CodeNotFound:           codes.NotFound,
+	databases.CodeFailedPrecondition: codes.FailedPrecondition,
+	databases.CodeInvalidArgument:    codes.InvalidArgument,
+	databases.CodeAlreadyExists:      codes.AlreadyExists,
+	databases.CodeAborted:            codes.Aborted,
+	databases.CodeInternal:           codes.Internal,
+}
+
+// toStatus converts error of database layer to gRPC status
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(statusCodes[databases.ErrorCode(err)], err.Error())
+}
+
+// GetBalance returns available, held and total money of user in every currency
+func (s *Server) GetBalance(ctx context.Context, req *pb.GetBalanceRequest) (*pb.GetBalanceResponse, error) {
+	if err := checkUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	balances, err := s.db(ctx).GetBalanceDetails(req.UserId, req.ByService)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.GetBalanceResponse{Balances: make([]*pb.Balance, 0, len(balances))}
+	for _, b := range balances {
+		resp.Balances = append(resp.Balances, balanceToProto(b))
+	}
+	return resp, nil
+}
+
+// AddBalance credits wallet of user
+func (s *Server) AddBalance(ctx context.Context, req *pb.AddBalanceRequest) (*pb.AddBalanceResponse, error) {
+	currency, err := utils.NormalizeCurrency(req.Currency)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err = s.db(ctx).AddBalance(req.UserId, req.Amount, currency); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.AddBalanceResponse{}, nil
+}
+
+// CreateReserve holds money of user for order
+func (s *Server) CreateReserve(ctx context.Context, req *pb.CreateReserveRequest) (*pb.Reserve, error) {
+	if err := checkService(ctx, req.ServiceId); err != nil {
+		return nil, err
+	}
+
+	// if currency is not given, it is taken from the service
+	currency := ""
+	if req.Currency != "" {
+		var err error
+		if currency, err = utils.NormalizeCurrency(req.Currency); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	reserve, err := s.db(ctx).Reserve(req.UserId, req.ServiceId, req.OrderId, req.Amount, currency)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return reserveToProto(reserve), nil
+}
+
+// GetReserve returns reserve with its status and history of amendments
+func (s *Server) GetReserve(ctx context.Context, req *pb.GetReserveRequest) (*pb.Reserve, error) {
+	if err := checkUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+	if err := checkService(ctx, req.ServiceId); err != nil {
+		return nil, err
+	}
+	reserve, err := s.db(ctx).GetReserve(req.UserId, req.ServiceId, req.OrderId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return reserveToProto(reserve), nil
+}
+
+// AmendReserve changes reserved amount and extends expiry time of open reserve
+func (s *Server) AmendReserve(ctx context.Context, req *pb.AmendReserveRequest) (*pb.Reserve, error) {
+	if err := checkService(ctx, req.ServiceId); err != nil {
+		return nil, err
+	}
+	var extend time.Duration
+	if req.Extend != nil {
+		if err := req.Extend.CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("rpc: amend reserve: %v", err))
+		}
+		extend = req.Extend.AsDuration()
+	}
+
+	reserve, err := s.db(ctx).AmendReserve(req.UserId, req.ServiceId, req.OrderId, req.Amount, extend)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return reserveToProto(reserve), nil
+}
+
+// ReleaseReserve returns reserved money to user
+func (s *Server) ReleaseReserve(ctx context.Context, req *pb.ReleaseReserveRequest) (*pb.ReleaseReserveResponse, error) {
+	if err := checkService(ctx, req.ServiceId); err != nil {
+		return nil, err
+	}
+	if _, err := utils.NormalizeCurrency(req.Currency); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.db(ctx).DeleteReserve(req.UserId, req.ServiceId, req.OrderId, req.Amount); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.ReleaseReserveResponse{}, nil
+}
+
+// Purchase moves reserved money to revenue
+func (s *Server) Purchase(ctx context.Context, req *pb.PurchaseRequest) (*pb.PurchaseResponse, error) {
+	if err := checkService(ctx, req.ServiceId); err != nil {
+		return nil, err
+	}
+
+	// if currency is not given, it is taken from the reserve
+	currency := ""
+	if req.Currency != "" {
+		var err error
+		if currency, err = utils.NormalizeCurrency(req.Currency); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if err := s.db(ctx).Purchase(req.UserId, req.ServiceId, req.OrderId, req.Amount, currency); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.PurchaseResponse{}, nil
+}
+
+// GetService returns service with its current price
+func (s *Server) GetService(ctx context.Context, req *pb.GetServiceRequest) (*pb.Service, error) {
+	service, err := s.db(ctx).GetService(req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return serviceToProto(service), nil
+}
+
+// ListServices returns page of services ordered by id
+func (s *Server) ListServices(ctx context.Context, req *pb.ListServicesRequest) (*pb.ListServicesResponse, error) {
+	filter := models.ServicesFilter{
+		Name:   req.Name,
+		Active: req.Active,
+		Limit:  int(req.Limit),
+		Offset: int(req.Offset),
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 20
+	}
+	if filter.Limit < 0 || filter.Limit > 100 || filter.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "rpc: list services: limit must be in [1, 100] range and offset must not be negative")
+	}
+
+	services, total, err := s.db(ctx).GetServices(filter)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.ListServicesResponse{Services: make([]*pb.Service, 0, len(services)), Total: total}
+	for _, service := range services {
+		resp.Services = append(resp.Services, serviceToProto(service))
+	}
+	return resp, nil
+}
+
+// CreateReport creates a new version of monthly csv report
+func (s *Server) CreateReport(ctx context.Context, req *pb.CreateReportRequest) (*pb.Report, error) {
+	if req.Month < 1 || req.Month > 12 {
+		return nil, status.Error(codes.InvalidArgument, "rpc: create report: wrong month input")
+	}
+
+	report, err := s.db(ctx).CreateReport(int(req.Year), int(req.Month))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return reportToProto(report), nil
+}
+
+// ListReports returns all versions of monthly report
+func (s *Server) ListReports(ctx context.Context, req *pb.ListReportsRequest) (*pb.ListReportsResponse, error) {
+	if req.Month < 1 || req.Month > 12 {
+		return nil, status.Error(codes.InvalidArgument, "rpc: list reports: wrong month input")
+	}
+
+	reports, err := s.db(ctx).GetReports(int(req.Year), int(req.Month))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.ListReportsResponse{Reports: make([]*pb.Report, 0, len(reports))}
+	for _, report := range reports {
+		resp.Reports = append(resp.Reports, reportToProto(report))
+	}
+	return resp, nil
+}
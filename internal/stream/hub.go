@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"balance/internal/databases"
+
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// reconnectDelay is delay before listening is restarted after failure
+const reconnectDelay = 5 * time.Second
+
+// Hub wakes streams of users notified by database, so streams work across multiple instances of service
+type Hub struct {
+	mu      sync.Mutex
+	streams map[uint64]map[chan struct{}]struct{}
+}
+
+// NewHub creates new Hub instance
+func NewHub() *Hub {
+	return &Hub{streams: make(map[uint64]map[chan struct{}]struct{})}
+}
+
+// Subscribe returns channel woken when user by given id has new events and function which unsubscribes from them.
+// Wakes are not queued, stream reads all new events of user once woken
+func (h *Hub) Subscribe(userId uint64) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	if h.streams[userId] == nil {
+		h.streams[userId] = make(map[chan struct{}]struct{})
+	}
+	h.streams[userId][wake] = struct{}{}
+	h.mu.Unlock()
+
+	return wake, func() {
+		h.mu.Lock()
+		delete(h.streams[userId], wake)
+		if len(h.streams[userId]) == 0 {
+			delete(h.streams, userId)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Notify wakes streams of user by given id
+func (h *Hub) Notify(userId uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for wake := range h.streams[userId] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyAll wakes streams of all users
+func (h *Hub) notifyAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, streams := range h.streams {
+		for wake := range streams {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Start listens to notifications of database until ctx is done. Listening is restarted after failures
+// and all streams are woken once it is restarted, as notifications could be lost meanwhile
+func (h *Hub) Start(ctx context.Context, db databases.DBInt, logger *zap.Logger) {
+	go func() {
+		started := func() {}
+		for {
+			err := db.ListenUserEvents(ctx, started, h.Notify)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("stream: listening failed", zap.Error(err))
+			started = h.notifyAll
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}()
+}
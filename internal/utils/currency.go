@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// DefaultCurrency is used when currency is not specified
+const DefaultCurrency = "RUB"
+
+// Currencies maps supported ISO 4217 currency codes to number of their minor units
+var Currencies = map[string]int{
+	"RUB": 2,
+	"KZT": 2,
+	"AMD": 2,
+	"USD": 2,
+	"EUR": 2,
+}
+
+// NormalizeCurrency returns upper-cased currency code, DefaultCurrency for empty code
+// or error if currency is not supported
+func NormalizeCurrency(code string) (string, error) {
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	code = strings.ToUpper(code)
+	if _, ok := Currencies[code]; !ok {
+		return "", fmt.Errorf("unsupported currency %q", code)
+	}
+	return code, nil
+}
+
+// minorUnitsFactor returns number of minor units in one major unit of currency
+func minorUnitsFactor(currency string) float64 {
+	units, ok := Currencies[currency]
+	if !ok {
+		units = 2
+	}
+	return math.Pow10(units)
+}
+
+// MoneyToInt converts money amount from float to number of minor units of given currency
+func MoneyToInt(amount float32, currency string) int64 {
+	return int64(math.Ceil(float64(amount * float32(minorUnitsFactor(currency)))))
+}
+
+// MoneyToFloat converts money amount from number of minor units of given currency to float
+func MoneyToFloat(amount int64, currency string) float32 {
+	return float32(float64(amount) / minorUnitsFactor(currency))
+}
+
+// FormatMoney formats money amount stored in minor units of given currency without float rounding
+func FormatMoney(amount int64, currency string) string {
+	units, ok := Currencies[currency]
+	if !ok {
+		units = 2
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if units == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	factor := int64(math.Pow10(units))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/factor, units, amount%factor)
+}
+
+// ParseDecimal parses exact decimal number such as exchange rate or spread
+func ParseDecimal(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, fmt.Errorf("wrong decimal number %q", s)
+	}
+	return r, nil
+}
+
+// ParseMoney parses exact money amount in major units of given currency, e.g. "10.50", to number of its minor units
+func ParseMoney(s string, currency string) (int64, error) {
+	r, err := ParseDecimal(s)
+	if err != nil {
+		return 0, fmt.Errorf("wrong amount %q", s)
+	}
+	units, ok := Currencies[currency]
+	if !ok {
+		units = 2
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(units)), nil)))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("amount %q has more than %d digits after point", s, units)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("amount %q is too large", s)
+	}
+	return r.Num().Int64(), nil
+}
+
+// FormatDecimal formats decimal number with up to 10 digits after point
+func FormatDecimal(r *big.Rat) string {
+	s := r.FloatString(10)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// ConvertMoney converts amount of money in minor units of currency from to minor units of currency to
+// by given rate and spread: amount * rate * (1 - spread). Result is rounded down
+func ConvertMoney(amount int64, from, to string, rate, spread *big.Rat) int64 {
+	converted := new(big.Rat).SetInt64(amount)
+	converted.Mul(converted, rate)
+	converted.Mul(converted, new(big.Rat).Sub(big.NewRat(1, 1), spread))
+
+	// currencies could have different number of minor units
+	fromUnits, toUnits := 2, 2
+	if units, ok := Currencies[from]; ok {
+		fromUnits = units
+	}
+	if units, ok := Currencies[to]; ok {
+		toUnits = units
+	}
+	if toUnits > fromUnits {
+		converted.Mul(converted, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(toUnits-fromUnits)), nil)))
+	} else if fromUnits > toUnits {
+		converted.Quo(converted, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(fromUnits-toUnits)), nil)))
+	}
+
+	// denominator is always positive, so Euclidean division rounds down
+	return new(big.Int).Div(converted.Num(), converted.Denom()).Int64()
+}
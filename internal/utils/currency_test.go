@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestConvertMoney(t *testing.T) {
+	// currencies with other number of minor units than supported ones
+	Currencies["JPY"], Currencies["KWD"] = 0, 3
+	defer func() {
+		delete(Currencies, "JPY")
+		delete(Currencies, "KWD")
+	}()
+
+	tests := []struct {
+		name     string
+		amount   int64
+		from, to string
+		rate     string
+		spread   string
+		want     int64
+	}{
+		{"same rate", 10000, "USD", "RUB", "1", "0", 10000},
+		{"whole rate", 100, "USD", "RUB", "90", "0", 9000},
+		{"fractional rate", 10000, "RUB", "USD", "0.0111", "0", 111},
+		{"result is rounded down", 100, "RUB", "USD", "0.0111", "0", 1},
+		{"result below minor unit is zero", 1, "RUB", "USD", "0.0111", "0", 0},
+		{"spread", 10000, "USD", "RUB", "90", "0.02", 882000},
+		{"spread is rounded down", 333, "USD", "EUR", "1", "0.01", 329},
+		{"zero amount", 0, "USD", "RUB", "90", "0.02", 0},
+		{"negative amount is rounded down", -100, "RUB", "USD", "0.0111", "0", -2},
+		{"exact rate without float error", 1000, "USD", "EUR", "0.1", "0", 100},
+		{"to currency without minor units", 12345, "USD", "JPY", "150", "0", 18517},
+		{"from currency without minor units", 1000, "JPY", "USD", "0.0066", "0", 660},
+		{"to currency with more minor units", 150, "USD", "KWD", "0.3075", "0", 461},
+		{"from currency with more minor units", 1001, "KWD", "USD", "3.25", "0", 325},
+		{"unknown currency has two minor units", 100, "USD", "XXX", "2", "0", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := ParseDecimal(tt.rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spread, err := ParseDecimal(tt.spread)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ConvertMoney(tt.amount, tt.from, tt.to, rate, spread); got != tt.want {
+				t.Errorf("ConvertMoney(%d %s to %s by %s with spread %s) = %d, want %d",
+					tt.amount, tt.from, tt.to, tt.rate, tt.spread, got, tt.want)
+			}
+		})
+	}
+
+	// rate and spread are not changed by conversion
+	rate, spread := big.NewRat(90, 1), big.NewRat(1, 50)
+	ConvertMoney(100, "USD", "RUB", rate, spread)
+	if rate.Cmp(big.NewRat(90, 1)) != 0 || spread.Cmp(big.NewRat(1, 50)) != 0 {
+		t.Errorf("rate %s and spread %s are changed", rate, spread)
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		s        string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{"10.50", "RUB", 1050, false},
+		{" 10 ", "RUB", 1000, false},
+		{"0.01", "USD", 1, false},
+		{"-3.5", "RUB", -350, false},
+		{"1.001", "RUB", 0, true},
+		{"ten", "RUB", 0, true},
+		{"", "RUB", 0, true},
+		{"100000000000000000000", "RUB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.s, tt.currency)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMoney(%q, %s) = %d, %v, want %d, error %v", tt.s, tt.currency, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{1050, "RUB", "10.50"},
+		{5, "USD", "0.05"},
+		{0, "EUR", "0.00"},
+		{-1050, "RUB", "-10.50"},
+		{-5, "RUB", "-0.05"},
+		{123, "XXX", "1.23"},
+	}
+	for _, tt := range tests {
+		if got := FormatMoney(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("FormatMoney(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// dejaVuSansMono is TrueType font of pdf documents, see fonts/LICENSE
+//
+//go:embed fonts/DejaVuSansMono.ttf
+var dejaVuSansMono []byte
+
+// pdfFont is TrueType font metrics needed to write text in pdf document, units are thousandths of font size
+type pdfFont struct {
+	Name        string
+	Width       int // advance width of every glyph of monospaced font
+	Ascent      int
+	Descent     int
+	BBox        [4]int
+	Compressed  []byte // zlib compressed font file
+	Length      int    // length of font file
+	glyphLookup func(r rune) uint16
+}
+
+var (
+	monoFont     pdfFont
+	monoFontErr  error
+	monoFontOnce sync.Once
+)
+
+// getMonoFont returns font of pdf documents parsed and compressed at the first call
+func getMonoFont() (pdfFont, error) {
+	monoFontOnce.Do(func() {
+		monoFont, monoFontErr = parseTTF("DejaVuSansMono", dejaVuSansMono)
+	})
+	return monoFont, monoFontErr
+}
+
+// Glyph returns glyph id of rune, runes not covered by font get .notdef glyph 0
+func (f pdfFont) Glyph(r rune) uint16 {
+	if r < 0 || r > 0xFFFF {
+		return 0
+	}
+	return f.glyphLookup(r)
+}
+
+// parseTTF reads metrics and Unicode BMP character map of TrueType font
+func parseTTF(name string, data []byte) (pdfFont, error) {
+	tables := make(map[string][]byte)
+	if len(data) < 12 {
+		return pdfFont{}, errors.New("utils: font: file is too short")
+	}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		record := 12 + i*16
+		if record+16 > len(data) {
+			return pdfFont{}, errors.New("utils: font: table directory is truncated")
+		}
+		offset := binary.BigEndian.Uint32(data[record+8:])
+		length := binary.BigEndian.Uint32(data[record+12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return pdfFont{}, errors.New("utils: font: table is out of file")
+		}
+		tables[string(data[record:record+4])] = data[offset : offset+length]
+	}
+	head, hhea, cmap := tables["head"], tables["hhea"], tables["cmap"]
+	if len(head) < 54 || len(hhea) < 36 || cmap == nil {
+		return pdfFont{}, errors.New("utils: font: head, hhea or cmap table is missing")
+	}
+
+	unitsPerEm := int(binary.BigEndian.Uint16(head[18:]))
+	if unitsPerEm == 0 {
+		return pdfFont{}, errors.New("utils: font: units per em is zero")
+	}
+	scale := func(b []byte) int {
+		return int(int16(binary.BigEndian.Uint16(b))) * 1000 / unitsPerEm
+	}
+	font := pdfFont{
+		Name:    name,
+		Width:   int(binary.BigEndian.Uint16(hhea[10:])) * 1000 / unitsPerEm,
+		Ascent:  scale(hhea[4:]),
+		Descent: scale(hhea[6:]),
+		BBox:    [4]int{scale(head[36:]), scale(head[38:]), scale(head[40:]), scale(head[42:])},
+		Length:  len(data),
+	}
+	if font.glyphLookup = cmapFormat4(cmap); font.glyphLookup == nil {
+		return pdfFont{}, errors.New("utils: font: no Unicode BMP character map")
+	}
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return pdfFont{}, err
+	}
+	if err := w.Close(); err != nil {
+		return pdfFont{}, err
+	}
+	font.Compressed = buf.Bytes()
+	return font, nil
+}
+
+// cmapFormat4 returns glyph lookup by Windows Unicode BMP (format 4) subtable of cmap table or nil if there is no such subtable
+func cmapFormat4(cmap []byte) func(r rune) uint16 {
+	if len(cmap) < 4 {
+		return nil
+	}
+	var sub []byte
+	for i := 0; i < int(binary.BigEndian.Uint16(cmap[2:])); i++ {
+		record := 4 + i*8
+		if record+8 > len(cmap) {
+			return nil
+		}
+		platform, encoding := binary.BigEndian.Uint16(cmap[record:]), binary.BigEndian.Uint16(cmap[record+2:])
+		offset := binary.BigEndian.Uint32(cmap[record+4:])
+		if platform == 3 && encoding == 1 && uint64(offset)+14 <= uint64(len(cmap)) && binary.BigEndian.Uint16(cmap[offset:]) == 4 {
+			sub = cmap[offset:]
+			break
+		}
+	}
+	if sub == nil {
+		return nil
+	}
+
+	segments := int(binary.BigEndian.Uint16(sub[6:]) / 2)
+	endCodes := 14
+	startCodes := endCodes + segments*2 + 2
+	idDeltas := startCodes + segments*2
+	idRangeOffsets := idDeltas + segments*2
+	if idRangeOffsets+segments*2 > len(sub) {
+		return nil
+	}
+	u16 := func(at int) uint16 {
+		if at < 0 || at+2 > len(sub) {
+			return 0
+		}
+		return binary.BigEndian.Uint16(sub[at:])
+	}
+
+	return func(r rune) uint16 {
+		c := uint16(r)
+		for i := 0; i < segments; i++ {
+			if u16(endCodes+i*2) < c {
+				continue
+			}
+			start := u16(startCodes + i*2)
+			if start > c {
+				return 0
+			}
+			delta := u16(idDeltas + i*2)
+			rangeOffset := u16(idRangeOffsets + i*2)
+			if rangeOffset == 0 {
+				return c + delta
+			}
+			// glyph id is read from glyph id array at offset counted from the range offset itself
+			glyph := u16(idRangeOffsets + i*2 + int(rangeOffset) + int(c-start)*2)
+			if glyph == 0 {
+				return 0
+			}
+			return glyph + delta
+		}
+		return 0
+	}
+}
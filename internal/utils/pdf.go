@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	pdfLinesPerPage = 60
+	pdfFontSize     = 9
+	pdfLineHeight   = 12
+	// pdfFirstPage is number of the first page object, objects before it are catalog, pages tree and font objects
+	pdfFirstPage = 8
+)
+
+// TextPDF returns a simple A4 PDF document with given text lines written in embedded monospaced font DejaVu Sans Mono,
+// characters the font has no glyphs for are shown as empty boxes
+func TextPDF(lines []string) ([]byte, error) {
+	font, err := getMonoFont()
+	if err != nil {
+		return nil, err
+	}
+
+	// split lines into pages, a document always has at least one page
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// objects: 1 - catalog, 2 - pages tree, 3 - font, 4 - its glyphs, 5 - its descriptor, 6 - font file,
+	// 7 - map of glyphs to text, then page and its content for every page.
+	// Text is written by glyph ids, so any character of the font is shown as is
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pdfFirstPage+i*2))
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	objects = append(objects,
+		fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [4 0 R] /ToUnicode 7 0 R >>", font.Name),
+		fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor 5 0 R /DW %d /CIDToGIDMap /Identity >>",
+			font.Name, font.Width),
+		fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 33 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 6 0 R >>",
+			font.Name, font.BBox[0], font.BBox[1], font.BBox[2], font.BBox[3], font.Ascent, font.Descent, font.Ascent),
+		fmt.Sprintf("<< /Length %d /Length1 %d /Filter /FlateDecode >>\nstream\n%s\nendstream", len(font.Compressed), font.Length, font.Compressed))
+
+	used := make(map[uint16]rune)
+	var contents []string
+	for _, page := range pages {
+		var content strings.Builder
+		content.WriteString(fmt.Sprintf("BT /F1 %d Tf %d TL 40 800 Td\n", pdfFontSize, pdfLineHeight))
+		for _, line := range page {
+			content.WriteString("<" + glyphsPDFText(font, line, used) + "> Tj T*\n")
+		}
+		content.WriteString("ET")
+		contents = append(contents, content.String())
+	}
+	objects = append(objects, toUnicodeCMap(used))
+	for i, content := range contents {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfFirstPage+i*2+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	// write objects and cross-reference table with their offsets
+	var buf bytes.Buffer
+	// binary comment marks the file as binary for transfer programs, the font file is compressed
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		buf.WriteString(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", i+1, object))
+	}
+	xref := buf.Len()
+	buf.WriteString(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(objects)+1))
+	for _, offset := range offsets {
+		buf.WriteString(fmt.Sprintf("%010d 00000 n \n", offset))
+	}
+	buf.WriteString(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref))
+	return buf.Bytes(), nil
+}
+
+// glyphsPDFText returns hex string of glyph ids of text and records characters of used glyphs
+func glyphsPDFText(font pdfFont, text string, used map[uint16]rune) string {
+	var sb strings.Builder
+	for _, r := range text {
+		glyph := font.Glyph(r)
+		if _, ok := used[glyph]; !ok && glyph != 0 {
+			used[glyph] = r
+		}
+		sb.WriteString(fmt.Sprintf("%04X", glyph))
+	}
+	return sb.String()
+}
+
+// toUnicodeCMap returns stream of map of used glyphs to their characters, so text of document could be copied and searched
+func toUnicodeCMap(used map[uint16]rune) string {
+	glyphs := make([]int, 0, len(used))
+	for glyph := range used {
+		glyphs = append(glyphs, int(glyph))
+	}
+	sort.Ints(glyphs)
+
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// a block of mappings has at most 100 entries
+	for len(glyphs) > 0 {
+		block := glyphs
+		if len(block) > 100 {
+			block = block[:100]
+		}
+		glyphs = glyphs[len(block):]
+		cmap.WriteString(fmt.Sprintf("%d beginbfchar\n", len(block)))
+		for _, glyph := range block {
+			cmap.WriteString(fmt.Sprintf("<%04X> <%04X>\n", glyph, used[uint16(glyph)]))
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend")
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", cmap.Len(), cmap.String())
+}
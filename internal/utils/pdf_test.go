@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMonoFontGlyphs(t *testing.T) {
+	font, err := getMonoFont()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if font.Width != 602 {
+		t.Errorf("width = %d, want 602 of DejaVu Sans Mono", font.Width)
+	}
+
+	tests := []struct {
+		r       rune
+		covered bool
+	}{
+		{'A', true},
+		{'z', true},
+		{'0', true},
+		{'Ж', true},
+		{'ё', true},
+		{'₽', true},
+		{'€', true},
+		{'\u0000', false},
+		{'😀', false},
+	}
+	glyphs := make(map[uint16]rune)
+	for _, tt := range tests {
+		glyph := font.Glyph(tt.r)
+		if (glyph != 0) != tt.covered {
+			t.Errorf("Glyph(%q) = %d, want covered %v", tt.r, glyph, tt.covered)
+		}
+		if other, ok := glyphs[glyph]; ok && glyph != 0 {
+			t.Errorf("Glyph(%q) = Glyph(%q) = %d", tt.r, other, glyph)
+		}
+		glyphs[glyph] = tt.r
+	}
+	// glyphs of DejaVu fonts start with .notdef, .null, nonmarkingreturn and space
+	if font.Glyph(' ') != 3 || font.Glyph('A') != 36 {
+		t.Errorf("Glyph(' ') = %d and Glyph('A') = %d, want 3 and 36", font.Glyph(' '), font.Glyph('A'))
+	}
+}
+
+func TestTextPDF(t *testing.T) {
+	lines := make([]string, pdfLinesPerPage+1)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("Покупка: Доставка (%d) \\ 100.00 ₽", i)
+	}
+	tests := []struct {
+		name  string
+		lines []string
+		pages int
+	}{
+		{"no lines", nil, 1},
+		{"one page", lines[:2], 1},
+		{"two pages", lines, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := TextPDF(tt.lines)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(doc, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+				t.Fatal("document has no PDF header or end of file")
+			}
+			if !bytes.Contains(doc, []byte(fmt.Sprintf("/Count %d", tt.pages))) {
+				t.Errorf("document has no %d pages", tt.pages)
+			}
+
+			// every object is at its offset of cross-reference table
+			xref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(doc)
+			if xref == nil {
+				t.Fatal("no startxref")
+			}
+			start, _ := strconv.Atoi(string(xref[1]))
+			offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(doc[start:], -1)
+			if len(offsets) != pdfFirstPage-1+tt.pages*2 {
+				t.Fatalf("%d objects, want %d", len(offsets), pdfFirstPage-1+tt.pages*2)
+			}
+			for i, offset := range offsets {
+				at, _ := strconv.Atoi(string(offset[1]))
+				if !bytes.HasPrefix(doc[at:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))) {
+					t.Errorf("object %d is not at offset %d", i+1, at)
+				}
+			}
+
+			// embedded font file is the whole font
+			file := regexp.MustCompile(`/Length (\d+) /Length1 (\d+) /Filter /FlateDecode >>\nstream\n`).FindSubmatchIndex(doc)
+			if file == nil {
+				t.Fatal("no font file")
+			}
+			length, _ := strconv.Atoi(string(doc[file[2]:file[3]]))
+			r, err := zlib.NewReader(bytes.NewReader(doc[file[1] : file[1]+length]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, dejaVuSansMono) {
+				t.Error("embedded font file differs from font")
+			}
+		})
+	}
+}
+
+func TestTextPDFWritesUnicode(t *testing.T) {
+	font, err := getMonoFont()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := TextPDF([]string{"Ж (x)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// text is written by glyph ids, so non ASCII characters are written as is and parentheses need no escaping
+	want := fmt.Sprintf("<%04X%04X%04X%04X%04X> Tj", font.Glyph('Ж'), font.Glyph(' '), font.Glyph('('), font.Glyph('x'), font.Glyph(')'))
+	if !bytes.Contains(doc, []byte(want)) {
+		t.Errorf("document has no text %s", want)
+	}
+
+	// glyphs map back to characters, so text could be copied
+	cmap := string(doc[bytes.Index(doc, []byte("beginbfchar")):bytes.Index(doc, []byte("endbfchar"))])
+	for _, r := range "Ж (x)" {
+		entry := fmt.Sprintf("<%04X> <%04X>", font.Glyph(r), r)
+		if !strings.Contains(cmap, entry) {
+			t.Errorf("map of glyphs to text has no %s for %q", entry, r)
+		}
+	}
+}
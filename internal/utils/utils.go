@@ -2,13 +2,18 @@ package utils
 
 import (
 	"fmt"
-	"math"
 	"strconv"
 )
 
-// GetReportFilePath returns filepath by given year and month
-func GetReportFilePath(year int, month int) string {
-	filePath := "./report/" + strconv.Itoa(year) + "/" + strconv.Itoa(month) + "/report.csv"
+// GetReportFilePath returns filepath by given year, month and report version
+func GetReportFilePath(year, month, version int) string {
+	filePath := GetReportVersionDir(year, month, version) + "report.csv"
+	return filePath
+}
+
+// GetReportDiffFilePath returns filepath of diff against the previous version by given year, month and report version
+func GetReportDiffFilePath(year, month, version int) string {
+	filePath := GetReportVersionDir(year, month, version) + "diff.csv"
 	return filePath
 }
 
@@ -18,6 +23,12 @@ func GetReportFileDir(year int, month int) string {
 	return filePath
 }
 
+// GetReportVersionDir returns dir path of report version by given year, month and version
+func GetReportVersionDir(year, month, version int) string {
+	filePath := GetReportFileDir(year, month) + strconv.Itoa(version) + "/"
+	return filePath
+}
+
 // FirstDayInMonth returns date string with first day in given month
 func FirstDayInMonth(year, month int) string {
 	return strconv.Itoa(year) + "-" + fmt.Sprintf("%02d", month) + "-01"
@@ -31,13 +42,3 @@ func LastDayInMonth(year, month int) string {
 		return strconv.Itoa(year) + "-" + fmt.Sprintf("%02d", month+1) + "-01"
 	}
 }
-
-// MoneyToInt converts money amount from float to number of cents
-func MoneyToInt(amount float32) int64 {
-	return int64(math.Ceil(float64(amount * 100)))
-}
-
-// MoneyToFloat converts money amount from float to number of cents
-func MoneyToFloat(amount int64) float32 {
-	return float32(amount) * 0.01
-}
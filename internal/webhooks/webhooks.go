@@ -0,0 +1,104 @@
+package webhooks
+
+import (
+	"balance/internal/models"
+	"balance/internal/utils"
+
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of requests sent to webhooks
+const (
+	EventHeader     = "X-Balance-Event"
+	DeliveryHeader  = "X-Balance-Delivery" // id of delivery, the same for every retry
+	TimestampHeader = "X-Balance-Timestamp"
+	SignatureHeader = "X-Balance-Signature" // sha256=<hex HMAC-SHA256 of "timestamp.body" with secret of webhook>
+)
+
+// Timeout is timeout of one delivery attempt
+const Timeout = 10 * time.Second
+
+// NewSecret generates random secret of webhook
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// Sign returns signature of body sent at given unix timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// EventToPayload converts event amount from minor units of currency
+func EventToPayload(event models.WebhookEvent) models.PayloadWebhookEvent {
+	return models.PayloadWebhookEvent{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data: models.PayloadWebhookEventData{
+			UserID:    event.UserID,
+			ServiceID: event.ServiceID,
+			OrderID:   event.OrderID,
+			Amount:    utils.MoneyToFloat(event.Amount, event.Currency),
+			Currency:  event.Currency,
+		},
+	}
+}
+
+// Deliver sends signed event of delivery to its webhook, response with status other than 2xx is a failed attempt
+func Deliver(client *http.Client, delivery models.WebhookDelivery) models.WebhookAttempt {
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	attempt := models.WebhookAttempt{
+		DeliveryID:  delivery.ID,
+		AttemptedAt: time.Now().In(loc),
+	}
+
+	body, err := json.Marshal(EventToPayload(delivery.Event))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	request, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := attempt.AttemptedAt.Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event.Type)
+	request.Header.Set(DeliveryHeader, strconv.FormatUint(delivery.ID, 10))
+	request.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, body))
+
+	response, err := client.Do(request)
+	attempt.Duration = time.Since(attempt.AttemptedAt)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	attempt.StatusCode = &response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected response status %d", response.StatusCode)
+	}
+	return attempt
+}
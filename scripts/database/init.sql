@@ -9,38 +9,162 @@ ALTER TABLESPACE pg_default
 -- Users
 CREATE TABLE IF NOT EXISTS users(
     id BIGSERIAL NOT NULL,
-    balance bigint NOT NULL,
     CONSTRAINT users_pkey PRIMARY KEY (id)
 ) TABLESPACE pg_default;
 
+-- API keys of clients, only SHA-256 of key is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL NOT NULL,
+    name varchar(64) NOT NULL,
+    prefix varchar(16) NOT NULL, -- beginning of key to recognize it
+    key_hash char(64) NOT NULL,
+    role varchar(16) NOT NULL, -- read-only, billing-client, finance or admin
+    services bigint[] NOT NULL DEFAULT '{}', -- services the key operates on, empty for all services
+    created_at timestamp NOT NULL,
+    expires_at timestamp, -- set when key is rotated, the old key works until then
+    revoked_at timestamp,
+    rotated_to bigint, -- key which replaced this one
+    CONSTRAINT api_keys_pkey PRIMARY KEY (id),
+    CONSTRAINT api_keys_unique_hash UNIQUE (key_hash),
+    CONSTRAINT api_keys_role_check CHECK (role IN ('read-only', 'billing-client', 'finance', 'admin'))
+) TABLESPACE pg_default;
+
+-- Signing secrets of API keys, requests of key with active secret moving money must be signed
+CREATE TABLE IF NOT EXISTS signing_secrets (
+    id BIGSERIAL NOT NULL,
+    api_key_id bigint NOT NULL,
+    secret varchar(128) NOT NULL, -- key of HMAC-SHA256 signature, kept as is to verify signatures
+    created_at timestamp NOT NULL,
+    expires_at timestamp, -- set when secret is rotated, the old secret works until then
+    revoked_at timestamp,
+    CONSTRAINT signing_secrets_pkey PRIMARY KEY (id),
+    CONSTRAINT fk_signing_secrets_api_key FOREIGN KEY (api_key_id)
+        REFERENCES api_keys (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+) TABLESPACE pg_default;
+
+CREATE INDEX signing_secrets_api_key ON signing_secrets (api_key_id);
+
+-- Nonces of signed requests, used nonce is rejected to prevent replay of request
+CREATE TABLE IF NOT EXISTS signature_nonces (
+    api_key_id bigint NOT NULL,
+    nonce varchar(64) NOT NULL,
+    created_at timestamp NOT NULL, -- nonces older than clock skew tolerance are deleted, their requests are rejected by timestamp
+    CONSTRAINT signature_nonces_pkey PRIMARY KEY (api_key_id, nonce)
+) TABLESPACE pg_default;
+
+CREATE INDEX signature_nonces_created ON signature_nonces (created_at);
+
+-- Wallets, balance of user in every currency stored in minor units
+CREATE TABLE IF NOT EXISTS wallets(
+    user_id bigint NOT NULL,
+    currency char(3) NOT NULL,
+    balance bigint NOT NULL,
+    CONSTRAINT wallets_pkey PRIMARY KEY (user_id, currency),
+    CONSTRAINT fk_wallets_user FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+) TABLESPACE pg_default;
+
 -- Services
 CREATE TABLE IF NOT EXISTS services(
     id BIGSERIAL NOT NULL,
     name varchar(255) NOT NULL UNIQUE,
+    currency char(3) NOT NULL DEFAULT 'RUB',
+    active bool NOT NULL DEFAULT true,
+    price_version int NOT NULL DEFAULT 1, -- current version of service price
     CONSTRAINT services_pkey PRIMARY KEY (id),
     CONSTRAINT services_unique_const_for_ops UNIQUE(id, name)
 ) TABLESPACE pg_default;
 
--- Reserves
+-- Versions of service prices, reserves keep the version they were made with
+CREATE TABLE IF NOT EXISTS service_prices(
+    service_id bigint NOT NULL,
+    version int NOT NULL,
+    price bigint CHECK (price >= 0), -- catalog price in minor units, used when amount is omitted
+    min_amount bigint CHECK (min_amount >= 0),
+    max_amount bigint CHECK (max_amount >= 0),
+    valid_from timestamp NOT NULL,
+    CONSTRAINT service_prices_pkey PRIMARY KEY (service_id, version),
+    CONSTRAINT service_prices_bounds CHECK (min_amount IS NULL OR max_amount IS NULL OR min_amount <= max_amount),
+    CONSTRAINT fk_service_prices_service FOREIGN KEY (service_id)
+        REFERENCES services (id)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+) TABLESPACE pg_default;
+
+-- Reserves, reserve of order with multiple line items has no service, its items are stored in order_items
 CREATE TABLE IF NOT EXISTS reserves (
     order_id bigint NOT NULL,
     user_id bigint NOT NULL,
-    service_id bigint NOT NULL,
+    service_id bigint,
     amount bigint NOT NULL,
-    purchased bool NOT NULL,
+    currency char(3) NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'open', -- released and expired reserves are kept for history
     reserved_at timestamp,
     purchased_at timestamp,
+    released_at timestamp, -- time when reserve was released or expired
+    price_version int,
+    expires_at timestamp NOT NULL, -- not purchased reserve is released after this time
+    api_key_id bigint DEFAULT nullif(current_setting('balance.api_key_id', true), '')::bigint, -- acting key, set by transaction of request
     CONSTRAINT reserves_pkey PRIMARY KEY (order_id),
+    CONSTRAINT reserves_status_check CHECK (status IN ('open', 'purchased', 'released', 'expired')),
     CONSTRAINT fk_reserves_service FOREIGN KEY (service_id)
         REFERENCES services (id)
         ON UPDATE NO ACTION
         ON DELETE NO ACTION,
+    CONSTRAINT fk_reserves_service_price FOREIGN KEY (service_id, price_version)
+        REFERENCES service_prices (service_id, version)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION,
     CONSTRAINT fk_reserves_user FOREIGN KEY (user_id)
         REFERENCES users (id)
         ON UPDATE NO ACTION
         ON DELETE NO ACTION
 ) TABLESPACE pg_default;
 
+CREATE INDEX IF NOT EXISTS reserves_user ON reserves (user_id, reserved_at);
+CREATE INDEX IF NOT EXISTS reserves_open ON reserves (expires_at) WHERE status = 'open';
+
+-- History of reserve amendments
+CREATE TABLE IF NOT EXISTS reserve_amendments (
+    id BIGSERIAL NOT NULL,
+    order_id bigint NOT NULL,
+    previous_amount bigint NOT NULL,
+    amount bigint NOT NULL,
+    previous_expires_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    amended_at timestamp NOT NULL,
+    CONSTRAINT reserve_amendments_pkey PRIMARY KEY (id),
+    CONSTRAINT fk_reserve_amendments_reserve FOREIGN KEY (order_id)
+        REFERENCES reserves (order_id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+) TABLESPACE pg_default;
+
+-- Line items of orders, the whole order is reserved at once, items could be captured partially
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id bigint NOT NULL,
+    line_no int NOT NULL,
+    service_id bigint NOT NULL,
+    quantity bigint NOT NULL CHECK (quantity > 0),
+    unit_price bigint NOT NULL CHECK (unit_price >= 0),
+    amount bigint NOT NULL, -- quantity * unit_price
+    price_version int NOT NULL,
+    captured bool NOT NULL DEFAULT false,
+    CONSTRAINT order_items_pkey PRIMARY KEY (order_id, line_no),
+    CONSTRAINT fk_order_items_reserve FOREIGN KEY (order_id)
+        REFERENCES reserves (order_id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT fk_order_items_service_price FOREIGN KEY (service_id, price_version)
+        REFERENCES service_prices (service_id, version)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+) TABLESPACE pg_default;
+
 -- operations
 CREATE TABLE IF NOT EXISTS operations (
     id BIGSERIAL NOT NULL,
@@ -48,7 +172,14 @@ CREATE TABLE IF NOT EXISTS operations (
     service_id bigint,
     service_name varchar(255),
     amount bigint NOT NULL,
+    currency char(3) NOT NULL,
     done_at timestamp,
+    kind varchar(32) NOT NULL, -- top_up, purchase, correction or conversion
+    rate numeric(20, 10), -- applied exchange rate of conversion
+    spread numeric(10, 6), -- applied spread of conversion
+    order_id bigint, -- order of purchase
+    line_no int, -- line item of order the revenue is attributed to
+    api_key_id bigint DEFAULT nullif(current_setting('balance.api_key_id', true), '')::bigint, -- acting key, set by transaction of request
     CONSTRAINT operations_pkey PRIMARY KEY (id),
     CONSTRAINT fk_operations_service FOREIGN KEY (service_id, service_name)
         REFERENCES services (id, name)
@@ -61,4 +192,219 @@ CREATE TABLE IF NOT EXISTS operations (
 ) TABLESPACE pg_default;
 
 -- Indexes
-CREATE INDEX reports ON operations (service_name, amount) where service_id is not null;
\ No newline at end of file
+CREATE INDEX reports ON operations (service_name, amount) where service_id is not null;
+
+-- Closed accounting periods
+CREATE TABLE IF NOT EXISTS closed_periods (
+    year int NOT NULL,
+    month int NOT NULL,
+    closed_at timestamp NOT NULL,
+    CONSTRAINT closed_periods_pkey PRIMARY KEY (year, month)
+) TABLESPACE pg_default;
+
+-- Report versions
+CREATE TABLE IF NOT EXISTS reports (
+    id BIGSERIAL NOT NULL,
+    year int NOT NULL,
+    month int NOT NULL,
+    version int NOT NULL,
+    closing bool NOT NULL,
+    sha256 char(64) NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT reports_pkey PRIMARY KEY (id),
+    CONSTRAINT reports_unique_version UNIQUE (year, month, version)
+) TABLESPACE pg_default;
+
+-- Report lines, used to build diffs between report versions
+CREATE TABLE IF NOT EXISTS report_lines (
+    report_id bigint NOT NULL,
+    service_name varchar(255) NOT NULL,
+    currency char(3) NOT NULL,
+    amount bigint NOT NULL,
+    CONSTRAINT report_lines_pkey PRIMARY KEY (report_id, service_name, currency),
+    CONSTRAINT fk_report_lines_report FOREIGN KEY (report_id)
+        REFERENCES reports (id)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+) TABLESPACE pg_default;
+
+-- Ledger accounts: funding (system), wallet and hold (per user), revenue (per service)
+CREATE TABLE IF NOT EXISTS accounts (
+    id BIGSERIAL NOT NULL,
+    kind varchar(16) NOT NULL,
+    owner_id bigint NOT NULL, -- user id for wallet and hold, service id for revenue, 0 for funding
+    currency char(3) NOT NULL,
+    CONSTRAINT accounts_pkey PRIMARY KEY (id),
+    CONSTRAINT accounts_unique_owner UNIQUE (kind, owner_id, currency)
+) TABLESPACE pg_default;
+
+-- Journal entries, every entry has balanced postings
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id BIGSERIAL NOT NULL,
+    kind varchar(32) NOT NULL,
+    user_id bigint NOT NULL,
+    service_id bigint,
+    order_id bigint,
+    created_at timestamp NOT NULL,
+    api_key_id bigint DEFAULT nullif(current_setting('balance.api_key_id', true), '')::bigint, -- acting key, set by transaction of request
+    CONSTRAINT journal_entries_pkey PRIMARY KEY (id)
+) TABLESPACE pg_default;
+
+-- Postings, sum of postings of every entry is zero in every currency
+CREATE TABLE IF NOT EXISTS postings (
+    id BIGSERIAL NOT NULL,
+    entry_id bigint NOT NULL,
+    account_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    CONSTRAINT postings_pkey PRIMARY KEY (id),
+    CONSTRAINT fk_postings_entry FOREIGN KEY (entry_id)
+        REFERENCES journal_entries (id)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION,
+    CONSTRAINT fk_postings_account FOREIGN KEY (account_id)
+        REFERENCES accounts (id)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+) TABLESPACE pg_default;
+
+CREATE INDEX postings_account ON postings (account_id);
+
+-- Exchange rates, one unit of base currency costs rate units of quote currency
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id BIGSERIAL NOT NULL,
+    base char(3) NOT NULL,
+    quote char(3) NOT NULL,
+    rate numeric(20, 10) NOT NULL CHECK (rate > 0),
+    spread numeric(10, 6) NOT NULL DEFAULT 0 CHECK (spread >= 0 AND spread < 1),
+    valid_from timestamp NOT NULL,
+    valid_to timestamp, -- rate without end is valid until superseded
+    created_at timestamp NOT NULL,
+    CONSTRAINT exchange_rates_pkey PRIMARY KEY (id),
+    CONSTRAINT exchange_rates_validity CHECK (valid_to IS NULL OR valid_to > valid_from)
+) TABLESPACE pg_default;
+
+CREATE INDEX exchange_rates_lookup ON exchange_rates (base, quote, valid_from);
+
+-- End of day balances of users, partitions by month are created by snapshot job
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+    day date NOT NULL,
+    user_id bigint NOT NULL,
+    currency char(3) NOT NULL,
+    available bigint NOT NULL,
+    held bigint NOT NULL,
+    total bigint NOT NULL, -- available + held, money owed to user
+    created_at timestamp NOT NULL,
+    CONSTRAINT balance_snapshots_pkey PRIMARY KEY (day, user_id, currency)
+) PARTITION BY RANGE (day);
+
+-- Webhook subscriptions, subscription is disabled after repeated failed deliveries
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id BIGSERIAL NOT NULL,
+    url text NOT NULL,
+    secret varchar(64) NOT NULL, -- key of HMAC-SHA256 signature of deliveries
+    event_types varchar(32)[] NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    failures integer NOT NULL DEFAULT 0, -- failed deliveries in a row
+    created_at timestamp NOT NULL,
+    disabled_at timestamp,
+    CONSTRAINT webhook_subscriptions_pkey PRIMARY KEY (id)
+) TABLESPACE pg_default;
+
+-- Webhook events, written in the same transaction as the change, so only committed changes are delivered
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id BIGSERIAL NOT NULL,
+    type varchar(32) NOT NULL,
+    user_id bigint NOT NULL,
+    service_id bigint,
+    order_id bigint,
+    amount bigint NOT NULL,
+    currency char(3) NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT webhook_events_pkey PRIMARY KEY (id)
+) TABLESPACE pg_default;
+
+-- Deliveries of events to subscriptions
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL NOT NULL,
+    subscription_id bigint NOT NULL,
+    event_id bigint NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp NOT NULL,
+    delivered_at timestamp,
+    CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (id),
+    CONSTRAINT webhook_deliveries_unique UNIQUE (subscription_id, event_id),
+    CONSTRAINT fk_webhook_deliveries_subscription FOREIGN KEY (subscription_id)
+        REFERENCES webhook_subscriptions (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT fk_webhook_deliveries_event FOREIGN KEY (event_id)
+        REFERENCES webhook_events (id)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+) TABLESPACE pg_default;
+
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- Attempts of webhook deliveries
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+    id BIGSERIAL NOT NULL,
+    delivery_id bigint NOT NULL,
+    attempted_at timestamp NOT NULL,
+    status_code integer, -- nullable if response was not received
+    error text,
+    duration_ms integer NOT NULL,
+    CONSTRAINT webhook_attempts_pkey PRIMARY KEY (id),
+    CONSTRAINT fk_webhook_attempts_delivery FOREIGN KEY (delivery_id)
+        REFERENCES webhook_deliveries (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+) TABLESPACE pg_default;
+
+-- Outbox of events for message broker, written in the same transaction as every money movement
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL NOT NULL,
+    user_id bigint NOT NULL,
+    type varchar(64) NOT NULL,
+    version integer NOT NULL, -- version of event schema
+    payload jsonb NOT NULL,
+    created_at timestamp NOT NULL,
+    sent_at timestamp, -- nullable until the event is published
+    claimed_until timestamp, -- set while relay publishes the event, expired claim is taken by the next relay
+    CONSTRAINT outbox_pkey PRIMARY KEY (id)
+) TABLESPACE pg_default;
+
+CREATE INDEX outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
+
+CREATE INDEX outbox_user ON outbox (user_id, id);
+
+-- Imports of balances from CSV files, the same file is detected by its checksum
+CREATE TABLE IF NOT EXISTS imports (
+    id BIGSERIAL NOT NULL,
+    file_name varchar(255) NOT NULL,
+    sha256 char(64) NOT NULL,
+    currency char(3) NOT NULL,
+    status varchar(16) NOT NULL, -- pending until every row is applied or failed, then completed
+    created_at timestamp NOT NULL,
+    completed_at timestamp,
+    CONSTRAINT imports_pkey PRIMARY KEY (id),
+    CONSTRAINT imports_unique_file UNIQUE (sha256)
+) TABLESPACE pg_default;
+
+-- Rows of imports, staging table loaded by COPY, credits are applied from it in chunks
+CREATE TABLE IF NOT EXISTS import_rows (
+    import_id bigint NOT NULL,
+    line integer NOT NULL, -- line of row in file
+    user_id bigint NOT NULL, -- zero for invalid row
+    amount bigint NOT NULL, -- amount of money in minor units, zero for invalid row
+    external_ref varchar(128) NOT NULL DEFAULT '',
+    status varchar(16) NOT NULL, -- pending, applied, invalid or failed
+    error text NOT NULL DEFAULT '',
+    CONSTRAINT import_rows_pkey PRIMARY KEY (import_id, line),
+    CONSTRAINT fk_import_rows_import FOREIGN KEY (import_id)
+        REFERENCES imports (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+) TABLESPACE pg_default;
+
+CREATE INDEX import_rows_pending ON import_rows (import_id, line) WHERE status = 'pending';